@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchOnlyFlags are the flags that set up a batch rather than each
+// conversion in it.
+var batchOnlyFlags = []string{"batch", "feed", "since", "limit", "crawl", "same-host", "sitemap", "max-pages", "jobs", "delay"}
+
+// batchSources are the flags a batch takes its URLs from, with what they
+// name.
+var batchSources = map[string]string{"batch": "list", "feed": "feed", "crawl": "crawl", "sitemap": "sitemap"}
+
+// readURLList reads one URL per line, skipping blank lines and # comments.
+func readURLList(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// checkBatchFlags rejects the flags that name a single page, which the
+// URLs of a batch, from the --<source> flag, replace.
+func checkBatchFlags(fs *flag.FlagSet, source string, jobs int) error {
+	if fs.NArg() > 0 || fs.Lookup("url").Value.String() != "" {
+		return fmt.Errorf("--%s takes its URLs from the %s, not from --url or arguments", source, batchSources[source])
+	}
+	for _, name := range []string{"input", "filename"} {
+		if fs.Lookup(name).Value.String() != "" {
+			return fmt.Errorf("--%s cannot be used with --%s", source, name)
+		}
+	}
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	return nil
+}
+
+// loadURLList reads the URL list at path, or stdin for "-".
+func loadURLList(path string, stdin io.Reader) ([]string, error) {
+	var urls []string
+	var err error
+	if path == "-" {
+		if stdin == nil {
+			return nil, fmt.Errorf("stdin is required but not available")
+		}
+		urls, err = readURLList(stdin)
+	} else {
+		f, openErr := os.Open(path)
+		if openErr != nil {
+			return nil, fmt.Errorf("failed to open URL list: %w", openErr)
+		}
+		urls, err = readURLList(f)
+		f.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read URL list: %w", err)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs in %s", path)
+	}
+	return urls, nil
+}
+
+// runBatch converts urls with jobs workers, each run with the flags set on
+// fs as if given one URL, starting one at most every delay. It logs
+// progress and failures as they happen, prints the saved paths and a
+// summary, and fails when any URL did.
+func runBatch(fs *flag.FlagSet, urls []string, jobs int, delay time.Duration, stdout io.Writer) error {
+	var common []string
+	fs.Visit(func(f *flag.Flag) {
+		if hasFormat(batchOnlyFlags, f.Name) {
+			return
+		}
+		if list, ok := f.Value.(*stringList); ok {
+			for _, v := range *list {
+				common = append(common, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		common = append(common, "--"+f.Name+"="+f.Value.String())
+	})
+
+	log.Printf("📦 Converting %d URLs with %d workers...", len(urls), jobs)
+	var (
+		mu     sync.Mutex
+		done   int
+		failed []string
+		wg     sync.WaitGroup
+	)
+	queue := make(chan string)
+	for range min(jobs, len(urls)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range queue {
+				var out bytes.Buffer
+				// stdin is the URL list or a terminal, never the page.
+				err := run(append(append([]string{}, common...), target), nil, &out)
+
+				mu.Lock()
+				done++
+				if err != nil {
+					failed = append(failed, target)
+					log.Printf("[%d/%d] ❌ %s: %v", done, len(urls), target, err)
+				} else {
+					log.Printf("[%d/%d] ✅ %s", done, len(urls), target)
+					stdout.Write(out.Bytes())
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i, target := range urls {
+		if i > 0 {
+			time.Sleep(delay)
+		}
+		queue <- target
+	}
+	close(queue)
+	wg.Wait()
+
+	fmt.Fprintf(stdout, "📦 Converted %d of %d URLs\n", len(urls)-len(failed), len(urls))
+	if len(failed) > 0 {
+		fmt.Fprintf(stdout, "❌ Failed:\n")
+		for _, target := range failed {
+			fmt.Fprintf(stdout, "  %s\n", target)
+		}
+		return &batchError{failed: failed, total: len(urls)}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunBatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><article><p>Content of %s.</p></article></body></html>", r.URL.Path[1:], r.URL.Path)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	list := "# reading list\n" + ts.URL + "/one\n\n" + ts.URL + "/missing\n" + ts.URL + "/two\n" + ts.URL + "/three\n"
+	stdout := &bytes.Buffer{}
+	err := run([]string{"--output", dir, "--batch", "-", "--jobs", "2", "--index", "--tags", "export"}, strings.NewReader(list), stdout)
+	if err == nil || !strings.Contains(err.Error(), "1 of 4 URLs failed") {
+		t.Fatalf("expected one failed URL, got %v", err)
+	}
+
+	out := stdout.String()
+	if strings.Count(out, "✅ Saved to:") != 3 || !strings.Contains(out, "📦 Converted 3 of 4 URLs") || !strings.Contains(out, "  "+ts.URL+"/missing\n") {
+		t.Errorf("unexpected output %q", out)
+	}
+	for _, name := range []string{"Page_one", "Page_two", "Page_three"} {
+		if matches, _ := filepath.Glob(filepath.Join(dir, name+"_*.md")); len(matches) != 1 {
+			t.Errorf("expected a snapshot for %s", name)
+		}
+	}
+
+	// Every conversion recorded itself in the shared index.
+	catalog, err := loadCatalog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Snapshots) != 3 || strings.Join(catalog.Snapshots[0].Tags, ",") != "export" {
+		t.Errorf("expected 3 tagged index entries, got %+v", catalog.Snapshots)
+	}
+}
+
+func TestRunBatchErrors(t *testing.T) {
+	dir := t.TempDir()
+	listFile := filepath.Join(dir, "links.txt")
+	os.WriteFile(listFile, []byte("# nothing yet\n"), 0644)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--output", dir, "--batch", listFile}, "no URLs"},
+		{[]string{"--output", dir, "--batch", listFile, "https://example.com"}, "not from --url"},
+		{[]string{"--output", dir, "--batch", listFile, "--input", "page.html"}, "--input"},
+		{[]string{"--output", dir, "--batch", listFile, "--jobs", "0"}, "--jobs"},
+		{[]string{"--output", dir, "--batch", filepath.Join(dir, "missing.txt")}, "failed to open"},
+	}
+	for _, tt := range tests {
+		if err := run(tt.args, nil, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("run(%q) = %v; want an error about %s", tt.args, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// canonicalURL returns the URL the page declares as its own, from
+// <link rel="canonical"> or else og:url, resolved against pageURL. It
+// returns "" when the page declares none, or one that is not an http(s) URL
+// or that sends an article to the site's front page (a common CMS
+// misconfiguration).
+func canonicalURL(body []byte, pageURL *url.URL) string {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	for _, href := range []string{
+		doc.Find("link[rel~='canonical']").First().AttrOr("href", ""),
+		doc.Find("meta[property='og:url']").First().AttrOr("content", ""),
+	} {
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if href == "" || err != nil {
+			continue
+		}
+		u := pageURL.ResolveReference(ref)
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		if strings.Trim(u.Path, "/") == "" && strings.Trim(pageURL.Path, "/") != "" {
+			continue
+		}
+		u.Fragment = ""
+		return u.String()
+	}
+	return ""
+}
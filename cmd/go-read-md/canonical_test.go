@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	pageURL, _ := url.Parse("https://m.example.com/2024/story?utm_source=x")
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"link", `<link rel="canonical" href="https://example.com/2024/story">`, "https://example.com/2024/story"},
+		{"relative link", `<link rel="canonical" href="/2024/story#top">`, "https://m.example.com/2024/story"},
+		{"og:url fallback", `<meta property="og:url" content="https://example.com/2024/story">`, "https://example.com/2024/story"},
+		{"link wins over og:url", `<meta property="og:url" content="https://a.example/x"><link rel="canonical" href="https://b.example/x">`, "https://b.example/x"},
+		{"front page is ignored", `<link rel="canonical" href="https://example.com/">`, ""},
+		{"not http", `<link rel="canonical" href="javascript:void(0)">`, ""},
+		{"none", `<title>Story</title>`, ""},
+	}
+	for _, tt := range tests {
+		if got := canonicalURL([]byte("<html><head>"+tt.head+"</head><body></body></html>"), pageURL); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
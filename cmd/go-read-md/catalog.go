@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	catalogJSON = "index.json"
+	catalogHTML = "index.html"
+)
+
+// CatalogEntry describes one saved page in the snapshot folder index.
+type CatalogEntry struct {
+	Title string            `json:"title"`
+	URL   string            `json:"url"`
+	Saved time.Time         `json:"saved"`
+	Tags  []string          `json:"tags,omitempty"`
+	Files map[string]string `json:"files"` // format -> path relative to the folder
+	// ContentHash fingerprints the article text, for --dedup without a
+	// history.
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// Catalog is the content of index.json.
+type Catalog struct {
+	Snapshots []CatalogEntry `json:"snapshots"`
+}
+
+// loadCatalog reads index.json from dir; a missing file is an empty catalog.
+func loadCatalog(dir string) (*Catalog, error) {
+	data, err := os.ReadFile(filepath.Join(dir, catalogJSON))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Catalog{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", catalogJSON, err)
+	}
+	return &c, nil
+}
+
+// upsert adds entry, replacing an earlier snapshot of the same URL.
+func (c *Catalog) upsert(entry CatalogEntry) {
+	for i, e := range c.Snapshots {
+		if e.URL == entry.URL {
+			c.Snapshots[i] = entry
+			c.sort()
+			return
+		}
+	}
+	c.Snapshots = append(c.Snapshots, entry)
+	c.sort()
+}
+
+// previous returns the first file, in format order, of the most recent
+// snapshot in dir of one of urls or of content with the given hash whose
+// file is still on disk, or "".
+func (c *Catalog) previous(dir, hash string, urls ...string) string {
+	for _, e := range c.Snapshots {
+		if !slices.Contains(urls, e.URL) && (hash == "" || e.ContentHash != hash) {
+			continue
+		}
+		for _, format := range supportedFormats {
+			if file, ok := e.Files[format]; ok {
+				path := filepath.Join(dir, filepath.FromSlash(file))
+				if _, err := os.Stat(path); err == nil {
+					return path
+				}
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// sort orders snapshots newest first.
+func (c *Catalog) sort() {
+	sort.SliceStable(c.Snapshots, func(i, j int) bool {
+		return c.Snapshots[i].Saved.After(c.Snapshots[j].Saved)
+	})
+}
+
+// save writes index.json and regenerates index.html in dir.
+func (c *Catalog) save(dir string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, catalogJSON), data); err != nil {
+		return err
+	}
+
+	var html strings.Builder
+	if err := catalogTemplate.Execute(&html, c); err != nil {
+		return fmt.Errorf("failed to render %s: %w", catalogHTML, err)
+	}
+	return writeFileAtomic(filepath.Join(dir, catalogHTML), []byte(html.String()))
+}
+
+// catalogMu serializes index updates of the pages a --batch converts at
+// once.
+var catalogMu sync.Mutex
+
+// updateCatalog records entry in the index of dir.
+func updateCatalog(dir string, entry CatalogEntry) error {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	c, err := loadCatalog(dir)
+	if err != nil {
+		return err
+	}
+	c.upsert(entry)
+	return c.save(dir)
+}
+
+// writeFileAtomic replaces path in one step, so a browser or sync client
+// never sees a half-written index.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var catalogTemplate = template.Must(template.New(catalogHTML).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Snapshots</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; }
+table { border-collapse: collapse; width: 100%; }
+td, th { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; vertical-align: top; }
+.tag { background: #eee; border-radius: 3px; padding: 0 .3em; margin-right: .2em; font-size: .9em; }
+.url { color: #666; font-size: .85em; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>Snapshots ({{len .Snapshots}})</h1>
+<table>
+<tr><th>Saved</th><th>Title</th><th>Tags</th><th>Formats</th></tr>
+{{- range .Snapshots}}
+<tr>
+<td>{{.Saved.Format "2006-01-02"}}</td>
+<td>{{.Title}}<br><a class="url" href="{{.URL}}">{{.URL}}</a></td>
+<td>{{range .Tags}}<span class="tag">{{.}}</span>{{end}}</td>
+<td>{{range $format, $file := .Files}}<a href="{{$file}}">{{$format}}</a> {{end}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateCatalog(t *testing.T) {
+	dir := t.TempDir()
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 12, 0, 0, 0, time.UTC) }
+
+	entries := []CatalogEntry{
+		{Title: "First", URL: "https://a.com", Saved: day(1), Files: map[string]string{"md": "first.md"}},
+		{Title: "Second <b>", URL: "https://b.com", Saved: day(2), Tags: []string{"golang"}, Files: map[string]string{"md": "second.md", "warc": "second.warc"}},
+		{Title: "First again", URL: "https://a.com", Saved: day(3), Files: map[string]string{"md": "first.md"}},
+	}
+	for _, e := range entries {
+		if err := updateCatalog(dir, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := loadCatalog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Snapshots) != 2 {
+		t.Fatalf("expected re-saved URL to replace its entry, got %d entries", len(c.Snapshots))
+	}
+	if c.Snapshots[0].Title != "First again" || c.Snapshots[1].Title != "Second <b>" {
+		t.Errorf("expected newest first, got %+v", c.Snapshots)
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, catalogHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Snapshots (2)", `href="second.warc"`, "Second &lt;b&gt;", `<span class="tag">golang</span>`} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("expected %q in index.html", want)
+		}
+	}
+}
+
+func TestLoadCatalog_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, catalogJSON), []byte("{not json"), 0644)
+
+	if _, err := loadCatalog(dir); err == nil {
+		t.Error("expected error for corrupt index.json")
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	got := parseTags(" golang, recipe,,golang ")
+	if strings.Join(got, "|") != "golang|recipe" {
+		t.Errorf("parseTags = %v", got)
+	}
+	if parseTags("") != nil {
+		t.Error("expected no tags for empty input")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// loadCookieJar reads a Netscape cookies.txt file, the format written by
+// browser "export cookies" extensions and yt-dlp --cookies-from-browser, into
+// a cookie jar. Expired cookies are dropped.
+func loadCookieJar(path string) (http.CookieJar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cookies file: %w", err)
+	}
+	defer f.Close()
+
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s:%d: expected 7 tab-separated fields, got %d", path, n, len(fields))
+		}
+		domain, subdomains, cookiePath, secure, expiry, name, value := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+		c := &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     cookiePath,
+			Secure:   strings.EqualFold(secure, "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if secs, err := strconv.ParseInt(expiry, 10, 64); err == nil && secs > 0 {
+			c.Expires = time.Unix(secs, 0)
+			if c.Expires.Before(now) {
+				continue
+			}
+		}
+		// A host-only cookie must not get a Domain attribute, or the jar
+		// would also send it to subdomains.
+		host := strings.TrimPrefix(domain, ".")
+		if strings.EqualFold(subdomains, "TRUE") {
+			c.Domain = host
+		}
+
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: "/"}, []*http.Cookie{c})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cookies file: %w", err)
+	}
+	return jar, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCookieJar(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(file, []byte(strings.Join([]string{
+		"# Netscape HTTP Cookie File",
+		"",
+		".example.com\tTRUE\t/\tTRUE\t0\tsession\tabc",
+		"#HttpOnly_news.example.com\tFALSE\t/\tFALSE\t4102444800\tlogin\tyes",
+		"old.example.com\tFALSE\t/\tFALSE\t1\texpired\tgone",
+	}, "\n")), 0600)
+
+	jar, err := loadCookieJar(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(rawURL string) string {
+		u, _ := url.Parse(rawURL)
+		var out []string
+		for _, c := range jar.Cookies(u) {
+			out = append(out, c.Name)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := names("https://www.example.com/a"); got != "session" {
+		t.Errorf("expected domain cookie on subdomain, got %q", got)
+	}
+	if got := names("http://www.example.com/a"); got != "" {
+		t.Errorf("expected secure cookie to stay off http, got %q", got)
+	}
+	if got := names("http://news.example.com/"); got != "login" {
+		t.Errorf("expected host-only cookie, got %q", got)
+	}
+	if got := names("http://sub.news.example.com/"); got != "" {
+		t.Errorf("expected host-only cookie not to reach subdomains, got %q", got)
+	}
+	if got := names("http://old.example.com/"); got != "" {
+		t.Errorf("expected expired cookie to be dropped, got %q", got)
+	}
+
+	os.WriteFile(file, []byte("example.com\tTRUE\t/\n"), 0600)
+	if _, err := loadCookieJar(file); err == nil || !strings.Contains(err.Error(), ":1: expected 7") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestRunWithCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("member"); err != nil || c.Value != "1" {
+			fmt.Fprint(w, "<html><body><article><p>Subscribe to keep reading this article.</p></article></body></html>")
+			return
+		}
+		fmt.Fprint(w, "<html><body><article><p>The full members-only article text.</p></article></body></html>")
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	u, _ := url.Parse(ts.URL)
+	file := filepath.Join(dir, "cookies.txt")
+	os.WriteFile(file, []byte(u.Hostname()+"\tFALSE\t/\tFALSE\t0\tmember\t1\n"), 0600)
+
+	if err := run([]string{"--output", dir, "--filename", "page", "--cookies", file, ts.URL}, nil, ioDiscard()); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "page.md"))
+	if !strings.Contains(string(data), "members-only") {
+		t.Errorf("expected the logged-in page, got %q", data)
+	}
+
+	if err := run([]string{"--output", dir, "--cookies", filepath.Join(dir, "missing.txt"), ts.URL}, nil, ioDiscard()); err == nil {
+		t.Error("expected an error for a missing cookies file")
+	}
+}
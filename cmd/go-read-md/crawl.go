@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"browser-pipes/pkg/readmd"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// crawlDelay is the --delay of --crawl and --sitemap when none is given.
+const crawlDelay = time.Second
+
+// crawlSkipExts are the file types a crawl does not fetch to look for links.
+var crawlSkipExts = []string{
+	".7z", ".avi", ".css", ".csv", ".doc", ".docx", ".epub", ".gif", ".gz", ".ico", ".jpeg", ".jpg",
+	".js", ".json", ".mov", ".mp3", ".mp4", ".pdf", ".png", ".rss", ".svg", ".tar", ".tgz", ".txt",
+	".wasm", ".webm", ".webp", ".woff", ".woff2", ".xls", ".xlsx", ".xml", ".zip",
+}
+
+// crawlURLs walks the links of start breadth-first, waiting delay between
+// requests, and returns the HTML pages it found, start first, at most
+// maxPages of them. With sameHost it stays on the host of start and under
+// its folder, so starting at https://example.com/docs/ archives the docs
+// and not the rest of the site.
+func crawlURLs(web *fetcher, start string, sameHost bool, maxPages int, delay time.Duration) ([]string, error) {
+	root, err := url.Parse(start)
+	if err != nil || (root.Scheme != "http" && root.Scheme != "https") || root.Host == "" {
+		return nil, fmt.Errorf("invalid --crawl URL: %s", start)
+	}
+	root.Fragment = ""
+	folder := root.Path[:strings.LastIndex(root.Path, "/")+1]
+	inScope := func(u *url.URL) bool {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return false
+		}
+		if slices.Contains(crawlSkipExts, strings.ToLower(path.Ext(u.Path))) {
+			return false
+		}
+		return !sameHost || (strings.EqualFold(u.Host, root.Host) && strings.HasPrefix(u.Path, folder))
+	}
+
+	queue := []string{root.String()}
+	seen := map[string]bool{root.String(): true}
+	var pages []string
+	for fetched := 0; len(queue) > 0 && len(pages) < maxPages; fetched++ {
+		target := queue[0]
+		queue = queue[1:]
+		if fetched > 0 {
+			time.Sleep(delay)
+		}
+		page, err := web.fetch(target, false)
+		if err != nil {
+			if target == root.String() {
+				return nil, fmt.Errorf("failed to fetch --crawl start page: %w", err)
+			}
+			log.Printf("⚠️ Skipping %s: %v", target, err)
+			continue
+		}
+		if page.contentType != "" && !strings.Contains(page.contentType, "html") {
+			continue
+		}
+		pages = append(pages, target)
+
+		base, _ := url.Parse(target)
+		for _, href := range pageLinks(readmd.DecodeHTML(page.body, page.contentType), base) {
+			link, err := url.Parse(href)
+			if err != nil || !inScope(link) {
+				continue
+			}
+			link.Fragment = ""
+			if !seen[link.String()] {
+				seen[link.String()] = true
+				queue = append(queue, link.String())
+			}
+		}
+	}
+	log.Printf("🕸️ Crawled %d pages from %s", len(pages), root)
+	return pages, nil
+}
+
+// pageLinks returns the absolute targets of the links in a page, honoring
+// its <base href> and skipping rel="nofollow" links.
+func pageLinks(body []byte, pageURL *url.URL) []string {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	base := pageURL
+	var links []string
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			var href, rel string
+			for _, a := range n.Attr {
+				switch a.Key {
+				case "href":
+					href = strings.TrimSpace(a.Val)
+				case "rel":
+					rel = a.Val
+				}
+			}
+			switch {
+			case n.DataAtom == atom.Base && href != "":
+				if u, err := pageURL.Parse(href); err == nil {
+					base = u
+				}
+			case (n.DataAtom == atom.A || n.DataAtom == atom.Area) && href != "" && !slices.Contains(strings.Fields(rel), "nofollow"):
+				if u, err := base.Parse(href); err == nil {
+					links = append(links, u.String())
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	return links
+}
+
+// sitemapURLs returns the pages listed in the sitemap at sitemapURL, in
+// order and at most maxPages of them, following the sitemaps of a sitemap
+// index one level down. Gzipped sitemaps are unpacked.
+func sitemapURLs(web *fetcher, sitemapURL string, maxPages int, delay time.Duration) ([]string, error) {
+	if u, err := url.Parse(sitemapURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid --sitemap URL: %s", sitemapURL)
+	}
+	pages, children, err := fetchSitemap(web, sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if len(pages) >= maxPages {
+			break
+		}
+		time.Sleep(delay)
+		more, _, err := fetchSitemap(web, child)
+		if err != nil {
+			log.Printf("⚠️ Skipping sitemap %s: %v", child, err)
+			continue
+		}
+		pages = append(pages, more...)
+	}
+
+	var urls []string
+	for _, p := range pages {
+		u, err := url.Parse(p)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || slices.Contains(urls, p) {
+			continue
+		}
+		if urls = append(urls, p); len(urls) == maxPages {
+			break
+		}
+	}
+	log.Printf("🗺️ %d pages listed in %s", len(urls), sitemapURL)
+	return urls, nil
+}
+
+// fetchSitemap reads one sitemap: the pages of a <urlset> or the sitemaps
+// of a <sitemapindex>.
+func fetchSitemap(web *fetcher, sitemapURL string) (pages, sitemaps []string, err error) {
+	page, err := web.fetch(sitemapURL, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch sitemap: %w", err)
+	}
+	data := page.body
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read sitemap: %w", err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, nil, fmt.Errorf("failed to read sitemap: %w", err)
+		}
+	}
+
+	var doc struct {
+		XMLName xml.Name
+		URLs    []struct {
+			Loc string `xml:"loc"`
+		} `xml:"url"`
+		Sitemaps []struct {
+			Loc string `xml:"loc"`
+		} `xml:"sitemap"`
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse sitemap: %w", err)
+	}
+	switch doc.XMLName.Local {
+	case "urlset":
+		for _, u := range doc.URLs {
+			if loc := strings.TrimSpace(u.Loc); loc != "" {
+				pages = append(pages, loc)
+			}
+		}
+	case "sitemapindex":
+		for _, s := range doc.Sitemaps {
+			if loc := strings.TrimSpace(s.Loc); loc != "" {
+				sitemaps = append(sitemaps, loc)
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("failed to parse sitemap: <%s> is not a sitemap", doc.XMLName.Local)
+	}
+	return pages, sitemaps, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunCrawl(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		links := map[string]string{
+			"/docs/":      `<a href="intro">Intro</a> <a href="/docs/guide#setup">Guide</a> <a href="/blog/">Blog</a> <a href="private" rel="nofollow">Private</a> <a href="logo.png">Logo</a> <a href="mailto:a@example.com">Mail</a>`,
+			"/docs/intro": `<a href="/docs/">Home</a> <a href="/docs/guide">Guide</a> <a href="https://elsewhere.example/">Elsewhere</a>`,
+			"/docs/guide": `<a href="/docs/api">API</a>`,
+		}[r.URL.Path]
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body><article><p>The %s page. %s</p></article></body></html>", r.URL.Path, r.URL.Path, links)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"--output", dir, "--delay", "0s", "--crawl", ts.URL + "/docs/"}, nil, stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "📦 Converted 4 of 4 URLs") {
+		t.Errorf("expected the four docs pages, got %q", stdout)
+	}
+	for _, path := range []string{"/blog/", "/docs/private", "/docs/logo.png"} {
+		if slices.Contains(fetched, path) {
+			t.Errorf("expected the crawl to leave %s alone", path)
+		}
+	}
+	catalog, err := loadCatalog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Snapshots) != 4 {
+		t.Errorf("expected an index of the four pages, got %d entries", len(catalog.Snapshots))
+	}
+
+	stdout.Reset()
+	if err := run([]string{"--output", t.TempDir(), "--delay", "0s", "--crawl", ts.URL + "/docs/", "--max-pages", "2", "--same-host=false"}, nil, stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "📦 Converted 2 of 2 URLs") {
+		t.Errorf("expected --max-pages to stop the crawl, got %q", stdout)
+	}
+
+	if err := run([]string{"--output", dir, "--crawl", ts.URL, "--sitemap", ts.URL}, nil, stdout); err == nil || !strings.Contains(err.Error(), "--sitemap cannot be combined with --crawl") {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+	if err := run([]string{"--output", dir, "--crawl", ts.URL, ts.URL}, nil, stdout); err == nil || !strings.Contains(err.Error(), "--crawl takes its URLs from the crawl") {
+		t.Errorf("expected a URL conflict error, got %v", err)
+	}
+}
+
+func TestRunSitemap(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>%s/posts.xml.gz</loc></sitemap><sitemap><loc>%s/missing.xml</loc></sitemap></sitemapindex>`, ts.URL, ts.URL)
+		case "/posts.xml.gz":
+			var b bytes.Buffer
+			zw := gzip.NewWriter(&b)
+			fmt.Fprintf(zw, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>%s/a</loc></url><url><loc> %s/b </loc></url><url><loc>%s/a</loc></url><url><loc>%s/c</loc></url></urlset>`, ts.URL, ts.URL, ts.URL, ts.URL)
+			zw.Close()
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(b.Bytes())
+		case "/missing.xml":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprintf(w, "<html><head><title>Post %s</title></head><body><article><p>Content of %s.</p></article></body></html>", r.URL.Path[1:], r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"--output", t.TempDir(), "--delay", "0s", "--sitemap", ts.URL + "/sitemap.xml", "--max-pages", "2"}, nil, stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "📦 Converted 2 of 2 URLs") {
+		t.Errorf("expected two sitemap pages, got %q", stdout)
+	}
+
+	if err := run([]string{"--output", t.TempDir(), "--sitemap", ts.URL + "/a"}, nil, stdout); err == nil || !strings.Contains(err.Error(), "failed to parse sitemap") {
+		t.Errorf("expected a sitemap error for an HTML page, got %v", err)
+	}
+}
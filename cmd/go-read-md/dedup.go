@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"browser-pipes/internal/history"
+
+	readability "codeberg.org/readeck/go-readability/v2"
+)
+
+// Policies for --dedup, applied when the history already holds a snapshot
+// of the same URL or the same content, and for --on-conflict, applied when
+// a file of the same name exists.
+const (
+	dedupSkip      = "skip"      // keep the existing snapshot, write nothing
+	dedupOverwrite = "overwrite" // replace the existing snapshot files
+	dedupVersion   = "version"   // write a new, date-stamped copy
+)
+
+func validDedupPolicy(policy string) bool {
+	switch policy {
+	case "", dedupSkip, dedupOverwrite, dedupVersion:
+		return true
+	}
+	return false
+}
+
+// contentHash fingerprints the extracted article text (see
+// history.ContentHash, which plumber watch uses as well).
+func contentHash(article readability.Article) (string, error) {
+	var text strings.Builder
+	if err := article.RenderText(&text); err != nil {
+		return "", fmt.Errorf("failed to render text: %w", err)
+	}
+	return history.ContentHash(text.String()), nil
+}
+
+// dedupCandidates returns the successful snapshots in the history at path
+// of one of urls or of content with the given hash, oldest first, for
+// previousSnapshot.
+func dedupCandidates(path, hash string, urls ...string) ([]history.Entry, error) {
+	filters := []history.Filter{}
+	for _, u := range urls {
+		filters = append(filters, history.Filter{Kind: history.KindSnapshot, Status: history.StatusSuccess, URL: u})
+	}
+	if hash != "" {
+		filters = append(filters, history.Filter{Kind: history.KindSnapshot, Status: history.StatusSuccess, ContentHash: hash})
+	}
+	var entries []history.Entry
+	for _, f := range filters {
+		found, err := history.Query(path, f)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, found...)
+	}
+	slices.SortStableFunc(entries, func(a, b history.Entry) int { return a.Time.Compare(b.Time) })
+	return entries, nil
+}
+
+// previousSnapshot returns the most recent snapshot of one of urls or of
+// content with the given hash whose files are still on disk, or nil. A
+// snapshot recorded under its canonical URL also matches its original URL.
+func previousSnapshot(entries []history.Entry, hash string, urls ...string) *history.Entry {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Kind != history.KindSnapshot || e.Status != history.StatusSuccess || len(e.Files) == 0 {
+			continue
+		}
+		if !slices.Contains(urls, e.URL) && !slices.Contains(urls, e.OriginalURL) && (hash == "" || e.ContentHash != hash) {
+			continue
+		}
+		if _, err := os.Stat(e.Files[0]); err != nil {
+			continue
+		}
+		return &entries[i]
+	}
+	return nil
+}
+
+// snapshotBase returns the directory and extension-less name of a snapshot
+// file, encrypted or not, so it can be rewritten in every requested format.
+func snapshotBase(path string) (dir, name string) {
+	return filepath.Dir(path), trimFormatExt(strings.TrimSuffix(filepath.Base(path), ageExt))
+}
+
+// existingSnapshot returns the first file, encrypted or not, that saving
+// name in kinds would replace, or "".
+func existingSnapshot(dir, name string, kinds []string, encrypted bool) string {
+	for _, kind := range kinds {
+		path := filepath.Join(dir, name+"."+kind)
+		if encrypted {
+			path += ageExt
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"browser-pipes/internal/history"
+)
+
+func TestPreviousSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.md")
+	os.WriteFile(existing, []byte("x"), 0644)
+	newer := filepath.Join(dir, "b.md")
+	os.WriteFile(newer, []byte("x"), 0644)
+
+	entries := []history.Entry{
+		{Kind: history.KindSnapshot, Status: history.StatusSuccess, URL: "https://a.com", ContentHash: "h1", Files: []string{existing}},
+		{Kind: history.KindRoute, Status: history.StatusSuccess, URL: "https://b.com"},
+		{Kind: history.KindSnapshot, Status: history.StatusSuccess, URL: "https://gone.com", ContentHash: "h2", Files: []string{filepath.Join(dir, "deleted.md")}},
+		{Kind: history.KindSnapshot, Status: history.StatusSuccess, URL: "https://a.com", ContentHash: "h3", Files: []string{newer}},
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		hash string
+		want string
+	}{
+		{"same URL picks the latest", "https://a.com", "", newer},
+		{"same content, different URL", "https://mirror.com", "h1", existing},
+		{"route entries are ignored", "https://b.com", "", ""},
+		{"deleted files are ignored", "https://gone.com", "h2", ""},
+		{"no match", "https://new.com", "h9", ""},
+	}
+	for _, tt := range tests {
+		got := previousSnapshot(entries, tt.hash, tt.url)
+		if (got == nil && tt.want != "") || (got != nil && got.Files[0] != tt.want) {
+			t.Errorf("%s: got %+v, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSnapshotBase(t *testing.T) {
+	dir, name := snapshotBase("/notes/read/article_abc.warc")
+	if dir != "/notes/read" || name != "article_abc" {
+		t.Errorf("snapshotBase = %q, %q", dir, name)
+	}
+}
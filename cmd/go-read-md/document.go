@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	readability "codeberg.org/readeck/go-readability/v2"
+)
+
+// snapshotDocument is the json output format: the extraction result for
+// other programs, with the article as markdown, HTML and plain text.
+type snapshotDocument struct {
+	Title       string     `json:"title"`
+	Byline      string     `json:"byline,omitempty"`
+	SiteName    string     `json:"site_name,omitempty"`
+	Excerpt     string     `json:"excerpt,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+	Saved       time.Time  `json:"saved"`
+	URL         string     `json:"url"`
+	OriginalURL string     `json:"original_url,omitempty"`
+	ArchiveURL  string     `json:"archive_url,omitempty"`
+	Lang        string     `json:"lang,omitempty"`
+	Hash        string     `json:"hash"`
+	ContentHash string     `json:"content_hash"`
+	Tags        []string   `json:"tags"`
+	WordCount   int        `json:"word_count"`
+	Markdown    string     `json:"markdown"`
+	HTML        string     `json:"html"`
+	Text        string     `json:"text"`
+}
+
+// renderJSON builds the json output of the article, whose body is
+// contentHTML and, as markdown, data.Markdown.
+func renderJSON(data snapshotData, article readability.Article, contentHTML string) ([]byte, error) {
+	var text strings.Builder
+	if err := article.RenderText(&text); err != nil {
+		return nil, fmt.Errorf("failed to render text: %w", err)
+	}
+	doc := snapshotDocument{
+		Title:       data.Title,
+		Byline:      data.Byline,
+		SiteName:    data.SiteName,
+		Excerpt:     data.Excerpt,
+		Saved:       data.Saved,
+		URL:         data.URL,
+		OriginalURL: data.OriginalURL,
+		ArchiveURL:  data.ArchiveURL,
+		Lang:        data.Lang,
+		Hash:        data.URLHash,
+		ContentHash: data.ContentHash,
+		Tags:        data.Tags,
+		WordCount:   len(strings.Fields(text.String())),
+		Markdown:    data.Markdown,
+		HTML:        contentHTML,
+		Text:        strings.TrimSpace(text.String()),
+	}
+	if !data.Published.IsZero() {
+		doc.Published = &data.Published
+	}
+	if doc.Tags == nil {
+		doc.Tags = []string{}
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"browser-pipes/internal/history"
+)
+
+func TestRunJSONFormat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>JSON Page</title><meta name="author" content="Ann"></head><body><article><p>`+strings.Repeat("One two three four five. ", 40)+`<strong>End</strong></p></article></body></html>`)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	if err := run([]string{"--output", dir, "--format", "json", "--filename", "page", "--tags", "a,b", ts.URL}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "page.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc snapshotDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "JSON Page" || doc.Byline != "Ann" || doc.URL != ts.URL || doc.Hash != hashString(ts.URL) || strings.Join(doc.Tags, ",") != "a,b" {
+		t.Errorf("unexpected metadata %+v", doc)
+	}
+	if doc.WordCount != 201 || doc.ContentHash == "" || doc.Published != nil {
+		t.Errorf("unexpected word count %d, content hash %q or published %v", doc.WordCount, doc.ContentHash, doc.Published)
+	}
+	if !strings.Contains(doc.Markdown, "**End**") || !strings.Contains(doc.HTML, "<strong>End</strong>") || !strings.HasSuffix(doc.Text, "End") {
+		t.Errorf("expected the article as markdown, HTML and text, got %+v", doc)
+	}
+}
+
+func TestRunLanguage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/declared" {
+			fmt.Fprint(w, `<html lang="de-AT"><head><title>Seite</title></head><body><article><p>Das ist nicht der Text, den wir auf der Straße gefunden haben, und er ist auch nicht von dem Hund.</p></article></body></html>`)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Page</title></head><body><article><p>Le chat de la voisine est dans le jardin et il ne veut pas rentrer avec les enfants pour le dîner.</p></article></body></html>`)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	historyPath := filepath.Join(dir, "history.db")
+	if err := run([]string{"--output", dir, "--format", "md,json", "--frontmatter", "--filename", "declared", "--history", historyPath, ts.URL + "/declared"}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	var doc snapshotDocument
+	data, _ := os.ReadFile(filepath.Join(dir, "declared.json"))
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Lang != "de" {
+		t.Errorf("expected lang de in the JSON document, got %q (%v)", doc.Lang, err)
+	}
+	if markdown, _ := os.ReadFile(filepath.Join(dir, "declared.md")); !strings.Contains(string(markdown), "\nlang: \"de\"\n") {
+		t.Errorf("expected lang in the frontmatter, got %q", markdown)
+	}
+	if entries, _ := history.Read(historyPath); len(entries) != 1 || entries[0].Lang != "de" {
+		t.Errorf("expected lang in the history, got %+v", entries)
+	}
+
+	if err := run([]string{"--output", dir, "--format", "html", "--filename", "guessed", ts.URL + "/guessed"}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if page, _ := os.ReadFile(filepath.Join(dir, "guessed.html")); !strings.Contains(string(page), `<html lang="fr">`) {
+		t.Errorf("expected the guessed language on the HTML page, got %q", page)
+	}
+}
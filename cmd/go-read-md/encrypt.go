@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ageExt is appended to the name of every encrypted snapshot file.
+const ageExt = ".age"
+
+// assetLinkRe matches the local image links written by localizeImages.
+var assetLinkRe = regexp.MustCompile(`src="` + assetsDirName + `/([^"/]+)"`)
+
+// encrypter encrypts snapshot files at rest with the age CLI, for archives
+// kept in synced cloud folders. Nothing is written to the output folder in
+// the clear: documents are piped to age, and images, WARC and PNG files are
+// written to a staging folder outside it first. Recipients are age public keys (age1...) or
+// SSH public keys; recipientsFile lists more of them, one per line.
+type encrypter struct {
+	recipients     []string
+	recipientsFile string
+}
+
+func (e encrypter) enabled() bool {
+	return len(e.recipients) > 0 || e.recipientsFile != ""
+}
+
+// check fails early, before anything is fetched, when age is not installed.
+func (e encrypter) check() error {
+	if _, err := exec.LookPath("age"); err != nil {
+		return fmt.Errorf("--encrypt-to needs the age command in PATH (https://age-encryption.org)")
+	}
+	return nil
+}
+
+// encrypt writes what r reads to out.age, encrypted to every recipient, and
+// returns its path. The plaintext only ever goes through age's stdin, and
+// the encrypted file is renamed into place once it is complete.
+func (e encrypter) encrypt(r io.Reader, out string) (string, error) {
+	var args []string
+	for _, r := range e.recipients {
+		args = append(args, "-r", r)
+	}
+	if e.recipientsFile != "" {
+		args = append(args, "-R", e.recipientsFile)
+	}
+	out += ageExt
+	tmp := out + ".tmp"
+	args = append(args, "-o", tmp)
+
+	cmd := exec.Command("age", args...)
+	cmd.Stdin = r
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to encrypt %s: %v: %s", out, err, strings.TrimSpace(string(output)))
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return "", fmt.Errorf("failed to encrypt %s: %w", out, err)
+	}
+	return out, nil
+}
+
+// encryptFile encrypts src, a file written to the staging folder, to out.age.
+func (e encrypter) encryptFile(src, out string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt %s: %w", out, err)
+	}
+	defer f.Close()
+	return e.encrypt(f, out)
+}
+
+// encryptAssets encrypts the downloaded images an article links to from
+// the staging folder into fileDir. The links are kept, so they resolve again
+// once the folder is decrypted.
+func (e encrypter) encryptAssets(contentHTML, stageDir, fileDir string) error {
+	done := make(map[string]bool)
+	for _, m := range assetLinkRe.FindAllStringSubmatch(contentHTML, -1) {
+		if done[m[1]] {
+			continue
+		}
+		done[m[1]] = true
+		if err := os.MkdirAll(filepath.Join(fileDir, assetsDirName), 0755); err != nil {
+			return fmt.Errorf("failed to create assets directory: %w", err)
+		}
+		src := filepath.Join(stageDir, assetsDirName, m[1])
+		if _, err := e.encryptFile(src, filepath.Join(fileDir, assetsDirName, m[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
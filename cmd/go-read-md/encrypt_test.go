@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"browser-pipes/internal/history"
+)
+
+// fakeAge "encrypts" by prefixing its input with a line listing the
+// recipients, so tests can check what was passed without the real age. When
+// AGE_WATCH names a folder, it fails if that folder holds any file that is
+// not encrypted, so plaintext written before an earlier call is caught.
+const fakeAge = `#!/bin/sh
+recipients= in=-
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-o) out=$2; shift 2 ;;
+	-r|-R) recipients="$recipients $2"; shift 2 ;;
+	*) in=$1; shift ;;
+	esac
+done
+if [ -n "$AGE_WATCH" ] && [ -n "$(find "$AGE_WATCH" -type f ! -name '*.age' ! -name '*.age.tmp')" ]; then
+	echo "plaintext in $AGE_WATCH" >&2
+	exit 1
+fi
+{ echo "AGE$recipients"; cat "$in"; } > "$out"
+`
+
+func installFakeAge(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "age"), []byte(fakeAge), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestEncrypt(t *testing.T) {
+	installFakeAge(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chart.png" {
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "png")
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Secret</title></head><body><article><p>Private reading, kept encrypted in a synced folder.</p><img src="/chart.png"></article></body></html>`)
+	}))
+	defer ts.Close()
+
+	dir, state := t.TempDir(), t.TempDir()
+	historyPath := filepath.Join(state, "history.db")
+	recipients := filepath.Join(state, "recipients.txt")
+	t.Setenv("AGE_WATCH", dir)
+	stdout := &bytes.Buffer{}
+	err := run([]string{
+		"--output", dir, "--filename", "secret", "--format", "md,html,epub,warc", "--download-images",
+		"--history", historyPath, "--encrypt-to", "age1abc,age1def", "--encrypt-to-file", recipients, ts.URL,
+	}, nil, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, _ := exec.Command("find", dir, "-type", "f", "!", "-name", "*.age").Output()
+	if len(plain) > 0 {
+		t.Errorf("expected only encrypted files in the output folder, got:\n%s", plain)
+	}
+	for _, name := range []string{"secret.md", "secret.html", "secret.epub", "secret.warc"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("expected no plaintext %s", name)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name+".age"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "AGE age1abc age1def "+recipients+"\n") {
+			t.Errorf("expected %s encrypted to every recipient, got %q", name, data)
+		}
+	}
+	assets, _ := filepath.Glob(filepath.Join(dir, "assets", "*"))
+	if len(assets) != 1 || !strings.HasSuffix(assets[0], ".png.age") {
+		t.Errorf("expected the image to be encrypted, got %v", assets)
+	}
+	if !strings.Contains(stdout.String(), "secret.md.age") {
+		t.Errorf("expected the encrypted file to be reported, got %q", stdout.String())
+	}
+
+	entries, _ := history.Read(historyPath)
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Files[0], "secret.md.age") {
+		t.Fatalf("expected the encrypted files in the history, got %+v", entries)
+	}
+	if d, name := snapshotBase(entries[0].Files[0]); d != dir || name != "secret" {
+		t.Errorf("expected dedup to rewrite secret, got %s %s", d, name)
+	}
+
+	indexDir := filepath.Join(state, "indexed")
+	if err := run([]string{"--output", indexDir, "--index", "--encrypt-to", "age1abc", ts.URL}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(indexDir, "index.json")); err == nil {
+		t.Error("expected no plaintext index next to encrypted snapshots")
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubImageTypes are the image types EPUB readers must support; other
+// images are left out of the book.
+var epubImageTypes = map[string]bool{
+	"image/gif": true, "image/jpeg": true, "image/png": true, "image/svg+xml": true, "image/webp": true,
+}
+
+// epubSkipTags are dropped from the chapter: readers do not run scripts or
+// load frames, and most reject them outright.
+var epubSkipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "iframe": true,
+	"object": true, "embed": true, "form": true, "input": true, "button": true, "select": true, "textarea": true,
+}
+
+// epubVoidTags are written as empty XML elements.
+var epubVoidTags = map[string]bool{
+	"area": true, "br": true, "col": true, "hr": true, "img": true, "source": true, "track": true, "wbr": true,
+}
+
+// epubImage is an image stored in the book.
+type epubImage struct {
+	name      string // file name under images/
+	mediaType string
+	data      []byte
+}
+
+// renderEPUB packs the article into a single-chapter EPUB 3 book with the
+// snapshot metadata in its package document. Images are embedded: remote
+// ones are fetched like --download-images does, the local copies it left
+// in fileDir are read back, and images that cannot be embedded are
+// replaced by their alt text, since readers will not load remote images.
+func renderEPUB(web *fetcher, data snapshotData, contentHTML string, base *url.URL, fileDir string, opts imageOptions) ([]byte, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(contentHTML), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse article HTML: %w", err)
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+
+	images := embedImages(web, body, base, fileDir, opts)
+
+	var chapter strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		writeXHTML(&chapter, c)
+	}
+
+	lang := data.Lang
+	if lang == "" {
+		lang = "und"
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// The mimetype comes first and uncompressed, so readers can sniff it.
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write EPUB: %w", err)
+	}
+	if _, err := mimetype.Write([]byte("application/epub+zip")); err != nil {
+		return nil, fmt.Errorf("failed to write EPUB: %w", err)
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"META-INF/container.xml", []byte(epubContainer)},
+		{"OEBPS/content.opf", []byte(epubPackage(data, lang, images))},
+		{"OEBPS/nav.xhtml", []byte(epubNav(data, lang))},
+		{"OEBPS/article.xhtml", []byte(epubChapter(data, lang, chapter.String()))},
+	}
+	for _, img := range images {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{"OEBPS/images/" + img.name, img.data})
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write EPUB: %w", err)
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return nil, fmt.Errorf("failed to write EPUB: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write EPUB: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// embedImages loads the images of the article, points their <img> tags
+// at the copies in the book and returns the copies.
+func embedImages(web *fetcher, body *html.Node, base *url.URL, fileDir string, opts imageOptions) []epubImage {
+	var imgs []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.DataAtom == atom.Img {
+			imgs = append(imgs, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+
+	var (
+		mu     sync.Mutex
+		loaded = make(map[string]*epubImage)
+		remote []*url.URL
+	)
+	store := func(key, name string, data []byte) {
+		mediaType := mime.TypeByExtension(path.Ext(name))
+		if i := strings.Index(mediaType, ";"); i >= 0 {
+			mediaType = mediaType[:i]
+		}
+		if !epubImageTypes[mediaType] {
+			log.Printf("⚠️ Leaving %s out of the EPUB: not a supported image type", key)
+			return
+		}
+		mu.Lock()
+		loaded[key] = &epubImage{name: name, mediaType: mediaType, data: data}
+		mu.Unlock()
+	}
+	for _, img := range imgs {
+		src := attr(img, "src")
+		u, err := url.Parse(src)
+		switch {
+		case src == "" || err != nil || loaded[src] != nil:
+		case !u.IsAbs() && !strings.HasPrefix(src, "/"):
+			// A copy saved by --download-images.
+			data, err := os.ReadFile(filepath.Join(fileDir, filepath.FromSlash(u.Path)))
+			if err != nil {
+				log.Printf("⚠️ Leaving %s out of the EPUB: %v", src, err)
+				continue
+			}
+			store(src, path.Base(u.Path), data)
+		default:
+			if u = base.ResolveReference(u); u.Scheme == "http" || u.Scheme == "https" {
+				remote = append(remote, u)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	var unique []*url.URL
+	for _, u := range remote {
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			unique = append(unique, u)
+		}
+	}
+	eachImage(unique, opts, func(src *url.URL) {
+		data, name, err := fetchImage(web, src, opts.maxSize)
+		if err != nil {
+			log.Printf("⚠️ Leaving %s out of the EPUB: %v", src, err)
+			return
+		}
+		store(src.String(), name, data)
+	})
+
+	var images []epubImage
+	added := make(map[string]bool)
+	for _, img := range imgs {
+		src := attr(img, "src")
+		key := src
+		if u, err := url.Parse(src); err == nil && loaded[src] == nil {
+			key = base.ResolveReference(u).String()
+		}
+		e := loaded[key]
+		if e == nil {
+			// Readers do not fetch remote images; the alt text stands in.
+			if alt := strings.TrimSpace(attr(img, "alt")); alt != "" {
+				img.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: alt}, img)
+			}
+			img.Parent.RemoveChild(img)
+			continue
+		}
+		setAttr(img, "src", "images/"+e.name)
+		removeAttr(img, "srcset")
+		removeAttr(img, "sizes")
+		if !added[e.name] {
+			added[e.name] = true
+			images = append(images, *e)
+		}
+	}
+	return images
+}
+
+// writeXHTML writes n as well-formed XHTML, which EPUB requires and the
+// HTML renderer does not produce: void elements are closed, attributes
+// that are not valid XML names are dropped, and SVG and MathML get their
+// namespaces.
+func writeXHTML(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(xmlChars(n.Data)))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if epubSkipTags[n.Data] && n.Namespace == "" {
+		return
+	}
+	if n.Data == "source" && n.Parent != nil && n.Parent.DataAtom == atom.Picture {
+		return // the <img> of the picture holds the embedded copy
+	}
+	if !xmlName(n.Data) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeXHTML(b, c)
+		}
+		return
+	}
+
+	b.WriteString("<" + n.Data)
+	if n.Namespace != "" && (n.Parent == nil || n.Parent.Namespace != n.Namespace) {
+		switch n.Namespace {
+		case "svg":
+			b.WriteString(` xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"`)
+		case "math":
+			b.WriteString(` xmlns="http://www.w3.org/1998/Math/MathML"`)
+		}
+	}
+	for _, a := range n.Attr {
+		key := a.Key
+		if a.Namespace == "xlink" || a.Namespace == "xml" {
+			key = a.Namespace + ":" + key
+		}
+		if !xmlName(key) || strings.HasPrefix(key, "on") || key == "xmlns" || strings.HasPrefix(key, "xmlns:") {
+			continue
+		}
+		b.WriteString(" " + key + `="` + html.EscapeString(xmlChars(a.Val)) + `"`)
+	}
+	if n.FirstChild == nil && (epubVoidTags[n.Data] || n.Namespace != "") {
+		b.WriteString("/>")
+		return
+	}
+	b.WriteString(">")
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeXHTML(b, c)
+	}
+	b.WriteString("</" + n.Data + ">")
+}
+
+// xmlName reports whether s can be used as an XML element or attribute
+// name; HTML allows names XML does not.
+func xmlName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.' || r == ':'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// xmlChars drops the control characters XML 1.0 does not allow.
+func xmlChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func removeAttr(n *html.Node, key string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+			return
+		}
+	}
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// epubPackage renders the package document: the snapshot metadata, the
+// files of the book and their reading order.
+func epubPackage(data snapshotData, lang string, images []epubImage) string {
+	esc := func(s string) string { return html.EscapeString(xmlChars(s)) }
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid" xml:lang="` + esc(lang) + `">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&b, "    <dc:identifier id=\"uid\">urn:browser-pipes:%s</dc:identifier>\n", esc(data.URLHash))
+	fmt.Fprintf(&b, "    <dc:title>%s</dc:title>\n", esc(data.Title))
+	fmt.Fprintf(&b, "    <dc:language>%s</dc:language>\n", esc(lang))
+	if data.Byline != "" {
+		fmt.Fprintf(&b, "    <dc:creator>%s</dc:creator>\n", esc(data.Byline))
+	}
+	if data.SiteName != "" {
+		fmt.Fprintf(&b, "    <dc:publisher>%s</dc:publisher>\n", esc(data.SiteName))
+	}
+	if !data.Published.IsZero() {
+		fmt.Fprintf(&b, "    <dc:date>%s</dc:date>\n", data.Published.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "    <dc:source>%s</dc:source>\n", esc(data.URL))
+	if data.Excerpt != "" {
+		fmt.Fprintf(&b, "    <dc:description>%s</dc:description>\n", esc(data.Excerpt))
+	}
+	for _, tag := range data.Tags {
+		fmt.Fprintf(&b, "    <dc:subject>%s</dc:subject>\n", esc(tag))
+	}
+	fmt.Fprintf(&b, "    <meta property=\"dcterms:modified\">%s</meta>\n", data.Saved.UTC().Format("2006-01-02T15:04:05Z"))
+	b.WriteString(`  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="article" href="article.xhtml" media-type="application/xhtml+xml"/>
+`)
+	for i, img := range images {
+		fmt.Fprintf(&b, "    <item id=\"img%d\" href=\"images/%s\" media-type=\"%s\"/>\n", i+1, esc(img.name), img.mediaType)
+	}
+	b.WriteString(`  </manifest>
+  <spine>
+    <itemref idref="article"/>
+  </spine>
+</package>
+`)
+	return b.String()
+}
+
+// epubNav renders the table of contents EPUB 3 requires, one entry long.
+func epubNav(data snapshotData, lang string) string {
+	title := html.EscapeString(xmlChars(data.Title))
+	return epubHead(title, lang) + `<body>
+<nav epub:type="toc" id="toc">
+<ol><li><a href="article.xhtml">` + title + `</a></li></ol>
+</nav>
+</body>
+</html>
+`
+}
+
+// epubChapter renders the article under a header like the html format's.
+func epubChapter(data snapshotData, lang, content string) string {
+	esc := func(s string) string { return html.EscapeString(xmlChars(s)) }
+	var b strings.Builder
+	b.WriteString(epubHead(esc(data.Title), lang) + "<body>\n<header>\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", esc(data.Title))
+	var meta []string
+	if data.Byline != "" {
+		meta = append(meta, esc(data.Byline))
+	}
+	if data.SiteName != "" {
+		meta = append(meta, esc(data.SiteName))
+	}
+	if !data.Published.IsZero() {
+		meta = append(meta, data.Published.Format("2006-01-02"))
+	}
+	if len(meta) > 0 {
+		fmt.Fprintf(&b, "<p>%s</p>\n", strings.Join(meta, " · "))
+	}
+	fmt.Fprintf(&b, "<p><a href=\"%s\">%s</a></p>\n", esc(data.URL), esc(data.URL))
+	if data.ArchiveURL != "" {
+		fmt.Fprintf(&b, "<p>Archived: <a href=\"%s\">%s</a></p>\n", esc(data.ArchiveURL), esc(data.ArchiveURL))
+	}
+	b.WriteString("</header>\n<hr/>\n" + content + "\n</body>\n</html>\n")
+	return b.String()
+}
+
+func epubHead(title, lang string) string {
+	lang = html.EscapeString(lang)
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + lang + `" lang="` + lang + `">
+<head>
+<meta charset="UTF-8"/>
+<title>` + title + `</title>
+</head>
+`
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestRunEPUBFormat(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nfake")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+		case "/gone.png":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprint(w, `<html lang="en"><head><title>EPUB Page</title><meta name="author" content="Ann"></head><body><article>
+<p>`+strings.Repeat("One two three four five. ", 40)+`<br>A &amp; B</p>
+<p><img src="/cat.png" alt="A cat"><img src="/gone.png" alt="Missing dog"></p>
+</article></body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	if err := run([]string{"--output", dir, "--format", "epub", "--filename", "page", "--tags", "cats", ts.URL}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(filepath.Join(dir, "page.epub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	if f := zr.File[0]; f.Name != "mimetype" || f.Method != zip.Store {
+		t.Errorf("expected an uncompressed mimetype first, got %s (method %d)", f.Name, f.Method)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	for name, want := range map[string][]string{
+		"mimetype":               {"application/epub+zip"},
+		"META-INF/container.xml": {`full-path="OEBPS/content.opf"`},
+		"OEBPS/content.opf": {
+			"<dc:title>EPUB Page</dc:title>",
+			"<dc:creator>Ann</dc:creator>",
+			"<dc:language>en</dc:language>",
+			"<dc:source>" + ts.URL + "</dc:source>",
+			"<dc:subject>cats</dc:subject>",
+			`media-type="image/png"`,
+		},
+		"OEBPS/nav.xhtml":     {`<a href="article.xhtml">EPUB Page</a>`},
+		"OEBPS/article.xhtml": {"<h1>EPUB Page</h1>", "<br/>A &amp; B", `<img src="images/`, "Missing dog"},
+	} {
+		for _, w := range want {
+			if !strings.Contains(files[name], w) {
+				t.Errorf("expected %q in %s:\n%s", w, name, files[name])
+			}
+		}
+	}
+	if strings.Contains(files["OEBPS/article.xhtml"], "gone.png") {
+		t.Errorf("expected the missing image to be dropped:\n%s", files["OEBPS/article.xhtml"])
+	}
+
+	var images int
+	for name, data := range files {
+		if strings.HasPrefix(name, "OEBPS/images/") {
+			images++
+			if data != string(png) {
+				t.Errorf("unexpected image data in %s", name)
+			}
+		}
+	}
+	if images != 1 {
+		t.Errorf("expected one embedded image, got %d", images)
+	}
+
+	for _, name := range []string{"OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/article.xhtml"} {
+		dec := xml.NewDecoder(strings.NewReader(files[name]))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s is not well-formed XML: %v", name, err)
+				break
+			}
+		}
+	}
+}
+
+func TestWriteXHTML(t *testing.T) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(`<p onclick="x()" data-1a="no" title='"q"'>a<br>b<wbr><script>x()</script></p><svg viewBox="0 0 10 10"><use xlink:href="#c"/></svg>`), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		writeXHTML(&b, n)
+	}
+	want := `<p data-1a="no" title="&#34;q&#34;">a<br/>b<wbr/></p><svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10"><use xlink:href="#c"/></svg>`
+	if b.String() != want {
+		t.Errorf("got  %s\nwant %s", b.String(), want)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Exit codes, by the stage of run that failed, so a wrapping script or a
+// plumber step can tell a dead link from a bad flag.
+const (
+	exitFailure = 1 // anything else
+	exitUsage   = 2 // invalid flags, arguments or the files they name
+	exitFetch   = 3 // the page, feed or sitemap could not be read
+	exitExtract = 4 // no article could be extracted from the page
+	exitWrite   = 5 // the snapshot could not be rendered or saved
+	exitBatch   = 6 // some URLs of a --batch, --feed, --crawl or --sitemap failed
+)
+
+var exitKinds = map[int]string{
+	exitFailure: "error",
+	exitUsage:   "usage",
+	exitFetch:   "fetch",
+	exitExtract: "extract",
+	exitWrite:   "write",
+	exitBatch:   "batch",
+}
+
+// runError is an error of run with its exit code and, for --json-errors,
+// what a script needs to react to it.
+type runError struct {
+	err    error
+	code   int
+	url    string
+	asJSON bool // --json-errors
+}
+
+func (e *runError) Error() string { return e.err.Error() }
+func (e *runError) Unwrap() error { return e.err }
+
+// batchError reports the URLs a batch failed to convert.
+type batchError struct {
+	failed []string
+	total  int
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("%d of %d URLs failed", len(e.failed), e.total)
+}
+
+// classify wraps err, unless nil or already classified, with the exit code
+// of the stage it happened in.
+func classify(err error, stage int, url string, asJSON bool) error {
+	if err == nil {
+		return nil
+	}
+	var re *runError
+	if errors.As(err, &re) {
+		return err
+	}
+	var be *batchError
+	if errors.As(err, &be) {
+		stage = exitBatch
+	}
+	return &runError{err: err, code: stage, url: url, asJSON: asJSON}
+}
+
+// reportError prints err to w, as text or with --json-errors as one JSON
+// object, and returns the exit code for it.
+func reportError(w io.Writer, err error) int {
+	re := &runError{err: err, code: exitFailure}
+	errors.As(err, &re)
+	if !re.asJSON {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return re.code
+	}
+
+	report := struct {
+		Error    string   `json:"error"`
+		Kind     string   `json:"kind"`
+		ExitCode int      `json:"exit_code"`
+		URL      string   `json:"url,omitempty"`
+		Status   int      `json:"status,omitempty"` // HTTP status of a refused fetch
+		Failed   []string `json:"failed,omitempty"` // URLs of a failed batch
+	}{Error: err.Error(), Kind: exitKinds[re.code], ExitCode: re.code, URL: re.url}
+	var status *statusError
+	if errors.As(err, &status) {
+		report.Status = status.code
+	}
+	var be *batchError
+	if errors.As(err, &be) {
+		report.Failed = be.failed
+	}
+	data, _ := json.Marshal(report)
+	fmt.Fprintf(w, "%s\n", data)
+	return re.code
+}
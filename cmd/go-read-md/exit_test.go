@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "<html><head><title>Page</title></head><body><article><p>Some article text.</p></article></body></html>")
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	blocked := filepath.Join(dir, "blocked")
+	os.WriteFile(blocked, []byte("a file, not a folder"), 0644)
+	list := filepath.Join(dir, "links.txt")
+	os.WriteFile(list, []byte(ts.URL+"\n"+ts.URL+"/missing\n"), 0644)
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"Usage", []string{"--output", dir, "--format", "docx", ts.URL}, exitUsage},
+		{"Unknown Flag", []string{"--output", dir, "--bogus", ts.URL}, exitUsage},
+		{"Fetch", []string{"--output", dir, ts.URL + "/missing"}, exitFetch},
+		{"Extract", []string{"--output", dir, "--content-selector", "main[", ts.URL}, exitExtract},
+		{"Write", []string{"--output", blocked, ts.URL}, exitWrite},
+		{"Batch", []string{"--output", dir, "--batch", list}, exitBatch},
+	} {
+		err := run(tt.args, nil, ioDiscard())
+		var re *runError
+		if !errors.As(err, &re) || re.code != tt.code {
+			t.Errorf("%s: expected exit code %d, got %v", tt.name, tt.code, err)
+		}
+	}
+}
+
+func TestReportError(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	var stderr bytes.Buffer
+	err := run([]string{"--output", t.TempDir(), "--json-errors", ts.URL + "/gone"}, nil, ioDiscard())
+	if code := reportError(&stderr, err); code != exitFetch {
+		t.Errorf("expected exit code %d, got %d", exitFetch, code)
+	}
+	var report map[string]any
+	if err := json.Unmarshal(stderr.Bytes(), &report); err != nil {
+		t.Fatalf("expected one JSON object, got %q: %v", stderr.String(), err)
+	}
+	want := map[string]any{"kind": "fetch", "exit_code": float64(exitFetch), "url": ts.URL + "/gone", "status": float64(404)}
+	for k, v := range want {
+		if report[k] != v {
+			t.Errorf("expected %s %v, got %v", k, v, report[k])
+		}
+	}
+
+	stderr.Reset()
+	err = run([]string{"--output", t.TempDir(), "--format", "docx", ts.URL}, nil, ioDiscard())
+	if code := reportError(&stderr, err); code != exitUsage || !strings.HasPrefix(stderr.String(), "Error: unsupported format") {
+		t.Errorf("expected a plain usage error, got %d %q", code, stderr.String())
+	}
+}
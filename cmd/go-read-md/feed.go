@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// feedEntry is an article an RSS or Atom feed links to.
+type feedEntry struct {
+	url       string
+	published time.Time // zero when the feed does not say
+}
+
+// feedDateLayouts are the date formats of RSS (RFC 822 and the variants
+// found in the wild) and Atom (RFC 3339).
+var feedDateLayouts = []string{
+	time.RFC3339, time.RFC1123Z, time.RFC1123, time.RFC822Z, time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700", "2006-01-02",
+}
+
+// feedURLs fetches the feed at feedURL and returns the links of its entries,
+// newest first: those published since since (all when it is zero, and
+// undated ones always), at most limit of them when limit is positive.
+func feedURLs(web *fetcher, feedURL string, since time.Time, limit int) ([]string, error) {
+	base, err := url.Parse(feedURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid --feed URL: %s", feedURL)
+	}
+	page, err := web.fetch(feedURL, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	entries, err := parseFeed(page.body)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(entries, func(a, b feedEntry) int { return b.published.Compare(a.published) })
+	var urls []string
+	for _, e := range entries {
+		if !since.IsZero() && !e.published.IsZero() && e.published.Before(since) {
+			continue
+		}
+		link, err := base.Parse(e.url)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+			log.Printf("⚠️ Skipping feed entry %q: not a web link", e.url)
+			continue
+		}
+		if !slices.Contains(urls, link.String()) {
+			urls = append(urls, link.String())
+		}
+		if limit > 0 && len(urls) == limit {
+			break
+		}
+	}
+	log.Printf("📰 %d of %d feed entries to convert", len(urls), len(entries))
+	return urls, nil
+}
+
+// feedLink is an RSS <link> (text) or an Atom <link> (href).
+type feedLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Text string `xml:",chardata"`
+}
+
+// feedItem is an RSS item or an Atom entry; each fills its own fields.
+type feedItem struct {
+	Links     []feedLink `xml:"link"`
+	GUID      string     `xml:"guid"`
+	PubDate   string     `xml:"pubDate"`
+	DCDate    string     `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+// parseFeed reads the entries of an RSS 2.0, RSS 1.0 (RDF) or Atom feed.
+func parseFeed(data []byte) ([]feedEntry, error) {
+	var doc struct {
+		XMLName xml.Name
+		Channel struct {
+			Items []feedItem `xml:"item"`
+		} `xml:"channel"`
+		Items   []feedItem `xml:"item"`  // RSS 1.0 puts them next to the channel
+		Entries []feedItem `xml:"entry"` // Atom
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	dec.Strict = false
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+	switch doc.XMLName.Local {
+	case "rss", "RDF", "feed":
+	default:
+		return nil, fmt.Errorf("failed to parse feed: <%s> is not an RSS or Atom feed", doc.XMLName.Local)
+	}
+
+	var entries []feedEntry
+	for _, item := range slices.Concat(doc.Channel.Items, doc.Items, doc.Entries) {
+		e := feedEntry{url: item.link()}
+		if e.url == "" {
+			continue
+		}
+		for _, value := range []string{item.Published, item.PubDate, item.DCDate, item.Updated} {
+			if t, ok := parseFeedDate(value); ok {
+				e.published = t
+				break
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// link picks the article URL of an item: the RSS link, the Atom alternate
+// link, or an RSS guid that is a URL.
+func (item feedItem) link() string {
+	for _, l := range item.Links {
+		if text := strings.TrimSpace(l.Text); text != "" {
+			return text
+		}
+	}
+	for _, l := range item.Links {
+		if l.Href != "" && (l.Rel == "" || l.Rel == "alternate") {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	if guid := strings.TrimSpace(item.GUID); strings.HasPrefix(guid, "http://") || strings.HasPrefix(guid, "https://") {
+		return guid
+	}
+	return ""
+}
+
+func parseFeedDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
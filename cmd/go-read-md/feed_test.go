@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name string
+		feed string
+		want []string
+	}{
+		{"RSS", `<?xml version="1.0"?><rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><link>https://example.com/</link>
+<item><title>A</title><link>https://example.com/a</link><atom:link rel="self" href="https://example.com/feed"/><pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate></item>
+<item><title>B</title><guid>https://example.com/b</guid></item>
+<item><title>No link</title><guid isPermaLink="false">tag-123</guid></item>
+</channel></rss>`, []string{"https://example.com/a 2006-01-02", "https://example.com/b"}},
+		{"Atom", `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link rel="replies" href="https://example.com/c#comments"/><link href="https://example.com/c"/><updated>2024-05-01T10:00:00Z</updated><published>2024-04-30T10:00:00Z</published></entry></feed>`, []string{"https://example.com/c 2024-04-30"}},
+		{"RDF", `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/"><channel><link>https://example.com/</link></channel><item><link>https://example.com/d</link><dc:date>2024-03-01T00:00:00Z</dc:date></item></rdf:RDF>`, []string{"https://example.com/d 2024-03-01"}},
+	}
+	for _, tt := range tests {
+		entries, err := parseFeed([]byte(tt.feed))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, e := range entries {
+			if e.published.IsZero() {
+				got = append(got, e.url)
+			} else {
+				got = append(got, e.url+" "+e.published.Format("2006-01-02"))
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := parseFeed([]byte("<html><body>not a feed</body></html>")); err == nil {
+		t.Error("expected an error for a page that is not a feed")
+	}
+}
+
+func TestRunFeed(t *testing.T) {
+	now := time.Now().UTC()
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed.xml" {
+			fmt.Fprintf(w, `<rss version="2.0"><channel>
+<item><link>/old</link><pubDate>%s</pubDate></item>
+<item><link>%s/new</link><pubDate>%s</pubDate></item>
+<item><link>%s/newer</link><pubDate>%s</pubDate></item>
+</channel></rss>`, now.AddDate(0, 0, -30).Format(time.RFC1123Z), ts.URL, now.AddDate(0, 0, -2).Format(time.RFC1123Z), ts.URL, now.AddDate(0, 0, -1).Format(time.RFC1123Z))
+			return
+		}
+		fmt.Fprintf(w, "<html><head><title>Post %s</title></head><body><article><p>Content of %s.</p></article></body></html>", r.URL.Path[1:], r.URL.Path)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"--output", dir, "--feed", ts.URL + "/feed.xml", "--since", "7d", "--limit", "1"}, nil, stdout); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.md")); len(matches) != 1 || !strings.Contains(matches[0], "Post_newer") {
+		t.Errorf("expected only the newest entry, got %v\n%s", matches, stdout)
+	}
+
+	stdout.Reset()
+	if err := run([]string{"--output", dir, "--feed", ts.URL + "/feed.xml"}, nil, stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "📦 Converted 3 of 3 URLs") {
+		t.Errorf("expected every entry, relative links included, got %q", stdout)
+	}
+
+	stdout.Reset()
+	if err := run([]string{"--output", dir, "--feed", ts.URL + "/feed.xml", "--since", now.AddDate(0, 0, 1).Format("2006-01-02")}, nil, stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "📭 No feed entries") {
+		t.Errorf("expected nothing to convert, got %q", stdout)
+	}
+
+	if err := run([]string{"--output", dir, "--feed", ts.URL + "/feed.xml", ts.URL}, nil, stdout); err == nil || !strings.Contains(err.Error(), "--feed takes its URLs from the feed") {
+		t.Errorf("expected a URL conflict error, got %v", err)
+	}
+}
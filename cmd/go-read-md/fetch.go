@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// fetchResult is the page as retrieved from its source. live is set when it
+// was fetched over HTTP; exchange is only populated when the raw HTTP traffic
+// was recorded (for WARC output). body keeps the page's own charset, which
+// contentType may name. capture is the Wayback Machine capture the page
+// came from when --archive-fallback stepped in.
+type fetchResult struct {
+	body        []byte
+	contentType string
+	live        bool
+	exchange    *exchange
+	capture     string
+}
+
+func readPage(r io.Reader) (*fetchResult, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return &fetchResult{body: body}, nil
+}
+
+// fetcher fetches pages and subresources with the --timeout, --retries,
+// --max-redirects and --max-size limits. Images are downloaded with its
+// client. Every request carries header.
+type fetcher struct {
+	client  *http.Client
+	header  http.Header // --header and --user-agent
+	retries int         // extra attempts after a network error, 429 or 5xx
+	maxSize int64       // largest response body in bytes; 0 means no limit
+}
+
+// retryDelay is the wait before the first retry; it doubles after each one.
+var retryDelay = time.Second
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+func newFetcher(jar http.CookieJar, timeout time.Duration, retries, maxRedirects int, maxSize int64) *fetcher {
+	return &fetcher{
+		client: &http.Client{
+			Jar:     jar,
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return fmt.Errorf("%w (limit %d)", errTooManyRedirects, maxRedirects)
+				}
+				return nil
+			},
+		},
+		retries: retries,
+		maxSize: maxSize,
+	}
+}
+
+// newRequest builds a GET request for target with the configured headers,
+// which a WARC file then records as sent.
+func (f *fetcher) newRequest(target string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range f.header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	return req, nil
+}
+
+// fetch downloads target. When record is set, the raw request and response
+// are kept so they can be written to a WARC file.
+func (f *fetcher) fetch(target string, record bool) (*fetchResult, error) {
+	req, err := f.newRequest(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+
+	resp, err := f.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	if f.maxSize > 0 {
+		if resp.ContentLength > f.maxSize {
+			return nil, f.tooLarge()
+		}
+		resp.Body = http.MaxBytesReader(nil, resp.Body, f.maxSize)
+	}
+
+	res := &fetchResult{live: true, contentType: resp.Header.Get("Content-Type")}
+	if record {
+		rawReq, err := httputil.DumpRequestOut(req, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record request: %w", err)
+		}
+		// DumpResponse consumes the body and replaces it with an in-memory copy.
+		rawResp, err := httputil.DumpResponse(resp, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record response: %w", f.readError(err))
+		}
+		res.exchange = &exchange{url: target, request: rawReq, response: rawResp}
+	}
+
+	if res.body, err = io.ReadAll(resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", f.readError(err))
+	}
+	return res, nil
+}
+
+// do sends req, retrying network errors, 429 and 5xx responses with a
+// growing delay. A redirect loop is not worth retrying.
+func (f *fetcher) do(req *http.Request) (*http.Response, error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := f.client.Do(req)
+		reason := ""
+		if err != nil && !errors.Is(err, errTooManyRedirects) {
+			reason = err.Error()
+		} else if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) {
+			reason = resp.Status
+		}
+		if reason == "" || attempt >= f.retries {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		log.Printf("🔁 Retrying %s in %s (%s)", req.URL, delay, reason)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// statusError is a page fetch refused for its HTTP status.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string { return "HTTP error: " + e.status }
+
+// gone reports whether err says the page is not there for us any more, so
+// an archived copy is worth trying: it is missing (404, 410), behind a
+// paywall or login (401, 402, 403, 451), the server is failing, or it
+// could not be reached at all.
+func gone(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		switch status.code {
+		case http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound,
+			http.StatusGone, http.StatusUnavailableForLegalReasons:
+			return true
+		}
+		return status.code >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !errors.Is(err, errTooManyRedirects)
+}
+
+func (f *fetcher) tooLarge() error {
+	return fmt.Errorf("response is larger than --max-size (%d bytes)", f.maxSize)
+}
+
+// readError replaces the error of a body cut off at --max-size.
+func (f *fetcher) readError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return f.tooLarge()
+	}
+	return err
+}
+
+// parseHeaders turns repeated "Name: value" --header flags and --user-agent
+// into the headers sent with every request.
+func parseHeaders(values []string, userAgent string) (http.Header, error) {
+	header := make(http.Header)
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		if name = strings.TrimSpace(name); !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid --header %q (use \"Name: value\")", v)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	if userAgent != "" {
+		header.Set("User-Agent", userAgent)
+	}
+	return header, nil
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
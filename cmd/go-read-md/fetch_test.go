@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+func TestFetcher(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if attempts++; attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "finally")
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/big":
+			// No Content-Length, so the limit applies while reading.
+			w.(http.Flusher).Flush()
+			fmt.Fprint(w, strings.Repeat("x", 100))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/gone":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	web := newFetcher(nil, 100*time.Millisecond, 2, 3, 50)
+
+	res, err := web.fetch(ts.URL+"/flaky", false)
+	if err != nil || string(res.body) != "finally" {
+		t.Errorf("expected the third attempt to succeed, got %v", err)
+	}
+
+	for path, want := range map[string]string{
+		"/loop": "too many redirects (limit 3)",
+		"/big":  "larger than --max-size (50 bytes)",
+		"/slow": "Client.Timeout exceeded",
+		"/gone": "HTTP error: 404",
+	} {
+		if _, err := web.fetch(ts.URL+path, path == "/big"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", path, want, err)
+		}
+	}
+
+	attempts = 0
+	if _, err := newFetcher(nil, 0, 1, 10, 0).fetch(ts.URL+"/flaky", false); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the 503 after one retry, got %v", err)
+	}
+}
+
+func TestRunHeaders(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]http.Header)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.URL.Path] = r.Header.Clone()
+		mu.Unlock()
+		if r.URL.Path == "/logo.png" {
+			fmt.Fprint(w, "PNG")
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Members</title></head><body><article><p>Members only.</p><img src="/logo.png"></article></body></html>`)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	list := ts.URL + "/a\n" + ts.URL + "/b\n"
+	args := []string{"--output", dir, "--batch", "-", "--format", "md,warc", "--download-images", "--header", "Authorization: Bearer abc", "--header", "Accept-Language: de", "--user-agent", "Mozilla/5.0 (test)"}
+	if err := run(args, strings.NewReader(list), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/a", "/b", "/logo.png"} {
+		h := seen[path]
+		if h.Get("Authorization") != "Bearer abc" || h.Get("Accept-Language") != "de" || h.Get("User-Agent") != "Mozilla/5.0 (test)" {
+			t.Errorf("%s: expected the configured headers, got %v", path, h)
+		}
+	}
+	warcs, _ := filepath.Glob(filepath.Join(dir, "*.warc"))
+	if len(warcs) != 2 {
+		t.Fatalf("expected two WARC files, got %v", warcs)
+	}
+	if data, _ := os.ReadFile(warcs[0]); !strings.Contains(string(data), "User-Agent: Mozilla/5.0 (test)") {
+		t.Errorf("expected the WARC request record to carry the User-Agent, got %q", data)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	h, err := parseHeaders([]string{"X-Token: a:b", "accept:  text/html ", "X-Token: c"}, "bot/1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(h.Values("X-Token"), ",") != "a:b,c" || h.Get("Accept") != "text/html" || h.Get("User-Agent") != "bot/1.0" {
+		t.Errorf("unexpected headers %v", h)
+	}
+	for _, bad := range []string{"no-colon", ": empty", "Bad Name: x"} {
+		if _, err := parseHeaders([]string{bad}, ""); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestRunProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><head><title>Via Proxy</title></head><body><p>Fetched %s through the proxy.</p></body></html>", r.URL)
+	}))
+	defer proxy.Close()
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"--stdout", "--proxy", proxy.URL, "http://example.invalid/story"}, nil, stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "Fetched http://example.invalid/story through the proxy.") {
+		t.Errorf("expected the page from the proxy, got %q", stdout.String())
+	}
+
+	if err := run([]string{"--stdout", "--proxy", "ftp://proxy", "http://example.invalid/"}, nil, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "invalid --proxy") {
+		t.Errorf("expected invalid proxy error, got %v", err)
+	}
+}
+
+func TestRunArchiveFallback(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/wayback/available":
+			if strings.HasSuffix(r.URL.Query().Get("url"), "/gone") {
+				fmt.Fprintf(w, `{"archived_snapshots":{"closest":{"available":true,"url":"%s/web/20240101000000/%s"}}}`, ts.URL, r.URL.Query().Get("url"))
+			} else {
+				fmt.Fprint(w, `{"archived_snapshots":{}}`)
+			}
+		case strings.HasPrefix(r.URL.Path, "/web/20240101000000id_/"):
+			fmt.Fprint(w, "<html><head><title>Archived</title></head><body><p>The archived copy of the page.</p></body></html>")
+		case r.URL.Path == "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	historyPath := filepath.Join(dir, "history.db")
+	args := func(path string) []string {
+		return []string{"--output", dir, "--filename", "page", "--frontmatter", "--history", historyPath, "--archive-fallback", "--wayback-endpoint", ts.URL, ts.URL + path}
+	}
+
+	if err := run(args("/gone"), nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	markdown, _ := os.ReadFile(filepath.Join(dir, "page.md"))
+	capture := "archive_url: \"" + ts.URL + "/web/20240101000000/" + ts.URL + "/gone\""
+	for _, want := range []string{"The archived copy", "url: \"" + ts.URL + "/gone\"", capture} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("expected %q in:\n%s", want, markdown)
+		}
+	}
+	if entries, _ := history.Read(historyPath); len(entries) != 1 || !strings.HasPrefix(entries[0].Link, ts.URL+"/web/") {
+		t.Errorf("expected the capture in the history, got %+v", entries)
+	}
+
+	if err := run(args("/missing"), nil, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "no Wayback Machine capture") {
+		t.Errorf("expected a missing capture error, got %v", err)
+	}
+	if err := run(args("/bad"), nil, &bytes.Buffer{}); err == nil || strings.Contains(err.Error(), "Wayback") {
+		t.Errorf("expected a 400 to fail without a lookup, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// assetsDirName is the folder, next to the snapshot, that holds downloaded images.
+const assetsDirName = "assets"
+
+// imageOptions limits how localizeImages downloads.
+type imageOptions struct {
+	maxSize int64 // bytes per image; 0 means no limit
+	jobs    int   // downloads at once
+	verbose bool
+}
+
+// localizeImages downloads every image referenced by articleHTML into
+// outputDir/assets, opts.jobs at a time, and rewrites the <img> tags to point
+// at the local copies. Images that fail to download or are larger than
+// opts.maxSize keep their original URL.
+func localizeImages(web *fetcher, articleHTML string, base *url.URL, outputDir string, opts imageOptions) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(articleHTML))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse article HTML: %w", err)
+	}
+
+	imgs := doc.Find("img[src]")
+	srcs := make([]string, imgs.Length())
+	var unique []*url.URL
+	seen := make(map[string]bool)
+	imgs.Each(func(i int, s *goquery.Selection) {
+		src, err := base.Parse(s.AttrOr("src", ""))
+		if err != nil || (src.Scheme != "http" && src.Scheme != "https") {
+			return
+		}
+		srcs[i] = src.String()
+		if !seen[srcs[i]] {
+			seen[srcs[i]] = true
+			unique = append(unique, src)
+		}
+	})
+
+	assetsDir := filepath.Join(outputDir, assetsDirName)
+	var mu sync.Mutex
+	downloaded := make(map[string]string)
+	eachImage(unique, opts, func(src *url.URL) {
+		name, err := downloadImage(web, src, assetsDir, opts.maxSize)
+		if err != nil {
+			log.Printf("⚠️ Keeping remote image %s: %v", src, err)
+			return
+		}
+		mu.Lock()
+		downloaded[src.String()] = name
+		mu.Unlock()
+	})
+
+	imgs.Each(func(i int, s *goquery.Selection) {
+		name, ok := downloaded[srcs[i]]
+		if !ok {
+			return
+		}
+		s.SetAttr("src", path.Join(assetsDirName, name))
+		// srcset would point the reader straight back at the remote copies.
+		s.RemoveAttr("srcset")
+	})
+
+	html, err := doc.Find("body").Html()
+	if err != nil {
+		return "", fmt.Errorf("failed to render article HTML: %w", err)
+	}
+	return html, nil
+}
+
+// eachImage calls fn for every src, opts.jobs at a time.
+func eachImage(srcs []*url.URL, opts imageOptions, fn func(src *url.URL)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(opts.jobs, 1))
+	for _, src := range srcs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if opts.verbose {
+				log.Printf("🖼️ Downloading image: %s", src)
+			}
+			fn(src)
+		}()
+	}
+	wg.Wait()
+}
+
+// downloadImage saves src into dir and returns the file name fetchImage
+// picked for it.
+func downloadImage(web *fetcher, src *url.URL, dir string, maxSize int64) (string, error) {
+	data, name, err := fetchImage(web, src, maxSize)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create assets directory: %w", err)
+	}
+	return name, os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
+// fetchImage downloads src and names it by the hash of its URL, so repeated
+// snapshots of the same page reuse the same files. Images larger than
+// maxSize bytes are refused, by their Content-Length when the server sends
+// one.
+func fetchImage(web *fetcher, src *url.URL, maxSize int64) ([]byte, string, error) {
+	req, err := web.newRequest(src.String())
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := web.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, "", fmt.Errorf("larger than %d bytes", maxSize)
+	}
+
+	body := io.Reader(resp.Body)
+	if maxSize > 0 {
+		body = io.LimitReader(resp.Body, maxSize+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, "", fmt.Errorf("larger than %d bytes", maxSize)
+	}
+	return data, hashString(src.String()) + imageExt(src, resp.Header.Get("Content-Type")), nil
+}
+
+// parseSize parses an image size limit such as "500KB", "10MB" or "2M"
+// (1024-based); a plain number is bytes and "0" turns the limit off.
+func parseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := 1.0
+	for i, unit := range []string{"K", "M", "G"} {
+		if rest, ok := strings.CutSuffix(s, unit); ok {
+			s = rest
+			mult = float64(int64(1) << (10 * (i + 1)))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * mult), nil
+}
+
+// imageExts maps common image types to their conventional extension;
+// mime.ExtensionsByType would pick ".jfif" for JPEGs.
+var imageExts = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/avif":    ".avif",
+	"image/svg+xml": ".svg",
+}
+
+// imageExt picks a file extension from the URL path, falling back to the
+// response Content-Type.
+func imageExt(src *url.URL, contentType string) string {
+	if ext := strings.ToLower(path.Ext(src.Path)); ext != "" && len(ext) <= 5 {
+		return ext
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if ext, ok := imageExts[mediaType]; ok {
+			return ext
+		}
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ".img"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalizeImages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.png":
+			fmt.Fprint(w, "PNG")
+		case "/huge.png":
+			fmt.Fprint(w, "TOO BIG")
+		case "/photo":
+			w.Header().Set("Content-Type", "image/jpeg")
+			fmt.Fprint(w, "JPEG")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	base, _ := url.Parse(ts.URL + "/article")
+	outputDir := t.TempDir()
+	articleHTML := `<div><img src="/cat.png" srcset="/cat-2x.png 2x"><img src="/cat.png"><img src="/photo"><img src="/missing.gif"><img src="/huge.png"></div>`
+
+	html, err := localizeImages(newFetcher(nil, 0, 0, 10, 0), articleHTML, base, outputDir, imageOptions{maxSize: 4, jobs: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	catName := hashString(ts.URL+"/cat.png") + ".png"
+	photoName := hashString(ts.URL+"/photo") + ".jpg"
+
+	if strings.Count(html, `src="assets/`+catName+`"`) != 2 {
+		t.Errorf("expected both cat images to be rewritten, got %s", html)
+	}
+	if !strings.Contains(html, `src="assets/`+photoName+`"`) {
+		t.Errorf("expected photo to use Content-Type extension, got %s", html)
+	}
+	if strings.Contains(html, "srcset") {
+		t.Errorf("expected srcset to be dropped, got %s", html)
+	}
+	if !strings.Contains(html, `src="/missing.gif"`) {
+		t.Errorf("expected failed download to keep its original src, got %s", html)
+	}
+	if !strings.Contains(html, `src="/huge.png"`) {
+		t.Errorf("expected image over the size limit to keep its original src, got %s", html)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, assetsDirName, hashString(ts.URL+"/huge.png")+".png")); err == nil {
+		t.Error("expected no file for the image over the size limit")
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, assetsDirName, catName))
+	if err != nil || string(data) != "PNG" {
+		t.Errorf("expected downloaded image on disk, got %q (%v)", data, err)
+	}
+}
+
+func TestImageExt(t *testing.T) {
+	tests := []struct {
+		rawURL      string
+		contentType string
+		expected    string
+	}{
+		{"https://x.com/a/b.PNG", "", ".png"},
+		{"https://x.com/a/b", "image/webp", ".webp"},
+		{"https://x.com/a/b", "image/jpeg; charset=binary", ".jpg"},
+		{"https://x.com/a/b", "", ".img"},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.rawURL)
+		if actual := imageExt(u, tt.contentType); actual != tt.expected {
+			t.Errorf("imageExt(%q, %q) = %q, want %q", tt.rawURL, tt.contentType, actual, tt.expected)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"0": 0, "1024": 1024, "500KB": 500 << 10, "10MB": 10 << 20, "1.5M": 3 << 19, "2GiB": 2 << 30}
+	for value, expected := range tests {
+		if actual, err := parseSize(value); err != nil || actual != expected {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", value, actual, err, expected)
+		}
+	}
+	for _, value := range []string{"", "big", "-1MB"} {
+		if _, err := parseSize(value); err == nil {
+			t.Errorf("parseSize(%q): expected an error", value)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"flag"
 	"fmt"
+	htmltemplate "html/template"
 	"io"
 	"log"
 	"net/http"
@@ -11,27 +12,91 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
-	readability "codeberg.org/readeck/go-readability/v2"
-	md "github.com/JohannesKaufmann/html-to-markdown"
+	"browser-pipes/internal/history"
+	"browser-pipes/internal/proxy"
+	"browser-pipes/internal/urlhash"
+	"browser-pipes/internal/wayback"
+	"browser-pipes/pkg/readmd"
 )
 
 func main() {
 	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(reportError(os.Stderr, err))
 	}
 }
 
-func run(args []string, stdin io.Reader, stdout io.Writer) error {
+func run(args []string, stdin io.Reader, stdout io.Writer) (err error) {
 	fs := flag.NewFlagSet("go-read-md", flag.ContinueOnError)
-	outputDir := fs.String("output", "", "Output directory for markdown files (required)")
+	outputDir := fs.String("output", "", "Output directory for markdown files (required unless --stdout)")
+	toStdout := fs.Bool("stdout", false, "Print the converted document to stdout instead of saving it (one of md, org, html, json)")
 	filenameOverride := fs.String("filename", "", "Explicit filename to use (optional)")
-	inputHTML := fs.String("input", "", "Input HTML file (optional, if hyphen '-' reads from stdin)")
+	filenameTemplate := fs.String("filename-template", "", "Filename pattern with {date}, {time}, {domain}, {title}, {url_hash} (or {hash}); may contain / for subfolders")
+	inputHTML := fs.String("input", "", "Input HTML file (optional, if hyphen '-' reads from stdin; empty fetches the URL)")
 	sourceURL := fs.String("url", "", "Source URL for metadata (required if not a positional argument)")
 	verbose := fs.Bool("verbose", false, "Enable verbose logging")
+	formats := fs.String("format", "md", "Comma-separated output formats: md, org, html, json, epub, warc, png")
+	warcSubresources := fs.Bool("warc-subresources", false, "Also archive images, stylesheets and scripts in WARC output")
+	browser := fs.String("browser", "", "Chromium-based browser used for png screenshots (default: first found in PATH)")
+	screenshotTimeout := fs.Duration("screenshot-timeout", 30*time.Second, "Maximum time to load and capture a png screenshot")
+	tags := fs.String("tags", "", "Comma-separated tags recorded with the snapshot")
+	index := fs.Bool("index", false, "Maintain index.json and index.html in the output directory")
+	historyFile := fs.String("history", "", "Append the snapshot to this history file (e.g. plumber's << parameters.history_file >>)")
+	keepHTML := fs.Bool("keep-html", false, "Also save the page as fetched, as <name>.source.html, to convert it again later with --input")
+	keepArticleHTML := fs.Bool("keep-article-html", false, "Also save the extracted article HTML as <name>.article.html")
+	downloadImages := fs.Bool("download-images", false, "Download article images into an assets/ folder and link them locally")
+	maxImageSize := fs.String("max-image-size", "10MB", "Largest image --download-images saves (e.g. 500KB or 10MB; 0 for no limit); larger ones stay remote")
+	imageJobs := fs.Int("image-jobs", 4, "Number of images --download-images fetches at once")
+	dedup := fs.String("dedup", "", "When --history (or else the --index catalog) already has this URL or content: skip, overwrite or version")
+	onConflict := fs.String("on-conflict", dedupOverwrite, "When a file with the snapshot's name already exists: skip, overwrite or version")
+	mdTemplate := fs.String("template", "", "Go text/template file for the markdown layout (default: built-in)")
+	htmlTemplate := fs.String("html-template", "", "Go html/template file for the html format (default: built-in)")
+	markdownPlugins := fs.String("markdown-plugins", "", "Comma-separated GitHub Flavored Markdown extensions: tables, strikethrough, task-lists, footnotes, or gfm for all")
+	codeFence := fs.String("code-fence", "backticks", "Markdown code block fence: backticks (```) or tildes (~~~)")
+	flavor := fs.String("flavor", flavorCommonMark, "Markdown flavor: commonmark, or obsidian for [[#heading]] wikilinks, ![[image]] embeds, callouts and a #tags line")
+	frontmatter := fs.Bool("frontmatter", false, "Start markdown with YAML frontmatter instead of the bold metadata block")
+	timeout := fs.Duration("timeout", time.Minute, "Maximum time for each HTTP request, including reading the response (0 for none)")
+	retries := fs.Int("retries", 2, "Times a fetch is retried after a network error, 429 or 5xx response")
+	maxRedirects := fs.Int("max-redirects", 10, "Maximum redirects followed per request")
+	maxSize := fs.String("max-size", "50MB", "Largest page or subresource fetched (e.g. 500KB or 50MB; 0 for no limit)")
+	proxyURL := fs.String("proxy", "", "Proxy for every fetch: http://, https://, socks5:// or socks5h:// (default: HTTP_PROXY, HTTPS_PROXY or ALL_PROXY)")
+	var headers stringList
+	fs.Var(&headers, "header", "Extra \"Name: value\" HTTP header sent with every fetch (repeatable)")
+	userAgent := fs.String("user-agent", "", "User-Agent sent with every fetch (default: Go's)")
+	cookies := fs.String("cookies", "", "Netscape cookies.txt file sent with fetches, for pages behind a login")
+	minChars := fs.Int("min-chars", 0, "Minimum article length before readability retries with looser rules (default: 500)")
+	topCandidates := fs.Int("top-candidates", 0, "Number of top-scoring content candidates readability compares (default: 5)")
+	keepClasses := fs.Bool("keep-classes", false, "Keep class attributes in the extracted article")
+	preserveClasses := fs.String("preserve-classes", "", "Comma-separated class attributes kept even without --keep-classes")
+	preserve := fs.String("preserve", "", "Comma-separated elements protected from readability cleanup: tables, figures, images")
+	debugReadability := fs.Bool("debug-readability", false, "Log readability candidate scoring and removed elements to stderr")
+	contentSelector := fs.String("content-selector", "", "CSS selector for the article body, used instead of readability when it matches")
+	archiveFallback := fs.Bool("archive-fallback", false, "When the page is gone (404, 410, paywall status, timeout), snapshot its latest Wayback Machine capture instead")
+	waybackEndpoint := fs.String("wayback-endpoint", wayback.Endpoint, "Wayback Machine availability API base URL for --archive-fallback")
+	noReadability := fs.Bool("no-readability", false, "Convert the whole page body instead of the article readability extracts (--content-selector still wins)")
+	titleSelector := fs.String("title-selector", "", "CSS selector for the article title")
+	authorSelector := fs.String("author-selector", "", "CSS selector for the article author")
+	encryptTo := fs.String("encrypt-to", "", "Comma-separated age recipients (age1... or SSH public keys); snapshot files are written encrypted as .age")
+	encryptToFile := fs.String("encrypt-to-file", "", "File of age recipients, one per line (like age -R)")
+	batch := fs.String("batch", "", "File listing URLs to convert, one per line (- for stdin); every other flag applies to each")
+	feed := fs.String("feed", "", "RSS or Atom feed whose entries are converted like a --batch list")
+	feedSince := fs.String("since", "", "Only convert --feed entries published since a date (2006-01-02) or age (7d, 36h)")
+	feedLimit := fs.Int("limit", 0, "Convert at most this many --feed entries, newest first (0: all)")
+	crawl := fs.String("crawl", "", "Start page of a site or section whose linked pages are converted like a --batch list, with --index")
+	sameHost := fs.Bool("same-host", true, "Keep --crawl on the start page's host and under its folder")
+	sitemap := fs.String("sitemap", "", "Sitemap or sitemap index whose pages are converted like a --batch list, with --index")
+	maxPages := fs.Int("max-pages", 100, "Convert at most this many --crawl or --sitemap pages")
+	jobs := fs.Int("jobs", 4, "Number of URLs --batch, --feed, --crawl and --sitemap convert at once")
+	delay := fs.Duration("delay", 0, "Wait between requests of --batch, --feed, --crawl and --sitemap (1s for --crawl and --sitemap unless set)")
+	canonical := fs.Bool("canonical", true, "Record the page's canonical URL (<link rel=canonical> or og:url) in the snapshot, history and dedup keys, keeping --url as original_url")
+	jsonErrors := fs.Bool("json-errors", false, "Report a failure on stderr as a JSON object (error, kind, exit_code, url, status, failed) instead of text")
+
+	// The stage run fails in picks the exit code (see exit.go).
+	stage, stageURL := exitUsage, ""
+	defer func() { err = classify(err, stage, stageURL, *jsonErrors) }()
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: go-read-md [flags] [url]\n\n")
@@ -40,7 +105,12 @@ func run(args []string, stdin io.Reader, stdout io.Writer) error {
 		fmt.Fprintf(os.Stderr, "Examples:\n")
 		fmt.Fprintf(os.Stderr, "  go-read-md --output ./read http://example.com\n")
 		fmt.Fprintf(os.Stderr, "  cat page.html | go-read-md --output ./read --url http://example.com\n")
-		fmt.Fprintf(os.Stderr, "  go-read-md --output ./read --input page.html --url http://example.com\n\n")
+		fmt.Fprintf(os.Stderr, "  go-read-md --output ./read --input page.html --url http://example.com\n")
+		fmt.Fprintf(os.Stderr, "  go-read-md --output ./read --format md,warc http://example.com\n")
+		fmt.Fprintf(os.Stderr, "  go-read-md --output ./read --batch links.txt --jobs 8\n")
+		fmt.Fprintf(os.Stderr, "  go-read-md --output ./blog --feed https://example.com/feed.xml --since 7d\n")
+		fmt.Fprintf(os.Stderr, "  go-read-md --output ./docs --crawl https://example.com/docs/ --max-pages 50\n")
+		fmt.Fprintf(os.Stderr, "  go-read-md --stdout http://example.com | glow\n\n")
 		fmt.Fprintf(os.Stderr, "Flags:\n")
 		fs.PrintDefaults()
 	}
@@ -49,10 +119,94 @@ func run(args []string, stdin io.Reader, stdout io.Writer) error {
 		return err
 	}
 
-	if *outputDir == "" {
+	if *outputDir == "" && !*toStdout {
 		return fmt.Errorf("--output directory is required")
 	}
 
+	maxBody, err := parseSize(*maxSize)
+	if err != nil {
+		return fmt.Errorf("invalid --max-size: %w", err)
+	}
+	var jar http.CookieJar
+	if *cookies != "" {
+		if jar, err = loadCookieJar(*cookies); err != nil {
+			return err
+		}
+	}
+	web := newFetcher(jar, *timeout, *retries, *maxRedirects, maxBody)
+	if web.client.Transport, err = proxy.Transport(*proxyURL); err != nil {
+		return fmt.Errorf("invalid --proxy: %w", err)
+	}
+	if web.header, err = parseHeaders(headers, *userAgent); err != nil {
+		return err
+	}
+
+	var source string
+	for _, name := range []string{"batch", "feed", "crawl", "sitemap"} {
+		if fs.Lookup(name).Value.String() == "" {
+			continue
+		}
+		if source != "" {
+			return fmt.Errorf("--%s cannot be combined with --%s", name, source)
+		}
+		source = name
+	}
+	if source != "" {
+		if *toStdout {
+			return fmt.Errorf("--stdout cannot be combined with --%s", source)
+		}
+		if err := checkBatchFlags(fs, source, *jobs); err != nil {
+			return err
+		}
+		wait := *delay
+		delaySet := false
+		fs.Visit(func(f *flag.Flag) { delaySet = delaySet || f.Name == "delay" })
+		var urls []string
+		switch source {
+		case "feed":
+			since, err := history.ParseSince(*feedSince, time.Now())
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			stage, stageURL = exitFetch, *feed
+			if urls, err = feedURLs(web, *feed, since, *feedLimit); err != nil {
+				return err
+			}
+			if len(urls) == 0 {
+				fmt.Fprintf(stdout, "📭 No feed entries to convert\n")
+				return nil
+			}
+		case "crawl", "sitemap":
+			if *maxPages < 1 {
+				return fmt.Errorf("--max-pages must be at least 1")
+			}
+			if !delaySet {
+				wait = crawlDelay
+			}
+			stage, stageURL = exitFetch, fs.Lookup(source).Value.String()
+			if source == "crawl" {
+				urls, err = crawlURLs(web, *crawl, *sameHost, *maxPages, wait)
+			} else {
+				urls, err = sitemapURLs(web, *sitemap, *maxPages, wait)
+			}
+			if err != nil {
+				return err
+			}
+			if len(urls) == 0 {
+				fmt.Fprintf(stdout, "📭 No pages to convert\n")
+				return nil
+			}
+			// The pages are a site of their own; the catalog is its table of
+			// contents.
+			fs.Set("index", "true")
+		default:
+			if urls, err = loadURLList(*batch, stdin); err != nil {
+				return err
+			}
+		}
+		return runBatch(fs, urls, *jobs, wait, stdout)
+	}
+
 	targetURL := *sourceURL
 	if targetURL == "" && fs.NArg() > 0 {
 		targetURL = fs.Arg(0)
@@ -68,9 +222,96 @@ func run(args []string, stdin io.Reader, stdout io.Writer) error {
 		return fmt.Errorf("invalid URL: %s", targetURL)
 	}
 
+	outputFormats, err := parseFormats(*formats)
+	if err != nil {
+		return err
+	}
+
+	if *toStdout {
+		if len(outputFormats) != 1 || !slices.Contains([]string{"md", "org", "html", "json"}, outputFormats[0]) {
+			return fmt.Errorf("--stdout prints a single md, org, html or json document")
+		}
+		// Everything these flags do happens on disk, next to the file
+		// --stdout does not write.
+		for _, conflict := range []struct {
+			flag string
+			set  bool
+		}{
+			{"index", *index},
+			{"history", *historyFile != ""},
+			{"dedup", *dedup != ""},
+			{"on-conflict", *onConflict != dedupOverwrite},
+			{"download-images", *downloadImages},
+			{"keep-html", *keepHTML},
+			{"keep-article-html", *keepArticleHTML},
+			{"encrypt-to", *encryptTo != "" || *encryptToFile != ""},
+		} {
+			if conflict.set {
+				return fmt.Errorf("--stdout cannot be combined with --%s", conflict.flag)
+			}
+		}
+	}
+
+	markdownOpts := readmd.MarkdownOptions{CodeFence: *codeFence}
+	if markdownOpts.Plugins, err = readmd.ParseMarkdownPlugins(*markdownPlugins); err != nil {
+		return err
+	}
+	if !slices.Contains(readmd.CodeFences, *codeFence) {
+		return fmt.Errorf("invalid --code-fence %q (use %s)", *codeFence, strings.Join(readmd.CodeFences, ", "))
+	}
+
+	if !validFlavor(*flavor) {
+		return fmt.Errorf("invalid --flavor %q (use commonmark or obsidian)", *flavor)
+	}
+
+	if !validDedupPolicy(*dedup) {
+		return fmt.Errorf("invalid --dedup policy %q (use skip, overwrite or version)", *dedup)
+	}
+	if *onConflict == "" {
+		*onConflict = dedupOverwrite
+	}
+	if !validDedupPolicy(*onConflict) {
+		return fmt.Errorf("invalid --on-conflict policy %q (use skip, overwrite or version)", *onConflict)
+	}
+	if *dedup != "" && *historyFile == "" && !*index {
+		return fmt.Errorf("--dedup requires --history or --index")
+	}
+
+	extract := readmd.Options{
+		MinChars:        *minChars,
+		TopCandidates:   *topCandidates,
+		KeepClasses:     *keepClasses,
+		PreserveClasses: parseTags(*preserveClasses),
+		Debug:           *debugReadability,
+	}
+	if extract.Preserve, err = readmd.ParsePreserve(*preserve); err != nil {
+		return err
+	}
+
+	images := imageOptions{jobs: *imageJobs, verbose: *verbose}
+	if images.maxSize, err = parseSize(*maxImageSize); err != nil {
+		return fmt.Errorf("invalid --max-image-size: %w", err)
+	}
+
+	enc := encrypter{recipients: parseTags(*encryptTo), recipientsFile: *encryptToFile}
+	if enc.enabled() {
+		if *index {
+			log.Printf("⚠️ Skipping --index: it would list titles and URLs in plaintext next to the encrypted snapshots")
+			*index = false
+		}
+		if err := enc.check(); err != nil {
+			return err
+		}
+	}
+
+	templates, err := loadTemplates(*mdTemplate, *htmlTemplate, *frontmatter)
+	if err != nil {
+		return err
+	}
+
 	// Get HTML content
-	var htmlReader io.Reader
-	var closer io.Closer
+	stage, stageURL = exitFetch, targetURL
+	var page *fetchResult
 
 	// Decide input source
 	if *inputHTML != "" {
@@ -78,14 +319,19 @@ func run(args []string, stdin io.Reader, stdout io.Writer) error {
 			if stdin == nil {
 				return fmt.Errorf("stdin is required but not available")
 			}
-			htmlReader = stdin
+			if page, err = readPage(stdin); err != nil {
+				return fmt.Errorf("failed to read stdin: %w", err)
+			}
 		} else {
 			f, err := os.Open(*inputHTML)
 			if err != nil {
 				return fmt.Errorf("failed to open input file: %w", err)
 			}
-			htmlReader = f
-			closer = f
+			page, err = readPage(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("failed to read input file: %w", err)
+			}
 		}
 	} else {
 		// Check if we should read from stdin (auto-detection)
@@ -106,66 +352,112 @@ func run(args []string, stdin io.Reader, stdout io.Writer) error {
 			if *verbose {
 				log.Println("📥 Reading from Stdin...")
 			}
-			htmlReader = stdin
+			if page, err = readPage(stdin); err != nil {
+				return fmt.Errorf("failed to read stdin: %w", err)
+			}
 		} else {
 			// Fetch URL
 			if *verbose {
 				log.Printf("🔍 Fetching: %s", targetURL)
 			}
-			resp, err := http.Get(targetURL)
-			if err != nil {
-				return fmt.Errorf("failed to fetch URL: %w", err)
-			}
-			if resp.StatusCode != http.StatusOK {
-				resp.Body.Close()
-				return fmt.Errorf("HTTP error: %s", resp.Status)
+			if page, err = web.fetch(targetURL, hasFormat(outputFormats, "warc")); err != nil {
+				if !*archiveFallback || !gone(err) {
+					return err
+				}
+				log.Printf("⚠️ %v, looking for a Wayback Machine capture", err)
+				capture, lookupErr := wayback.Closest(web.client, *waybackEndpoint, targetURL)
+				if lookupErr != nil {
+					return fmt.Errorf("%w (Wayback Machine lookup failed: %v)", err, lookupErr)
+				}
+				if capture == "" {
+					return fmt.Errorf("%w (no Wayback Machine capture)", err)
+				}
+				log.Printf("🏛️ Using capture %s", capture)
+				if page, err = web.fetch(wayback.Raw(capture), hasFormat(outputFormats, "warc")); err != nil {
+					return fmt.Errorf("failed to fetch Wayback Machine capture: %w", err)
+				}
+				page.capture = capture
 			}
-			htmlReader = resp.Body
-			closer = resp.Body
 		}
 	}
 
-	if closer != nil {
-		defer closer.Close()
-	}
+	stage = exitExtract
 
-	// Parse with go-readability
-	article, err := readability.FromReader(htmlReader, parsedURL)
+	// Parse with go-readability. The archive formats keep the page as it
+	// came; everything parsed from it sees UTF-8.
+	body := readmd.DecodeHTML(page.body, page.contentType)
+	article, err := readmd.Extract(body, parsedURL, extract)
 	if err != nil {
 		return fmt.Errorf("failed to parse article: %w", err)
 	}
 
-	if *verbose {
-		log.Printf("📄 Title: %s", article.Title())
-		log.Printf("👤 Author: %s", article.Byline())
-		pubTime, _ := article.PublishedTime()
-		log.Printf("📅 Published: %s", pubTime.Format(time.RFC3339))
+	var match siteMatch
+	// Without readability the whole body is the article; metadata still
+	// comes from readability and the selectors.
+	rule := siteRule{content: *contentSelector, title: *titleSelector, author: *authorSelector}
+	if *noReadability && rule.content == "" {
+		rule.content = "body"
 	}
-
-	// Convert HTML to Markdown
-	var htmlBuf strings.Builder
-	if err := article.RenderHTML(&htmlBuf); err != nil {
-		return fmt.Errorf("failed to render HTML: %w", err)
+	if !rule.empty() {
+		if match, err = applySiteRule(body, parsedURL, rule); err != nil {
+			return err
+		}
+		if match.content != nil {
+			article.Node = match.content
+			if *verbose {
+				log.Printf("🎯 Extracted content with %s", rule.content)
+			}
+		} else if rule.content != "" {
+			log.Printf("⚠️ %s matched nothing, falling back to readability", rule.content)
+		}
 	}
 
-	converter := md.NewConverter("", true, nil)
-	markdown, err := converter.ConvertString(htmlBuf.String())
+	textHash, err := contentHash(article)
 	if err != nil {
-		return fmt.Errorf("failed to convert to markdown: %w", err)
+		return err
+	}
+
+	// The page is still fetched, resolved and archived as targetURL; the
+	// canonical URL is what the snapshot is recorded under.
+	recordURL := targetURL
+	if *canonical {
+		if c := canonicalURL(body, parsedURL); c != "" && c != targetURL {
+			recordURL = c
+			if *verbose {
+				log.Printf("🔗 Canonical URL: %s", recordURL)
+			}
+		}
+	}
+
+	saved := time.Now()
+	data := newSnapshotData(article, recordURL, parseTags(*tags), textHash, saved)
+	if recordURL != targetURL {
+		data.OriginalURL = targetURL
 	}
+	data.ArchiveURL = page.capture
+	match.apply(&data)
+	data.Lang = readmd.Language(body, article)
 
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(*outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	if *verbose {
+		log.Printf("📄 Title: %s", data.Title)
+		log.Printf("👤 Author: %s", data.Byline)
+		log.Printf("📅 Published: %s", data.Published.Format(time.RFC3339))
 	}
 
-	// Generate filename
+	stage = exitWrite
+
+	// Generate filename, relative to dir
+	dir := *outputDir
 	var filename string
 	if *filenameOverride != "" {
-		filename = *filenameOverride
+		filename = trimFormatExt(*filenameOverride)
+	} else if *filenameTemplate != "" {
+		if filename, err = expandFilenameTemplate(*filenameTemplate, parsedURL, data); err != nil {
+			return err
+		}
 	} else {
-		titleHash := hashString(targetURL)
-		filename = sanitizeFilename(article.Title())
+		titleHash := hashString(recordURL)
+		filename = sanitizeFilename(data.Title)
 		if filename == "" {
 			filename = fmt.Sprintf("article_%s", titleHash)
 		} else {
@@ -173,36 +465,301 @@ func run(args []string, stdin io.Reader, stdout io.Writer) error {
 		}
 	}
 
-	if !strings.HasSuffix(filename, ".md") {
-		filename += ".md"
+	// The kept HTML copies are saved like formats, as <name>.<kind>.
+	kinds := slices.Clone(outputFormats)
+	if *keepHTML {
+		kinds = append(kinds, "source.html")
+	}
+	if *keepArticleHTML {
+		kinds = append(kinds, "article.html")
 	}
 
-	outputPath := filepath.Join(*outputDir, filename)
+	replacing := false
+	if *dedup != "" {
+		// The same article under another URL (a syndicated copy, a print
+		// view) matches by its content hash.
+		var prev string
+		if *historyFile != "" {
+			entries, err := dedupCandidates(*historyFile, textHash, recordURL, targetURL)
+			if err != nil {
+				return err
+			}
+			if e := previousSnapshot(entries, textHash, recordURL, targetURL); e != nil {
+				prev = e.Files[0]
+			}
+		} else {
+			c, err := loadCatalog(*outputDir)
+			if err != nil {
+				return fmt.Errorf("failed to read index: %w", err)
+			}
+			prev = c.previous(*outputDir, textHash, recordURL, targetURL)
+		}
+		if prev != "" {
+			switch *dedup {
+			case dedupSkip:
+				fmt.Fprintf(stdout, "⏭️ Already saved: %s\n", prev)
+				return nil
+			case dedupOverwrite:
+				dir, filename = snapshotBase(prev)
+				replacing = true
+				if *verbose {
+					log.Printf("♻️ Overwriting previous snapshot: %s", prev)
+				}
+			case dedupVersion:
+				filename += "_" + saved.Format("20060102-150405")
+			}
+		}
+	}
+
+	// A file of the same name that --dedup did not pick to replace is
+	// another page's snapshot, or this one saved without history.
+	if !replacing && !*toStdout && *onConflict != dedupOverwrite {
+		if existing := existingSnapshot(dir, filename, kinds, enc.enabled()); existing != "" {
+			switch *onConflict {
+			case dedupSkip:
+				fmt.Fprintf(stdout, "⏭️ Already exists: %s\n", existing)
+				return nil
+			case dedupVersion:
+				filename += "_" + saved.Format("20060102-150405")
+				if *verbose {
+					log.Printf("🗂️ %s exists, saving a new version", existing)
+				}
+			}
+		}
+	}
+
+	// Create output directory if it doesn't exist. Assets go next to the
+	// snapshot so relative image links keep working in subfolders.
+	fileDir := filepath.Join(dir, filepath.Dir(filename))
+	if !*toStdout {
+		if err := os.MkdirAll(fileDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	var htmlBuf strings.Builder
+	if err := article.RenderHTML(&htmlBuf); err != nil {
+		return fmt.Errorf("failed to render HTML: %w", err)
+	}
+	contentHTML := htmlBuf.String()
+
+	// Encrypted snapshots are staged outside the output folder: images,
+	// WARC and PNG files are written there and only their .age copies land
+	// in the output folder.
+	workDir := fileDir
+	if enc.enabled() && !*toStdout {
+		if workDir, err = os.MkdirTemp("", "go-read-md-*"); err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		defer os.RemoveAll(workDir)
+	}
+
+	if *downloadImages {
+		if contentHTML, err = localizeImages(web, contentHTML, parsedURL, workDir, images); err != nil {
+			return err
+		}
+	}
+
+	files := make(map[string]string)
+	var savedPaths []string
+	for _, format := range kinds {
+		outputPath := filepath.Join(dir, filename+"."+format)
+		writePath := outputPath
+		if workDir != fileDir {
+			writePath = filepath.Join(workDir, filepath.Base(outputPath))
+		}
+
+		// Text formats are rendered into doc and written below; the
+		// archive formats write their own files.
+		var doc []byte
+		switch format {
+		case "md":
+			if data.Markdown, err = convertMarkdown(contentHTML, markdownOpts, *flavor, data.Tags); err != nil {
+				return err
+			}
+			markdown, err := templates.renderMarkdown(data)
+			if err != nil {
+				return err
+			}
+			doc = []byte(markdown)
+		case "org":
+			if data.Org, err = convertOrg(contentHTML); err != nil {
+				return err
+			}
+			org, err := templates.renderOrg(data)
+			if err != nil {
+				return err
+			}
+			doc = []byte(org)
+		case "html":
+			data.Content = htmltemplate.HTML(contentHTML)
+			htmlDoc, err := templates.renderHTML(data)
+			if err != nil {
+				return err
+			}
+			doc = []byte(htmlDoc)
+		case "json":
+			if data.Markdown == "" {
+				if data.Markdown, err = convertMarkdown(contentHTML, markdownOpts, *flavor, data.Tags); err != nil {
+					return err
+				}
+			}
+			if doc, err = renderJSON(data, article, contentHTML); err != nil {
+				return err
+			}
+		case "epub":
+			if doc, err = renderEPUB(web, data, contentHTML, parsedURL, workDir, images); err != nil {
+				return err
+			}
+		case "source.html":
+			doc = page.body
+		case "article.html":
+			doc = []byte(contentHTML)
+		case "warc":
+			if err := writeWARC(web, writePath, page, parsedURL, *warcSubresources, *verbose); err != nil {
+				return err
+			}
+		case "png":
+			if *verbose {
+				log.Println("📸 Capturing full-page screenshot...")
+			}
+			if err := writeScreenshot(writePath, page, targetURL, *browser, *screenshotTimeout); err != nil {
+				return err
+			}
+		}
+
+		if doc != nil {
+			if *toStdout {
+				if _, err := stdout.Write(doc); err != nil {
+					return fmt.Errorf("failed to write to stdout: %w", err)
+				}
+				return nil
+			}
+			if enc.enabled() {
+				if outputPath, err = enc.encrypt(bytes.NewReader(doc), outputPath); err != nil {
+					return err
+				}
+			} else if err := os.WriteFile(outputPath, doc, 0644); err != nil {
+				return fmt.Errorf("failed to write file: %w", err)
+			}
+		} else if enc.enabled() {
+			if outputPath, err = enc.encryptFile(writePath, outputPath); err != nil {
+				return err
+			}
+		}
 
-	// Build the full markdown document
-	var fullMarkdown strings.Builder
-	fullMarkdown.WriteString(fmt.Sprintf("# %s\n\n", article.Title()))
-	if article.Byline() != "" {
-		fullMarkdown.WriteString(fmt.Sprintf("**Author:** %s\n\n", article.Byline()))
+		files[format] = filepath.ToSlash(filename + "." + format)
+		savedPaths = append(savedPaths, outputPath)
+		fmt.Fprintf(stdout, "✅ Saved to: %s\n", outputPath)
 	}
-	pubTime, err := article.PublishedTime()
-	if err == nil && !pubTime.IsZero() {
-		fullMarkdown.WriteString(fmt.Sprintf("**Published:** %s\n\n", pubTime.Format(time.RFC3339)))
+
+	if enc.enabled() && *downloadImages {
+		if err := enc.encryptAssets(contentHTML, workDir, fileDir); err != nil {
+			return err
+		}
 	}
-	fullMarkdown.WriteString(fmt.Sprintf("**Source:** [%s](%s)\n\n", targetURL, targetURL))
-	fullMarkdown.WriteString(fmt.Sprintf("**Saved:** %s\n\n", time.Now().Format(time.RFC3339)))
-	fullMarkdown.WriteString("---\n\n")
-	fullMarkdown.WriteString(markdown)
 
-	// Write to file
-	if err := os.WriteFile(outputPath, []byte(fullMarkdown.String()), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	if *historyFile != "" {
+		for i, p := range savedPaths {
+			if abs, err := filepath.Abs(p); err == nil {
+				savedPaths[i] = abs
+			}
+		}
+		err := history.Append(*historyFile, history.Entry{
+			Kind:        history.KindSnapshot,
+			URL:         recordURL,
+			Hash:        hashString(recordURL),
+			OriginalURL: data.OriginalURL,
+			Link:        data.ArchiveURL,
+			Status:      history.StatusSuccess,
+			Title:       data.Title,
+			Files:       savedPaths,
+			ContentHash: textHash,
+			Lang:        data.Lang,
+			Tags:        data.Tags,
+		})
+		if err != nil {
+			// The snapshot is already on disk; losing the log line is not fatal.
+			log.Printf("⚠️ Failed to record history: %v", err)
+		}
+	}
+
+	if *index {
+		entry := CatalogEntry{
+			Title:       data.Title,
+			URL:         recordURL,
+			Saved:       saved,
+			Tags:        data.Tags,
+			Files:       files,
+			ContentHash: textHash,
+		}
+		if err := updateCatalog(dir, entry); err != nil {
+			return fmt.Errorf("failed to update index: %w", err)
+		}
+		if *verbose {
+			log.Printf("🗂️ Updated index in %s", dir)
+		}
 	}
 
-	fmt.Fprintf(stdout, "✅ Saved to: %s\n", outputPath)
 	return nil
 }
 
+// supportedFormats lists the output formats in the order they are written.
+var supportedFormats = []string{"md", "org", "html", "json", "epub", "warc", "png"}
+
+// parseFormats parses the comma-separated --format value.
+func parseFormats(value string) ([]string, error) {
+	var formats []string
+	for _, f := range strings.Split(value, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" || hasFormat(formats, f) {
+			continue
+		}
+		if !hasFormat(supportedFormats, f) {
+			return nil, fmt.Errorf("unsupported format %q (supported: %s)", f, strings.Join(supportedFormats, ", "))
+		}
+		formats = append(formats, f)
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("at least one --format is required")
+	}
+	return formats, nil
+}
+
+func hasFormat(formats []string, format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// trimFormatExt strips a known format extension from an explicit filename so
+// "--filename note.md" yields "note.md" rather than "note.md.md".
+func trimFormatExt(filename string) string {
+	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
+	if hasFormat(supportedFormats, ext) {
+		return strings.TrimSuffix(filename, "."+ext)
+	}
+	return filename
+}
+
+// parseTags splits a comma-separated tag list, dropping blanks and duplicates.
+func parseTags(value string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(value, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	return tags
+}
+
 // sanitizeFilename creates a safe filename from a title
 func sanitizeFilename(title string) string {
 	reg := regexp.MustCompile(`[<>:"/\\|?*]`)
@@ -218,7 +775,5 @@ func sanitizeFilename(title string) string {
 }
 
 func hashString(s string) string {
-	h := sha256.New()
-	h.Write([]byte(s))
-	return fmt.Sprintf("%x", h.Sum(nil))[:8]
+	return urlhash.Short(s)
 }
@@ -9,6 +9,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"browser-pipes/internal/history"
+	"golang.org/x/text/encoding/japanese"
 )
 
 func TestRun(t *testing.T) {
@@ -76,6 +79,383 @@ func TestRun(t *testing.T) {
 		}
 	})
 
+	t.Run("Success: Shift-JIS Page", func(t *testing.T) {
+		page, _ := japanese.ShiftJIS.NewEncoder().String("<html><head><title>記事</title></head><body><p>日本語の本文です。</p></body></html>")
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=Shift_JIS")
+			fmt.Fprint(w, page)
+		}))
+		defer ts.Close()
+
+		stdout := &bytes.Buffer{}
+		if err := run([]string{"--stdout", ts.URL}, nil, stdout); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(stdout.String(), "# 記事") || !strings.Contains(stdout.String(), "日本語の本文です。") {
+			t.Errorf("expected the page transcoded to UTF-8, got %q", stdout.String())
+		}
+	})
+
+	t.Run("Success: Keep HTML", func(t *testing.T) {
+		page := `<html><head><title>Kept</title></head><body><nav>Menu</nav><article><p>The article to convert again later.</p></article></body></html>`
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, page)
+		}))
+		defer ts.Close()
+
+		outputDir := filepath.Join(baseTmpDir, "keep-html")
+		stdout := &bytes.Buffer{}
+		err := run([]string{"--output", outputDir, "--filename", "page", "--keep-html", "--keep-article-html", "--index", ts.URL}, nil, stdout)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if source, _ := os.ReadFile(filepath.Join(outputDir, "page.source.html")); string(source) != page {
+			t.Errorf("expected the page as fetched, got %q", source)
+		}
+		article, _ := os.ReadFile(filepath.Join(outputDir, "page.article.html"))
+		if !strings.Contains(string(article), "The article to convert again later.") || strings.Contains(string(article), "<html") {
+			t.Errorf("expected the extracted article HTML, got %q", article)
+		}
+		if strings.Count(stdout.String(), "✅ Saved to:") != 3 {
+			t.Errorf("expected three saved files, got %q", stdout.String())
+		}
+		if c, _ := loadCatalog(outputDir); len(c.Snapshots) != 1 || c.Snapshots[0].Files["source.html"] != "page.source.html" {
+			t.Errorf("expected the source in the catalog, got %+v", c.Snapshots)
+		}
+
+		// The kept page converts again without the server.
+		stdout.Reset()
+		if err := run([]string{"--stdout", "--url", ts.URL, "--input", filepath.Join(outputDir, "page.source.html")}, nil, stdout); err != nil || !strings.Contains(stdout.String(), "The article to convert again later.") {
+			t.Errorf("expected the kept page to convert again, got %q (%v)", stdout.String(), err)
+		}
+	})
+
+	t.Run("Success: WARC Format", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/logo.png" {
+				w.Header().Set("Content-Type", "image/png")
+				fmt.Fprint(w, "PNGDATA")
+				return
+			}
+			fmt.Fprint(w, `<html><body><h1>Archived</h1><article><p>Worth keeping forever.</p><img src="/logo.png"></article></body></html>`)
+		}))
+		defer ts.Close()
+
+		outputDir := filepath.Join(baseTmpDir, "warc")
+		stdout := &bytes.Buffer{}
+		err := run([]string{"--output", outputDir, "--filename", "page.md", "--format", "md,warc", "--warc-subresources", ts.URL}, nil, stdout)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(outputDir, "page.md")); err != nil {
+			t.Errorf("expected markdown output: %v", err)
+		}
+		warc, err := os.ReadFile(filepath.Join(outputDir, "page.warc"))
+		if err != nil {
+			t.Fatalf("expected WARC output: %v", err)
+		}
+		for _, want := range []string{"WARC-Type: warcinfo", "WARC-Type: request", "Worth keeping forever.", "WARC-Target-URI: " + ts.URL + "/logo.png", "PNGDATA"} {
+			if !strings.Contains(string(warc), want) {
+				t.Errorf("expected %q in WARC file", want)
+			}
+		}
+	})
+
+	t.Run("Success: WARC From Stdin", func(t *testing.T) {
+		stdin := strings.NewReader("<html><body><h1>Saved</h1><p>Seen in the browser.</p></body></html>")
+		outputDir := filepath.Join(baseTmpDir, "warc-stdin")
+		err := run([]string{"--output", outputDir, "--url", "http://test.com", "--filename", "page", "--format", "warc", "--input", "-"}, stdin, ioDiscard())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		warc, _ := os.ReadFile(filepath.Join(outputDir, "page.warc"))
+		if !strings.Contains(string(warc), "WARC-Type: resource") {
+			t.Errorf("expected resource record for stdin input, got %q", warc)
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, "page.md")); err == nil {
+			t.Error("markdown should not be written when only warc is requested")
+		}
+	})
+
+	t.Run("Success: HTML Format With Template", func(t *testing.T) {
+		stdin := strings.NewReader("<html><head><title>Styled</title></head><body><p>Styled content here.</p></body></html>")
+		outputDir := filepath.Join(baseTmpDir, "html")
+		tmpl := filepath.Join(baseTmpDir, "note.tmpl")
+		os.WriteFile(tmpl, []byte("title: {{.Title}}\n\n{{.Markdown}}"), 0644)
+
+		err := run([]string{"--output", outputDir, "--url", "http://test.com", "--filename", "page", "--format", "md,html", "--template", tmpl, "--input", "-"}, stdin, ioDiscard())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		markdown, _ := os.ReadFile(filepath.Join(outputDir, "page.md"))
+		if !strings.HasPrefix(string(markdown), "title: Styled\n\n") {
+			t.Errorf("expected custom markdown layout, got %q", markdown)
+		}
+		html, _ := os.ReadFile(filepath.Join(outputDir, "page.html"))
+		if !strings.Contains(string(html), "Styled content here.") {
+			t.Errorf("expected article in HTML output, got %q", html)
+		}
+	})
+
+	t.Run("Success: Filename Template", func(t *testing.T) {
+		stdin := strings.NewReader(`<html><head><title>Nested</title></head><body><p>Nested content here.</p></body></html>`)
+		outputDir := filepath.Join(baseTmpDir, "filename-template")
+		err := run([]string{"--output", outputDir, "--url", "http://www.test.com/a", "--filename-template", "{domain}/{title}", "--index", "--input", "-"}, stdin, ioDiscard())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(outputDir, "test.com", "Nested.md")); err != nil {
+			t.Errorf("expected snapshot in domain folder: %v", err)
+		}
+		c, _ := loadCatalog(outputDir)
+		if len(c.Snapshots) != 1 || c.Snapshots[0].Files["md"] != "test.com/Nested.md" {
+			t.Errorf("expected catalog at the output root, got %+v", c.Snapshots)
+		}
+	})
+
+	t.Run("Success: Index", func(t *testing.T) {
+		stdin := strings.NewReader("<html><head><title>Indexed</title></head><body><p>Indexed content here.</p></body></html>")
+		outputDir := filepath.Join(baseTmpDir, "index")
+		err := run([]string{"--output", outputDir, "--url", "http://test.com", "--tags", "a,b", "--index", "--input", "-"}, stdin, ioDiscard())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		c, err := loadCatalog(outputDir)
+		if err != nil || len(c.Snapshots) != 1 {
+			t.Fatalf("expected one catalog entry, got %+v (%v)", c, err)
+		}
+		if e := c.Snapshots[0]; e.URL != "http://test.com" || len(e.Tags) != 2 || e.Files["md"] == "" {
+			t.Errorf("unexpected catalog entry %+v", e)
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, catalogHTML)); err != nil {
+			t.Errorf("expected index.html: %v", err)
+		}
+	})
+
+	t.Run("Success: Site Rule", func(t *testing.T) {
+		stdin := strings.NewReader(`<html><head><title>Site | Wrong</title></head><body><h2 class="hl">Right Title</h2><span class="by">Jane Doe</span><div class="body"><p>Only this part.</p></div><aside><p>Not this part, even though it is much longer than the body above.</p></aside></body></html>`)
+		outputDir := filepath.Join(baseTmpDir, "site-rule")
+		err := run([]string{"--output", outputDir, "--url", "http://test.com", "--filename", "page", "--frontmatter", "--content-selector", "div.body", "--title-selector", ".hl", "--author-selector", ".by", "--input", "-"}, stdin, ioDiscard())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		markdown, _ := os.ReadFile(filepath.Join(outputDir, "page.md"))
+		for _, want := range []string{`title: "Right Title"`, `author: "Jane Doe"`, "Only this part."} {
+			if !strings.Contains(string(markdown), want) {
+				t.Errorf("expected %q in %q", want, markdown)
+			}
+		}
+		if strings.Contains(string(markdown), "Not this part") {
+			t.Errorf("expected only the selected content, got %q", markdown)
+		}
+	})
+
+	t.Run("Success: No Readability", func(t *testing.T) {
+		page := `<html><head><title>Changelog</title><script>var x;</script></head><body><nav><a href="/docs">Docs</a></nav><article><p>A long introduction that readability is happy to keep as the article, since it is the only prose on this page.</p></article><table><tr><td>v1.2</td><td>Fixed</td></tr></table></body></html>`
+		outputDir := filepath.Join(baseTmpDir, "no-readability")
+		if err := run([]string{"--output", outputDir, "--url", "http://test.com", "--filename", "page", "--no-readability", "--input", "-"}, strings.NewReader(page), ioDiscard()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		markdown, _ := os.ReadFile(filepath.Join(outputDir, "page.md"))
+		for _, want := range []string{"# Changelog", "[Docs](http://test.com/docs)", "A long introduction", "v1.2"} {
+			if !strings.Contains(string(markdown), want) {
+				t.Errorf("expected %q in %q", want, markdown)
+			}
+		}
+		if strings.Contains(string(markdown), "var x") {
+			t.Errorf("expected no scripts, got %q", markdown)
+		}
+	})
+
+	t.Run("Success: History", func(t *testing.T) {
+		stdin := strings.NewReader("<html><head><title>Logged</title></head><body><p>Logged content here.</p></body></html>")
+		outputDir := filepath.Join(baseTmpDir, "history")
+		historyPath := filepath.Join(baseTmpDir, "history.db")
+		err := run([]string{"--output", outputDir, "--url", "http://test.com", "--history", historyPath, "--input", "-"}, stdin, ioDiscard())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		entries, err := history.Read(historyPath)
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("expected one history entry, got %v (%v)", entries, err)
+		}
+		e := entries[0]
+		if e.Kind != history.KindSnapshot || e.URL != "http://test.com" || e.Hash != hashString("http://test.com") || len(e.Files) != 1 || !filepath.IsAbs(e.Files[0]) {
+			t.Errorf("unexpected history entry %+v", e)
+		}
+	})
+
+	t.Run("Success: Canonical URL", func(t *testing.T) {
+		page := `<html><head><title>Story</title><link rel="canonical" href="/news/story"></head><body><p>The story itself.</p></body></html>`
+		outputDir := filepath.Join(baseTmpDir, "canonical")
+		historyPath := filepath.Join(baseTmpDir, "canonical.jsonl")
+		args := []string{"--output", outputDir, "--url", "http://test.com/news/story?share=1", "--filename", "story", "--frontmatter", "--history", historyPath, "--dedup", "skip", "--input", "-"}
+		if err := run(args, strings.NewReader(page), ioDiscard()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		markdown, _ := os.ReadFile(filepath.Join(outputDir, "story.md"))
+		for _, want := range []string{`url: "http://test.com/news/story"`, `original_url: "http://test.com/news/story?share=1"`} {
+			if !strings.Contains(string(markdown), want) {
+				t.Errorf("expected %q in %q", want, markdown)
+			}
+		}
+		entries, _ := history.Read(historyPath)
+		if len(entries) != 1 || entries[0].URL != "http://test.com/news/story" || entries[0].OriginalURL != "http://test.com/news/story?share=1" {
+			t.Fatalf("expected the canonical URL in the history, got %+v", entries)
+		}
+
+		// Another copy of the article dedupes against the canonical URL.
+		stdout := &bytes.Buffer{}
+		other := `<html><head><title>Story</title><meta property="og:url" content="http://test.com/news/story"></head><body><p>The story, edited.</p></body></html>`
+		args = []string{"--output", outputDir, "--url", "http://m.test.com/news/story", "--history", historyPath, "--dedup", "skip", "--input", "-"}
+		if err := run(args, strings.NewReader(other), stdout); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(stdout.String(), "⏭️ Already saved:") {
+			t.Errorf("expected skip for the same canonical URL, got %q", stdout.String())
+		}
+	})
+
+	t.Run("Success: Conflict Policies", func(t *testing.T) {
+		outputDir := filepath.Join(baseTmpDir, "conflict")
+		save := func(body, policy string) string {
+			stdout := &bytes.Buffer{}
+			page := "<html><head><title>Page</title></head><body><p>" + body + "</p></body></html>"
+			args := []string{"--output", outputDir, "--url", "http://test.com", "--filename", "page", "--on-conflict", policy, "--input", "-"}
+			if err := run(args, strings.NewReader(page), stdout); err != nil {
+				t.Fatalf("on-conflict %s: %v", policy, err)
+			}
+			return stdout.String()
+		}
+
+		save("First version of the page.", "skip")
+		if out := save("Second version of the page.", "skip"); !strings.Contains(out, "⏭️ Already exists:") {
+			t.Errorf("expected skip for an existing file, got %q", out)
+		}
+		if markdown, _ := os.ReadFile(filepath.Join(outputDir, "page.md")); !strings.Contains(string(markdown), "First version") {
+			t.Errorf("expected skip to keep the file, got %q", markdown)
+		}
+
+		save("Third version of the page.", "version")
+		if files, _ := os.ReadDir(outputDir); len(files) != 2 {
+			t.Errorf("expected a new dated version, got %d files", len(files))
+		}
+
+		save("Fourth version of the page.", "overwrite")
+		if markdown, _ := os.ReadFile(filepath.Join(outputDir, "page.md")); !strings.Contains(string(markdown), "Fourth version") {
+			t.Errorf("expected overwrite to replace the file, got %q", markdown)
+		}
+	})
+
+	t.Run("Success: Dedup Policies", func(t *testing.T) {
+		page := "<html><head><title>Same</title></head><body><p>Identical article body text.</p></body></html>"
+		outputDir := filepath.Join(baseTmpDir, "dedup")
+		historyPath := filepath.Join(baseTmpDir, "dedup.jsonl")
+		save := func(rawURL, policy string) string {
+			stdout := &bytes.Buffer{}
+			args := []string{"--output", outputDir, "--url", rawURL, "--history", historyPath, "--dedup", policy, "--input", "-"}
+			if err := run(args, strings.NewReader(page), stdout); err != nil {
+				t.Fatalf("dedup %s: %v", policy, err)
+			}
+			return stdout.String()
+		}
+
+		save("http://test.com/a", "skip")
+		if out := save("http://test.com/a", "skip"); !strings.Contains(out, "⏭️ Already saved:") {
+			t.Errorf("expected skip for same URL, got %q", out)
+		}
+		if out := save("http://mirror.com/a", "skip"); !strings.Contains(out, "⏭️ Already saved:") {
+			t.Errorf("expected skip for same content, got %q", out)
+		}
+
+		save("http://test.com/a", "overwrite")
+		if files, _ := os.ReadDir(outputDir); len(files) != 1 {
+			t.Errorf("expected overwrite to reuse the file, got %d files", len(files))
+		}
+
+		save("http://test.com/a", "version")
+		if files, _ := os.ReadDir(outputDir); len(files) != 2 {
+			t.Errorf("expected a new dated version, got %d files", len(files))
+		}
+	})
+
+	t.Run("Success: Dedup Against Index", func(t *testing.T) {
+		outputDir := filepath.Join(baseTmpDir, "dedup-index")
+		save := func(rawURL, body string) string {
+			stdout := &bytes.Buffer{}
+			page := "<html><head><title>Syndicated</title></head><body><p>" + body + "</p></body></html>"
+			args := []string{"--output", outputDir, "--url", rawURL, "--index", "--dedup", "skip", "--input", "-"}
+			if err := run(args, strings.NewReader(page), stdout); err != nil {
+				t.Fatalf("dedup %s: %v", rawURL, err)
+			}
+			return stdout.String()
+		}
+
+		first := save("http://blog.com/post", "The same post, published twice.")
+		if out := save("http://aggregator.com/copy", "The same post, published twice."); !strings.Contains(out, "⏭️ Already saved: "+strings.TrimSpace(strings.TrimPrefix(first, "✅ Saved to: "))) {
+			t.Errorf("expected the syndicated copy to report the original file, got %q", out)
+		}
+		if out := save("http://aggregator.com/other", "A different post."); !strings.Contains(out, "✅ Saved to:") {
+			t.Errorf("expected different content to be saved, got %q", out)
+		}
+	})
+
+	t.Run("Success: Stdout", func(t *testing.T) {
+		stdin := strings.NewReader("<html><head><title>Piped</title></head><body><p>Piped content here.</p></body></html>")
+		wd, _ := os.Getwd()
+		stdout := &bytes.Buffer{}
+		err := run([]string{"--stdout", "--url", "http://test.com", "--input", "-"}, stdin, stdout)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !strings.Contains(stdout.String(), "# Piped") || !strings.Contains(stdout.String(), "Piped content here.") || strings.Contains(stdout.String(), "✅") {
+			t.Errorf("expected only the markdown on stdout, got %q", stdout.String())
+		}
+		if files, _ := filepath.Glob(filepath.Join(wd, "Piped*")); len(files) != 0 {
+			t.Errorf("expected no file written, got %v", files)
+		}
+	})
+
+	t.Run("Error: Stdout Conflicts", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--stdout", "--format", "md,html"},
+			{"--stdout", "--format", "png"},
+			{"--stdout", "--index"},
+			{"--stdout", "--keep-html"},
+			{"--stdout", "--batch", "-"},
+		} {
+			err := run(append(args, "http://example.com"), nil, ioDiscard())
+			if err == nil || !strings.Contains(err.Error(), "--stdout") {
+				t.Errorf("%v: expected --stdout error, got %v", args, err)
+			}
+		}
+	})
+
+	t.Run("Error: Dedup Without History", func(t *testing.T) {
+		err := run([]string{"--output", baseTmpDir, "--dedup", "skip", "http://example.com"}, nil, ioDiscard())
+		if err == nil || !strings.Contains(err.Error(), "--dedup requires --history or --index") {
+			t.Errorf("expected missing history error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Unsupported Format", func(t *testing.T) {
+		err := run([]string{"--output", baseTmpDir, "--format", "docx", "http://example.com"}, nil, ioDiscard())
+		if err == nil || !strings.Contains(err.Error(), "unsupported format") {
+			t.Errorf("expected unsupported format error, got %v", err)
+		}
+	})
+
 	t.Run("Error: Missing Output Dir", func(t *testing.T) {
 		err := run([]string{"http://example.com"}, nil, ioDiscard())
 		if err == nil || !strings.Contains(err.Error(), "--output directory is required") {
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+
+	"browser-pipes/pkg/readmd"
+)
+
+// Markdown flavors accepted by --flavor.
+const (
+	flavorCommonMark = "commonmark"
+	flavorObsidian   = "obsidian"
+)
+
+func validFlavor(flavor string) bool {
+	return flavor == flavorCommonMark || flavor == flavorObsidian
+}
+
+// convertMarkdown converts the article HTML into markdown of the given
+// flavor. The obsidian flavor also starts the body with a line of #tags.
+func convertMarkdown(contentHTML string, opts readmd.MarkdownOptions, flavor string, tags []string) (string, error) {
+	if flavor != flavorObsidian {
+		return readmd.Markdown(contentHTML, opts)
+	}
+	opts.Rules = append(opts.Rules, obsidianRules...)
+	markdown, err := readmd.Markdown(contentHTML, opts)
+	if err != nil {
+		return "", err
+	}
+	if line := obsidianTags(tags); line != "" {
+		markdown = line + "\n\n" + markdown
+	}
+	return markdown, nil
+}
+
+// obsidianRules turn links to the article's own headings into [[#Heading]]
+// wikilinks, downloaded images into ![[assets/...]] embeds, and blockquotes
+// that start with a marker such as "Note:" or [!tip] into callouts.
+var obsidianRules = []md.Rule{
+	{
+		Filter: []string{"a"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			frag, ok := strings.CutPrefix(selec.AttrOr("href", ""), "#")
+			if !ok || frag == "" || strings.ContainsAny(frag, `"\`) {
+				return nil
+			}
+			target := selec.Parents().Last().Find(`[id="` + frag + `"], a[name="` + frag + `"]`).First()
+			if !target.Is("h1, h2, h3, h4, h5, h6") {
+				target = target.ParentsFiltered("h1, h2, h3, h4, h5, h6").First()
+			}
+			heading := obsidianLinkText(target.Text())
+			if heading == "" {
+				return nil
+			}
+			text := obsidianLinkText(selec.Text())
+			link := "[[#" + heading + "]]"
+			if text != "" && text != heading {
+				link = "[[#" + heading + "|" + text + "]]"
+			}
+			return &link
+		},
+	},
+	{
+		Filter: []string{"img"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			// Only files in the vault can be embedded; remote images stay links.
+			src := selec.AttrOr("src", "")
+			if !strings.HasPrefix(src, assetsDirName+"/") {
+				return nil
+			}
+			embed := "![[" + src + "]]"
+			return &embed
+		},
+	},
+	{
+		Filter: []string{"blockquote"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			content = blankLines.ReplaceAllString(strings.TrimSpace(content), "\n\n")
+			m := calloutMarker.FindStringSubmatch(content)
+			if m == nil {
+				return nil
+			}
+			kind := strings.ToLower(m[1] + m[2])
+			lines := []string{"> [!" + kind + "]"}
+			for _, line := range strings.Split(strings.TrimSpace(content[len(m[0]):]), "\n") {
+				lines = append(lines, strings.TrimRight("> "+line, " "))
+			}
+			callout := "\n\n" + strings.Join(lines, "\n") + "\n\n"
+			return &callout
+		},
+	},
+}
+
+// calloutMarker matches the start of a blockquote that reads as a callout:
+// a GitHub-style [!type] (escaped by the converter), or a known type as a bold or colon-ended label.
+var calloutMarker = regexp.MustCompile(`(?i)^(?:\\?\[!(\w+)\\?\]|(?:\*\*|__)?(note|tip|info|hint|important|warning|caution|danger|example|todo)(?:(?:\*\*|__):?|:(?:\*\*|__)?))[ \t]*`)
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// obsidianLinkText drops the characters Obsidian does not allow in a link
+// target or its alias.
+func obsidianLinkText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune("#|[]^", r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// obsidianTags renders tags as Obsidian #tags, which allow letters, digits,
+// _, - and / but no spaces and not only digits.
+func obsidianTags(tags []string) string {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-/", r) {
+				return r
+			}
+			return '-'
+		}, tag)
+		if strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			tag = "_" + tag
+		}
+		out = append(out, "#"+tag)
+	}
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"browser-pipes/pkg/readmd"
+)
+
+func TestConvertMarkdownObsidian(t *testing.T) {
+	contentHTML := `<div>
+<h2 id="setup">Setup [v2]</h2>
+<p>See <a href="#setup">Setup [v2]</a>, <a href="#usage">how to use it</a>, <a href="#para">this</a> and <a href="https://example.com/">the site</a>.</p>
+<h2><a name="usage"></a>Usage</h2>
+<p id="para"><img src="assets/1a2b3c4d.png" alt="local"> <img src="https://example.com/remote.png" alt="remote"></p>
+<blockquote><p><strong>Warning:</strong> Back up first.</p><p>Really.</p></blockquote>
+<blockquote><p>[!tip] Use the flag.</p></blockquote>
+<blockquote><p>Just a quote.</p></blockquote>
+</div>`
+
+	markdown, err := convertMarkdown(contentHTML, readmd.MarkdownOptions{}, flavorObsidian, []string{"go lang", "2024", "dev/tools"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#go-lang #_2024 #dev/tools\n\n",
+		"See [[#Setup v2]], [[#Usage|how to use it]], [this](#para) and [the site](https://example.com/).",
+		"![[assets/1a2b3c4d.png]]",
+		"![remote](https://example.com/remote.png)",
+		"> [!warning]\n> Back up first.\n>\n> Really.",
+		"> [!tip]\n> Use the flag.",
+		"> Just a quote.",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("expected %q in:\n%s", want, markdown)
+		}
+	}
+	if !strings.HasPrefix(markdown, "#go-lang") {
+		t.Errorf("expected the tag line first, got %q", markdown)
+	}
+
+	plain, err := convertMarkdown(contentHTML, readmd.MarkdownOptions{}, flavorCommonMark, []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain, "[[") || strings.Contains(plain, "[!warning]") || strings.Contains(plain, "#go") {
+		t.Errorf("expected plain markdown without the obsidian flavor, got:\n%s", plain)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// orgBlockTags are the elements convertOrg lays out as blocks; everything
+// else is inline text.
+var orgBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "dd": true, "details": true,
+	"div": true, "dl": true, "dt": true, "figcaption": true, "figure": true, "footer": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true, "pre": true,
+	"section": true, "summary": true, "table": true, "ul": true,
+}
+
+// orgSkipTags hold nothing worth converting.
+var orgSkipTags = map[string]bool{"script": true, "style": true, "noscript": true, "template": true}
+
+var orgSpace = regexp.MustCompile(`\s+`)
+
+// convertOrg converts the extracted article HTML into Org syntax: headings,
+// paragraphs with emphasis and [[links]], plain and numbered lists, quote
+// and source blocks, and tables. The metadata around it comes from the org
+// template.
+func convertOrg(contentHTML string) (string, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(contentHTML), body)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert to org: %w", err)
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	var out strings.Builder
+	orgBlocks(&out, body)
+	return strings.TrimSpace(out.String()) + "\n", nil
+}
+
+// orgBlocks writes the children of n, gathering runs of inline content
+// into paragraphs.
+func orgBlocks(out *strings.Builder, n *html.Node) {
+	var para strings.Builder
+	flush := func() {
+		var lines []string
+		for _, line := range strings.Split(para.String(), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, orgEscapeLine(line))
+			}
+		}
+		if len(lines) > 0 {
+			out.WriteString(strings.Join(lines, "\n") + "\n\n")
+		}
+		para.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && orgBlockTags[c.Data] {
+			flush()
+			orgBlock(out, c)
+		} else {
+			para.WriteString(orgInline(c))
+		}
+	}
+	flush()
+}
+
+func orgBlock(out *strings.Builder, n *html.Node) {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if text := orgLine(orgInline(n)); text != "" {
+			fmt.Fprintf(out, "%s %s\n\n", strings.Repeat("*", int(n.Data[1]-'0')), text)
+		}
+	case "pre":
+		block := "#+BEGIN_SRC"
+		if lang := codeLanguage(n); lang != "" {
+			block += " " + lang
+		}
+		out.WriteString(block + "\n")
+		for _, line := range strings.Split(strings.Trim(textContent(n), "\n"), "\n") {
+			// Lines that Org would read as headings or keywords are
+			// escaped with a comma.
+			if strings.HasPrefix(line, "*") || strings.HasPrefix(line, "#+") || strings.HasPrefix(line, ",*") || strings.HasPrefix(line, ",#+") {
+				line = "," + line
+			}
+			out.WriteString(line + "\n")
+		}
+		out.WriteString("#+END_SRC\n\n")
+	case "blockquote":
+		out.WriteString("#+BEGIN_QUOTE\n")
+		var inner strings.Builder
+		orgBlocks(&inner, n)
+		out.WriteString(strings.TrimSpace(inner.String()) + "\n#+END_QUOTE\n\n")
+	case "ul", "ol":
+		orgList(out, n)
+		out.WriteString("\n")
+	case "table":
+		orgTable(out, n)
+	case "hr":
+		out.WriteString("-----\n\n")
+	default:
+		orgBlocks(out, n)
+	}
+}
+
+// orgList writes the items of a list, with nested lists and continuation
+// lines indented under their item.
+func orgList(out *strings.Builder, n *html.Node) {
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = start
+	}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		var item strings.Builder
+		orgBlocks(&item, li)
+		first := true
+		for _, line := range strings.Split(strings.TrimSpace(item.String()), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if first {
+				out.WriteString(marker + line + "\n")
+				first = false
+			} else {
+				out.WriteString(strings.Repeat(" ", len(marker)) + line + "\n")
+			}
+		}
+		if first {
+			out.WriteString(strings.TrimSpace(marker) + "\n")
+		}
+	}
+}
+
+// orgTable writes a table row by row, with a rule under a header row.
+func orgTable(out *strings.Builder, n *html.Node) {
+	var rows [][]string
+	header := false
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "tr":
+				var cells []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						if cell.Data == "th" && len(rows) == 0 {
+							header = true
+						}
+						cells = append(cells, strings.ReplaceAll(orgLine(orgInline(cell)), "|", `\vert{}`))
+					}
+				}
+				rows = append(rows, cells)
+			case "table":
+				// Nested tables are flattened into their cell.
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	for i, cells := range rows {
+		out.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 && header && len(rows) > 1 {
+			out.WriteString("|" + strings.Repeat("---+", max(len(cells), 1)-1) + "---|\n")
+		}
+	}
+	if len(rows) > 0 {
+		out.WriteString("\n")
+	}
+}
+
+// orgInline renders inline content. Line breaks stay as "\\" and a newline.
+func orgInline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return orgSpace.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	if orgSkipTags[n.Data] {
+		return ""
+	}
+
+	switch n.Data {
+	case "br":
+		return "\\\\\n"
+	case "img":
+		if src := attr(n, "src"); src != "" {
+			return "[[" + orgLinkTarget(src) + "]]"
+		}
+		return ""
+	case "code", "kbd", "samp", "tt":
+		return orgEmphasis("~", orgSpace.ReplaceAllString(textContent(n), " "))
+	}
+
+	var inner strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		inner.WriteString(orgInline(c))
+	}
+	text := inner.String()
+	switch n.Data {
+	case "strong", "b":
+		return orgEmphasis("*", text)
+	case "em", "i", "cite":
+		return orgEmphasis("/", text)
+	case "del", "s", "strike":
+		return orgEmphasis("+", text)
+	case "u", "ins":
+		return orgEmphasis("_", text)
+	case "a":
+		href := attr(n, "href")
+		desc := strings.TrimSpace(text)
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+			return text
+		}
+		if strings.Contains(desc, "[[") {
+			return text // an image link keeps the image
+		}
+		if desc == "" || desc == href {
+			return "[[" + orgLinkTarget(href) + "]]"
+		}
+		desc = strings.NewReplacer("[", "(", "]", ")").Replace(desc)
+		return "[[" + orgLinkTarget(href) + "][" + desc + "]]"
+	}
+	return text
+}
+
+// orgEmphasis wraps text in an Org emphasis marker, which must touch the
+// text, keeping the spaces around it outside.
+func orgEmphasis(marker, text string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// orgLinkTarget escapes the brackets that would end an Org link.
+func orgLinkTarget(target string) string {
+	return strings.NewReplacer("[", "%5B", "]", "%5D", " ", "%20").Replace(target)
+}
+
+// orgLine joins inline content onto one line, for headings and cells.
+func orgLine(text string) string {
+	return strings.TrimSpace(orgSpace.ReplaceAllString(strings.ReplaceAll(text, "\\\\\n", " "), " "))
+}
+
+// orgEscapeLine keeps a paragraph line that starts like a heading, a
+// comment, a keyword or a list item from being read as one, with the zero
+// width space the Org manual recommends.
+func orgEscapeLine(line string) string {
+	for _, prefix := range []string{"*", "#", "- ", "+ "} {
+		if strings.HasPrefix(line, prefix) {
+			return "\u200b" + line
+		}
+	}
+	return line
+}
+
+// codeLanguage reads the language of a code block from a "language-go" or
+// "lang-go" class on the pre or its code element.
+func codeLanguage(pre *html.Node) string {
+	classes := attr(pre, "class")
+	for c := pre.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "code" {
+			classes += " " + attr(c, "class")
+		}
+	}
+	for _, class := range strings.Fields(classes) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if lang, ok := strings.CutPrefix(class, prefix); ok && lang != "" {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+// orgTime renders t as an inactive Org timestamp.
+func orgTime(t time.Time) string {
+	return t.Format("[2006-01-02 Mon 15:04]")
+}
+
+// orgTags renders tags as Org filetags, which only allow letters, digits,
+// _, @, # and %.
+func orgTags(tags []string) string {
+	var clean []string
+	for _, tag := range tags {
+		tag = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_@#%", r) {
+				return r
+			}
+			return '_'
+		}, tag)
+		clean = append(clean, tag)
+	}
+	return ":" + strings.Join(clean, ":") + ":"
+}
+
+// orgValue puts a value on a single keyword or property line.
+func orgValue(s string) string {
+	return strings.TrimSpace(orgSpace.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertOrg(t *testing.T) {
+	in := `<div><h2>Intro</h2><p>Some <strong>bold</strong>, <em>italic </em>and <code>x := 1</code> text
+with a <a href="https://example.com/a[1]">link [here]</a> and <a href="https://go.dev/">https://go.dev/</a>.</p>
+<p>* not a heading<br>second line</p>
+<ul><li>one</li><li>two<ol start="3"><li>three</li></ol></li></ul>
+<blockquote><p>Quoted.</p></blockquote>
+<pre><code class="language-go">func main() {
+* pointer
+}</code></pre>
+<table><thead><tr><th>Key</th><th>Value</th></tr></thead><tbody><tr><td>a|b</td><td><img src="https://example.com/i.png"></td></tr></tbody></table>
+<script>alert(1)</script><hr></div>`
+	want := `** Intro
+
+Some *bold*, /italic/ and ~x := 1~ text with a [[https://example.com/a%5B1%5D][link (here)]] and [[https://go.dev/]].
+
+` + "\u200b" + `* not a heading\\
+second line
+
+- one
+- two
+  3. three
+
+#+BEGIN_QUOTE
+Quoted.
+#+END_QUOTE
+
+#+BEGIN_SRC go
+func main() {
+,* pointer
+}
+#+END_SRC
+
+| Key | Value |
+|---+---|
+| a\vert{}b | [[https://example.com/i.png]] |
+
+-----
+`
+	got, err := convertOrg(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("unexpected org:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOrgTemplate(t *testing.T) {
+	tmpl, err := loadTemplates("", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tmpl.renderOrg(snapshotData{
+		Title:   "Go:\nthe language",
+		Byline:  "Ann",
+		URL:     "https://example.com/go",
+		URLHash: "abcd1234",
+		Saved:   time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Tags:    []string{"go", "read later"},
+		Org:     "Body.\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `:PROPERTIES:
+:URL: https://example.com/go
+:AUTHOR: Ann
+:SAVED: [2025-03-01 Sat 12:00]
+:HASH: abcd1234
+:END:
+#+title: Go: the language
+#+author: Ann
+#+date: [2025-03-01 Sat 12:00]
+#+filetags: :go:read_later:
+
+Body.
+`
+	if out != want {
+		t.Errorf("unexpected org document:\n%s", out)
+	}
+}
+
+func TestRunOrgFormat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><head><title>Org Page</title></head><body><article><h2>Section</h2><p>"+strings.Repeat("Words for the article body. ", 30)+"</p></article></body></html>")
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	if err := run([]string{"--output", dir, "--format", "md,org", "--filename", "page", ts.URL}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "page.org"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{":URL: " + ts.URL, "#+title: Org Page", "\n** Section\n", "Words for the article body."} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in:\n%s", want, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "page.md")); err != nil {
+		t.Errorf("expected the markdown snapshot too: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// headlessBrowsers are tried in order when --browser is not given.
+var headlessBrowsers = []string{
+	"chromium", "chromium-browser", "google-chrome", "google-chrome-stable",
+	"brave-browser", "microsoft-edge",
+}
+
+// findHeadlessBrowser resolves the browser binary used for screenshots.
+func findHeadlessBrowser(explicit string) (string, error) {
+	if explicit != "" {
+		return exec.LookPath(explicit)
+	}
+	for _, name := range headlessBrowsers {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no Chromium-based browser found in PATH (tried %s); set --browser", strings.Join(headlessBrowsers, ", "))
+}
+
+// takeScreenshot launches a throwaway headless browser, loads pageURL and
+// returns a PNG of the whole page, not just the first viewport.
+func takeScreenshot(browser, pageURL string, timeout time.Duration) ([]byte, error) {
+	profile, err := os.MkdirTemp("", "go-read-md-browser-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser profile: %w", err)
+	}
+	defer os.RemoveAll(profile)
+
+	cmd := exec.Command(browser,
+		"--headless=new",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--no-first-run",
+		"--window-size=1280,800",
+		"--remote-debugging-port=0",
+		"--remote-allow-origins=*",
+		"--user-data-dir="+profile,
+		"about:blank",
+	)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start browser: %w", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	deadline := time.Now().Add(timeout)
+	port, err := waitDevToolsPort(profile, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	wsURL, err := pageTarget(fmt.Sprintf("http://127.0.0.1:%s", port))
+	if err != nil {
+		return nil, err
+	}
+	return captureFullPage(wsURL, pageURL, deadline)
+}
+
+// waitDevToolsPort waits for the browser to announce its debugging port in
+// the DevToolsActivePort file of its profile.
+func waitDevToolsPort(profile string, deadline time.Time) (string, error) {
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(filepath.Join(profile, "DevToolsActivePort"))
+		if err == nil {
+			if port, _, _ := strings.Cut(string(data), "\n"); port != "" {
+				return strings.TrimSpace(port), nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return "", fmt.Errorf("timed out waiting for browser DevTools")
+}
+
+// pageTarget returns the WebSocket debugger URL of the first open page.
+func pageTarget(devtoolsURL string) (string, error) {
+	resp, err := http.Get(devtoolsURL + "/json/list")
+	if err != nil {
+		return "", fmt.Errorf("failed to list browser targets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var targets []struct {
+		Type                 string `json:"type"`
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
+		return "", fmt.Errorf("failed to decode browser targets: %w", err)
+	}
+	for _, t := range targets {
+		if t.Type == "page" && t.WebSocketDebuggerURL != "" {
+			return t.WebSocketDebuggerURL, nil
+		}
+	}
+	return "", fmt.Errorf("browser has no open page")
+}
+
+// cdpMessage is a Chrome DevTools Protocol command, response or event.
+type cdpMessage struct {
+	ID     int             `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params any             `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// cdpConn is a minimal DevTools Protocol client: one command in flight at a
+// time, with events remembered so they can be awaited after the fact.
+type cdpConn struct {
+	ws     *websocket.Conn
+	nextID int
+	seen   map[string]bool
+}
+
+func (c *cdpConn) call(method string, params any, result any) error {
+	c.nextID++
+	id := c.nextID
+	if err := websocket.JSON.Send(c.ws, cdpMessage{ID: id, Method: method, Params: params}); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	for {
+		var msg cdpMessage
+		if err := websocket.JSON.Receive(c.ws, &msg); err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		if msg.ID != id {
+			c.seen[msg.Method] = true
+			continue
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	}
+}
+
+func (c *cdpConn) waitEvent(method string) error {
+	for !c.seen[method] {
+		var msg cdpMessage
+		if err := websocket.JSON.Receive(c.ws, &msg); err != nil {
+			return fmt.Errorf("waiting for %s: %w", method, err)
+		}
+		c.seen[msg.Method] = true
+	}
+	return nil
+}
+
+// captureFullPage navigates the page behind wsURL to pageURL and captures it
+// at its full content size.
+func captureFullPage(wsURL, pageURL string, deadline time.Time) ([]byte, error) {
+	ws, err := websocket.Dial(wsURL, "", "http://127.0.0.1/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to browser: %w", err)
+	}
+	defer ws.Close()
+	ws.SetDeadline(deadline)
+	ws.MaxPayloadBytes = 256 << 20 // tall pages produce large screenshots
+
+	c := &cdpConn{ws: ws, seen: make(map[string]bool)}
+
+	if err := c.call("Page.enable", nil, nil); err != nil {
+		return nil, err
+	}
+	if err := c.call("Page.navigate", map[string]string{"url": pageURL}, nil); err != nil {
+		return nil, err
+	}
+	if err := c.waitEvent("Page.loadEventFired"); err != nil {
+		return nil, err
+	}
+
+	var metrics struct {
+		CSSContentSize struct {
+			Width  float64 `json:"width"`
+			Height float64 `json:"height"`
+		} `json:"cssContentSize"`
+	}
+	if err := c.call("Page.getLayoutMetrics", nil, &metrics); err != nil {
+		return nil, err
+	}
+
+	var shot struct {
+		Data string `json:"data"`
+	}
+	err = c.call("Page.captureScreenshot", map[string]any{
+		"format":                "png",
+		"captureBeyondViewport": true,
+		"clip": map[string]float64{
+			"x":      0,
+			"y":      0,
+			"width":  metrics.CSSContentSize.Width,
+			"height": metrics.CSSContentSize.Height,
+			"scale":  1,
+		},
+	}, &shot)
+	if err != nil {
+		return nil, err
+	}
+
+	png, err := base64.StdEncoding.DecodeString(shot.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+	return png, nil
+}
+
+// writeScreenshot captures the page into a PNG at path. Pages that were not
+// fetched live (file or stdin input) are rendered from a temporary copy.
+func writeScreenshot(path string, page *fetchResult, pageURL string, browser string, timeout time.Duration) error {
+	bin, err := findHeadlessBrowser(browser)
+	if err != nil {
+		return err
+	}
+
+	if !page.live {
+		tmp, err := os.CreateTemp("", "go-read-md-*.html")
+		if err != nil {
+			return fmt.Errorf("failed to create temp file for HTML: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(page.body); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write HTML to temp file: %w", err)
+		}
+		tmp.Close()
+		pageURL = "file://" + tmp.Name()
+	}
+
+	png, err := takeScreenshot(bin, pageURL, timeout)
+	if err != nil {
+		return fmt.Errorf("failed to capture screenshot: %w", err)
+	}
+	if err := os.WriteFile(path, png, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// fakeDevTools emulates the subset of the DevTools protocol used by
+// captureFullPage: it acknowledges every command, fires the load event after
+// navigation and returns a canned screenshot.
+func fakeDevTools(t *testing.T, navigated *string) *httptest.Server {
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+
+	mux.HandleFunc("/json/list", func(w http.ResponseWriter, r *http.Request) {
+		wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/devtools/page/1"
+		fmt.Fprintf(w, `[{"type":"service_worker","webSocketDebuggerUrl":"ws://nope"},{"type":"page","webSocketDebuggerUrl":%q}]`, wsURL)
+	})
+	mux.Handle("/devtools/page/1", websocket.Handler(func(ws *websocket.Conn) {
+		for {
+			var req struct {
+				ID     int            `json:"id"`
+				Method string         `json:"method"`
+				Params map[string]any `json:"params"`
+			}
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+
+			result := "{}"
+			switch req.Method {
+			case "Page.navigate":
+				*navigated = req.Params["url"].(string)
+				websocket.Message.Send(ws, `{"method":"Page.frameStartedLoading"}`)
+				websocket.Message.Send(ws, `{"method":"Page.loadEventFired"}`)
+			case "Page.getLayoutMetrics":
+				result = `{"cssContentSize":{"width":1280,"height":5000}}`
+			case "Page.captureScreenshot":
+				clip := req.Params["clip"].(map[string]any)
+				if clip["height"].(float64) != 5000 || req.Params["captureBeyondViewport"] != true {
+					t.Errorf("expected full-page clip, got %v", req.Params)
+				}
+				result = fmt.Sprintf(`{"data":%q}`, base64.StdEncoding.EncodeToString([]byte("PNGBYTES")))
+			}
+			websocket.Message.Send(ws, fmt.Sprintf(`{"id":%d,"result":%s}`, req.ID, result))
+		}
+	}))
+
+	ts = httptest.NewServer(mux)
+	return ts
+}
+
+func TestCaptureFullPage(t *testing.T) {
+	var navigated string
+	ts := fakeDevTools(t, &navigated)
+	defer ts.Close()
+
+	wsURL, err := pageTarget(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(wsURL, "/devtools/page/1") {
+		t.Fatalf("expected the page target, got %q", wsURL)
+	}
+
+	png, err := captureFullPage(wsURL, "https://example.com/dashboard", time.Now().Add(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(png) != "PNGBYTES" {
+		t.Errorf("unexpected screenshot data %q", png)
+	}
+	if navigated != "https://example.com/dashboard" {
+		t.Errorf("expected navigation to the page URL, got %q", navigated)
+	}
+}
+
+func TestCDPError(t *testing.T) {
+	ts := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var req cdpMessage
+		websocket.JSON.Receive(ws, &req)
+		msg, _ := json.Marshal(map[string]any{"id": req.ID, "error": map[string]string{"message": "boom"}})
+		websocket.Message.Send(ws, string(msg))
+	}))
+	defer ts.Close()
+
+	_, err := captureFullPage("ws"+strings.TrimPrefix(ts.URL, "http"), "https://example.com", time.Now().Add(5*time.Second))
+	if err == nil || !strings.Contains(err.Error(), "Page.enable: boom") {
+		t.Errorf("expected protocol error, got %v", err)
+	}
+}
+
+func TestFindHeadlessBrowser(t *testing.T) {
+	if _, err := findHeadlessBrowser("definitely-not-a-browser-binary"); err == nil {
+		t.Error("expected error for missing explicit browser")
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	_, err := findHeadlessBrowser("")
+	if err == nil || !strings.Contains(err.Error(), "no Chromium-based browser found") {
+		t.Errorf("expected actionable error, got %v", err)
+	}
+}
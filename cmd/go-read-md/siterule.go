@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"browser-pipes/pkg/readmd"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// siteRule holds CSS selectors for a site where automatic extraction fails,
+// in the spirit of Wallabag's site config. Empty selectors leave the
+// readability result alone.
+type siteRule struct {
+	content string // elements making up the article body
+	title   string
+	author  string
+}
+
+func (r siteRule) empty() bool {
+	return r.content == "" && r.title == "" && r.author == ""
+}
+
+// siteMatch is what a siteRule selected from a page. Empty fields did not
+// match and fall back to readability.
+type siteMatch struct {
+	content *html.Node
+	title   string
+	author  string
+}
+
+// applySiteRule runs rule over the page body. The content selector's
+// matches are joined, in document order, into the article body; scripts and
+// styles are dropped and links resolved against pageURL.
+func applySiteRule(body []byte, pageURL *url.URL, rule siteRule) (siteMatch, error) {
+	var m siteMatch
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return m, fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	if rule.content != "" {
+		sel, err := find(doc, rule.content)
+		if err != nil {
+			return m, fmt.Errorf("invalid --content-selector: %w", err)
+		}
+		if sel.Length() > 0 {
+			sel.Find("script, style, noscript").Remove()
+			m.content = &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+			for _, n := range sel.Nodes {
+				// A match inside another match comes along with it.
+				if sel.Contains(n) {
+					continue
+				}
+				n.Parent.RemoveChild(n)
+				readmd.ResolveLinks(n, pageURL)
+				m.content.AppendChild(n)
+			}
+		}
+	}
+	if rule.title != "" {
+		if m.title, err = firstText(doc, rule.title); err != nil {
+			return m, fmt.Errorf("invalid --title-selector: %w", err)
+		}
+	}
+	if rule.author != "" {
+		if m.author, err = firstText(doc, rule.author); err != nil {
+			return m, fmt.Errorf("invalid --author-selector: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// apply overrides the snapshot metadata the rule matched.
+func (m siteMatch) apply(data *snapshotData) {
+	if m.title != "" {
+		data.Title = m.title
+	}
+	if m.author != "" {
+		data.Byline = m.author
+	}
+}
+
+// find is doc.Find for a selector that comes from the user: goquery
+// silently matches nothing on invalid selectors, this reports them.
+func find(doc *goquery.Document, selector string) (*goquery.Selection, error) {
+	m, err := cascadia.Compile(selector)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", selector, err)
+	}
+	return doc.FindMatcher(m), nil
+}
+
+// firstText returns the whitespace-normalized text of the first match.
+func firstText(doc *goquery.Document, selector string) (string, error) {
+	sel, err := find(doc, selector)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(sel.First().Text()), " "), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestApplySiteRule(t *testing.T) {
+	body := []byte(`<html><body>
+<h1 class="title">  Real
+  Title </h1>
+<div class="part"><p>One <a href="/more">more</a></p><script>track()</script></div>
+<div class="ad">Buy now</div>
+<div class="part"><p>Two</p><div class="part">nested</div></div>
+</body></html>`)
+	pageURL, _ := url.Parse("https://example.com/post/1")
+
+	m, err := applySiteRule(body, pageURL, siteRule{content: "div.part", title: "h1.title", author: ".missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.title != "Real Title" {
+		t.Errorf("expected normalized title, got %q", m.title)
+	}
+	if m.author != "" {
+		t.Errorf("expected no author, got %q", m.author)
+	}
+
+	var b strings.Builder
+	html.Render(&b, m.content)
+	got := b.String()
+	want := `<div><div class="part"><p>One <a href="https://example.com/more">more</a></p></div><div class="part"><p>Two</p><div class="part">nested</div></div></div>`
+	if got != want {
+		t.Errorf("unexpected content\n got: %s\nwant: %s", got, want)
+	}
+
+	if m, err := applySiteRule(body, pageURL, siteRule{content: "article"}); err != nil || m.content != nil {
+		t.Errorf("expected no content for an unmatched selector, got %v (%v)", m.content, err)
+	}
+	if _, err := applySiteRule(body, pageURL, siteRule{content: "div["}); err == nil {
+		t.Error("expected an error for an invalid selector")
+	}
+}
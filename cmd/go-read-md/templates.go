@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	readability "codeberg.org/readeck/go-readability/v2"
+)
+
+// snapshotData is what the markdown and HTML templates are rendered with.
+type snapshotData struct {
+	Title       string
+	Byline      string
+	SiteName    string
+	Excerpt     string
+	URL         string
+	OriginalURL string // the URL fetched, when the page's canonical URL differs
+	ArchiveURL  string // the Wayback Machine capture saved, when the page itself was gone
+	Lang        string // ISO 639 code such as "en", "" when unknown
+	URLHash     string
+	ContentHash string
+	Published   time.Time // zero when the page does not say
+	Saved       time.Time
+	Tags        []string
+	Markdown    string            // article body, only set for md output
+	Org         string            // article body, only set for org output
+	Content     htmltemplate.HTML // article body, only set for html output
+}
+
+func newSnapshotData(article readability.Article, targetURL string, tags []string, textHash string, saved time.Time) snapshotData {
+	published, err := article.PublishedTime()
+	if err != nil {
+		published = time.Time{}
+	}
+	return snapshotData{
+		Title:       article.Title(),
+		Byline:      article.Byline(),
+		SiteName:    article.SiteName(),
+		Excerpt:     article.Excerpt(),
+		URL:         targetURL,
+		URLHash:     hashString(targetURL),
+		ContentHash: textHash,
+		Published:   published,
+		Saved:       saved,
+		Tags:        tags,
+	}
+}
+
+// templateFuncs are available to both markdown and HTML templates.
+var templateFuncs = map[string]any{
+	"rfc3339": func(t time.Time) string { return t.Format(time.RFC3339) },
+	"date":    func(layout string, t time.Time) string { return t.Format(layout) },
+	"join":    strings.Join,
+	"yaml":    yamlValue,
+	"orgTime": orgTime,
+	"orgTags": orgTags,
+	"org":     orgValue,
+}
+
+// yamlValue renders v as a YAML flow scalar or sequence. JSON is valid YAML,
+// so encoding/json takes care of quoting titles with colons or quotes.
+func yamlValue(v any) string {
+	if tags, ok := v.([]string); ok && len(tags) == 0 {
+		return "[]"
+	}
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return `""`
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+const defaultMarkdownTemplate = `# {{.Title}}
+
+{{if .Byline}}**Author:** {{.Byline}}
+
+{{end}}{{if not .Published.IsZero}}**Published:** {{rfc3339 .Published}}
+
+{{end}}**Source:** [{{.URL}}]({{.URL}})
+
+{{if .ArchiveURL}}**Archived:** [{{.ArchiveURL}}]({{.ArchiveURL}})
+
+{{end}}**Saved:** {{rfc3339 .Saved}}
+
+---
+
+{{.Markdown}}`
+
+// defaultFrontmatterTemplate replaces the bold metadata block with YAML
+// frontmatter understood by Obsidian, Hugo and most static site generators.
+// date is what Hugo and Jekyll sort by: the publication date when the page
+// has one, else the save date.
+const defaultFrontmatterTemplate = `---
+title: {{yaml .Title}}
+date: {{if .Published.IsZero}}{{rfc3339 .Saved}}{{else}}{{rfc3339 .Published}}{{end}}
+url: {{yaml .URL}}
+{{- if .OriginalURL}}
+original_url: {{yaml .OriginalURL}}
+{{- end}}
+{{- if .ArchiveURL}}
+archive_url: {{yaml .ArchiveURL}}
+{{- end}}
+{{- if .Byline}}
+author: {{yaml .Byline}}
+{{- end}}
+{{- if not .Published.IsZero}}
+published: {{rfc3339 .Published}}
+{{- end}}
+{{- if .Lang}}
+lang: {{yaml .Lang}}
+{{- end}}
+saved: {{rfc3339 .Saved}}
+tags: {{yaml .Tags}}
+hash: {{yaml .URLHash}}
+content_hash: {{yaml .ContentHash}}
+---
+
+# {{.Title}}
+
+{{.Markdown}}`
+
+// defaultOrgTemplate starts the Org snapshot with a file-level PROPERTIES
+// drawer, which Org and org-roam only read before anything else, followed
+// by the title, author, date and filetags keywords.
+const defaultOrgTemplate = `:PROPERTIES:
+:URL: {{org .URL}}
+{{- if .OriginalURL}}
+:ORIGINAL_URL: {{org .OriginalURL}}
+{{- end}}
+{{- if .ArchiveURL}}
+:ARCHIVE_URL: {{org .ArchiveURL}}
+{{- end}}
+{{- if .Byline}}
+:AUTHOR: {{org .Byline}}
+{{- end}}
+{{- if not .Published.IsZero}}
+:PUBLISHED: {{orgTime .Published}}
+{{- end}}
+:SAVED: {{orgTime .Saved}}
+:HASH: {{.URLHash}}
+{{- if .ContentHash}}
+:CONTENT_HASH: {{.ContentHash}}
+{{- end}}
+:END:
+#+title: {{org .Title}}
+{{- if .Byline}}
+#+author: {{org .Byline}}
+{{- end}}
+#+date: {{if .Published.IsZero}}{{orgTime .Saved}}{{else}}{{orgTime .Published}}{{end}}
+{{- if .Lang}}
+#+language: {{.Lang}}
+{{- end}}
+{{- if .Tags}}
+#+filetags: {{orgTags .Tags}}
+{{- end}}
+
+{{.Org}}`
+
+const defaultHTMLTemplate = `<!DOCTYPE html>
+<html{{if .Lang}} lang="{{.Lang}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="canonical" href="{{.URL}}">
+{{- if .Byline}}
+<meta name="author" content="{{.Byline}}">
+{{- end}}
+{{- if not .Published.IsZero}}
+<meta property="article:published_time" content="{{rfc3339 .Published}}">
+{{- end}}
+{{- if .SiteName}}
+<meta property="og:site_name" content="{{.SiteName}}">
+{{- end}}
+{{- if .Tags}}
+<meta name="keywords" content="{{join .Tags ", "}}">
+{{- end}}
+<style>
+body { font-family: Georgia, serif; max-width: 40em; margin: 2em auto; padding: 0 1em; line-height: 1.6; }
+img { max-width: 100%; height: auto; }
+.meta { color: #666; font-family: sans-serif; font-size: .9em; border-bottom: 1px solid #ddd; padding-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="meta">
+{{- if .Byline}}<div>{{.Byline}}</div>{{end}}
+{{- if not .Published.IsZero}}<div>Published {{rfc3339 .Published}}</div>{{end}}
+<div>Source: <a href="{{.URL}}">{{.URL}}</a></div>
+{{- if .ArchiveURL}}
+<div>Archived: <a href="{{.ArchiveURL}}">{{.ArchiveURL}}</a></div>
+{{- end}}
+<div>Saved {{rfc3339 .Saved}}</div>
+</div>
+{{.Content}}
+</body>
+</html>
+`
+
+// snapshotTemplates holds the parsed templates for md, org and html
+// output.
+type snapshotTemplates struct {
+	markdown *template.Template
+	org      *template.Template
+	html     *htmltemplate.Template
+}
+
+// loadTemplates parses the user templates at mdPath and htmlPath, falling
+// back to the built-in layouts when a path is empty. frontmatter selects the
+// built-in YAML frontmatter layout for markdown.
+func loadTemplates(mdPath, htmlPath string, frontmatter bool) (*snapshotTemplates, error) {
+	mdDefault := defaultMarkdownTemplate
+	if frontmatter {
+		mdDefault = defaultFrontmatterTemplate
+	}
+	mdSrc, err := templateSource(mdPath, mdDefault)
+	if err != nil {
+		return nil, err
+	}
+	htmlSrc, err := templateSource(htmlPath, defaultHTMLTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &snapshotTemplates{}
+	if t.markdown, err = template.New("md").Funcs(templateFuncs).Parse(mdSrc); err != nil {
+		return nil, fmt.Errorf("invalid markdown template: %w", err)
+	}
+	t.org = template.Must(template.New("org").Funcs(templateFuncs).Parse(defaultOrgTemplate))
+	if t.html, err = htmltemplate.New("html").Funcs(templateFuncs).Parse(htmlSrc); err != nil {
+		return nil, fmt.Errorf("invalid HTML template: %w", err)
+	}
+	return t, nil
+}
+
+func templateSource(path, fallback string) (string, error) {
+	if path == "" {
+		return fallback, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template: %w", err)
+	}
+	return string(data), nil
+}
+
+// renderMarkdown executes the markdown template; data.Markdown must be set.
+func (t *snapshotTemplates) renderMarkdown(data snapshotData) (string, error) {
+	var out strings.Builder
+	if err := t.markdown.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render markdown template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// renderOrg executes the org template; data.Org must be set.
+func (t *snapshotTemplates) renderOrg(data snapshotData) (string, error) {
+	var out strings.Builder
+	if err := t.org.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render org template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// renderHTML executes the HTML template; data.Content must be set.
+func (t *snapshotTemplates) renderHTML(data snapshotData) (string, error) {
+	var out strings.Builder
+	if err := t.html.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render HTML template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// filenamePlaceholders are the {name} tokens accepted by --filename-template.
+// {hash} is short for {url_hash}.
+var filenamePlaceholders = []string{"{date}", "{time}", "{domain}", "{title}", "{url_hash}", "{hash}"}
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// expandFilenameTemplate turns a pattern such as "{domain}/{date}-{title}"
+// into a snapshot path relative to the output directory.
+func expandFilenameTemplate(pattern string, pageURL *url.URL, data snapshotData) (string, error) {
+	for _, p := range placeholderPattern.FindAllString(pattern, -1) {
+		if !hasFormat(filenamePlaceholders, p) {
+			return "", fmt.Errorf("unknown placeholder %s in --filename-template (supported: %s)", p, strings.Join(filenamePlaceholders, ", "))
+		}
+	}
+
+	title := sanitizeFilename(data.Title)
+	if title == "" {
+		title = "article"
+	}
+	domain := sanitizeFilename(strings.TrimPrefix(pageURL.Hostname(), "www."))
+
+	name := strings.NewReplacer(
+		"{date}", data.Saved.Format("2006-01-02"),
+		"{time}", data.Saved.Format("150405"),
+		"{domain}", domain,
+		"{title}", title,
+		"{url_hash}", data.URLHash,
+		"{hash}", data.URLHash,
+	).Replace(pattern)
+
+	name = filepath.Clean(trimFormatExt(filepath.FromSlash(name)))
+	if name == "." || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("--filename-template %q must stay inside the output directory", pattern)
+	}
+	return name, nil
+}
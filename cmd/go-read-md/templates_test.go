@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultTemplates(t *testing.T) {
+	tmpl, err := loadTemplates("", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := snapshotData{
+		Title:    "A <Title>",
+		URL:      "https://example.com/a",
+		Saved:    time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Markdown: "Body text.",
+		Content:  "<p>Body text.</p>",
+	}
+
+	markdown, err := tmpl.renderMarkdown(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# A <Title>\n\n**Source:** [https://example.com/a](https://example.com/a)\n\n**Saved:** 2025-03-01T12:00:00Z\n\n---\n\nBody text."
+	if markdown != want {
+		t.Errorf("unexpected markdown:\n%s", markdown)
+	}
+
+	html, err := tmpl.renderHTML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"<title>A &lt;Title&gt;</title>", "<p>Body text.</p>", `href="https://example.com/a"`, `<link rel="canonical" href="https://example.com/a">`} {
+		if !strings.Contains(html, s) {
+			t.Errorf("expected %q in HTML output", s)
+		}
+	}
+	if strings.Contains(html, "Published") {
+		t.Error("zero published time should be omitted")
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "note.tmpl")
+	os.WriteFile(path, []byte(`{{.Title}} [{{join .Tags ", "}}] {{date "2006" .Saved}}`), 0644)
+
+	tmpl, err := loadTemplates(path, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tmpl.renderMarkdown(snapshotData{Title: "T", Tags: []string{"a", "b"}, Saved: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "T [a, b] 2025" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	os.WriteFile(path, []byte(`{{.Title`), 0644)
+	if _, err := loadTemplates(path, "", false); err == nil || !strings.Contains(err.Error(), "invalid markdown template") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+	if _, err := loadTemplates("", filepath.Join(dir, "missing.tmpl"), false); err == nil {
+		t.Error("expected error for missing template file")
+	}
+}
+
+func TestFrontmatterTemplate(t *testing.T) {
+	tmpl, err := loadTemplates("", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tmpl.renderMarkdown(snapshotData{
+		Title:    `Go: "the" language`,
+		URL:      "https://example.com/go",
+		URLHash:  "abcd1234",
+		Saved:    time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Markdown: "Body.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+title: "Go: \"the\" language"
+date: 2025-03-01T12:00:00Z
+url: "https://example.com/go"
+saved: 2025-03-01T12:00:00Z
+tags: []
+hash: "abcd1234"
+content_hash: ""
+---
+
+# Go: "the" language
+
+Body.`
+	if out != want {
+		t.Errorf("unexpected frontmatter:\n%s", out)
+	}
+
+	// A published page is dated by its publication.
+	out, err = tmpl.renderMarkdown(snapshotData{
+		Title:     "Dated",
+		Published: time.Date(2024, 12, 24, 8, 0, 0, 0, time.UTC),
+		Saved:     time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil || !strings.Contains(out, "\ndate: 2024-12-24T08:00:00Z\n") {
+		t.Errorf("expected the publication date, got %v:\n%s", err, out)
+	}
+}
+
+func TestExpandFilenameTemplate(t *testing.T) {
+	u, _ := url.Parse("https://www.example.com/post")
+	data := snapshotData{Title: "Hello: World?", URLHash: "abcd1234", Saved: time.Date(2025, 3, 1, 9, 5, 7, 0, time.UTC)}
+
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr string
+	}{
+		{"{domain}/{date}-{title}", filepath.Join("example.com", "2025-03-01-Hello_World"), ""},
+		{"{date}_{time}_{url_hash}.md", "2025-03-01_090507_abcd1234", ""},
+		{"{domain}-{hash}", "example.com-abcd1234", ""},
+		{"{title}/{nope}", "", "unknown placeholder {nope}"},
+		{"../{title}", "", "must stay inside the output directory"},
+		{"/abs/{title}", "", "must stay inside the output directory"},
+	}
+	for _, tt := range tests {
+		got, err := expandFilenameTemplate(tt.pattern, u, data)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected error %q, got %v", tt.pattern, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %q, %v; want %q", tt.pattern, got, err, tt.want)
+		}
+	}
+}
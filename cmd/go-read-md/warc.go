@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// warcRecordSep terminates every WARC record (WARC 1.1, section 4).
+const warcRecordSep = "\r\n\r\n"
+
+// exchange holds a raw HTTP request/response pair as sent over the wire,
+// which is what a WARC "request" and "response" record must contain.
+type exchange struct {
+	url      string
+	request  []byte
+	response []byte
+}
+
+// warcWriter writes WARC/1.1 records to an underlying writer.
+type warcWriter struct {
+	w   io.Writer
+	now func() time.Time
+}
+
+func newWARCWriter(w io.Writer) *warcWriter {
+	return &warcWriter{w: w, now: time.Now}
+}
+
+// writeRecord writes a single record. headers are written in order, followed
+// by the mandatory Content-Length and the block itself.
+func (ww *warcWriter) writeRecord(headers [][2]string, block []byte) error {
+	var buf bytes.Buffer
+	buf.WriteString("WARC/1.1\r\n")
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+	fmt.Fprintf(&buf, "WARC-Block-Digest: %s\r\n", blockDigest(block))
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(block))
+	buf.Write(block)
+	buf.WriteString(warcRecordSep)
+
+	_, err := ww.w.Write(buf.Bytes())
+	return err
+}
+
+func (ww *warcWriter) writeInfo(filename string) error {
+	block := []byte("software: go-read-md (browser-pipes)\r\nformat: WARC File Format 1.1\r\n")
+	return ww.writeRecord([][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Date", ww.date()},
+		{"WARC-Filename", filename},
+		{"WARC-Record-ID", newRecordID()},
+		{"Content-Type", "application/warc-fields"},
+	}, block)
+}
+
+// writeExchange writes a request record and its matching response record.
+func (ww *warcWriter) writeExchange(ex exchange) error {
+	date := ww.date()
+	respID := newRecordID()
+
+	if err := ww.writeRecord([][2]string{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", ex.url},
+		{"WARC-Concurrent-To", respID},
+		{"Content-Type", "application/http;msgtype=request"},
+	}, ex.request); err != nil {
+		return err
+	}
+
+	return ww.writeRecord([][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", respID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", ex.url},
+		{"Content-Type", "application/http;msgtype=response"},
+	}, ex.response)
+}
+
+// writeResource stores content that was not fetched over HTTP (e.g. HTML
+// from a file or stdin) as a "resource" record.
+func (ww *warcWriter) writeResource(targetURI, contentType string, body []byte) error {
+	return ww.writeRecord([][2]string{
+		{"WARC-Type", "resource"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", ww.date()},
+		{"WARC-Target-URI", targetURI},
+		{"Content-Type", contentType},
+	}, body)
+}
+
+func (ww *warcWriter) date() string {
+	return ww.now().UTC().Format(time.RFC3339)
+}
+
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func blockDigest(block []byte) string {
+	sum := sha1.Sum(block)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// findSubresources returns the absolute URLs of images, stylesheets and
+// scripts referenced by the page, without duplicates.
+func findSubresources(page []byte, base *url.URL) []string {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var urls []string
+	add := func(ref string) {
+		if ref == "" {
+			return
+		}
+		u, err := base.Parse(ref)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		if abs := u.String(); !seen[abs] {
+			seen[abs] = true
+			urls = append(urls, abs)
+		}
+	}
+
+	doc.Find("img[src]").Each(func(_ int, s *goquery.Selection) { add(s.AttrOr("src", "")) })
+	doc.Find("link[rel='stylesheet'][href]").Each(func(_ int, s *goquery.Selection) { add(s.AttrOr("href", "")) })
+	doc.Find("script[src]").Each(func(_ int, s *goquery.Selection) { add(s.AttrOr("src", "")) })
+	return urls
+}
+
+// writeWARC archives the page (and optionally its subresources) at path.
+func writeWARC(web *fetcher, path string, page *fetchResult, pageURL *url.URL, subresources bool, verbose bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create WARC file: %w", err)
+	}
+	defer f.Close()
+
+	ww := newWARCWriter(f)
+	if err := ww.writeInfo(filepath.Base(path)); err != nil {
+		return fmt.Errorf("failed to write WARC record: %w", err)
+	}
+
+	if page.exchange != nil {
+		err = ww.writeExchange(*page.exchange)
+	} else {
+		err = ww.writeResource(pageURL.String(), "text/html", page.body)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write WARC record: %w", err)
+	}
+
+	if !subresources {
+		return nil
+	}
+
+	for _, ref := range findSubresources(page.body, pageURL) {
+		if verbose {
+			log.Printf("📦 Archiving subresource: %s", ref)
+		}
+		res, err := web.fetch(ref, true)
+		if err != nil {
+			// A missing image should not cost us the whole archive.
+			log.Printf("⚠️ Skipping subresource %s: %v", ref, err)
+			continue
+		}
+		if err := ww.writeExchange(*res.exchange); err != nil {
+			return fmt.Errorf("failed to write WARC record: %w", err)
+		}
+	}
+
+	return nil
+}
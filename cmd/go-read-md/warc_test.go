@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWARCWriter(t *testing.T) {
+	var buf bytes.Buffer
+	ww := newWARCWriter(&buf)
+	ww.now = func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	err := ww.writeExchange(exchange{
+		url:      "http://example.com/",
+		request:  []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+		response: []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nhi"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	records := strings.Split(strings.TrimSuffix(out, warcRecordSep), warcRecordSep+"WARC/1.1")
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d:\n%s", len(records), out)
+	}
+
+	for _, want := range []string{
+		"WARC-Type: request",
+		"WARC-Type: response",
+		"WARC-Target-URI: http://example.com/",
+		"WARC-Date: 2025-01-02T03:04:05Z",
+		"Content-Type: application/http;msgtype=response",
+		"Content-Length: 40",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in WARC output:\n%s", want, out)
+		}
+	}
+
+	if !strings.HasSuffix(out, "hi"+warcRecordSep) {
+		t.Errorf("response block should end the file, got %q", out[len(out)-10:])
+	}
+}
+
+func TestNewRecordID(t *testing.T) {
+	id := newRecordID()
+	if !strings.HasPrefix(id, "<urn:uuid:") || !strings.HasSuffix(id, ">") || len(id) != 47 {
+		t.Errorf("malformed record id %q", id)
+	}
+	if id == newRecordID() {
+		t.Error("record ids must be unique")
+	}
+}
+
+func TestFindSubresources(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+	page := []byte(`<html><head>
+<link rel="stylesheet" href="/style.css">
+<script src="app.js"></script>
+</head><body>
+<img src="https://cdn.example.com/a.png">
+<img src="https://cdn.example.com/a.png#dup">
+<img src="data:image/png;base64,AAAA">
+</body></html>`)
+
+	got := findSubresources(page, base)
+	want := []string{
+		"https://cdn.example.com/a.png",
+		"https://example.com/style.css",
+		"https://example.com/posts/app.js",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("findSubresources = %v, want %v", got, want)
+	}
+}
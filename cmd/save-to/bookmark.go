@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// bookmarkApps maps --app to the function that creates the bookmark and
+// returns a link to it.
+var bookmarkApps = map[string]func(b *bookmarker, target string) (string, error){
+	"karakeep": (*bookmarker).karakeep,
+	"linkding": (*bookmarker).linkding,
+	"readeck":  (*bookmarker).readeck,
+	"shiori":   (*bookmarker).shiori,
+}
+
+// bookmarker saves bookmarks to a self-hosted bookmark manager.
+type bookmarker struct {
+	client   *http.Client
+	base     string
+	token    string // API token; the password for Shiori
+	username string // Shiori only
+	title    string
+	tags     []string
+}
+
+func runBookmark(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("bookmark", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	app := fs.String("app", "", "Bookmark manager: karakeep, linkding, readeck or shiori (required)")
+	base := fs.String("base-url", "", "Instance URL, e.g. https://links.example.com (required)")
+	token := fs.String("token", "", "API token (the account password for shiori)")
+	tokenFile := fs.String("token-file", "", "File containing the API token")
+	username := fs.String("username", "", "Account name (shiori only)")
+	title := fs.String("title", "", "Bookmark title (default: the app fetches it)")
+	tags := fs.String("tags", "", "Comma-separated tags")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	save, ok := bookmarkApps[*app]
+	if !ok {
+		return fmt.Errorf("unsupported --app %q (use karakeep, linkding, readeck or shiori)", *app)
+	}
+	if *base == "" {
+		return fmt.Errorf("--base-url is required")
+	}
+	if *app == "shiori" && *username == "" {
+		return fmt.Errorf("--username is required for shiori")
+	}
+
+	b := &bookmarker{
+		client:   c.client(),
+		base:     strings.TrimSuffix(*base, "/"),
+		username: *username,
+		title:    *title,
+		tags:     splitTags(*tags),
+	}
+	if b.token, err = readSecret(*token, *tokenFile); err != nil {
+		return err
+	}
+
+	if *c.verbose {
+		log.Printf("🔖 Bookmarking %s in %s", target, *app)
+	}
+	link, err := save(b, target)
+	c.record(target, *app, link, err)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// karakeep (formerly Hoarder): POST /api/v1/bookmarks, then attach the tags
+// in a second call since bookmark creation does not take them.
+func (b *bookmarker) karakeep(target string) (string, error) {
+	body := map[string]any{"type": "link", "url": target}
+	if b.title != "" {
+		body["title"] = b.title
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if _, err := b.postJSON("/api/v1/bookmarks", "Bearer "+b.token, body, &created); err != nil {
+		return "", fmt.Errorf("karakeep: %w", err)
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("karakeep: response has no bookmark id")
+	}
+	link := fmt.Sprintf("%s/dashboard/preview/%s", b.base, created.ID)
+
+	if len(b.tags) > 0 {
+		tags := make([]map[string]string, 0, len(b.tags))
+		for _, t := range b.tags {
+			tags = append(tags, map[string]string{"tagName": t})
+		}
+		if _, err := b.postJSON("/api/v1/bookmarks/"+created.ID+"/tags", "Bearer "+b.token, map[string]any{"tags": tags}, nil); err != nil {
+			return link, fmt.Errorf("karakeep: bookmark saved but tagging failed: %w", err)
+		}
+	}
+	return link, nil
+}
+
+// linkding: POST /api/bookmarks/ with "Authorization: Token ...".
+func (b *bookmarker) linkding(target string) (string, error) {
+	body := map[string]any{"url": target, "title": b.title, "tag_names": nonNil(b.tags)}
+	var created struct {
+		ID int `json:"id"`
+	}
+	if _, err := b.postJSON("/api/bookmarks/", "Token "+b.token, body, &created); err != nil {
+		return "", fmt.Errorf("linkding: %w", err)
+	}
+	return fmt.Sprintf("%s/bookmarks/%d/edit", b.base, created.ID), nil
+}
+
+// readeck: POST /api/bookmarks; the bookmark is created asynchronously and
+// its ID comes back in the Bookmark-Id header.
+func (b *bookmarker) readeck(target string) (string, error) {
+	body := map[string]any{"url": target, "labels": nonNil(b.tags)}
+	if b.title != "" {
+		body["title"] = b.title
+	}
+	resp, err := b.postJSON("/api/bookmarks", "Bearer "+b.token, body, nil)
+	if err != nil {
+		return "", fmt.Errorf("readeck: %w", err)
+	}
+	id := resp.Header.Get("Bookmark-Id")
+	if id == "" {
+		return "", fmt.Errorf("readeck: response has no Bookmark-Id")
+	}
+	return fmt.Sprintf("%s/bookmarks/%s", b.base, id), nil
+}
+
+// shiori: log in for a session token, then POST /api/bookmarks.
+func (b *bookmarker) shiori(target string) (string, error) {
+	var login struct {
+		Message struct {
+			Token string `json:"token"`
+		} `json:"message"`
+	}
+	creds := map[string]any{"username": b.username, "password": b.token, "remember_me": false}
+	if _, err := b.postJSON("/api/v1/auth/login", "", creds, &login); err != nil {
+		return "", fmt.Errorf("shiori login: %w", err)
+	}
+	if login.Message.Token == "" {
+		return "", fmt.Errorf("shiori login: no session token in response")
+	}
+
+	tags := make([]map[string]string, 0, len(b.tags))
+	for _, t := range b.tags {
+		tags = append(tags, map[string]string{"name": t})
+	}
+	body := map[string]any{"url": target, "title": b.title, "tags": tags, "createArchive": false}
+	var created struct {
+		ID int `json:"id"`
+	}
+	if _, err := b.postJSON("/api/bookmarks", "Bearer "+login.Message.Token, body, &created); err != nil {
+		return "", fmt.Errorf("shiori: %w", err)
+	}
+	return fmt.Sprintf("%s/bookmark/%d/content", b.base, created.ID), nil
+}
+
+// postJSON posts body to path and decodes the response into result, if
+// given. Any 2xx status is success; Readeck answers 202 Accepted.
+func (b *bookmarker) postJSON(path, auth string, body any, result any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, b.base+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// splitTags splits a comma-separated tag list, dropping blanks.
+func splitTags(value string) []string {
+	var tags []string
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// nonNil keeps an empty tag list encoded as [] rather than null.
+func nonNil(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
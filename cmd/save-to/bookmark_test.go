@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBookmarkApps(t *testing.T) {
+	var got map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		switch {
+		case r.URL.Path == "/api/v1/bookmarks" && auth == "Bearer tok" && got["type"] == "link":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id":"kk1"}`)
+		case r.URL.Path == "/api/v1/bookmarks/kk1/tags" && auth == "Bearer tok":
+			fmt.Fprint(w, `{"attached":["t1","t2"]}`)
+		case r.URL.Path == "/api/bookmarks/" && auth == "Token tok":
+			fmt.Fprint(w, `{"id":7}`)
+		case r.URL.Path == "/api/bookmarks" && auth == "Bearer tok":
+			w.Header().Set("Bookmark-Id", "abc")
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/api/v1/auth/login" && got["password"] == "tok":
+			fmt.Fprint(w, `{"ok":true,"message":{"token":"session"}}`)
+		case r.URL.Path == "/api/bookmarks" && auth == "Bearer session":
+			fmt.Fprint(w, `{"id":9}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		app     string
+		want    string
+		tagsKey string
+	}{
+		{"karakeep", "/dashboard/preview/kk1", "tags"},
+		{"linkding", "/bookmarks/7/edit", "tag_names"},
+		{"readeck", "/bookmarks/abc", "labels"},
+		{"shiori", "/bookmark/9/content", "tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.app, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			err := runBookmark([]string{"--app", tt.app, "--base-url", ts.URL, "--token", "tok", "--username", "me", "--tags", "go, tools", "https://example.com"}, stdout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link := strings.TrimSpace(stdout.String()); link != ts.URL+tt.want {
+				t.Errorf("unexpected link %q", link)
+			}
+			if tags, _ := got[tt.tagsKey].([]any); len(tags) != 2 {
+				t.Errorf("expected two tags in %q, got %v", tt.tagsKey, got)
+			}
+		})
+	}
+
+	err := runBookmark([]string{"--app", "linkding", "--base-url", ts.URL, "--token", "wrong", "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "linkding: 401") {
+		t.Errorf("expected auth error, got %v", err)
+	}
+	err = runBookmark([]string{"--app", "delicious", "--base-url", ts.URL, "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported --app") {
+		t.Errorf("expected unsupported app error, got %v", err)
+	}
+	err = runBookmark([]string{"--app", "shiori", "--base-url", ts.URL, "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "--username is required") {
+		t.Errorf("expected missing username error, got %v", err)
+	}
+}
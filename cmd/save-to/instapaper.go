@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// instapaper saves URLs to Instapaper. With an API consumer key it uses the
+// Full API (OAuth 1.0a xAuth), which supports tags; without one it falls
+// back to the Simple API, which only takes the URL and title.
+type instapaper struct {
+	client         *http.Client
+	endpoint       string
+	username       string
+	password       string
+	consumerKey    string
+	consumerSecret string
+}
+
+func runInstapaper(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("instapaper", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	endpoint := fs.String("endpoint", "https://www.instapaper.com", "Instapaper base URL")
+	username := fs.String("username", "", "Instapaper account email or username (required)")
+	password := fs.String("password", "", "Instapaper password")
+	passwordFile := fs.String("password-file", "", "File containing the Instapaper password")
+	consumerKey := fs.String("consumer-key", "", "Full API consumer key (enables tags)")
+	consumerSecret := fs.String("consumer-secret", "", "Full API consumer secret")
+	consumerSecretFile := fs.String("consumer-secret-file", "", "File containing the Full API consumer secret")
+	title := fs.String("title", "", "Title (default: Instapaper fetches it)")
+	tags := fs.String("tags", "", "Comma-separated tags (Full API only)")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("--username is required")
+	}
+
+	ip := &instapaper{
+		client:      c.client(),
+		endpoint:    strings.TrimSuffix(*endpoint, "/"),
+		username:    *username,
+		consumerKey: *consumerKey,
+	}
+	if ip.password, err = readSecret(*password, *passwordFile); err != nil {
+		return err
+	}
+	if ip.consumerSecret, err = readSecret(*consumerSecret, *consumerSecretFile); err != nil {
+		return err
+	}
+
+	if *c.verbose {
+		log.Printf("📚 Saving %s to Instapaper", target)
+	}
+	var link string
+	if ip.consumerKey == "" {
+		if *tags != "" {
+			log.Printf("⚠️ Ignoring --tags: the Instapaper Simple API does not support them (set --consumer-key)")
+		}
+		link, err = ip.addSimple(target, *title)
+	} else {
+		link, err = ip.addBookmark(target, *title, splitTags(*tags))
+	}
+	c.record(target, "instapaper", link, err)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// addSimple uses the Simple API: basic auth, 201 Created on success.
+func (ip *instapaper) addSimple(target, title string) (string, error) {
+	form := url.Values{"url": {target}}
+	if title != "" {
+		form.Set("title", title)
+	}
+	req, err := http.NewRequest(http.MethodPost, ip.endpoint+"/api/add", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(ip.username, ip.password)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ip.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("instapaper request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("instapaper error: %s", resp.Status)
+	}
+	return ip.endpoint + "/u", nil
+}
+
+// addBookmark uses the Full API: exchange the credentials for an access
+// token, then add the bookmark with its tags.
+func (ip *instapaper) addBookmark(target, title string, tags []string) (string, error) {
+	tokenForm := url.Values{
+		"x_auth_username": {ip.username},
+		"x_auth_password": {ip.password},
+		"x_auth_mode":     {"client_auth"},
+	}
+	body, err := ip.signedPost("/api/1/oauth/access_token", tokenForm, "", "")
+	if err != nil {
+		return "", fmt.Errorf("instapaper authentication failed: %w", err)
+	}
+	token, err := url.ParseQuery(string(body))
+	if err != nil || token.Get("oauth_token") == "" {
+		return "", fmt.Errorf("instapaper authentication failed: no access token")
+	}
+
+	form := url.Values{"url": {target}}
+	if title != "" {
+		form.Set("title", title)
+	}
+	if len(tags) > 0 {
+		named := make([]map[string]string, len(tags))
+		for i, t := range tags {
+			named[i] = map[string]string{"name": t}
+		}
+		data, _ := json.Marshal(named)
+		form.Set("tags", string(data))
+	}
+	body, err = ip.signedPost("/api/1/bookmarks/add", form, token.Get("oauth_token"), token.Get("oauth_token_secret"))
+	if err != nil {
+		return "", fmt.Errorf("instapaper error: %w", err)
+	}
+
+	var items []struct {
+		Type       string `json:"type"`
+		BookmarkID int64  `json:"bookmark_id"`
+		Message    string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &items); err != nil {
+		return "", fmt.Errorf("failed to decode instapaper response: %w", err)
+	}
+	for _, it := range items {
+		switch it.Type {
+		case "bookmark":
+			return fmt.Sprintf("%s/read/%d", ip.endpoint, it.BookmarkID), nil
+		case "error":
+			return "", fmt.Errorf("instapaper error: %s", it.Message)
+		}
+	}
+	return "", fmt.Errorf("instapaper response has no bookmark")
+}
+
+// signedPost posts form to path with an OAuth 1.0a HMAC-SHA1 signature.
+func (ip *instapaper) signedPost(path string, form url.Values, token, tokenSecret string) ([]byte, error) {
+	endpoint := ip.endpoint + path
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	oauth := map[string]string{
+		"oauth_consumer_key":     ip.consumerKey,
+		"oauth_nonce":            hex.EncodeToString(nonce),
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(time.Now().Unix(), 10),
+		"oauth_version":          "1.0",
+	}
+	if token != "" {
+		oauth["oauth_token"] = token
+	}
+	oauth["oauth_signature"] = oauthSignature(http.MethodPost, endpoint, form, oauth, ip.consumerSecret, tokenSecret)
+
+	keys := make([]string, 0, len(oauth))
+	for k := range oauth {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf(`%s="%s"`, k, oauthEscape(oauth[k]))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "OAuth "+strings.Join(parts, ", "))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ip.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return body, nil
+}
+
+// oauthSignature computes the RFC 5849 HMAC-SHA1 signature over the request
+// method, URL and all form and oauth_* parameters.
+func oauthSignature(method, endpoint string, form url.Values, oauth map[string]string, consumerSecret, tokenSecret string) string {
+	var params []string
+	for k, vs := range form {
+		for _, v := range vs {
+			params = append(params, oauthEscape(k)+"="+oauthEscape(v))
+		}
+	}
+	for k, v := range oauth {
+		params = append(params, oauthEscape(k)+"="+oauthEscape(v))
+	}
+	sort.Strings(params)
+
+	base := method + "&" + oauthEscape(endpoint) + "&" + oauthEscape(strings.Join(params, "&"))
+	mac := hmac.New(sha1.New, []byte(oauthEscape(consumerSecret)+"&"+oauthEscape(tokenSecret)))
+	mac.Write([]byte(base))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// oauthEscape percent-encodes s as RFC 3986 requires: only unreserved
+// characters are left as is.
+func oauthEscape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(url.QueryEscape(s), "+", "%20"), "%7E", "~")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOAuthSignature(t *testing.T) {
+	// The worked example from Twitter's "Creating a signature" guide.
+	form := url.Values{
+		"include_entities": {"true"},
+		"status":           {"Hello Ladies + Gentlemen, a signed OAuth request!"},
+	}
+	oauth := map[string]string{
+		"oauth_consumer_key":     "xvz1evFS4wEEPTGEFPHBog",
+		"oauth_nonce":            "kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "1318622958",
+		"oauth_token":            "370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb",
+		"oauth_version":          "1.0",
+	}
+	got := oauthSignature("POST", "https://api.twitter.com/1.1/statuses/update.json", form, oauth,
+		"kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw", "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE")
+	if got != "hCtSmYh+iHYCEqBWrE7C7hYmtUk=" {
+		t.Errorf("unexpected signature %q", got)
+	}
+}
+
+func TestInstapaperFullAPI(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "OAuth ") || !strings.Contains(r.Header.Get("Authorization"), `oauth_consumer_key="ck"`) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/1/oauth/access_token":
+			if r.FormValue("x_auth_password") != "pw" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "oauth_token=at&oauth_token_secret=ats")
+		case "/api/1/bookmarks/add":
+			if !strings.Contains(r.Header.Get("Authorization"), `oauth_token="at"`) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var tags []map[string]string
+			json.Unmarshal([]byte(r.FormValue("tags")), &tags)
+			if len(tags) != 2 || tags[1]["name"] != "paper" {
+				t.Errorf("unexpected tags %q", r.FormValue("tags"))
+			}
+			fmt.Fprint(w, `[{"type":"meta"},{"type":"bookmark","bookmark_id":1234}]`)
+		}
+	}))
+	defer ts.Close()
+
+	stdout := &bytes.Buffer{}
+	err := runInstapaper([]string{"--endpoint", ts.URL, "--username", "me", "--password", "pw", "--consumer-key", "ck", "--consumer-secret", "cs", "--tags", "science,paper", "https://example.com"}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link := strings.TrimSpace(stdout.String()); link != ts.URL+"/read/1234" {
+		t.Errorf("unexpected link %q", link)
+	}
+
+	err = runInstapaper([]string{"--endpoint", ts.URL, "--username", "me", "--password", "nope", "--consumer-key", "ck", "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+}
+
+func TestInstapaperSimpleAPI(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.URL.Path != "/api/add" || user != "me" || pass != "pw" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	stdout := &bytes.Buffer{}
+	if err := runInstapaper([]string{"--endpoint", ts.URL, "--username", "me", "--password", "pw", "https://example.com"}, stdout); err != nil {
+		t.Fatal(err)
+	}
+	if link := strings.TrimSpace(stdout.String()); link != ts.URL+"/u" {
+		t.Errorf("unexpected link %q", link)
+	}
+
+	err := runInstapaper([]string{"--endpoint", ts.URL, "--username", "me", "--password", "bad", "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected 403 error, got %v", err)
+	}
+}
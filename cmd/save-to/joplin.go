@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// joplin creates notes through the Web Clipper service of a running Joplin
+// desktop app (Options > Web Clipper).
+type joplin struct {
+	client   *http.Client
+	endpoint string
+	token    string
+}
+
+// joplinFolder is a notebook as listed by GET /folders.
+type joplinFolder struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+func runJoplin(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("joplin", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	endpoint := fs.String("endpoint", "http://localhost:41184", "Joplin Web Clipper service URL")
+	token := fs.String("token", "", "Web Clipper authorisation token")
+	tokenFile := fs.String("token-file", "", "File containing the Web Clipper token")
+	notebook := fs.String("notebook", "", "Notebook title, created if missing (default: Joplin's current notebook)")
+	markdown := fs.String("markdown", "", "go-read-md markdown snapshot used as the note body and metadata")
+	title := fs.String("title", "", "Note title (overrides the snapshot)")
+	tags := fs.String("tags", "", "Comma-separated tags")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	j := &joplin{client: c.client(), endpoint: strings.TrimSuffix(*endpoint, "/")}
+	if j.token, err = readSecret(*token, *tokenFile); err != nil {
+		return err
+	}
+	if j.token == "" {
+		return fmt.Errorf("--token or --token-file is required")
+	}
+
+	meta := map[string]string{}
+	body := target
+	if *markdown != "" {
+		data, err := os.ReadFile(*markdown)
+		if err != nil {
+			return fmt.Errorf("failed to read markdown: %w", err)
+		}
+		if front, rest := splitFrontmatter(string(data)); front != nil {
+			meta, body = front, rest
+		} else {
+			body = string(data)
+		}
+		body = stripTitle(body, meta)
+	}
+	if *title != "" {
+		meta["title"] = *title
+	}
+	if meta["title"] == "" {
+		meta["title"] = target
+	}
+
+	note := map[string]any{
+		"title":      meta["title"],
+		"body":       body,
+		"source_url": target,
+	}
+	if meta["author"] != "" {
+		note["author"] = meta["author"]
+	}
+	if t := splitTags(*tags); len(t) > 0 {
+		note["tags"] = strings.Join(t, ",")
+	}
+
+	if *c.verbose {
+		log.Printf("📓 Sending %q to Joplin", meta["title"])
+	}
+	link, err := j.save(note, *notebook)
+	c.record(target, "joplin", link, err)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// save files the note in notebook and returns a joplin:// link that opens it.
+func (j *joplin) save(note map[string]any, notebook string) (string, error) {
+	if notebook != "" {
+		id, err := j.notebookID(notebook)
+		if err != nil {
+			return "", err
+		}
+		note["parent_id"] = id
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := j.call(http.MethodPost, "/notes", nil, note, &created); err != nil {
+		return "", err
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("joplin returned no note ID")
+	}
+	return "joplin://x-callback-url/openNote?id=" + created.ID, nil
+}
+
+// notebookID finds a notebook by title, case-insensitively, creating a
+// top-level one when there is no match.
+func (j *joplin) notebookID(title string) (string, error) {
+	for page := 1; ; page++ {
+		var list struct {
+			Items   []joplinFolder `json:"items"`
+			HasMore bool           `json:"has_more"`
+		}
+		query := url.Values{"fields": {"id,title"}, "page": {strconv.Itoa(page)}}
+		if err := j.call(http.MethodGet, "/folders", query, nil, &list); err != nil {
+			return "", err
+		}
+		for _, f := range list.Items {
+			if strings.EqualFold(f.Title, title) {
+				return f.ID, nil
+			}
+		}
+		if !list.HasMore {
+			break
+		}
+	}
+
+	log.Printf("📁 Creating Joplin notebook %q", title)
+	var created joplinFolder
+	if err := j.call(http.MethodPost, "/folders", nil, map[string]string{"title": title}, &created); err != nil {
+		return "", fmt.Errorf("failed to create notebook: %w", err)
+	}
+	return created.ID, nil
+}
+
+func (j *joplin) call(method, path string, query url.Values, body any, result any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("token", j.token)
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, j.endpoint+path+"?"+query.Encode(), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("joplin request failed (is Joplin running with the Web Clipper enabled?): %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("joplin error: %s %s", resp.Status, apiErr.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode joplin response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJoplin(t *testing.T) {
+	var note map[string]string
+	var createdFolder string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error":"Invalid \"token\" parameter"}`)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/folders":
+			if r.URL.Query().Get("page") == "1" {
+				fmt.Fprint(w, `{"items":[{"id":"f1","title":"Inbox"}],"has_more":true}`)
+			} else {
+				fmt.Fprint(w, `{"items":[{"id":"f2","title":"Reading"}],"has_more":false}`)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/folders":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			createdFolder = body["title"]
+			fmt.Fprint(w, `{"id":"f3","title":"New"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/notes":
+			json.NewDecoder(r.Body).Decode(&note)
+			fmt.Fprint(w, `{"id":"n1"}`)
+		}
+	}))
+	defer ts.Close()
+
+	md := "---\ntitle: \"Long Read\"\nauthor: \"Jane\"\n---\n\n# Long Read\n\nBody text."
+	file := filepath.Join(t.TempDir(), "long.md")
+	os.WriteFile(file, []byte(md), 0644)
+
+	stdout := &bytes.Buffer{}
+	err := runJoplin([]string{"--endpoint", ts.URL, "--token", "secret", "--notebook", "reading", "--markdown", file, "--tags", "go, web", "https://example.com/long"}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(stdout.String()) != "joplin://x-callback-url/openNote?id=n1" {
+		t.Errorf("unexpected link %q", stdout.String())
+	}
+	if note["parent_id"] != "f2" || note["title"] != "Long Read" || note["author"] != "Jane" ||
+		note["body"] != "Body text." || note["source_url"] != "https://example.com/long" || note["tags"] != "go,web" {
+		t.Errorf("unexpected note %v", note)
+	}
+
+	if err := runJoplin([]string{"--endpoint", ts.URL, "--token", "secret", "--notebook", "New", "https://example.com"}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if createdFolder != "New" || note["parent_id"] != "f3" || note["body"] != "https://example.com" {
+		t.Errorf("expected notebook to be created, got %q and %v", createdFolder, note)
+	}
+
+	err = runJoplin([]string{"--endpoint", ts.URL, "--token", "nope", "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "Invalid") {
+		t.Errorf("expected API error, got %v", err)
+	}
+}
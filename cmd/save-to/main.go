@@ -0,0 +1,141 @@
+// save-to hands a URL to an external archiving, bookmarking or read-later
+// service, or uploads its snapshot to remote storage (s3, webdav). Each
+// service is a subcommand with its own flags; the location the service
+// reports back is printed on stdout so plumber can capture it with save_to.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+// service runs one subcommand.
+type service func(args []string, stdout io.Writer) error
+
+var services = map[string]service{
+	"bookmark":   runBookmark,
+	"instapaper": runInstapaper,
+	"joplin":     runJoplin,
+	"notion":     runNotion,
+	"obsidian":   runObsidian,
+	"s3":         runS3,
+	"wallabag":   runWallabag,
+	"wayback":    runWayback,
+	"webdav":     runWebDAV,
+	"zotero":     runZotero,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		return fmt.Errorf("missing service")
+	}
+	svc, ok := services[args[0]]
+	if !ok {
+		usage(stderr)
+		return fmt.Errorf("unknown service %q", args[0])
+	}
+	return svc(args[1:], stdout)
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "Usage: save-to <service> [flags] <url>\n\n")
+	fmt.Fprintf(w, "Saves a URL to an external service and prints where it was stored.\n\n")
+	fmt.Fprintf(w, "Services: %s\n", strings.Join(names, ", "))
+	fmt.Fprintf(w, "Run 'save-to <service> --help' for the flags of a service.\n")
+}
+
+// common holds the flags shared by every service.
+type common struct {
+	history *string
+	timeout *time.Duration
+	verbose *bool
+}
+
+func addCommonFlags(fs *flag.FlagSet) *common {
+	return &common{
+		history: fs.String("history", "", "Append the result to this history file (e.g. plumber's << parameters.history_file >>)"),
+		timeout: fs.Duration("timeout", 30*time.Second, "Timeout for each request to the service"),
+		verbose: fs.Bool("verbose", false, "Enable verbose logging"),
+	}
+}
+
+// parse parses args and returns the URL to save, given as the single
+// positional argument.
+func (c *common) parse(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("expected exactly one URL argument")
+	}
+	target := fs.Arg(0)
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid URL: %s", target)
+	}
+	return target, nil
+}
+
+func (c *common) client() *http.Client {
+	return &http.Client{Timeout: *c.timeout}
+}
+
+// record appends the outcome to the history log when --history is set.
+// Failing to record never fails the save itself.
+func (c *common) record(target, svc, link string, saveErr error) {
+	if *c.history == "" {
+		return
+	}
+	e := history.Entry{
+		Kind:   history.KindSave,
+		URL:    target,
+		Target: svc,
+		Status: history.StatusSuccess,
+		Link:   link,
+	}
+	if saveErr != nil {
+		e.Status = history.StatusError
+		e.Error = saveErr.Error()
+	}
+	if err := history.Append(*c.history, e); err != nil {
+		log.Printf("⚠️ Failed to record history: %v", err)
+	}
+}
+
+// readSecret returns value, or the trimmed content of file when value is
+// empty. Keeping tokens in a file keeps them out of the config and the
+// process list.
+func readSecret(value, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"browser-pipes/internal/history"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("Error: Missing Service", func(t *testing.T) {
+		err := run(nil, &bytes.Buffer{}, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "missing service") {
+			t.Errorf("expected missing service error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Unknown Service", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		err := run([]string{"myspace", "https://example.com"}, &bytes.Buffer{}, stderr)
+		if err == nil || !strings.Contains(err.Error(), "unknown service") {
+			t.Errorf("expected unknown service error, got %v", err)
+		}
+		if !strings.Contains(stderr.String(), "wayback") {
+			t.Errorf("expected usage to list services, got %q", stderr.String())
+		}
+	})
+
+	t.Run("Error: Invalid URL", func(t *testing.T) {
+		err := run([]string{"wayback", "not a url"}, &bytes.Buffer{}, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "invalid URL") {
+			t.Errorf("expected invalid URL error, got %v", err)
+		}
+	})
+
+	t.Run("Success: History", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Location", "/web/20250301120000/https://example.com/")
+		}))
+		defer ts.Close()
+
+		historyPath := filepath.Join(t.TempDir(), "history.db")
+		stdout := &bytes.Buffer{}
+		err := run([]string{"wayback", "--endpoint", ts.URL, "--history", historyPath, "https://example.com/"}, stdout, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		entries, _ := history.Read(historyPath)
+		if len(entries) != 1 {
+			t.Fatalf("expected one history entry, got %d", len(entries))
+		}
+		e := entries[0]
+		if e.Kind != history.KindSave || e.Target != "wayback" || e.Link != strings.TrimSpace(stdout.String()) {
+			t.Errorf("unexpected history entry %+v", e)
+		}
+	})
+}
+
+func TestReadSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(file, []byte("s3cret\n"), 0600)
+
+	if got, _ := readSecret("flag", file); got != "flag" {
+		t.Errorf("expected the flag value to win, got %q", got)
+	}
+	if got, _ := readSecret("", file); got != "s3cret" {
+		t.Errorf("expected trimmed file content, got %q", got)
+	}
+	if _, err := readSecret("", file+".missing"); err == nil {
+		t.Error("expected error for missing secret file")
+	}
+}
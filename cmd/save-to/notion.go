@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	notionVersion   = "2022-06-28"
+	notionMaxBlocks = 100  // children per request
+	notionMaxText   = 2000 // characters per rich text object
+)
+
+// notion creates pages in a Notion database through the public API.
+type notion struct {
+	client   *http.Client
+	endpoint string
+	token    string
+}
+
+func runNotion(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("notion", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	endpoint := fs.String("endpoint", "https://api.notion.com", "Notion API base URL")
+	token := fs.String("token", "", "Internal integration token")
+	tokenFile := fs.String("token-file", "", "File containing the integration token")
+	database := fs.String("database", "", "ID of the database the page is created in (required)")
+	markdown := fs.String("markdown", "", "go-read-md markdown snapshot used as the page content and metadata")
+	title := fs.String("title", "", "Page title (overrides the snapshot)")
+	author := fs.String("author", "", "Author (overrides the snapshot)")
+	titleProp := fs.String("title-property", "Name", "Title property of the database")
+	urlProp := fs.String("url-property", "URL", "URL property of the database (empty to skip)")
+	authorProp := fs.String("author-property", "", "Text property for the author (empty to skip)")
+	dateProp := fs.String("date-property", "", "Date property for the publish date (empty to skip)")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *database == "" {
+		return fmt.Errorf("--database is required")
+	}
+	n := &notion{client: c.client(), endpoint: strings.TrimSuffix(*endpoint, "/")}
+	if n.token, err = readSecret(*token, *tokenFile); err != nil {
+		return err
+	}
+	if n.token == "" {
+		return fmt.Errorf("--token or --token-file is required")
+	}
+
+	var meta map[string]string
+	var blocks []map[string]any
+	if *markdown != "" {
+		data, err := os.ReadFile(*markdown)
+		if err != nil {
+			return fmt.Errorf("failed to read markdown: %w", err)
+		}
+		var body string
+		meta, body = splitFrontmatter(string(data))
+		body = stripTitle(body, meta)
+		blocks = markdownBlocks(body)
+	}
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	if *title != "" {
+		meta["title"] = *title
+	}
+	if *author != "" {
+		meta["author"] = *author
+	}
+	if meta["title"] == "" {
+		meta["title"] = target
+	}
+
+	props := map[string]any{*titleProp: map[string]any{"title": richText(meta["title"])}}
+	if *urlProp != "" {
+		props[*urlProp] = map[string]any{"url": target}
+	}
+	if *authorProp != "" && meta["author"] != "" {
+		props[*authorProp] = map[string]any{"rich_text": richText(meta["author"])}
+	}
+	if *dateProp != "" && meta["published"] != "" {
+		props[*dateProp] = map[string]any{"date": map[string]string{"start": meta["published"]}}
+	}
+
+	if *c.verbose {
+		log.Printf("🗒️ Creating Notion page %q with %d blocks", meta["title"], len(blocks))
+	}
+	link, err := n.createPage(*database, props, blocks)
+	c.record(target, "notion", link, err)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// createPage creates the page with its first blocks and appends the rest in
+// batches, since Notion limits the number of children per request.
+func (n *notion) createPage(database string, props map[string]any, blocks []map[string]any) (string, error) {
+	first := blocks
+	if len(first) > notionMaxBlocks {
+		first = first[:notionMaxBlocks]
+	}
+	page := map[string]any{
+		"parent":     map[string]string{"database_id": database},
+		"properties": props,
+		"children":   nonNilBlocks(first),
+	}
+
+	var created struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := n.call(http.MethodPost, "/v1/pages", page, &created); err != nil {
+		return "", err
+	}
+
+	for rest := blocks[len(first):]; len(rest) > 0; {
+		batch := rest
+		if len(batch) > notionMaxBlocks {
+			batch = batch[:notionMaxBlocks]
+		}
+		rest = rest[len(batch):]
+		if err := n.call(http.MethodPatch, "/v1/blocks/"+created.ID+"/children", map[string]any{"children": batch}, nil); err != nil {
+			return created.URL, fmt.Errorf("page created but content is incomplete: %w", err)
+		}
+	}
+	return created.URL, nil
+}
+
+func (n *notion) call(method, path string, body any, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, n.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+n.token)
+	req.Header.Set("Notion-Version", notionVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notion request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("notion error: %s %s", resp.Status, apiErr.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode notion response: %w", err)
+	}
+	return nil
+}
+
+// splitFrontmatter separates go-read-md's YAML frontmatter from the body.
+// Values are single-line scalars, JSON-quoted when they need quoting.
+func splitFrontmatter(md string) (map[string]string, string) {
+	rest, ok := strings.CutPrefix(md, "---\n")
+	if !ok {
+		return nil, md
+	}
+	front, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return nil, md
+	}
+
+	meta := make(map[string]string)
+	for _, line := range strings.Split(front, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		var unquoted string
+		if strings.HasPrefix(value, `"`) && json.Unmarshal([]byte(value), &unquoted) == nil {
+			value = unquoted
+		}
+		meta[strings.TrimSpace(key)] = value
+	}
+	return meta, strings.TrimLeft(body, "\n")
+}
+
+// stripTitle drops the leading "# Title" heading, which becomes the page
+// title, filling meta["title"] from it if the frontmatter had none.
+func stripTitle(body string, meta map[string]string) string {
+	first, rest, _ := strings.Cut(body, "\n")
+	title, ok := strings.CutPrefix(first, "# ")
+	if !ok {
+		return body
+	}
+	if meta != nil && meta["title"] == "" {
+		meta["title"] = strings.TrimSpace(title)
+	}
+	return strings.TrimLeft(rest, "\n")
+}
+
+var orderedItem = regexp.MustCompile(`^\d+\.\s+`)
+
+// markdownBlocks converts markdown into Notion blocks: headings, lists,
+// quotes, code fences, dividers and paragraphs. Inline formatting is kept as
+// plain text.
+func markdownBlocks(md string) []map[string]any {
+	var blocks []map[string]any
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, textBlock("paragraph", strings.Join(para, " ")))
+			para = nil
+		}
+	}
+
+	lines := strings.Split(md, "\n")
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			lang := strings.TrimPrefix(trimmed, "```")
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			block := textBlock("code", strings.Join(code, "\n"))
+			block["code"].(map[string]any)["language"] = notionLanguage(lang)
+			blocks = append(blocks, block)
+		case trimmed == "---" || trimmed == "***":
+			flush()
+			blocks = append(blocks, map[string]any{"object": "block", "type": "divider", "divider": map[string]any{}})
+		case strings.HasPrefix(trimmed, "### "):
+			flush()
+			blocks = append(blocks, textBlock("heading_3", trimmed[4:]))
+		case strings.HasPrefix(trimmed, "## "):
+			flush()
+			blocks = append(blocks, textBlock("heading_2", trimmed[3:]))
+		case strings.HasPrefix(trimmed, "# "):
+			flush()
+			blocks = append(blocks, textBlock("heading_1", trimmed[2:]))
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			flush()
+			blocks = append(blocks, textBlock("bulleted_list_item", trimmed[2:]))
+		case orderedItem.MatchString(trimmed):
+			flush()
+			blocks = append(blocks, textBlock("numbered_list_item", orderedItem.ReplaceAllString(trimmed, "")))
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			blocks = append(blocks, textBlock("quote", strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))))
+		default:
+			para = append(para, trimmed)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func textBlock(kind, text string) map[string]any {
+	return map[string]any{
+		"object": "block",
+		"type":   kind,
+		kind:     map[string]any{"rich_text": richText(text)},
+	}
+}
+
+// richText splits text into rich text objects within Notion's size limit.
+func richText(text string) []map[string]any {
+	var out []map[string]any
+	runes := []rune(text)
+	for len(runes) > 0 {
+		n := min(len(runes), notionMaxText)
+		out = append(out, map[string]any{"type": "text", "text": map[string]string{"content": string(runes[:n])}})
+		runes = runes[n:]
+	}
+	if out == nil {
+		out = []map[string]any{}
+	}
+	return out
+}
+
+// notionLanguages are the code block languages we pass through; Notion
+// rejects languages it does not know.
+var notionLanguages = map[string]bool{
+	"bash": true, "c": true, "c++": true, "c#": true, "css": true, "go": true,
+	"html": true, "java": true, "javascript": true, "json": true, "kotlin": true,
+	"markdown": true, "php": true, "python": true, "ruby": true, "rust": true,
+	"shell": true, "sql": true, "swift": true, "typescript": true, "yaml": true,
+}
+
+// notionLanguage maps a code fence info string to a Notion code language.
+func notionLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	switch lang {
+	case "sh", "zsh":
+		lang = "shell"
+	case "js":
+		lang = "javascript"
+	case "ts":
+		lang = "typescript"
+	case "py":
+		lang = "python"
+	case "yml":
+		lang = "yaml"
+	}
+	if notionLanguages[lang] {
+		return lang
+	}
+	return "plain text"
+}
+
+func nonNilBlocks(blocks []map[string]any) []map[string]any {
+	if blocks == nil {
+		return []map[string]any{}
+	}
+	return blocks
+}
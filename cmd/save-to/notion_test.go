@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownBlocks(t *testing.T) {
+	md := "Intro line one\nline two.\n\n## Section\n\n- a\n* b\n1. first\n\n> quoted\n\n```go\nfmt.Println()\n```\n\n---\n"
+	var kinds []string
+	for _, b := range markdownBlocks(md) {
+		kinds = append(kinds, b["type"].(string))
+	}
+	want := "paragraph heading_2 bulleted_list_item bulleted_list_item numbered_list_item quote code divider"
+	if strings.Join(kinds, " ") != want {
+		t.Errorf("got blocks %v", kinds)
+	}
+
+	blocks := markdownBlocks("Intro line one\nline two.")
+	text := blocks[0]["paragraph"].(map[string]any)["rich_text"].([]map[string]any)[0]["text"].(map[string]string)["content"]
+	if text != "Intro line one line two." {
+		t.Errorf("expected paragraph lines to be joined, got %q", text)
+	}
+
+	if n := len(richText(strings.Repeat("x", notionMaxText*2+1))); n != 3 {
+		t.Errorf("expected long text to be split in 3, got %d", n)
+	}
+}
+
+func TestSplitFrontmatter(t *testing.T) {
+	meta, body := splitFrontmatter("---\ntitle: \"A: \\\"B\\\"\"\nauthor: \"Jane\"\npublished: 2024-01-02T00:00:00Z\n---\n\n# A: \"B\"\n\nBody")
+	if meta["title"] != `A: "B"` || meta["author"] != "Jane" || meta["published"] != "2024-01-02T00:00:00Z" {
+		t.Errorf("unexpected meta %v", meta)
+	}
+	if got := stripTitle(body, meta); got != "Body" {
+		t.Errorf("unexpected body %q", got)
+	}
+
+	meta, body = splitFrontmatter("# Plain\n\nBody")
+	if meta != nil {
+		t.Errorf("expected no frontmatter, got %v", meta)
+	}
+	meta = map[string]string{}
+	if stripTitle(body, meta); meta["title"] != "Plain" {
+		t.Errorf("expected title from heading, got %v", meta)
+	}
+}
+
+func TestNotion(t *testing.T) {
+	var page map[string]any
+	appended := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Notion-Version") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"API token is invalid."}`)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/pages":
+			json.NewDecoder(r.Body).Decode(&page)
+			fmt.Fprint(w, `{"id":"page-1","url":"https://www.notion.so/page-1"}`)
+		case r.Method == http.MethodPatch && r.URL.Path == "/v1/blocks/page-1/children":
+			var body struct{ Children []any }
+			json.NewDecoder(r.Body).Decode(&body)
+			appended += len(body.Children)
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer ts.Close()
+
+	md := "---\ntitle: \"Long Read\"\nauthor: \"Jane\"\n---\n\n# Long Read\n\n" + strings.Repeat("Paragraph.\n\n", 150)
+	file := filepath.Join(t.TempDir(), "long.md")
+	os.WriteFile(file, []byte(md), 0644)
+
+	stdout := &bytes.Buffer{}
+	err := runNotion([]string{"--endpoint", ts.URL, "--token", "secret", "--database", "db", "--markdown", file, "--author-property", "Author", "https://example.com/long"}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(stdout.String()) != "https://www.notion.so/page-1" {
+		t.Errorf("unexpected link %q", stdout.String())
+	}
+
+	props := page["properties"].(map[string]any)
+	if title, _ := json.Marshal(props["Name"]); !strings.Contains(string(title), "Long Read") {
+		t.Errorf("unexpected title property %s", title)
+	}
+	if props["URL"].(map[string]any)["url"] != "https://example.com/long" || props["Author"] == nil {
+		t.Errorf("unexpected properties %v", props)
+	}
+	if n := len(page["children"].([]any)); n != notionMaxBlocks || appended != 50 {
+		t.Errorf("expected 100 blocks on create and 50 appended, got %d and %d", n, appended)
+	}
+
+	err = runNotion([]string{"--endpoint", ts.URL, "--token", "nope", "--database", "db", "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "API token is invalid") {
+		t.Errorf("expected API error, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+// runObsidian files a markdown snapshot that go-read-md wrote into an
+// Obsidian vault: it links the note from today's daily note and can open it
+// in Obsidian. It does not write the note itself.
+func runObsidian(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("obsidian", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	vault := fs.String("vault", "", "Path to the Obsidian vault (required)")
+	note := fs.String("note", "", "The markdown snapshot inside the vault (default: the latest snapshot of the URL in --history)")
+	dailyFolder := fs.String("daily-folder", "", "Vault folder of the daily notes")
+	dailyFormat := fs.String("daily-format", "2006-01-02", "Go time layout of daily note names")
+	daily := fs.Bool("daily", false, "Append a link to the note to today's daily note")
+	open := fs.Bool("open", false, "Open the note in Obsidian via its obsidian:// URI")
+	opener := fs.String("opener", "xdg-open", "Command used to open the obsidian:// URI")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *vault == "" {
+		return fmt.Errorf("--vault is required")
+	}
+
+	notePath, title := *note, ""
+	if notePath == "" {
+		if *c.history == "" {
+			return fmt.Errorf("--note or --history is required")
+		}
+		if notePath, title, err = latestMarkdown(*c.history, target); err != nil {
+			return err
+		}
+	}
+
+	rel, err := vaultPath(*vault, notePath)
+	if err != nil {
+		return err
+	}
+	link := obsidianURI(*vault, rel)
+
+	if *daily {
+		dailyNote := filepath.Join(*vault, *dailyFolder, time.Now().Format(*dailyFormat)+".md")
+		if err := appendDailyLink(dailyNote, rel, title); err != nil {
+			c.record(target, "obsidian", link, err)
+			return err
+		}
+		if *c.verbose {
+			log.Printf("🗓️ Linked from %s", dailyNote)
+		}
+	}
+
+	if *open {
+		if err := exec.Command(*opener, link).Start(); err != nil {
+			c.record(target, "obsidian", link, err)
+			return fmt.Errorf("failed to open note: %w", err)
+		}
+	}
+
+	// Record only what this step did; go-read-md already logged the snapshot.
+	if *daily || *open {
+		c.record(target, "obsidian", link, nil)
+	}
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// latestMarkdown returns the newest markdown file recorded for target in
+// the history log, with the page title.
+func latestMarkdown(historyPath, target string) (string, string, error) {
+	entries, err := history.Query(historyPath, history.Filter{Kind: history.KindSnapshot, Status: history.StatusSuccess, URL: target})
+	if err != nil {
+		return "", "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.URL != target {
+			continue
+		}
+		for _, f := range e.Files {
+			if strings.HasSuffix(f, ".md") {
+				return f, e.Title, nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("no markdown snapshot of %s in %s", target, historyPath)
+}
+
+// vaultPath returns note relative to the vault, which it must be inside of.
+func vaultPath(vault, note string) (string, error) {
+	absVault, err := filepath.Abs(vault)
+	if err != nil {
+		return "", err
+	}
+	absNote, err := filepath.Abs(note)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absVault, absNote)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("note %s is not inside the vault %s", note, vault)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// obsidianURI opens file (relative to the vault) in the vault named after
+// the vault folder, which is how Obsidian names vaults by default.
+func obsidianURI(vault, rel string) string {
+	name := filepath.Base(filepath.Clean(vault))
+	q := "vault=" + url.QueryEscape(name) + "&file=" + url.QueryEscape(strings.TrimSuffix(rel, ".md"))
+	return "obsidian://open?" + strings.ReplaceAll(q, "+", "%20")
+}
+
+// appendDailyLink adds a wikilink to rel at the end of the daily note,
+// creating the note if needed.
+func appendDailyLink(dailyNote, rel, title string) error {
+	if err := os.MkdirAll(filepath.Dir(dailyNote), 0755); err != nil {
+		return fmt.Errorf("failed to create daily notes folder: %w", err)
+	}
+	f, err := os.OpenFile(dailyNote, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open daily note: %w", err)
+	}
+	defer f.Close()
+
+	link := strings.TrimSuffix(rel, ".md")
+	if title != "" {
+		link += "|" + strings.NewReplacer("[", "", "]", "", "|", "-").Replace(title)
+	}
+	if _, err := fmt.Fprintf(f, "- [[%s]]\n", link); err != nil {
+		return fmt.Errorf("failed to write daily note: %w", err)
+	}
+	return nil
+}
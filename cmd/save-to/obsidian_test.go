@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+func TestObsidian(t *testing.T) {
+	vault := filepath.Join(t.TempDir(), "My Vault")
+	note := filepath.Join(vault, "Clippings", "Go_Proverbs_abcd1234.md")
+	os.MkdirAll(filepath.Dir(note), 0755)
+	os.WriteFile(note, []byte("# Go Proverbs\n"), 0644)
+
+	historyPath := filepath.Join(t.TempDir(), "history.db")
+	history.Append(historyPath, history.Entry{Kind: history.KindSnapshot, URL: "https://go-proverbs.github.io/", Status: history.StatusSuccess, Title: "Go [Proverbs]", Files: []string{note}})
+
+	stdout := &bytes.Buffer{}
+	err := runObsidian([]string{"--vault", vault, "--daily", "--daily-folder", "Daily", "--history", historyPath, "https://go-proverbs.github.io/"}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "obsidian://open?vault=My%20Vault&file=Clippings%2FGo_Proverbs_abcd1234"
+	if got := strings.TrimSpace(stdout.String()); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	daily, err := os.ReadFile(filepath.Join(vault, "Daily", time.Now().Format("2006-01-02")+".md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(daily) != "- [[Clippings/Go_Proverbs_abcd1234|Go Proverbs]]\n" {
+		t.Errorf("unexpected daily note %q", daily)
+	}
+
+	entries, _ := history.Read(historyPath)
+	if last := entries[len(entries)-1]; last.Kind != history.KindSave || last.Target != "obsidian" || last.Link != want {
+		t.Errorf("unexpected history entry %+v", last)
+	}
+}
+
+func TestObsidianErrors(t *testing.T) {
+	vault := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "note.md")
+
+	err := runObsidian([]string{"--vault", vault, "--note", outside, "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "not inside the vault") {
+		t.Errorf("expected outside-vault error, got %v", err)
+	}
+	err = runObsidian([]string{"--vault", vault, "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "--note or --history is required") {
+		t.Errorf("expected missing note error, got %v", err)
+	}
+	err = runObsidian([]string{"--vault", vault, "--history", filepath.Join(vault, "h.jsonl"), "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "no markdown snapshot") {
+		t.Errorf("expected missing snapshot error, got %v", err)
+	}
+}
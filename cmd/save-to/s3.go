@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// s3 uploads snapshot folders to an S3-compatible object store (AWS, MinIO,
+// Garage, Backblaze B2, Cloudflare R2, ...) with Signature Version 4 signed
+// PUT requests.
+type s3 struct {
+	client       *http.Client
+	endpoint     *url.URL
+	bucket       string
+	region       string
+	accessKey    string
+	secretKey    string
+	virtualHosts bool // bucket.endpoint/key instead of endpoint/bucket/key
+	now          func() time.Time
+}
+
+func runS3(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("s3", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	endpoint := fs.String("endpoint", "https://s3.amazonaws.com", "S3 endpoint, e.g. http://nas.local:9000 for MinIO")
+	bucket := fs.String("bucket", "", "Bucket to upload to")
+	region := fs.String("region", "us-east-1", "Region used to sign requests")
+	token := fs.String("token", "", "Access keys as ACCESS:SECRET")
+	tokenFile := fs.String("token-file", "", "File containing the access keys as ACCESS:SECRET")
+	dir := fs.String("dir", "", "Folder to upload, e.g. the go-read-md --output of a previous step")
+	prefix := fs.String("prefix", "", "Key prefix (remote folder) the files are stored under")
+	virtualHosts := fs.Bool("virtual-hosted", false, "Address the bucket as a subdomain of the endpoint, as newer AWS buckets require")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *bucket == "" || *dir == "" {
+		return fmt.Errorf("--bucket and --dir are required")
+	}
+	keys, err := readSecret(*token, *tokenFile)
+	if err != nil {
+		return err
+	}
+	access, secret, ok := strings.Cut(keys, ":")
+	if !ok || access == "" || secret == "" {
+		return fmt.Errorf("--token or --token-file with ACCESS:SECRET keys is required")
+	}
+	u, err := url.Parse(strings.TrimSuffix(*endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid --endpoint %q", *endpoint)
+	}
+
+	s := &s3{
+		client:       c.client(),
+		endpoint:     u,
+		bucket:       *bucket,
+		region:       *region,
+		accessKey:    access,
+		secretKey:    secret,
+		virtualHosts: *virtualHosts,
+		now:          time.Now,
+	}
+	folder := cleanPrefix(*prefix)
+	n, err := uploadDir(*dir, folder, *c.verbose, s.put)
+	link := s.objectURL(folder)
+	c.record(target, "s3", link, err)
+	if err != nil {
+		return err
+	}
+	log.Printf("🪣 Uploaded %d files to %s", n, link)
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// objectURL returns the URL of key in the bucket.
+func (s *s3) objectURL(key string) string {
+	u := *s.endpoint
+	escaped := s3Escape(key)
+	if s.virtualHosts {
+		u.Host = s.bucket + "." + u.Host
+	} else {
+		escaped = s3Escape(s.bucket) + "/" + escaped
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimSuffix(u.EscapedPath(), "/") + "/" + escaped
+}
+
+func (s *s3) put(key string, data []byte, contentType string) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, data, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 error: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req. Only the headers
+// put sets are signed.
+func (s *s3) sign(req *http.Request, payload []byte, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSHA256(signingKey(s.secretKey, date, s.region, "s3"), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// signingKey derives the SigV4 key for one day, region and service.
+func signingKey(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3Escape percent-encodes a key the way SigV4 expects: everything but
+// unreserved characters and the / separators.
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+// writeSnapshotDir creates a staging folder as go-read-md --output leaves it.
+func writeSnapshotDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "assets"), 0755)
+	os.WriteFile(filepath.Join(dir, "My Post.md"), []byte("# My Post\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "assets", "chart.png"), []byte("png"), 0644)
+	return dir
+}
+
+func TestSigningKey(t *testing.T) {
+	// From the AWS Signature Version 4 documentation.
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20150830", "us-east-1", "iam")
+	if got := hex.EncodeToString(key); got != "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9" {
+		t.Errorf("unexpected signing key %s", got)
+	}
+}
+
+func TestS3(t *testing.T) {
+	var mu sync.Mutex
+	uploads := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.Method != http.MethodPut || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		uploads[r.URL.EscapedPath()] = string(body)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys")
+	os.WriteFile(keys, []byte("AKID:secret\n"), 0600)
+	historyPath := filepath.Join(dir, "history.db")
+
+	stdout := &bytes.Buffer{}
+	err := runS3([]string{
+		"--endpoint", ts.URL, "--bucket", "archive", "--region", "eu-west-1", "--token-file", keys,
+		"--dir", writeSnapshotDir(t), "--prefix", "/2025/abc123/", "--history", historyPath, "https://example.com/post",
+	}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploads["/archive/2025/abc123/My%20Post.md"] != "# My Post\n" || uploads["/archive/2025/abc123/assets/chart.png"] != "png" {
+		t.Errorf("unexpected uploads %v", uploads)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != ts.URL+"/archive/2025/abc123" {
+		t.Errorf("expected the remote folder on stdout, got %q", got)
+	}
+	if entries, _ := history.Read(historyPath); len(entries) != 1 || entries[0].Target != "s3" {
+		t.Errorf("expected a history entry, got %+v", entries)
+	}
+
+	err = runS3([]string{"--endpoint", ts.URL, "--bucket", "archive", "--dir", dir, "https://example.com/post"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "ACCESS:SECRET") {
+		t.Errorf("expected a missing keys error, got %v", err)
+	}
+}
+
+func TestS3Sign(t *testing.T) {
+	s := &s3{bucket: "b", region: "us-east-1", accessKey: "AKID", secretKey: "secret"}
+	req, _ := http.NewRequest(http.MethodPut, "https://s3.example.com/b/a%20b%2Bc.md", strings.NewReader("x"))
+	req.Header.Set("Content-Type", "text/markdown")
+	s.sign(req, []byte("x"), time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	if req.Header.Get("X-Amz-Date") != "20250301T120000Z" {
+		t.Errorf("unexpected date header %q", req.Header.Get("X-Amz-Date"))
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20250301/us-east-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Errorf("unexpected authorization %q", auth)
+	}
+	if s3Escape("2025/a b+c(1).md") != "2025/a%20b%2Bc%281%29.md" {
+		t.Errorf("unexpected key escaping %q", s3Escape("2025/a b+c(1).md"))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// putFunc stores one file under key (a slash-separated path relative to
+// the remote folder).
+type putFunc func(key string, data []byte, contentType string) error
+
+// uploadDir stores every file under dir through put, keeping their paths
+// relative to dir below prefix. Storage services upload a folder rather
+// than a single file so a snapshot keeps its formats and assets together:
+// plumber jobs write it into a staging folder in their temporary workspace
+// first (go-read-md --output), then hand the folder to save-to.
+func uploadDir(dir, prefix string, verbose bool, put putFunc) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		key := path.Join(prefix, filepath.ToSlash(rel))
+		if verbose {
+			log.Printf("⬆️ Uploading %s", key)
+		}
+		if err := put(key, data, contentType(p)); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", rel, err)
+		}
+		count++
+		return nil
+	})
+	if err == nil && count == 0 {
+		err = fmt.Errorf("no files to upload in %s", dir)
+	}
+	return count, err
+}
+
+// contentType guesses the type of a snapshot file from its extension.
+func contentType(name string) string {
+	switch ext := filepath.Ext(name); ext {
+	case ".md":
+		return "text/markdown; charset=utf-8"
+	case ".warc":
+		return "application/warc"
+	case ".epub":
+		return "application/epub+zip"
+	case ".age":
+		return "application/octet-stream"
+	default:
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+	}
+	return "application/octet-stream"
+}
+
+// cleanPrefix normalizes a remote folder given on the command line.
+func cleanPrefix(prefix string) string {
+	return strings.Trim(path.Clean("/"+prefix), "/")
+}
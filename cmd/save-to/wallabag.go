@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// wallabag saves entries through the Wallabag API, authenticating with the
+// OAuth password grant of an API client created in Wallabag's settings.
+type wallabag struct {
+	client       *http.Client
+	base         string
+	clientID     string
+	clientSecret string
+	username     string
+	password     string
+}
+
+func runWallabag(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("wallabag", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	base := fs.String("base-url", "", "Wallabag instance URL, e.g. https://wallabag.example.com (required)")
+	clientID := fs.String("client-id", "", "API client ID (required)")
+	clientSecret := fs.String("client-secret", "", "API client secret")
+	clientSecretFile := fs.String("client-secret-file", "", "File containing the API client secret")
+	username := fs.String("username", "", "Wallabag user (required)")
+	password := fs.String("password", "", "Wallabag password")
+	passwordFile := fs.String("password-file", "", "File containing the Wallabag password")
+	tags := fs.String("tags", "", "Comma-separated tags for the entry")
+	title := fs.String("title", "", "Entry title (default: Wallabag extracts it)")
+	content := fs.String("content", "", "HTML file with pre-extracted content, e.g. plumber's {html}, instead of letting Wallabag fetch the URL")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *base == "" || *clientID == "" || *username == "" {
+		return fmt.Errorf("--base-url, --client-id and --username are required")
+	}
+
+	w := &wallabag{client: c.client(), base: strings.TrimSuffix(*base, "/"), clientID: *clientID, username: *username}
+	if w.clientSecret, err = readSecret(*clientSecret, *clientSecretFile); err != nil {
+		return err
+	}
+	if w.password, err = readSecret(*password, *passwordFile); err != nil {
+		return err
+	}
+
+	entry := url.Values{"url": {target}}
+	if *tags != "" {
+		entry.Set("tags", *tags)
+	}
+	if *title != "" {
+		entry.Set("title", *title)
+	}
+	if *content != "" {
+		html, err := os.ReadFile(*content)
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+		entry.Set("content", string(html))
+	}
+
+	if *c.verbose {
+		log.Printf("📥 Saving %s to %s", target, w.base)
+	}
+	link, err := w.save(entry)
+	c.record(target, "wallabag", link, err)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// token exchanges the user credentials for an access token.
+func (w *wallabag) token() (string, error) {
+	resp, err := w.client.PostForm(w.base+"/oauth/v2/token", url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {w.clientID},
+		"client_secret": {w.clientSecret},
+		"username":      {w.username},
+		"password":      {w.password},
+	})
+	if err != nil {
+		return "", fmt.Errorf("wallabag authentication failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("wallabag authentication failed: %s", resp.Status)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil || tok.AccessToken == "" {
+		return "", fmt.Errorf("wallabag returned no access token")
+	}
+	return tok.AccessToken, nil
+}
+
+// save creates the entry and returns the link to it in the Wallabag UI.
+func (w *wallabag) save(entry url.Values) (string, error) {
+	token, err := w.token()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.base+"/api/entries.json", strings.NewReader(entry.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("wallabag request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("wallabag error: %s", resp.Status)
+	}
+
+	var created struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to decode wallabag response: %w", err)
+	}
+	return fmt.Sprintf("%s/view/%d", w.base, created.ID), nil
+}
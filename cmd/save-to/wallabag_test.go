@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWallabag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/v2/token":
+			if r.FormValue("grant_type") != "password" || r.FormValue("password") != "hunter2" || r.FormValue("client_secret") != "cs" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"tok","token_type":"bearer"}`)
+		case "/api/entries.json":
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.FormValue("url") != "https://example.com/a" || r.FormValue("tags") != "go,reading" || r.FormValue("content") != "<p>hi</p>" {
+				t.Errorf("unexpected entry %v", r.Form)
+			}
+			fmt.Fprint(w, `{"id":42,"url":"https://example.com/a"}`)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	os.WriteFile(passwordFile, []byte("hunter2\n"), 0600)
+	content := filepath.Join(dir, "page.html")
+	os.WriteFile(content, []byte("<p>hi</p>"), 0644)
+
+	stdout := &bytes.Buffer{}
+	err := runWallabag([]string{
+		"--base-url", ts.URL + "/", "--client-id", "id", "--client-secret", "cs",
+		"--username", "me", "--password-file", passwordFile,
+		"--tags", "go,reading", "--content", content, "https://example.com/a",
+	}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != ts.URL+"/view/42" {
+		t.Errorf("unexpected link %q", got)
+	}
+
+	err = runWallabag([]string{"--base-url", ts.URL, "--client-id", "id", "--username", "me", "--password", "wrong", "https://example.com/a"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+
+	err = runWallabag([]string{"https://example.com/a"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "are required") {
+		t.Errorf("expected missing flags error, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// wayback talks to the Internet Archive's Save Page Now service. Without
+// keys it uses the anonymous GET /save/<url> form; with archive.org S3 keys
+// it uses the SPN2 API, which supports capture options and reports failures.
+type wayback struct {
+	client   *http.Client
+	endpoint string
+	keys     string // "ACCESS:SECRET", empty for anonymous captures
+	poll     time.Duration
+	wait     time.Duration
+}
+
+func runWayback(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("wayback", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	endpoint := fs.String("endpoint", "https://web.archive.org", "Wayback Machine base URL")
+	token := fs.String("token", "", "archive.org S3 keys as ACCESS:SECRET (enables the authenticated API)")
+	tokenFile := fs.String("token-file", "", "File containing the archive.org S3 keys")
+	outlinks := fs.Bool("capture-outlinks", false, "Also capture the pages the URL links to (needs keys)")
+	screenshot := fs.Bool("capture-screenshot", false, "Also capture a screenshot of the page (needs keys)")
+	wait := fs.Duration("wait", 2*time.Minute, "How long to wait for an authenticated capture to finish")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	keys, err := readSecret(*token, *tokenFile)
+	if err != nil {
+		return err
+	}
+	if keys == "" && (*outlinks || *screenshot) {
+		return fmt.Errorf("--capture-outlinks and --capture-screenshot require --token or --token-file")
+	}
+
+	w := &wayback{
+		client:   c.client(),
+		endpoint: strings.TrimSuffix(*endpoint, "/"),
+		keys:     keys,
+		poll:     5 * time.Second,
+		wait:     *wait,
+	}
+	if *c.verbose {
+		log.Printf("🏛️ Submitting %s to Save Page Now", target)
+	}
+
+	var link string
+	if keys == "" {
+		link, err = w.saveAnonymous(target)
+	} else {
+		link, err = w.save(target, *outlinks, *screenshot)
+	}
+	c.record(target, "wayback", link, err)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// saveAnonymous captures target and returns the archived URL, which the
+// service reports in Content-Location or by redirecting to it.
+func (w *wayback) saveAnonymous(target string) (string, error) {
+	resp, err := w.client.Get(w.endpoint + "/save/" + target)
+	if err != nil {
+		return "", fmt.Errorf("Save Page Now request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Save Page Now error: %s", resp.Status)
+	}
+	if loc := resp.Header.Get("Content-Location"); strings.HasPrefix(loc, "/web/") {
+		return w.endpoint + loc, nil
+	}
+	if strings.HasPrefix(resp.Request.URL.Path, "/web/") {
+		return resp.Request.URL.String(), nil
+	}
+	return "", fmt.Errorf("Save Page Now did not return an archive URL")
+}
+
+// spnStatus is the part of the SPN2 responses we care about.
+type spnStatus struct {
+	JobID       string `json:"job_id"`
+	Status      string `json:"status"` // pending, success or error
+	Timestamp   string `json:"timestamp"`
+	OriginalURL string `json:"original_url"`
+	Message     string `json:"message"`
+}
+
+// save submits target to the SPN2 API and polls the capture job until it
+// finishes, returning the archived URL.
+func (w *wayback) save(target string, outlinks, screenshot bool) (string, error) {
+	form := url.Values{"url": {target}}
+	if outlinks {
+		form.Set("capture_outlinks", "1")
+	}
+	if screenshot {
+		form.Set("capture_screenshot", "1")
+	}
+
+	var job spnStatus
+	err := w.call(http.MethodPost, "/save", strings.NewReader(form.Encode()), &job)
+	if err != nil {
+		return "", err
+	}
+	if job.JobID == "" {
+		return "", fmt.Errorf("Save Page Now rejected the URL: %s", job.Message)
+	}
+
+	deadline := time.Now().Add(w.wait)
+	for {
+		var status spnStatus
+		if err := w.call(http.MethodGet, "/save/status/"+job.JobID, nil, &status); err != nil {
+			return "", err
+		}
+		switch status.Status {
+		case "success":
+			original := status.OriginalURL
+			if original == "" {
+				original = target
+			}
+			return fmt.Sprintf("%s/web/%s/%s", w.endpoint, status.Timestamp, original), nil
+		case "error":
+			return "", fmt.Errorf("Save Page Now capture failed: %s", status.Message)
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("Save Page Now capture %s still pending after %s", job.JobID, w.wait)
+		}
+		time.Sleep(w.poll)
+	}
+}
+
+func (w *wayback) call(method, path string, body io.Reader, result any) error {
+	req, err := http.NewRequest(method, w.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "LOW "+w.keys)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Save Page Now request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Save Page Now error: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode Save Page Now response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaybackAnonymous(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/save/https://example.com/page" {
+			w.Header().Set("Location", "/web/20250301120000/https://example.com/page")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "archived")
+	}))
+	defer ts.Close()
+
+	stdout := &bytes.Buffer{}
+	if err := runWayback([]string{"--endpoint", ts.URL, "https://example.com/page"}, stdout); err != nil {
+		t.Fatal(err)
+	}
+	want := ts.URL + "/web/20250301120000/https://example.com/page"
+	if strings.TrimSpace(stdout.String()) != want {
+		t.Errorf("expected %q, got %q", want, stdout.String())
+	}
+}
+
+func TestWaybackAuthenticated(t *testing.T) {
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "LOW key:secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/save":
+			r.ParseForm()
+			if r.Form.Get("capture_outlinks") != "1" || r.Form.Get("url") != "https://example.com" {
+				t.Errorf("unexpected form %v", r.Form)
+			}
+			fmt.Fprint(w, `{"url":"https://example.com","job_id":"spn2-1"}`)
+		case "/save/status/spn2-1":
+			polls++
+			if polls == 1 {
+				fmt.Fprint(w, `{"status":"pending"}`)
+				return
+			}
+			fmt.Fprint(w, `{"status":"success","timestamp":"20250301120000","original_url":"https://example.com/"}`)
+		}
+	}))
+	defer ts.Close()
+
+	w := &wayback{client: ts.Client(), endpoint: ts.URL, keys: "key:secret", wait: time.Second}
+	link, err := w.save("https://example.com", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != ts.URL+"/web/20250301120000/https://example.com/" || polls != 2 {
+		t.Errorf("unexpected link %q after %d polls", link, polls)
+	}
+}
+
+func TestWaybackErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/save":
+			if r.FormValue("url") == "https://blocked.com" {
+				fmt.Fprint(w, `{"message":"This host has been excluded"}`)
+				return
+			}
+			fmt.Fprint(w, `{"job_id":"spn2-2"}`)
+		case "/save/status/spn2-2":
+			fmt.Fprint(w, `{"status":"error","message":"Live page is not available: 404"}`)
+		}
+	}))
+	defer ts.Close()
+
+	w := &wayback{client: ts.Client(), endpoint: ts.URL, keys: "k:s", wait: time.Second}
+	if _, err := w.save("https://blocked.com", false, false); err == nil || !strings.Contains(err.Error(), "excluded") {
+		t.Errorf("expected rejection, got %v", err)
+	}
+	if _, err := w.save("https://example.com/gone", false, false); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected capture failure, got %v", err)
+	}
+
+	err := runWayback([]string{"--capture-screenshot", "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "require --token") {
+		t.Errorf("expected missing keys error, got %v", err)
+	}
+}
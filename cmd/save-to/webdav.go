@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// webdav uploads snapshot folders to a WebDAV share (Nextcloud, ownCloud,
+// Synology and most NAS web servers), creating the folders it needs.
+type webdav struct {
+	client   *http.Client
+	base     string // folder URL, without a trailing slash
+	username string
+	password string
+	created  map[string]bool // folders known to exist
+}
+
+func runWebDAV(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("webdav", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	baseURL := fs.String("base-url", "", "WebDAV folder URL, e.g. https://cloud.example.com/remote.php/dav/files/me/ReadLater")
+	username := fs.String("username", "", "WebDAV user")
+	password := fs.String("password", "", "WebDAV password or app password")
+	passwordFile := fs.String("password-file", "", "File containing the WebDAV password")
+	dir := fs.String("dir", "", "Folder to upload, e.g. the go-read-md --output of a previous step")
+	prefix := fs.String("prefix", "", "Subfolder of --base-url the files are stored in")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *baseURL == "" || *dir == "" {
+		return fmt.Errorf("--base-url and --dir are required")
+	}
+	if u, err := url.Parse(*baseURL); err != nil || u.Host == "" {
+		return fmt.Errorf("invalid --base-url %q", *baseURL)
+	}
+
+	w := &webdav{
+		client:   c.client(),
+		base:     strings.TrimSuffix(*baseURL, "/"),
+		username: *username,
+		created:  map[string]bool{"": true},
+	}
+	if w.password, err = readSecret(*password, *passwordFile); err != nil {
+		return err
+	}
+
+	folder := cleanPrefix(*prefix)
+	n, err := uploadDir(*dir, folder, *c.verbose, w.put)
+	link := w.url(folder)
+	c.record(target, "webdav", link, err)
+	if err != nil {
+		return err
+	}
+	log.Printf("🗄️ Uploaded %d files to %s", n, link)
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// url returns the URL of a path below the base folder.
+func (w *webdav) url(p string) string {
+	if p == "" {
+		return w.base
+	}
+	return w.base + "/" + (&url.URL{Path: p}).EscapedPath()
+}
+
+func (w *webdav) put(key string, data []byte, contentType string) error {
+	if err := w.mkdirAll(path.Dir(key)); err != nil {
+		return err
+	}
+	resp, err := w.do(http.MethodPut, w.url(key), bytes.NewReader(data), contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("WebDAV error: %s", resp.Status)
+	}
+	return nil
+}
+
+// mkdirAll creates dir and its parents with MKCOL. Servers answer 405 for
+// folders that already exist.
+func (w *webdav) mkdirAll(dir string) error {
+	if dir == "." || w.created[dir] {
+		return nil
+	}
+	if err := w.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+	resp, err := w.do("MKCOL", w.url(dir)+"/", nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("WebDAV error creating %s: %s", dir, resp.Status)
+	}
+	w.created[dir] = true
+	return nil
+}
+
+func (w *webdav) do(method, target string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	return w.client.Do(req)
+}
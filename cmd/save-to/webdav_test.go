@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWebDAV(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	uploads := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "me" || pass != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		switch r.Method {
+		case "MKCOL":
+			if r.URL.Path == "/dav/ReadLater/2025/" {
+				w.WriteHeader(http.StatusMethodNotAllowed) // already exists
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			uploads[r.URL.Path] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer ts.Close()
+
+	stdout := &bytes.Buffer{}
+	err := runWebDAV([]string{
+		"--base-url", ts.URL + "/dav/ReadLater/", "--username", "me", "--password", "app-password",
+		"--dir", writeSnapshotDir(t), "--prefix", "2025/abc123", "https://example.com/post",
+	}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploads["/dav/ReadLater/2025/abc123/My Post.md"] != "# My Post\n" || uploads["/dav/ReadLater/2025/abc123/assets/chart.png"] != "png" {
+		t.Errorf("unexpected uploads %v", uploads)
+	}
+	want := []string{
+		"MKCOL /dav/ReadLater/2025/",
+		"MKCOL /dav/ReadLater/2025/abc123/",
+		"PUT /dav/ReadLater/2025/abc123/My%20Post.md",
+		"MKCOL /dav/ReadLater/2025/abc123/assets/",
+		"PUT /dav/ReadLater/2025/abc123/assets/chart.png",
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected requests:\n%s", strings.Join(requests, "\n"))
+	}
+	if got := strings.TrimSpace(stdout.String()); got != ts.URL+"/dav/ReadLater/2025/abc123" {
+		t.Errorf("expected the remote folder on stdout, got %q", got)
+	}
+
+	err = runWebDAV([]string{"--base-url", ts.URL + "/dav", "--username", "me", "--password", "wrong", "--dir", writeSnapshotDir(t), "https://example.com/post"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected an auth error, got %v", err)
+	}
+}
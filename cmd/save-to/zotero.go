@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// zotero creates items through the Zotero Web API (v3) in a user or group
+// library, optionally uploading a snapshot file as a child attachment.
+type zotero struct {
+	client   *http.Client
+	endpoint string
+	library  string // "users/<id>" or "groups/<id>"
+	apiKey   string
+}
+
+// zoteroMeta is the item metadata, from flags or a go-read-md HTML snapshot.
+type zoteroMeta struct {
+	Title     string
+	Author    string
+	Published string
+	Site      string
+	Tags      []string
+}
+
+func runZotero(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("zotero", flag.ContinueOnError)
+	c := addCommonFlags(fs)
+	endpoint := fs.String("endpoint", "https://api.zotero.org", "Zotero Web API base URL")
+	userID := fs.String("user-id", "", "Numeric ID of the user library (see zotero.org/settings/keys)")
+	groupID := fs.String("group-id", "", "Numeric ID of a group library, instead of --user-id")
+	token := fs.String("token", "", "Zotero API key with write access")
+	tokenFile := fs.String("token-file", "", "File containing the Zotero API key")
+	itemType := fs.String("item-type", "webpage", "Zotero item type, e.g. webpage, journalArticle, blogPost")
+	attachment := fs.String("attachment", "", "Snapshot to attach (HTML or PDF); go-read-md HTML snapshots also provide the metadata")
+	title := fs.String("title", "", "Item title (overrides the snapshot)")
+	author := fs.String("author", "", "Author (overrides the snapshot)")
+	tags := fs.String("tags", "", "Comma-separated tags")
+
+	target, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if (*userID == "") == (*groupID == "") {
+		return fmt.Errorf("exactly one of --user-id or --group-id is required")
+	}
+
+	z := &zotero{client: c.client(), endpoint: strings.TrimSuffix(*endpoint, "/"), library: "users/" + *userID}
+	if *groupID != "" {
+		z.library = "groups/" + *groupID
+	}
+	if z.apiKey, err = readSecret(*token, *tokenFile); err != nil {
+		return err
+	}
+	if z.apiKey == "" {
+		return fmt.Errorf("--token or --token-file is required")
+	}
+
+	var meta zoteroMeta
+	if *attachment != "" && isHTMLFile(*attachment) {
+		if meta, err = readSnapshotMeta(*attachment); err != nil {
+			return err
+		}
+	}
+	if *title != "" {
+		meta.Title = *title
+	}
+	if *author != "" {
+		meta.Author = *author
+	}
+	meta.Tags = append(meta.Tags, splitTags(*tags)...)
+
+	if *c.verbose {
+		log.Printf("📚 Creating Zotero item for %s in %s", target, z.library)
+	}
+	link, err := z.save(target, *itemType, meta, *attachment)
+	c.record(target, "zotero", link, err)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, link)
+	return nil
+}
+
+// save creates the item and uploads the attachment, returning a zotero://
+// link that selects the item in the desktop app.
+func (z *zotero) save(target, itemType string, meta zoteroMeta, attachment string) (string, error) {
+	item := map[string]any{
+		"itemType":   itemType,
+		"title":      meta.Title,
+		"url":        target,
+		"accessDate": time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"tags":       zoteroTags(meta.Tags),
+	}
+	if meta.Author != "" {
+		item["creators"] = []map[string]string{{"creatorType": "author", "name": meta.Author}}
+	}
+	if meta.Published != "" {
+		item["date"] = meta.Published
+	}
+	if meta.Site != "" && itemType == "webpage" {
+		item["websiteTitle"] = meta.Site
+	}
+
+	key, err := z.createItem(item)
+	if err != nil {
+		return "", err
+	}
+	if attachment != "" {
+		if err := z.attach(key, attachment); err != nil {
+			return "", fmt.Errorf("created item %s but failed to attach snapshot: %w", key, err)
+		}
+	}
+
+	if group, ok := strings.CutPrefix(z.library, "groups/"); ok {
+		return fmt.Sprintf("zotero://select/groups/%s/items/%s", group, key), nil
+	}
+	return "zotero://select/library/items/" + key, nil
+}
+
+// attach uploads path as an imported file under the parent item, following
+// the Web API's authorize / upload / register sequence.
+func (z *zotero) attach(parent, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read attachment: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+
+	key, err := z.createItem(map[string]any{
+		"itemType":    "attachment",
+		"parentItem":  parent,
+		"linkMode":    "imported_file",
+		"title":       "Snapshot",
+		"contentType": contentType,
+		"filename":    name,
+		"tags":        []any{},
+	})
+	if err != nil {
+		return err
+	}
+
+	sum := md5.Sum(data)
+	form := url.Values{
+		"md5":      {hex.EncodeToString(sum[:])},
+		"filename": {name},
+		"filesize": {strconv.Itoa(len(data))},
+		"mtime":    {strconv.FormatInt(info.ModTime().UnixMilli(), 10)},
+	}
+	var auth struct {
+		Exists      int    `json:"exists"`
+		URL         string `json:"url"`
+		ContentType string `json:"contentType"`
+		Prefix      string `json:"prefix"`
+		Suffix      string `json:"suffix"`
+		UploadKey   string `json:"uploadKey"`
+	}
+	if err := z.postFile(key, form, &auth); err != nil {
+		return err
+	}
+	if auth.Exists == 1 {
+		return nil
+	}
+
+	body := append(append([]byte(auth.Prefix), data...), auth.Suffix...)
+	resp, err := z.client.Post(auth.URL, auth.ContentType, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload failed: %s", resp.Status)
+	}
+
+	return z.postFile(key, url.Values{"upload": {auth.UploadKey}}, nil)
+}
+
+// createItem posts a single item and returns its key.
+func (z *zotero) createItem(item map[string]any) (string, error) {
+	data, err := json.Marshal([]any{item})
+	if err != nil {
+		return "", err
+	}
+	req, err := z.newRequest(z.library+"/items", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Successful map[string]struct {
+			Key string `json:"key"`
+		} `json:"successful"`
+		Failed map[string]struct {
+			Message string `json:"message"`
+		} `json:"failed"`
+	}
+	if err := z.do(req, &result); err != nil {
+		return "", err
+	}
+	if f, ok := result.Failed["0"]; ok {
+		return "", fmt.Errorf("zotero rejected the item: %s", f.Message)
+	}
+	key := result.Successful["0"].Key
+	if key == "" {
+		return "", fmt.Errorf("zotero returned no item key")
+	}
+	return key, nil
+}
+
+// postFile calls the file endpoint of an attachment item.
+func (z *zotero) postFile(key string, form url.Values, result any) error {
+	req, err := z.newRequest(z.library+"/items/"+key+"/file", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-None-Match", "*")
+	return z.do(req, result)
+}
+
+func (z *zotero) newRequest(path, contentType string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, z.endpoint+"/"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Zotero-API-Key", z.apiKey)
+	req.Header.Set("Zotero-API-Version", "3")
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+func (z *zotero) do(req *http.Request, result any) error {
+	resp, err := z.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("zotero request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("zotero error: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode zotero response: %w", err)
+	}
+	return nil
+}
+
+func zoteroTags(tags []string) []map[string]string {
+	out := make([]map[string]string, 0, len(tags))
+	for _, t := range tags {
+		out = append(out, map[string]string{"tag": t})
+	}
+	return out
+}
+
+func isHTMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".html" || ext == ".htm"
+}
+
+// readSnapshotMeta reads the metadata go-read-md writes into the head of its
+// HTML snapshots. Missing tags simply leave fields empty.
+func readSnapshotMeta(path string) (zoteroMeta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return zoteroMeta{}, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	defer f.Close()
+
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		return zoteroMeta{}, fmt.Errorf("failed to parse attachment: %w", err)
+	}
+	attr := func(selector string) string {
+		v, _ := doc.Find(selector).First().Attr("content")
+		return strings.TrimSpace(v)
+	}
+	return zoteroMeta{
+		Title:     strings.TrimSpace(doc.Find("title").First().Text()),
+		Author:    attr(`meta[name="author"]`),
+		Published: attr(`meta[property="article:published_time"]`),
+		Site:      attr(`meta[property="og:site_name"]`),
+		Tags:      splitTags(attr(`meta[name="keywords"]`)),
+	}, nil
+}
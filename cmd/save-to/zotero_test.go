@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestZotero(t *testing.T) {
+	var items []map[string]any
+	var uploaded string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			body, _ := io.ReadAll(r.Body)
+			uploaded = string(body)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.Header.Get("Zotero-API-Key") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/users/123/items":
+			var batch []map[string]any
+			json.NewDecoder(r.Body).Decode(&batch)
+			items = append(items, batch[0])
+			fmt.Fprintf(w, `{"successful":{"0":{"key":"KEY%d"}},"failed":{}}`, len(items))
+		case "/users/123/items/KEY2/file":
+			if r.Header.Get("If-None-Match") != "*" {
+				w.WriteHeader(http.StatusPreconditionRequired)
+				return
+			}
+			if r.FormValue("upload") == "up1" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			fmt.Fprintf(w, `{"url":%q,"contentType":"text/plain","prefix":"<","suffix":">","uploadKey":"up1"}`, ts.URL+"/upload")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	snapshot := filepath.Join(t.TempDir(), "page.html")
+	os.WriteFile(snapshot, []byte(`<html><head><title>Attention Is All You Need</title>
+<meta name="author" content="Vaswani et al.">
+<meta property="article:published_time" content="2017-06-12T00:00:00Z">
+<meta name="keywords" content="ml"></head><body>paper</body></html>`), 0644)
+
+	stdout := &bytes.Buffer{}
+	err := runZotero([]string{"--endpoint", ts.URL, "--user-id", "123", "--token", "key", "--tags", "paper", "--attachment", snapshot, "https://arxiv.org/abs/1706.03762"}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link := strings.TrimSpace(stdout.String()); link != "zotero://select/library/items/KEY1" {
+		t.Errorf("unexpected link %q", link)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("expected parent and attachment items, got %d", len(items))
+	}
+	parent := items[0]
+	if parent["title"] != "Attention Is All You Need" || parent["date"] != "2017-06-12T00:00:00Z" || len(parent["tags"].([]any)) != 2 {
+		t.Errorf("unexpected parent item %v", parent)
+	}
+	if creators := parent["creators"].([]any); creators[0].(map[string]any)["name"] != "Vaswani et al." {
+		t.Errorf("unexpected creators %v", creators)
+	}
+	if att := items[1]; att["parentItem"] != "KEY1" || att["contentType"] != "text/html" {
+		t.Errorf("unexpected attachment item %v", att)
+	}
+	if !strings.HasPrefix(uploaded, "<<html>") || !strings.HasSuffix(uploaded, ">") {
+		t.Errorf("expected prefix+file+suffix upload, got %q", uploaded)
+	}
+
+	err = runZotero([]string{"--endpoint", ts.URL, "--user-id", "123", "--token", "wrong", "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected forbidden error, got %v", err)
+	}
+	err = runZotero([]string{"--user-id", "1", "--group-id", "2", "https://example.com"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "exactly one of") {
+		t.Errorf("expected library selection error, got %v", err)
+	}
+}
@@ -1,40 +1,261 @@
 package main
 
 import (
-	"crypto/sha256"
+	"bufio"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+
+	"browser-pipes/internal/history"
+	"browser-pipes/internal/urlclean"
+	"browser-pipes/internal/urlhash"
+	"browser-pipes/internal/urlnorm"
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
-	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
 		os.Exit(1)
 	}
 }
 
-func run(args []string, stdout io.Writer, stderr io.Writer) error {
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
 	fs := flag.NewFlagSet("url-hash", flag.ContinueOnError)
 	fs.SetOutput(stderr)
+	var opts urlnorm.Options
+	normalize := fs.Bool("normalize", false, "Strip tracking parameters (plumber's defaults, or those of --config) and apply --strip-fragment --sort-query --lowercase-host --strip-default-port")
+	config := fs.String("config", "", "Clean and normalize URLs with the settings.cleaning and settings.normalize of this plumber config")
+	fs.BoolVar(&opts.StripFragment, "strip-fragment", false, "Drop the #fragment before hashing")
+	fs.BoolVar(&opts.SortQuery, "sort-query", false, "Order query parameters by name before hashing")
+	fs.BoolVar(&opts.LowercaseHost, "lowercase-host", false, "Lowercase the host before hashing")
+	fs.BoolVar(&opts.DefaultPort, "strip-default-port", false, "Drop :80 on http and :443 on https before hashing")
+	fs.StringVar(&opts.TrailingSlash, "trailing-slash", "", "Trailing slash policy before hashing: keep, add or remove")
+	algo := fs.String("algo", urlhash.DefaultAlgo, "Digest algorithm: "+strings.Join(urlhash.Algorithms, ", "))
+	encoding := fs.String("encoding", urlhash.DefaultEncoding, "Digest encoding: "+strings.Join(urlhash.Encodings, ", "))
+	length := fs.Int("length", urlhash.DefaultLength, "Number of characters to print (default: 8 hex, 7 base32 or 6 base58, about 32 bits)")
+	full := fs.Bool("full", false, "Print the whole digest instead of --length characters")
+	historyFile := fs.String("history", "", "Record each hash and its URL in this history file (e.g. plumber's << parameters.history_file >>)")
+	lookup := fs.String("lookup", "", "Print the URLs recorded with this hash in --history (default: plumber's history file)")
 	fs.Usage = func() {
-		fmt.Fprintf(stderr, "Usage: url-hash <url>\n")
-		fmt.Fprintf(stderr, "Outputs an 8-character SHA-256 hash of the given URL.\n")
+		fmt.Fprintf(stderr, "Usage: url-hash [flags] <url>\n")
+		fmt.Fprintf(stderr, "       url-hash [flags] - < urls.txt\n")
+		fmt.Fprintf(stderr, "Outputs an 8-character SHA-256 hash of the given URL, optionally normalized\n")
+		fmt.Fprintf(stderr, "first (use the same options as plumber's settings.normalize). --normalize\n")
+		fmt.Fprintf(stderr, "also strips tracking parameters, and --config cleans and normalizes URLs\n")
+		fmt.Fprintf(stderr, "as a plumber config does, so equivalent URLs hash alike. --algo,\n")
+		fmt.Fprintf(stderr, "--length and --full match the naming schemes of other tools, and --encoding\n")
+		fmt.Fprintf(stderr, "base32 or base58 gives shorter names of the same strength.\n")
+		fmt.Fprintf(stderr, "With - (or no URL and piped input) it hashes one URL per line of stdin\n")
+		fmt.Fprintf(stderr, "and prints hash<TAB>url lines. --history records the hashes, and --lookup\n")
+		fmt.Fprintf(stderr, "turns one back into the URLs it was computed from.\n\n")
+		fs.PrintDefaults()
 	}
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	if *lookup != "" {
+		if err := lookupHash(*historyFile, *lookup, stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return err
+		}
+		return nil
+	}
+	if *normalize {
+		opts.StripFragment, opts.SortQuery, opts.LowercaseHost, opts.DefaultPort = true, true, true, true
+	}
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return err
+	}
+	lengthSet := false
+	fs.Visit(func(f *flag.Flag) { lengthSet = lengthSet || f.Name == "length" })
+	if n, ok := urlhash.DefaultLengths[*encoding]; ok && !lengthSet {
+		*length = n
+	}
+	if *full {
+		*length = 0
+	} else if *length < 1 {
+		err := fmt.Errorf("--length must be at least 1")
+		fmt.Fprintln(stderr, err)
+		return err
+	}
+
+	// The config's cleaning runs first; the flags normalize on top of it.
+	var cleaning plumberCleaning
+	if *config != "" {
+		if err := cleaning.load(*config); err != nil {
+			fmt.Fprintln(stderr, err)
+			return err
+		}
+	}
+	clean := *normalize || *config != ""
+	rec := newRecorder(*historyFile)
+	hash := func(rawURL string) (string, error) {
+		hashed := rawURL
+		if clean {
+			hashed = cleaning.clean(hashed)
+		}
+		hashed = urlnorm.Normalize(hashed, opts)
+		h, err := urlhash.Hash(hashed, *algo, *encoding, *length)
+		if err != nil {
+			return "", err
+		}
+		return h, rec.record(h, hashed, rawURL)
+	}
 
+	if fs.Arg(0) == "-" || (fs.NArg() == 0 && piped(stdin)) {
+		if err := hashLines(stdin, stdout, hash); err != nil {
+			fmt.Fprintln(stderr, err)
+			return err
+		}
+		return nil
+	}
 	if fs.NArg() < 1 {
 		fs.Usage()
 		return fmt.Errorf("missing URL argument")
 	}
 
-	url := fs.Arg(0)
-	h := sha256.New()
-	h.Write([]byte(url))
-	hash := fmt.Sprintf("%x", h.Sum(nil))
-	fmt.Fprintln(stdout, hash[:8])
+	h, err := hash(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return err
+	}
+	fmt.Fprintln(stdout, h)
+	return nil
+}
+
+// plumberCleaning is the part of a plumber config url-hash cleans URLs
+// with. The zero value strips plumber's default tracking parameters.
+type plumberCleaning struct {
+	Settings struct {
+		Cleaning  urlclean.CleaningSettings  `yaml:"cleaning"`
+		Normalize urlclean.NormalizeSettings `yaml:"normalize"`
+	} `yaml:"settings"`
+	providers []urlclean.Provider
+}
+
+// load reads settings.cleaning and settings.normalize from the plumber
+// config at path and compiles its ClearURLs rules.
+func (c *plumberCleaning) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not open config file at %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("could not decode config: %w", err)
+	}
+	if err := c.Settings.Cleaning.Validate(); err != nil {
+		return fmt.Errorf("configuration is invalid: %w", err)
+	}
+	if err := c.Settings.Normalize.Options().Validate(); err != nil {
+		return fmt.Errorf("configuration is invalid: settings.normalize: %w", err)
+	}
+	if c.providers, err = c.Settings.Cleaning.ClearURLs.Load(); err != nil {
+		return fmt.Errorf("configuration is invalid: settings.cleaning.clearurls: %w", err)
+	}
+	return nil
+}
+
+// clean cleans and normalizes rawURL as plumber does before routing it.
+func (c *plumberCleaning) clean(rawURL string) string {
+	return c.Settings.Normalize.Normalize(c.Settings.Cleaning.Clean(c.providers, rawURL))
+}
+
+// piped reports whether stdin is a pipe or file rather than a terminal.
+func piped(stdin io.Reader) bool {
+	if stdin == nil {
+		return false
+	}
+	f, ok := stdin.(*os.File)
+	if !ok {
+		return true
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice == 0
+}
+
+// hashLines prints hash<TAB>url for each URL of r, one per line, skipping
+// blank lines and # comments.
+func hashLines(r io.Reader, w io.Writer, hash func(string) (string, error)) error {
+	if r == nil {
+		return fmt.Errorf("stdin is required but not available")
+	}
+	out := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		h, err := hash(line)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\t%s\n", h, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return out.Flush()
+}
+
+// lookupHash prints the URLs the history file at path (plumber's when
+// empty) recorded with hash, newest first.
+func lookupHash(path, hash string, w io.Writer) error {
+	if path == "" {
+		var err error
+		if path, err = history.DefaultPath(); err != nil {
+			return err
+		}
+	}
+	entries, err := history.Query(path, history.Filter{Hash: hash})
+	if err != nil {
+		return err
+	}
+	urls := history.Lookup(entries, hash)
+	if len(urls) == 0 {
+		return fmt.Errorf("no URL recorded for hash %q in %s", hash, path)
+	}
+	for _, u := range urls {
+		fmt.Fprintln(w, u)
+	}
 	return nil
 }
+
+// recorder appends hash entries to a history file, once per hash and URL.
+// A recorder without a path records nothing.
+type recorder struct {
+	path string
+	seen map[string]bool
+}
+
+func newRecorder(path string) *recorder {
+	return &recorder{path: path, seen: make(map[string]bool)}
+}
+
+// record notes that url, given as original before cleaning and
+// normalization, hashes to hash, unless the history already has.
+func (r *recorder) record(hash, url, original string) error {
+	if r.path == "" || r.seen[hash+"\t"+url] {
+		return nil
+	}
+	r.seen[hash+"\t"+url] = true
+	entries, err := history.Query(r.path, history.Filter{Hash: hash, URL: url})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Hash == hash && e.URL == url {
+			return nil
+		}
+	}
+	e := history.Entry{Kind: history.KindHash, URL: url, Hash: hash, Status: history.StatusSuccess}
+	if original != url {
+		e.OriginalURL = original
+	}
+	return history.Append(r.path, e)
+}
@@ -2,15 +2,19 @@ package main
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"browser-pipes/internal/history"
 )
 
 func TestRun(t *testing.T) {
 	t.Run("Success: Normal URL", func(t *testing.T) {
 		stdout := &bytes.Buffer{}
 		stderr := &bytes.Buffer{}
-		err := run([]string{"http://example.com"}, stdout, stderr)
+		err := run([]string{"http://example.com"}, nil, stdout, stderr)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -24,20 +28,165 @@ func TestRun(t *testing.T) {
 
 	t.Run("Success: Stable Hash", func(t *testing.T) {
 		stdout1 := &bytes.Buffer{}
-		run([]string{"http://google.com"}, stdout1, &bytes.Buffer{})
+		run([]string{"http://google.com"}, nil, stdout1, &bytes.Buffer{})
 
 		stdout2 := &bytes.Buffer{}
-		run([]string{"http://google.com"}, stdout2, &bytes.Buffer{})
+		run([]string{"http://google.com"}, nil, stdout2, &bytes.Buffer{})
 
 		if stdout1.String() != stdout2.String() {
 			t.Errorf("hashes should be stable, got %q and %q", stdout1.String(), stdout2.String())
 		}
 	})
 
+	t.Run("Success: Normalized URL", func(t *testing.T) {
+		hash := func(args ...string) string {
+			stdout := &bytes.Buffer{}
+			if err := run(args, nil, stdout, &bytes.Buffer{}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			return strings.TrimSpace(stdout.String())
+		}
+
+		if hash("--normalize", "--trailing-slash", "add", "HTTP://Example.com:80/docs#top") != hash("http://example.com/docs/") {
+			t.Error("expected the normalized URL to be hashed")
+		}
+		if hash("--sort-query", "http://example.com/?b=2&a=1") != hash("http://example.com/?a=1&b=2") {
+			t.Error("expected --sort-query to hash both orders alike")
+		}
+		if hash("http://example.com/?b=2&a=1") == hash("http://example.com/?a=1&b=2") {
+			t.Error("expected URLs to be hashed as given without normalization flags")
+		}
+	})
+
+	t.Run("Success: Tracking Parameters", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		if err := run([]string{"--normalize", "http://Example.com/?utm_source=x&b=1&fbclid=y#frag"}, nil, stdout, &bytes.Buffer{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := strings.TrimSpace(stdout.String()); got != hashOf(t, "http://example.com/?b=1") {
+			t.Errorf("expected the cleaned URL to be hashed, got %q", got)
+		}
+	})
+
+	t.Run("Success: Plumber Config", func(t *testing.T) {
+		config := filepath.Join(t.TempDir(), "plumber.yaml")
+		os.WriteFile(config, []byte(`version: "2"
+settings:
+  cleaning:
+    params: ["ref_*"]
+  normalize:
+    sort_query: true
+    strip_fragment: true
+jobs:
+  noop:
+    steps:
+      - run: "true"
+workflows:
+  main:
+    jobs:
+      - noop:
+          match: ".*"
+`), 0644)
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		if err := run([]string{"--config", config, "http://example.com/?ref_src=x&utm_source=y&a=1#top"}, nil, stdout, stderr); err != nil {
+			t.Fatalf("expected no error, got %v: %s", err, stderr)
+		}
+		if got := strings.TrimSpace(stdout.String()); got != hashOf(t, "http://example.com/?a=1&utm_source=y") {
+			t.Errorf("expected the config's cleaning to be applied, got %q", got)
+		}
+
+		if err := run([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml"), "http://example.com"}, nil, &bytes.Buffer{}, stderr); err == nil {
+			t.Error("expected an error for a missing config")
+		}
+	})
+
+	t.Run("Success: Algorithm And Length", func(t *testing.T) {
+		for _, tt := range []struct {
+			args []string
+			want string
+		}{
+			{[]string{"--full"}, "f0e6a6a97042a4f1f1c87f5f7d44315b2d852c2df5c7991cc66241bf7072d1c4"},
+			{[]string{"--length", "12"}, "f0e6a6a97042"},
+			{[]string{"--algo", "sha1", "--length", "10"}, "89dce6a446"},
+			{[]string{"--algo", "xxhash", "--full"}, "0a9e8c9510e27c29"},
+			{[]string{"--encoding", "base32"}, "6dtknkl"},
+			{[]string{"--encoding", "base58"}, "HDNqWe"},
+			{[]string{"--encoding", "base58", "--length", "10"}, "HDNqWe2A8j"},
+		} {
+			stdout := &bytes.Buffer{}
+			if err := run(append(tt.args, "http://example.com"), nil, stdout, &bytes.Buffer{}); err != nil {
+				t.Fatalf("%v: expected no error, got %v", tt.args, err)
+			}
+			if got := strings.TrimSpace(stdout.String()); got != tt.want {
+				t.Errorf("%v: expected %q, got %q", tt.args, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("Success: URLs From Stdin", func(t *testing.T) {
+		input := "http://example.com\n\n# bookmarks\n  http://google.com  \n"
+		want := "f0e6a6a9\thttp://example.com\n" + hashOf(t, "http://google.com") + "\thttp://google.com\n"
+		for _, args := range [][]string{{"-"}, {}} {
+			stdout := &bytes.Buffer{}
+			if err := run(args, strings.NewReader(input), stdout, &bytes.Buffer{}); err != nil {
+				t.Fatalf("%v: expected no error, got %v", args, err)
+			}
+			if stdout.String() != want {
+				t.Errorf("%v: expected %q, got %q", args, want, stdout.String())
+			}
+		}
+	})
+
+	t.Run("Success: Lookup", func(t *testing.T) {
+		historyPath := filepath.Join(t.TempDir(), "history.db")
+		input := "HTTP://Example.com/a\nhttp://example.com/a\nhttp://example.com/b\n"
+		if err := run([]string{"--history", historyPath, "--lowercase-host", "-"}, strings.NewReader(input), &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entries, _ := history.Read(historyPath); len(entries) != 2 || entries[0].OriginalURL != "HTTP://Example.com/a" {
+			t.Errorf("expected one entry per hash and URL, got %+v", entries)
+		}
+
+		stdout := &bytes.Buffer{}
+		if err := run([]string{"--history", historyPath, "--lookup", hashOf(t, "http://example.com/a")}, nil, stdout, &bytes.Buffer{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := stdout.String(); got != "http://example.com/a\n" {
+			t.Errorf("expected the recorded URL, got %q", got)
+		}
+
+		stderr := &bytes.Buffer{}
+		if err := run([]string{"--history", historyPath, "--lookup", "00000000"}, nil, &bytes.Buffer{}, stderr); err == nil || stderr.Len() == 0 {
+			t.Errorf("expected an error on stderr for an unknown hash, got %v", err)
+		}
+	})
+
+	t.Run("Error: Invalid Algorithm Or Length", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--algo", "md5"},
+			{"--length", "0"},
+			{"--algo", "xxhash", "--length", "20"},
+			{"--encoding", "base64"},
+		} {
+			stderr := &bytes.Buffer{}
+			if err := run(append(args, "http://example.com"), nil, &bytes.Buffer{}, stderr); err == nil || stderr.Len() == 0 {
+				t.Errorf("%v: expected an error on stderr, got %v", args, err)
+			}
+		}
+	})
+
+	t.Run("Error: Invalid Trailing Slash Policy", func(t *testing.T) {
+		if err := run([]string{"--trailing-slash", "always", "http://example.com"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+			t.Error("expected an error for an unknown policy")
+		}
+	})
+
 	t.Run("Error: Missing Argument", func(t *testing.T) {
 		stdout := &bytes.Buffer{}
 		stderr := &bytes.Buffer{}
-		err := run([]string{}, stdout, stderr)
+		err := run([]string{}, nil, stdout, stderr)
 		if err == nil {
 			t.Fatal("expected error for missing argument, got nil")
 		}
@@ -50,9 +199,18 @@ func TestRun(t *testing.T) {
 	t.Run("Error: Invalid Flag", func(t *testing.T) {
 		stdout := &bytes.Buffer{}
 		stderr := &bytes.Buffer{}
-		err := run([]string{"--invalid-flag"}, stdout, stderr)
+		err := run([]string{"--invalid-flag"}, nil, stdout, stderr)
 		if err == nil {
 			t.Fatal("expected error for invalid flag, got nil")
 		}
 	})
 }
+
+func hashOf(t *testing.T, url string) string {
+	t.Helper()
+	stdout := &bytes.Buffer{}
+	if err := run([]string{url}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(stdout.String())
+}
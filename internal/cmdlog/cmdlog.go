@@ -0,0 +1,189 @@
+// Package cmdlog is the append-only log of the external commands plumber
+// runs for the URLs the browser sends it: what ran, where, how it ended and
+// which URL triggered it. It is stored as JSON Lines.
+// Entries may be chained by SHA-256, each naming the hash of the line before
+// it, so that editing or deleting a line in the middle is detected by Verify.
+// Chaining does not detect lines cut off the end of the log. Appends take
+// an exclusive lock on the file, so concurrent plumbers keep one chain.
+package cmdlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Entry is a single command.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Argv     []string  `json:"argv"`
+	Dir      string    `json:"cwd"`
+	ExitCode *int      `json:"exit_code"` // nil when the command was left running in the background or did not start
+	Error    string    `json:"error,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Origin   string    `json:"origin,omitempty"`
+	Job      string    `json:"job,omitempty"`
+	Prev     string    `json:"prev,omitempty"` // hash of the line before, when chained
+	Hash     string    `json:"hash,omitempty"` // SHA-256 of the entry without this field, when chained
+}
+
+// sum returns the chain hash of e: the SHA-256 of its JSON without Hash.
+func (e Entry) sum() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Append adds e to the log at path, creating it if needed. With chain, e is
+// linked to the last line of the log, or starts a chain when that line is
+// not chained.
+func Append(path string, e Entry, chain bool) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create command log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open command log: %w", err)
+	}
+	defer f.Close()
+	// Plumbers run side by side, one per browser connection; without the
+	// lock two of them could chain to the same line.
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock command log: %w", err)
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	if chain {
+		last, err := lastLine(f)
+		if err != nil {
+			return fmt.Errorf("failed to read command log: %w", err)
+		}
+		var prev Entry
+		if json.Unmarshal(last, &prev) == nil {
+			e.Prev = prev.Hash
+		}
+		if e.Hash, err = e.sum(); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write command log: %w", err)
+	}
+	return nil
+}
+
+// lastLine returns the last complete line of f, without its newline.
+func lastLine(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	const chunk = 4096
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := max(end-chunk, 0)
+		buf := make([]byte, end-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, err
+		}
+		tail = append(buf, tail...)
+		if i := bytes.LastIndexByte(bytes.TrimSuffix(tail, []byte("\n")), '\n'); i >= 0 {
+			return bytes.TrimSuffix(tail[i+1:], []byte("\n")), nil
+		}
+		end = start
+	}
+	return bytes.TrimSuffix(tail, []byte("\n")), nil
+}
+
+// Read returns all entries in file order. A missing file is an empty log;
+// malformed lines are skipped.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open command log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read command log: %w", err)
+	}
+	return entries, nil
+}
+
+// Verify checks the chain of the log at path and returns how many chained
+// entries it has. The error names the first line that was edited, or that
+// follows a deleted or edited line. Lines written before chaining was
+// turned on are not checked; lines after it are.
+func Verify(path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open command log: %w", err)
+	}
+	defer f.Close()
+
+	chained, prev := 0, ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			if chained > 0 {
+				return chained, fmt.Errorf("line %d is not an entry", n)
+			}
+			continue
+		}
+		if e.Hash != "" {
+			if e.Prev != prev {
+				return chained, fmt.Errorf("line %d does not follow the line before it", n)
+			}
+			if sum, err := e.sum(); err != nil || sum != e.Hash {
+				return chained, fmt.Errorf("line %d was modified", n)
+			}
+			chained++
+		} else if chained > 0 {
+			return chained, fmt.Errorf("line %d is not chained", n)
+		}
+		prev = e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return chained, fmt.Errorf("failed to read command log: %w", err)
+	}
+	return chained, nil
+}
@@ -0,0 +1,109 @@
+package cmdlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppendRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "commands.jsonl")
+	code := 0
+	if err := Append(path, Entry{Argv: []string{"sh", "-c", "true"}, Dir: "/tmp", ExitCode: &code, URL: "https://example.com/", Origin: "chrome"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(path, Entry{Argv: []string{"firefox", "https://example.com/"}, Error: "not found"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if e := entries[0]; e.Time.IsZero() || *e.ExitCode != 0 || e.Dir != "/tmp" || e.Origin != "chrome" || e.Hash != "" {
+		t.Errorf("unexpected first entry %+v", e)
+	}
+	if e := entries[1]; e.ExitCode != nil || e.Error != "not found" {
+		t.Errorf("expected no exit code for a command that did not start, got %+v", e)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"exit_code":null`) {
+		t.Errorf("expected exit_code null to be written, got %s", data)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	write := func(t *testing.T, chain ...bool) string {
+		path := filepath.Join(t.TempDir(), "commands.jsonl")
+		for i, c := range chain {
+			code := i
+			if err := Append(path, Entry{Argv: []string{"sh", "-c", strings.Repeat("x", i*3000)}, ExitCode: &code}, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+	lines := func(path string) []string {
+		data, _ := os.ReadFile(path)
+		l := strings.SplitAfter(string(data), "\n")
+		return l[:len(l)-1]
+	}
+
+	path := write(t, false, true, true, true)
+	if n, err := Verify(path); n != 3 || err != nil {
+		t.Fatalf("expected 3 chained entries, got %d, %v", n, err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(l []string) []string
+		want   string
+	}{
+		{"edited", func(l []string) []string {
+			l[2] = strings.Replace(l[2], `"exit_code":2`, `"exit_code":0`, 1)
+			return l
+		}, "line 3 was modified"},
+		{"deleted", func(l []string) []string { return append(l[:2], l[3:]...) }, "line 3 does not follow"},
+		{"inserted", func(l []string) []string { return append(l[:2], append([]string{l[0]}, l[2:]...)...) }, "line 3 is not chained"},
+		{"garbage", func(l []string) []string { return append(l, "{not json\n") }, "line 5 is not an entry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := filepath.Join(t.TempDir(), "commands.jsonl")
+			os.WriteFile(tampered, []byte(strings.Join(tt.change(lines(path)), "")), 0600)
+			if _, err := Verify(tampered); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if n, err := Verify(filepath.Join(t.TempDir(), "missing.jsonl")); n != 0 || err != nil {
+		t.Errorf("expected an empty log for a missing file, got %d, %v", n, err)
+	}
+}
+
+func TestAppend_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.jsonl")
+	const writers, each = 16, 50
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range each {
+				code := w*each + i
+				if err := Append(path, Entry{Argv: []string{"sh", "-c", strings.Repeat("x", 5000)}, ExitCode: &code}, true); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := Verify(path); n != writers*each || err != nil {
+		t.Errorf("expected %d chained entries, got %d, %v", writers*each, n, err)
+	}
+}
@@ -0,0 +1,140 @@
+package history
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FeedOptions configures WriteFeed.
+type FeedOptions struct {
+	Title   string // feed title (default: "Saved articles")
+	Dir     string // folder the feed is written to; snapshot links are relative to it
+	BaseURL string // URL Dir is served at, to make snapshot links absolute
+	Limit   int    // maximum number of entries (0 for all)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// WriteFeed writes an Atom feed of the successful snapshots in entries,
+// newest first. A URL snapshotted several times appears once, with its
+// latest snapshot, so it keeps the same entry ID in feed readers.
+func WriteFeed(w io.Writer, entries []Entry, opts FeedOptions) error {
+	feed := atomFeed{
+		ID:     "urn:browser-pipes:snapshots",
+		Title:  opts.Title,
+		Author: atomAuthor{Name: "browser-pipes"},
+	}
+	if feed.Title == "" {
+		feed.Title = "Saved articles"
+	}
+	if opts.BaseURL != "" {
+		self := strings.TrimSuffix(opts.BaseURL, "/") + "/feed.xml"
+		feed.ID = self
+		feed.Links = []atomLink{{Rel: "self", Href: self, Type: "application/atom+xml"}}
+	}
+
+	var updated time.Time
+	seen := make(map[string]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Kind != KindSnapshot || e.Status != StatusSuccess || seen[e.URL] {
+			continue
+		}
+		seen[e.URL] = true
+		if opts.Limit > 0 && len(feed.Entries) == opts.Limit {
+			continue
+		}
+
+		title := e.Title
+		if title == "" {
+			title = e.URL
+		}
+		entry := atomEntry{
+			ID:      e.URL,
+			Title:   title,
+			Updated: e.Time.UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Rel: "alternate", Href: e.URL}},
+		}
+		for _, tag := range e.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		for _, f := range e.Files {
+			entry.Links = append(entry.Links, atomLink{
+				Rel:   "related",
+				Href:  snapshotLink(f, opts.Dir, opts.BaseURL),
+				Type:  mime.TypeByExtension(filepath.Ext(f)),
+				Title: strings.TrimPrefix(filepath.Ext(f), "."),
+			})
+		}
+		feed.Entries = append(feed.Entries, entry)
+		if e.Time.After(updated) {
+			updated = e.Time
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// snapshotLink links a snapshot file relative to the feed folder (or under
+// baseURL), falling back to a file:// URL for files outside of it.
+func snapshotLink(file, dir, baseURL string) string {
+	if dir != "" {
+		if rel, err := filepath.Rel(dir, file); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			u := (&url.URL{Path: filepath.ToSlash(rel)}).String()
+			if baseURL != "" {
+				return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(u, "./")
+			}
+			return u
+		}
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String()
+}
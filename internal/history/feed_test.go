@@ -0,0 +1,60 @@
+package history
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFeed(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: t0, Kind: KindSnapshot, URL: "https://a.com/1", Status: StatusSuccess, Title: "Old A", Files: []string{filepath.Join(dir, "a.md")}},
+		{Time: t0.Add(time.Hour), Kind: KindRoute, URL: "https://b.com", Status: StatusSuccess},
+		{Time: t0.Add(2 * time.Hour), Kind: KindSnapshot, URL: "https://c.com", Status: StatusError},
+		{Time: t0.Add(3 * time.Hour), Kind: KindSnapshot, URL: "https://d.com/x", Status: StatusSuccess, Files: []string{"/elsewhere/d.html"}},
+		{Time: t0.Add(4 * time.Hour), Kind: KindSnapshot, URL: "https://a.com/1", Status: StatusSuccess, Title: "A & B", Files: []string{filepath.Join(dir, "news", "a b.md")}, Tags: []string{"news"}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteFeed(&buf, entries, FeedOptions{Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &feed); err != nil {
+		t.Fatalf("feed is not valid XML: %v\n%s", err, buf.String())
+	}
+	if feed.Title != "Saved articles" || feed.Updated != "2024-05-01T16:00:00Z" {
+		t.Errorf("unexpected feed header %+v", feed)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("expected the newest snapshot per URL, got %+v", feed.Entries)
+	}
+	if e := feed.Entries[0]; e.ID != "https://a.com/1" || e.Title != "A & B" || e.Links[1].Href != "news/a%20b.md" || e.Categories[0].Term != "news" {
+		t.Errorf("unexpected first entry %+v", e)
+	}
+	if e := feed.Entries[1]; e.Title != "https://d.com/x" || e.Links[1].Href != "file:///elsewhere/d.html" || e.Links[1].Type != "text/html; charset=utf-8" {
+		t.Errorf("unexpected second entry %+v", e)
+	}
+
+	buf.Reset()
+	WriteFeed(&buf, entries, FeedOptions{Title: "Mine", Dir: dir, BaseURL: "https://home.lan/read/", Limit: 1})
+	out := buf.String()
+	for _, want := range []string{
+		"<title>Mine</title>",
+		`<link rel="self" href="https://home.lan/read/feed.xml"`,
+		`href="https://home.lan/read/news/a%20b.md"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in feed:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "<entry>") != 1 {
+		t.Errorf("expected the limit to apply:\n%s", out)
+	}
+}
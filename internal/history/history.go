@@ -0,0 +1,149 @@
+// Package history is the log of URLs routed by plumber and snapshots
+// written by the tools. It is stored in a SQLite database (see store.go), so
+// that every tool can append to it concurrently and queries only load the
+// entries they match.
+package history
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Entry kinds.
+const (
+	KindRoute    = "route"
+	KindSnapshot = "snapshot"
+	KindSave     = "save"  // URL handed to an external service (Target names it)
+	KindAudit    = "audit" // liveness check of a snapshotted URL (Link is a Wayback capture)
+	KindHash     = "hash"  // URL hashed by url-hash, recorded so Lookup can reverse it
+)
+
+// Entry statuses.
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// Entry is a single history record.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	URL         string    `json:"url"`
+	OriginalURL string    `json:"original_url,omitempty"`
+	Origin      string    `json:"origin,omitempty"`
+	Target      string    `json:"target,omitempty"`
+	Jobs        []string  `json:"jobs,omitempty"`
+	DurationMS  int64     `json:"duration_ms,omitempty"` // time the jobs of a route took to run
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Files       []string  `json:"files,omitempty"`
+	Hash        string    `json:"hash,omitempty"` // URL hash files were named after, as url-hash prints it
+	ContentHash string    `json:"content_hash,omitempty"`
+	Lang        string    `json:"lang,omitempty"` // language of a snapshot, as an ISO 639 code such as "en"
+	Link        string    `json:"link,omitempty"` // where an external service stored the URL, or the Wayback capture a snapshot came from
+	Tags        []string  `json:"tags,omitempty"`
+}
+
+// ContentHash fingerprints article text for Entry.ContentHash. Whitespace is
+// normalized so that markup-only changes do not produce a new hash.
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+	return fmt.Sprintf("%x", sum)[:16]
+}
+
+// Domain returns the host of the entry's URL, without a "www." prefix.
+func (e Entry) Domain() string {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// DefaultPath is $XDG_DATA_HOME/browser-pipes/history.db, falling back to
+// ~/.local/share when XDG_DATA_HOME is unset.
+func DefaultPath() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "browser-pipes", "history.db"), nil
+}
+
+// Filter selects history entries. Zero-valued fields match everything.
+type Filter struct {
+	Domain      string    // matches the host and its subdomains
+	URL         string    // entries recorded for this URL or fetched from it
+	Target      string    // envelope target
+	Kind        string    // KindRoute, KindSnapshot, KindSave, KindAudit or KindHash
+	Status      string    // StatusSuccess or StatusError
+	Tag         string    // entries carrying this tag
+	Lang        string    // snapshots in this language
+	ContentHash string    // snapshots of this text (see ContentHash)
+	Hash        string    // entries recorded with this URL hash (see Lookup)
+	Since       time.Time // entries at or after this time
+	Limit       int       // only the most recent Limit matches (0 for all)
+}
+
+// Lookup returns the URLs recorded with hash, newest first and without
+// repeats. hash matches the recorded hashes case-insensitively and either
+// may be a prefix of the other, so a hash printed with --full resolves
+// the 8-character names too.
+func Lookup(entries []Entry, hash string) []string {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if hash == "" {
+		return nil
+	}
+	var urls []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if hashMatches(e.Hash, hash) && !slices.Contains(urls, e.URL) {
+			urls = append(urls, e.URL)
+		}
+	}
+	return urls
+}
+
+// hashMatches reports whether the recorded URL hash matches hash the way
+// Lookup does.
+func hashMatches(recorded, hash string) bool {
+	recorded = strings.ToLower(recorded)
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	return recorded != "" && (strings.HasPrefix(recorded, hash) || strings.HasPrefix(hash, recorded))
+}
+
+// ParseSince accepts a date (2006-01-02), an RFC 3339 timestamp, a Go
+// duration ("36h") or a number of days ("7d") and returns the point in time
+// it refers to, relative to now.
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		if _, err := fmt.Sscanf(days, "%d", &n); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use 2006-01-02, 7d or 36h)", value)
+}
@@ -0,0 +1,226 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "history.db")
+
+	if entries, err := Read(path); err != nil || entries != nil {
+		t.Fatalf("missing file should be empty history, got %v (%v)", entries, err)
+	}
+
+	Append(path, Entry{Kind: KindRoute, URL: "https://a.com", Status: StatusSuccess, Jobs: []string{"read"}})
+	Append(path, Entry{Kind: KindSnapshot, URL: "https://b.com", Status: StatusSuccess, Files: []string{"/tmp/b.md"}})
+	Append(path, Entry{Kind: KindRoute, URL: "https://c.com", Status: StatusError, Error: "boom"})
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Jobs[0] != "read" || entries[1].Files[0] != "/tmp/b.md" || entries[2].Error != "boom" {
+		t.Errorf("entries did not round-trip: %+v", entries)
+	}
+	if entries[0].Time.IsZero() {
+		t.Error("expected Append to stamp the time")
+	}
+
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("history should be private, got %v", info.Mode().Perm())
+	}
+}
+
+func TestAppend_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := Append(path, Entry{Kind: KindRoute, URL: fmt.Sprintf("https://a.com/%d", i), Status: StatusSuccess}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if entries, err := Read(path); err != nil || len(entries) != 20 {
+		t.Errorf("expected 20 entries, got %d (%v)", len(entries), err)
+	}
+}
+
+func TestImportLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.db")
+	os.WriteFile(filepath.Join(dir, "history.jsonl"), []byte(`{"time":"2025-06-01T10:00:00Z","kind":"route","url":"https://a.com","status":"success"}
+{"kind":"rou
+{"time":"2025-06-02T10:00:00Z","kind":"snapshot","url":"https://b.com","status":"success","files":["/tmp/b.md"]}
+`), 0600)
+
+	// A torn line must not hide the rest of the log.
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].URL != "https://a.com" || entries[1].Files[0] != "/tmp/b.md" {
+		t.Fatalf("expected the log to be imported, got %+v", entries)
+	}
+	Append(path, Entry{Kind: KindRoute, URL: "https://c.com", Status: StatusSuccess})
+	if entries, _ := Read(path); len(entries) != 3 {
+		t.Errorf("expected the log to be imported once, got %d entries", len(entries))
+	}
+
+	if _, err := Read(filepath.Join(dir, "history.jsonl")); err == nil || !strings.Contains(err.Error(), "not a history database") {
+		t.Errorf("expected the log itself to be refused, got %v", err)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	Append(path, Entry{Kind: KindSnapshot, URL: "https://a.com", Status: StatusSuccess, Files: []string{"/tmp/a.md"}})
+	Append(path, Entry{Kind: KindSnapshot, URL: "https://b.com", Status: StatusSuccess, Files: []string{"/tmp/b.md"}})
+
+	n, err := Rewrite(path, func(e *Entry) bool {
+		if e.URL != "https://b.com" {
+			return false
+		}
+		e.Files = nil
+		return true
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 rewritten entry, got %d (%v)", n, err)
+	}
+
+	entries, _ := Read(path)
+	if len(entries) != 2 || entries[0].Files[0] != "/tmp/a.md" || entries[1].Files != nil {
+		t.Errorf("unexpected entries after rewrite: %+v", entries)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("history should stay private, got %v", info.Mode().Perm())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: now.AddDate(0, 0, -10), Kind: KindRoute, URL: "https://www.golang.org/doc", Target: "toggle"},
+		{Time: now.AddDate(0, 0, -1), Kind: KindRoute, URL: "https://blog.golang.org/x", OriginalURL: "https://old.golang.org/x", Hash: "abcd1234", Tags: []string{"golang", "blog"}, Status: StatusError},
+		{Time: now, Kind: KindSnapshot, URL: "https://notgolang.org/", Lang: "fr", ContentHash: "c0ffee"},
+	}
+
+	var (
+		doc  = "https://www.golang.org/doc"
+		blog = "https://blog.golang.org/x"
+		fr   = "https://notgolang.org/"
+	)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{doc, blog, fr}},
+		{"domain with subdomains", Filter{Domain: "golang.org"}, []string{doc, blog}},
+		{"domain with www", Filter{Domain: "www.golang.org"}, []string{doc, blog}},
+		{"target", Filter{Target: "toggle"}, []string{doc}},
+		{"kind", Filter{Kind: KindSnapshot}, []string{fr}},
+		{"status", Filter{Status: StatusError}, []string{blog}},
+		{"since", Filter{Since: now.AddDate(0, 0, -2)}, []string{blog, fr}},
+		{"tag", Filter{Tag: "blog"}, []string{blog}},
+		{"lang", Filter{Lang: "FR"}, []string{fr}},
+		{"combined", Filter{Domain: "golang.org", Since: now.AddDate(0, 0, -2)}, []string{blog}},
+		{"url", Filter{URL: "https://old.golang.org/x"}, []string{blog}},
+		{"content hash", Filter{ContentHash: "c0ffee"}, []string{fr}},
+		{"hash prefix", Filter{Hash: "ABCD"}, []string{blog}},
+		{"longer hash", Filter{Hash: "abcd1234ef"}, []string{blog}},
+		{"limit", Filter{Limit: 2}, []string{blog, fr}},
+		{"limit with filter", Filter{Kind: KindRoute, Limit: 1}, []string{blog}},
+	}
+	path := filepath.Join(t.TempDir(), "history.db")
+	for _, e := range entries {
+		Append(path, e)
+	}
+	for _, tt := range tests {
+		got, err := Query(path, tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var urls []string
+		for _, e := range got {
+			urls = append(urls, e.URL)
+		}
+		if !slices.Equal(urls, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, urls, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	entries := []Entry{
+		{Kind: KindRoute, URL: "https://a.com/old", Hash: "abcd1234"},
+		{Kind: KindHash, URL: "https://b.com", Hash: "ffff0000aaaa"},
+		{Kind: KindSnapshot, URL: "https://a.com/new", Hash: "abcd1234"},
+		{Kind: KindHash, URL: "https://a.com/new", Hash: "abcd1234"},
+		{Kind: KindRoute, URL: "https://c.com"},
+	}
+
+	tests := []struct {
+		hash string
+		want []string
+	}{
+		{"abcd1234", []string{"https://a.com/new", "https://a.com/old"}},
+		{"ABCD1234ef", []string{"https://a.com/new", "https://a.com/old"}},
+		{"ffff0000", []string{"https://b.com"}},
+		{"0000", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := Lookup(entries, tt.hash); !slices.Equal(got, tt.want) {
+			t.Errorf("Lookup(%q) = %v, want %v", tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"7d", now.AddDate(0, 0, -7)},
+		{"36h", now.Add(-36 * time.Hour)},
+		{"2025-06-01T00:00:00Z", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseSince(tt.input, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseSince(%q) = %v, %v; want %v", tt.input, got, err, tt.want)
+		}
+	}
+
+	if d, err := ParseSince("2025-06-01", now); err != nil || d.Day() != 1 {
+		t.Errorf("expected date to parse, got %v (%v)", d, err)
+	}
+	if _, err := ParseSince("last tuesday", now); err == nil {
+		t.Error("expected error for unparseable time")
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+	if p, _ := DefaultPath(); p != "/data/browser-pipes/history.db" {
+		t.Errorf("DefaultPath = %q", p)
+	}
+}
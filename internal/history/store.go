@@ -0,0 +1,362 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go, so the tools still build without cgo
+)
+
+// schema keeps each entry as JSON, with the fields filters run on in
+// indexed columns of their own.
+const schema = `
+CREATE TABLE entries (
+	id           INTEGER PRIMARY KEY,
+	time         INTEGER NOT NULL, -- Unix nanoseconds
+	kind         TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	url          TEXT NOT NULL,
+	original_url TEXT NOT NULL,
+	domain       TEXT NOT NULL,
+	target       TEXT NOT NULL,
+	lang         TEXT NOT NULL, -- lower case
+	hash         TEXT NOT NULL, -- lower case
+	content_hash TEXT NOT NULL,
+	entry        TEXT NOT NULL  -- the Entry as JSON
+);
+CREATE INDEX entries_time ON entries (time);
+CREATE INDEX entries_kind ON entries (kind, status);
+CREATE INDEX entries_url ON entries (url);
+CREATE INDEX entries_original_url ON entries (original_url);
+CREATE INDEX entries_domain ON entries (domain);
+CREATE INDEX entries_hash ON entries (hash);
+CREATE INDEX entries_content_hash ON entries (content_hash);
+PRAGMA user_version = 1;
+`
+
+// sqliteHeader starts every SQLite database file.
+const sqliteHeader = "SQLite format 3\x00"
+
+// open opens the history database at path. A database that does not exist
+// yet is created when create is set, or when there is a JSON Lines log to
+// import (see legacyPath); otherwise open returns nil.
+func open(path string, create bool) (*sql.DB, error) {
+	head := make([]byte, len(sqliteHeader))
+	f, err := os.Open(path)
+	if err == nil {
+		n, _ := f.Read(head)
+		f.Close()
+		if n > 0 && !bytes.Equal(head[:n], []byte(sqliteHeader)[:n]) {
+			return nil, fmt.Errorf("%s is not a history database: point the history at a .db file and its .jsonl log next to it is imported", path)
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		if !create && !exists(legacyPath(path)) {
+			return nil, nil
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create history directory: %w", err)
+		}
+		// SQLite would create it world-readable.
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create history: %w", err)
+		}
+		f.Close()
+	} else {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+
+	// Every tool appends on its own, so writers wait for each other, and
+	// transactions take the write lock up front rather than fail to upgrade.
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(10000)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	if err := migrate(db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrate creates the schema of a new database and imports the JSON Lines
+// log next to it.
+func migrate(db *sql.DB, path string) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	if version > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer tx.Rollback()
+	// Another tool may have created it while this one waited for the lock.
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version > 0 {
+		return err
+	}
+	if _, err := tx.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create history: %w", err)
+	}
+	if err := importLog(tx, legacyPath(path)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// legacyPath is where the history was kept as JSON Lines before it moved to
+// SQLite: the database path with a .jsonl extension.
+func legacyPath(path string) string {
+	legacy := strings.TrimSuffix(path, filepath.Ext(path)) + ".jsonl"
+	if legacy == path {
+		return ""
+	}
+	return legacy
+}
+
+// importLog inserts the entries of the JSON Lines log at path, if there is
+// one. Malformed lines (e.g. a torn write) are skipped.
+func importLog(tx *sql.Tx, path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if err := insert(tx, e); err != nil {
+			return fmt.Errorf("failed to import %s: %w", path, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insert adds e as a new row.
+func insert(db execer, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO entries (time, kind, status, url, original_url, domain, target, lang, hash, content_hash, entry)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UnixNano(), e.Kind, e.Status, e.URL, e.OriginalURL, e.Domain(), e.Target,
+		strings.ToLower(e.Lang), strings.ToLower(e.Hash), e.ContentHash, string(data))
+	return err
+}
+
+// updateRow replaces the row id with e.
+func updateRow(db execer, id int64, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE entries SET time = ?, kind = ?, status = ?, url = ?, original_url = ?, domain = ?, target = ?, lang = ?, hash = ?, content_hash = ?, entry = ?
+		WHERE id = ?`,
+		e.Time.UnixNano(), e.Kind, e.Status, e.URL, e.OriginalURL, e.Domain(), e.Target,
+		strings.ToLower(e.Lang), strings.ToLower(e.Hash), e.ContentHash, string(data), id)
+	return err
+}
+
+// where renders f as an SQL condition on the entries table. Domains match
+// their subdomains too, and hashes match by prefix either way as in Lookup.
+func (f Filter) where() (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, values ...any) {
+		conds = append(conds, cond)
+		args = append(args, values...)
+	}
+	if f.Kind != "" {
+		add("kind = ?", f.Kind)
+	}
+	if f.Status != "" {
+		add("status = ?", f.Status)
+	}
+	if f.Target != "" {
+		add("target = ?", f.Target)
+	}
+	if f.URL != "" {
+		add("(url = ? OR original_url = ?)", f.URL, f.URL)
+	}
+	if f.ContentHash != "" {
+		add("content_hash = ?", f.ContentHash)
+	}
+	if f.Hash != "" {
+		hash := strings.ToLower(strings.TrimSpace(f.Hash))
+		add("hash != '' AND (substr(hash, 1, length(?)) = ? OR substr(?, 1, length(hash)) = hash)", hash, hash, hash)
+	}
+	if !f.Since.IsZero() {
+		add("time >= ?", f.Since.UnixNano())
+	}
+	if f.Lang != "" {
+		add("lang = ?", strings.ToLower(f.Lang))
+	}
+	if f.Domain != "" {
+		want := strings.TrimPrefix(strings.ToLower(f.Domain), "www.")
+		add("(domain = ? OR substr(domain, -length(?)) = ?)", want, "."+want, "."+want)
+	}
+	if f.Tag != "" {
+		add("EXISTS (SELECT 1 FROM json_each(entry, '$.tags') WHERE value = ?)", f.Tag)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Append adds e to the history at path, creating it if needed.
+func Append(path string, e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	db, err := open(path, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := insert(db, e); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// Read returns all entries in the order they were recorded. A missing
+// database is an empty history.
+func Read(path string) ([]Entry, error) {
+	return Query(path, Filter{})
+}
+
+// Query returns the entries matching f in the order they were recorded.
+// The database does the filtering, so only the matches are loaded.
+func Query(path string, f Filter) ([]Entry, error) {
+	db, err := open(path, false)
+	if err != nil || db == nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	where, args := f.where()
+	query := "SELECT entry FROM entries" + where + " ORDER BY id"
+	if f.Limit > 0 {
+		query = "SELECT entry FROM (SELECT id, entry FROM entries" + where + " ORDER BY id DESC LIMIT ?) ORDER BY id"
+		args = append(args, f.Limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		var e Entry
+		if json.Unmarshal([]byte(data), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return entries, nil
+}
+
+// Rewrite applies update to every entry of the history at path and saves
+// the entries it reports as changed. It is for maintenance such as pruning,
+// which must keep the history consistent with the snapshot folder. Tools
+// appending meanwhile wait for it to finish. It returns the number of
+// changed entries.
+func Rewrite(path string, update func(e *Entry) bool) (int, error) {
+	db, err := open(path, false)
+	if err != nil || db == nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to write history: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, entry FROM entries ORDER BY id")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read history: %w", err)
+	}
+	type row struct {
+		id    int64
+		entry Entry
+	}
+	var changed []row
+	for rows.Next() {
+		var id int64
+		var data string
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read history: %w", err)
+		}
+		var e Entry
+		if json.Unmarshal([]byte(data), &e) == nil && update(&e) {
+			changed = append(changed, row{id, e})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	for _, r := range changed {
+		if err := updateRow(tx, r.id, r.entry); err != nil {
+			return 0, fmt.Errorf("failed to write history: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to write history: %w", err)
+	}
+	return len(changed), nil
+}
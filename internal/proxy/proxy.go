@@ -0,0 +1,73 @@
+// Package proxy chooses the proxy for outgoing fetches: an explicit proxy
+// URL (http, https, socks5 or socks5h, e.g. Tor at socks5h://127.0.0.1:9050),
+// or else the HTTP_PROXY, HTTPS_PROXY, ALL_PROXY and NO_PROXY variables.
+// net/http on its own ignores ALL_PROXY.
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Func returns the proxy function for proxyURL, or for the environment when
+// it is empty.
+func Func(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL == "" {
+		return fromEnvironment(), nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q", proxyURL)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q (use http, https, socks5 or socks5h)", proxyURL)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// Transport returns a copy of http.DefaultTransport that goes through
+// proxyURL, or through the proxy the environment names.
+func Transport(proxyURL string) (*http.Transport, error) {
+	fn, err := Func(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = fn
+	return t, nil
+}
+
+func fromEnvironment() func(*http.Request) (*url.URL, error) {
+	all := getenv("ALL_PROXY")
+	cfg := httpproxy.Config{
+		HTTPProxy:  or(getenv("HTTP_PROXY"), all),
+		HTTPSProxy: or(getenv("HTTPS_PROXY"), all),
+		NoProxy:    getenv("NO_PROXY"),
+	}
+	fn := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return fn(req.URL)
+	}
+}
+
+// getenv reads an upper- or lowercase proxy variable, as curl does.
+func getenv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+func or(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFuncEnvironment(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("all_proxy", "socks5h://127.0.0.1:9050")
+	t.Setenv("HTTPS_PROXY", "http://proxy.work:3128")
+	t.Setenv("NO_PROXY", "intranet.work")
+
+	fn, err := Func("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"http://example.com/":    "socks5h://127.0.0.1:9050",
+		"https://example.com/":   "http://proxy.work:3128",
+		"https://intranet.work/": "",
+	}
+	for target, want := range tests {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		u, err := fn(req)
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if err != nil || got != want {
+			t.Errorf("%s: got proxy %q, %v; want %q", target, got, err, want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "proxied %s", r.URL)
+	}))
+	defer proxy.Close()
+
+	transport, err := Transport(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get("http://example.invalid/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "proxied http://example.invalid/page" {
+		t.Errorf("expected the request to go through the proxy, got %q", body)
+	}
+
+	for _, bad := range []string{"ftp://proxy:21", "localhost:8080", "::"} {
+		if _, err := Func(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
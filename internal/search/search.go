@@ -0,0 +1,313 @@
+// Package search is a small full-text index over snapshot files. The index
+// keeps per-document term frequencies, is refreshed incrementally by file
+// modification time and ranks results with BM25.
+package search
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// BM25 tuning constants (the usual defaults).
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Doc is an indexed snapshot file.
+type Doc struct {
+	Path    string
+	Title   string
+	URL     string
+	ModTime time.Time
+	Length  int
+	Terms   map[string]int
+}
+
+// Index maps file paths to their indexed content.
+type Index struct {
+	Docs map[string]*Doc
+}
+
+// Source is a file to index, with optional metadata known from elsewhere
+// (e.g. the history log).
+type Source struct {
+	Path  string
+	Title string
+	URL   string
+}
+
+// Result is a ranked match.
+type Result struct {
+	Doc     *Doc
+	Score   float64
+	Snippet string
+}
+
+// Load reads an index from path; a missing or unreadable index starts empty,
+// since it can always be rebuilt from the files.
+func Load(path string) *Index {
+	idx := &Index{Docs: make(map[string]*Doc)}
+	f, err := os.Open(path)
+	if err != nil {
+		return idx
+	}
+	defer f.Close()
+
+	if err := gob.NewDecoder(f).Decode(idx); err != nil || idx.Docs == nil {
+		return &Index{Docs: make(map[string]*Doc)}
+	}
+	return idx
+}
+
+// Save writes the index to path.
+func (idx *Index) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(idx); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Refresh brings the index in line with sources: new or modified files are
+// (re)indexed and files that are no longer listed or no longer exist are
+// dropped. It returns how many files were (re)indexed.
+func (idx *Index) Refresh(sources []Source) (int, error) {
+	keep := make(map[string]bool, len(sources))
+	updated := 0
+
+	for _, src := range sources {
+		info, err := os.Stat(src.Path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		keep[src.Path] = true
+
+		if doc, ok := idx.Docs[src.Path]; ok && doc.ModTime.Equal(info.ModTime()) {
+			// Metadata may have been learned after the file was indexed.
+			if src.URL != "" {
+				doc.URL = src.URL
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(src.Path)
+		if err != nil {
+			return updated, fmt.Errorf("failed to index %s: %w", src.Path, err)
+		}
+
+		tokens := Tokenize(string(data))
+		terms := make(map[string]int)
+		for _, t := range tokens {
+			terms[t]++
+		}
+
+		title := src.Title
+		if title == "" {
+			title = firstHeading(string(data))
+		}
+		if title == "" {
+			title = filepath.Base(src.Path)
+		}
+
+		idx.Docs[src.Path] = &Doc{
+			Path:    src.Path,
+			Title:   title,
+			URL:     src.URL,
+			ModTime: info.ModTime(),
+			Length:  len(tokens),
+			Terms:   terms,
+		}
+		updated++
+	}
+
+	for path := range idx.Docs {
+		if !keep[path] {
+			delete(idx.Docs, path)
+		}
+	}
+	return updated, nil
+}
+
+// Search returns up to limit documents matching any query term, best first.
+func (idx *Index) Search(query string, limit int) []Result {
+	terms := uniq(Tokenize(query))
+	if len(terms) == 0 || len(idx.Docs) == 0 {
+		return nil
+	}
+
+	total := 0
+	df := make(map[string]int)
+	for _, doc := range idx.Docs {
+		total += doc.Length
+		for _, t := range terms {
+			if doc.Terms[t] > 0 {
+				df[t]++
+			}
+		}
+	}
+	n := float64(len(idx.Docs))
+	avgLen := float64(total) / n
+
+	var results []Result
+	for _, doc := range idx.Docs {
+		score := 0.0
+		for _, t := range terms {
+			tf := float64(doc.Terms[t])
+			if tf == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			norm := tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(doc.Length)/avgLen))
+			score += idf * norm
+		}
+		if score > 0 {
+			results = append(results, Result{Doc: doc, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Doc.Path < results[j].Doc.Path
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	for i := range results {
+		results[i].Snippet = snippet(results[i].Doc.Path, terms)
+	}
+	return results
+}
+
+// Tokenize lowercases text and splits it into words of two or more letters
+// or digits.
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) >= 2 {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+// WalkDir returns every markdown file below dir as a Source.
+func WalkDir(dir string) ([]Source, error) {
+	var sources []Source
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".md") {
+			sources = append(sources, Source{Path: path})
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("directory not found: %s", dir)
+	}
+	return sources, err
+}
+
+// snippet returns the first body line of the file containing a query term,
+// shortened around the match. Headings are skipped since the title is shown
+// separately.
+func snippet(path string, terms []string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lower := strings.ToLower(line)
+		for _, t := range terms {
+			if i := strings.Index(lower, t); i >= 0 {
+				return excerpt(line, i, 160)
+			}
+		}
+	}
+	return ""
+}
+
+// excerpt cuts about width bytes of line around offset, on rune boundaries.
+func excerpt(line string, offset, width int) string {
+	if len(line) <= width {
+		return line
+	}
+	start := max(0, offset-width/3)
+	end := min(len(line), start+width)
+	for start > 0 && !utf8RuneStart(line[start]) {
+		start--
+	}
+	for end < len(line) && !utf8RuneStart(line[end]) {
+		end++
+	}
+
+	out := line[start:end]
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(line) {
+		out += "…"
+	}
+	return out
+}
+
+func utf8RuneStart(b byte) bool { return b&0xC0 != 0x80 }
+
+func firstHeading(text string) string {
+	for _, line := range strings.SplitN(text, "\n", 20) {
+		if title, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok {
+			return strings.TrimSpace(title)
+		}
+	}
+	return ""
+}
+
+func uniq(tokens []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeDoc(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIndexSearch(t *testing.T) {
+	dir := t.TempDir()
+	goDoc := writeDoc(t, dir, "go.md", "# Go Generics\n\nGenerics in Go arrive with type parameters.\nGenerics generics generics.\n")
+	bread := writeDoc(t, dir, "bread.md", "# Sourdough\n\nA recipe for bread. Mention of go once.\n")
+	writeDoc(t, dir, "notes.txt", "generics")
+
+	sources, err := WalkDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("expected only markdown files, got %v", sources)
+	}
+	sources[0].URL = "https://example.com/" + filepath.Base(sources[0].Path)
+
+	idx := Load(filepath.Join(dir, "missing.idx"))
+	if n, err := idx.Refresh(sources); err != nil || n != 2 {
+		t.Fatalf("expected 2 indexed docs, got %d (%v)", n, err)
+	}
+
+	results := idx.Search("GENERICS go", 10)
+	if len(results) != 2 {
+		t.Fatalf("expected both docs to match, got %d", len(results))
+	}
+	if results[0].Doc.Path != goDoc || results[0].Doc.Title != "Go Generics" {
+		t.Errorf("expected the generics article to rank first, got %+v", results[0].Doc)
+	}
+	if !strings.Contains(results[0].Snippet, "Generics in Go") {
+		t.Errorf("unexpected snippet %q", results[0].Snippet)
+	}
+
+	if got := idx.Search("sourdough", 10); len(got) != 1 || got[0].Doc.Path != bread {
+		t.Errorf("expected only the bread doc, got %v", got)
+	}
+	if got := idx.Search("", 10); got != nil {
+		t.Errorf("empty query should return nothing, got %v", got)
+	}
+	if got := idx.Search("generics go", 1); len(got) != 1 {
+		t.Errorf("expected limit to apply, got %d results", len(got))
+	}
+}
+
+func TestIndexRefreshAndPersistence(t *testing.T) {
+	dir := t.TempDir()
+	a := writeDoc(t, dir, "a.md", "# A\nalpha")
+	b := writeDoc(t, dir, "b.md", "# B\nbeta")
+	idxPath := filepath.Join(dir, "index", "search.idx")
+
+	idx := Load(idxPath)
+	idx.Refresh([]Source{{Path: a}, {Path: b}})
+	if err := idx.Save(idxPath); err != nil {
+		t.Fatal(err)
+	}
+
+	idx = Load(idxPath)
+	if len(idx.Docs) != 2 {
+		t.Fatalf("expected persisted index with 2 docs, got %d", len(idx.Docs))
+	}
+
+	// Unchanged files are not re-read; modified ones are.
+	if n, _ := idx.Refresh([]Source{{Path: a}, {Path: b}}); n != 0 {
+		t.Errorf("expected no work for unchanged files, got %d", n)
+	}
+	os.WriteFile(a, []byte("# A\ngamma"), 0644)
+	os.Chtimes(a, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	os.Remove(b)
+
+	if n, _ := idx.Refresh([]Source{{Path: a}, {Path: b}}); n != 1 {
+		t.Errorf("expected the modified file to be reindexed, got %d", n)
+	}
+	if _, ok := idx.Docs[b]; ok {
+		t.Error("expected deleted file to be dropped")
+	}
+	if len(idx.Search("gamma", 0)) != 1 || len(idx.Search("alpha", 0)) != 0 {
+		t.Error("expected index to reflect the new content")
+	}
+}
+
+func TestLoad_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search.idx")
+	os.WriteFile(path, []byte("garbage"), 0600)
+	if idx := Load(path); idx.Docs == nil || len(idx.Docs) != 0 {
+		t.Error("expected a corrupt index to start empty")
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Hello, World! Go's año-2025 a")
+	want := "hello world go año 2025"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Tokenize = %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	line := strings.Repeat("x", 200) + "needle" + strings.Repeat("y", 200)
+	got := excerpt(line, 200, 60)
+	if !strings.Contains(got, "needle") || !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("unexpected excerpt %q", got)
+	}
+	if excerpt("short", 0, 60) != "short" {
+		t.Error("short lines should be returned whole")
+	}
+}
@@ -0,0 +1,201 @@
+package urlclean
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// bundledClearURLs is a subset of the ClearURLs rules (the global tracking
+// parameters and the providers of the most shared sites), in the format of
+// its data.min.json so a downloaded copy of the full list can replace it.
+//
+//go:embed clearurls.json
+var bundledClearURLs []byte
+
+// maxRedirections bounds how many redirect URLs are unwrapped in a row.
+const maxRedirections = 5
+
+type clearURLsFile struct {
+	Providers map[string]struct {
+		URLPattern        string   `json:"urlPattern"`
+		Rules             []string `json:"rules"`
+		ReferralMarketing []string `json:"referralMarketing"`
+		RawRules          []string `json:"rawRules"`
+		Exceptions        []string `json:"exceptions"`
+		Redirections      []string `json:"redirections"`
+	} `json:"providers"`
+}
+
+// Provider is a compiled ClearURLs provider: the URLs it applies to
+// and what it strips from them.
+type Provider struct {
+	name         string
+	urlPattern   *regexp.Regexp
+	rules        []*regexp.Regexp // query parameter names, referral marketing included
+	rawRules     []*regexp.Regexp // removed from the whole URL
+	exceptions   []*regexp.Regexp
+	redirections []*regexp.Regexp // the first group is the target URL
+}
+
+// Load compiles the enabled rule sets, the bundled one first.
+func (s ClearURLsSettings) Load() ([]Provider, error) {
+	var providers []Provider
+	skipped := 0
+	add := func(name string, data []byte) error {
+		p, n, err := parseClearURLs(data)
+		if err != nil {
+			return fmt.Errorf("invalid ClearURLs rules in %s: %w", name, err)
+		}
+		providers = append(providers, p...)
+		skipped += n
+		return nil
+	}
+
+	if s.Bundled {
+		if err := add("bundled rules", bundledClearURLs); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range s.Files {
+		data, err := os.ReadFile(expandHome(f))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ClearURLs rules: %w", err)
+		}
+		if err := add(f, data); err != nil {
+			return nil, err
+		}
+	}
+	if skipped > 0 {
+		log.Printf("   ⚠️ Skipped %d ClearURLs patterns Go regexps do not support", skipped)
+	}
+	return providers, nil
+}
+
+// parseClearURLs compiles the providers of a ClearURLs rule file, sorted by
+// name. Patterns RE2 cannot compile (lookarounds, backreferences) are
+// skipped and counted; a provider whose urlPattern fails is skipped whole.
+func parseClearURLs(data []byte) ([]Provider, int, error) {
+	var file clearURLsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, 0, err
+	}
+	if len(file.Providers) == 0 {
+		return nil, 0, fmt.Errorf("no providers")
+	}
+
+	skipped := 0
+	compile := func(patterns []string, wrap string) []*regexp.Regexp {
+		var out []*regexp.Regexp
+		for _, p := range patterns {
+			re, err := regexp.Compile("(?i)" + fmt.Sprintf(wrap, p))
+			if err != nil {
+				skipped++
+				continue
+			}
+			out = append(out, re)
+		}
+		return out
+	}
+
+	var providers []Provider
+	for name, p := range file.Providers {
+		pattern := compile([]string{p.URLPattern}, "%s")
+		if len(pattern) == 0 {
+			continue
+		}
+		providers = append(providers, Provider{
+			name:         name,
+			urlPattern:   pattern[0],
+			rules:        compile(append(slices.Clip(p.Rules), p.ReferralMarketing...), "^(?:%s)$"),
+			rawRules:     compile(p.RawRules, "%s"),
+			exceptions:   compile(p.Exceptions, "%s"),
+			redirections: compile(p.Redirections, "%s"),
+		})
+	}
+	slices.SortFunc(providers, func(a, b Provider) int { return strings.Compare(a.name, b.name) })
+	return providers, skipped, nil
+}
+
+func (p *Provider) matches(rawURL string) bool {
+	if !p.urlPattern.MatchString(rawURL) {
+		return false
+	}
+	return !slices.ContainsFunc(p.exceptions, func(re *regexp.Regexp) bool { return re.MatchString(rawURL) })
+}
+
+// clearURLs applies the providers matching rawURL: redirect URLs are replaced
+// by their target (which is cleaned in turn), then raw rules and tracking
+// parameters are removed. The query is left untouched when no parameter
+// matched.
+func clearURLs(providers []Provider, rawURL string) string {
+	for range maxRedirections {
+		target := clearURLsRedirect(providers, rawURL)
+		if target == "" {
+			break
+		}
+		rawURL = target
+	}
+
+	for i := range providers {
+		p := &providers[i]
+		if !p.matches(rawURL) {
+			continue
+		}
+		for _, re := range p.rawRules {
+			rawURL = re.ReplaceAllString(rawURL, "")
+		}
+		if len(p.rules) == 0 {
+			continue
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return rawURL
+		}
+		q := u.Query()
+		removed := false
+		for name := range q {
+			if slices.ContainsFunc(p.rules, func(re *regexp.Regexp) bool { return re.MatchString(name) }) {
+				q.Del(name)
+				removed = true
+			}
+		}
+		if removed {
+			u.RawQuery = q.Encode()
+			rawURL = u.String()
+		}
+	}
+	return rawURL
+}
+
+// clearURLsRedirect returns the target embedded in rawURL by the first
+// matching redirection rule, or "".
+func clearURLsRedirect(providers []Provider, rawURL string) string {
+	for i := range providers {
+		p := &providers[i]
+		if !p.matches(rawURL) {
+			continue
+		}
+		for _, re := range p.redirections {
+			m := re.FindStringSubmatch(rawURL)
+			if len(m) < 2 || m[1] == "" {
+				continue
+			}
+			target := m[1]
+			if unescaped, err := url.QueryUnescape(target); err == nil {
+				target = unescaped
+			}
+			if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+				target = "https://" + target
+			}
+			return target
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package urlclean
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseClearURLs(t *testing.T) {
+	rules := []byte(`{"providers": {"news": {
+		"urlPattern": "^https?:\\/\\/(?:[a-z0-9-]+\\.)*?news\\.example",
+		"rules": ["share_[a-z]+"],
+		"rawRules": ["\\/amp(?=\\/)"],
+		"redirections": ["^https?:\\/\\/news\\.example\\/out\\?to=([^&]*)"]
+	}}}`)
+	providers, skipped, err := parseClearURLs(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 1 || skipped != 1 {
+		t.Fatalf("expected 1 provider with the lookahead skipped, got %d providers and %d skipped", len(providers), skipped)
+	}
+
+	if _, _, err := parseClearURLs([]byte(`{"providers": {}}`)); err == nil {
+		t.Error("expected an error for a file without providers")
+	}
+}
+
+func TestClearURLsLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.min.json")
+	os.WriteFile(path, []byte(`{"providers": {"news": {"urlPattern": "news\\.example", "rules": ["share_id"]}}}`), 0644)
+
+	providers, err := ClearURLsSettings{Bundled: true, Files: []string{path}}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := CleaningSettings{Params: []string{}}
+	if got := s.Clean(providers, "https://www.youtube.com/watch?v=abc&si=xyz"); got != "https://www.youtube.com/watch?v=abc" {
+		t.Errorf("expected the bundled rules applied, got %q", got)
+	}
+	if got := s.Clean(providers, "https://news.example/story?share_id=1&id=7"); got != "https://news.example/story?id=7" {
+		t.Errorf("expected the file's rules applied, got %q", got)
+	}
+
+	if _, err := (ClearURLsSettings{Files: []string{filepath.Join(t.TempDir(), "missing.json")}}).Load(); err == nil {
+		t.Error("expected an error for a missing rule file")
+	}
+}
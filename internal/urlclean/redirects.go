@@ -0,0 +1,68 @@
+package urlclean
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// defaultRedirects are the outbound-link interstitials of common sites.
+// settings.cleaning.redirects adds to them.
+var defaultRedirects = []RedirectRule{
+	{Domains: GoogleDomains, Path: "/url", Param: "q"},
+	{Domains: GoogleDomains, Path: "/url", Param: "url"},
+	{Domains: []string{"l.facebook.com", "lm.facebook.com", "l.messenger.com"}, Path: "/l.php", Param: "u"},
+	{Domains: []string{"l.instagram.com"}, Param: "u"},
+	{Domains: []string{"l.threads.net"}, Param: "u"},
+	{Domains: []string{"out.reddit.com"}, Param: "url"},
+	{Domains: []string{"youtube.com"}, Path: "/redirect", Param: "q"},
+	{Domains: []string{"linkedin.com"}, Path: "/redir/redirect", Param: "url"},
+	{Domains: []string{"duckduckgo.com"}, Path: "/l/", Param: "uddg"},
+	{Domains: []string{"t.umblr.com"}, Path: "/redirect", Param: "z"},
+	{Domains: []string{"steamcommunity.com"}, Path: "/linkfilter", Param: "url"},
+	{Domains: []string{"slack-redir.net"}, Path: "/link", Param: "url"},
+	{Domains: []string{"safelinks.protection.outlook.com"}, Param: "url"},
+}
+
+// GoogleDomains are the Google search hosts, whose /url pages redirect.
+var GoogleDomains = []string{"google.com", "google.co.uk", "google.ca", "google.com.au", "google.de", "google.fr", "google.es", "google.it", "google.nl", "google.co.in", "google.co.jp", "google.com.br", "google.com.mx"}
+
+// UnwrapRedirects replaces an outbound redirect URL such as
+// google.com/url?q=... with the target it carries, repeatedly for nested
+// redirects. Other URLs are returned as they are.
+func (s CleaningSettings) UnwrapRedirects(rawURL string) string {
+	rules := append(slices.Clip(s.Redirects), defaultRedirects...)
+	for range maxRedirections {
+		target := redirectParam(rules, rawURL)
+		if target == "" {
+			break
+		}
+		rawURL = target
+	}
+	return rawURL
+}
+
+// redirectParam returns the target of the first rule matching rawURL, or
+// "" when none does or the parameter is not an http(s) URL.
+func redirectParam(rules []RedirectRule, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	for _, r := range rules {
+		if !MatchesDomain(u, r.Domains) || !strings.HasPrefix(u.Path, r.Path) {
+			continue
+		}
+		target := u.Query().Get(r.Param)
+		// Some redirectors encode the target twice.
+		if lower := strings.ToLower(target); strings.HasPrefix(lower, "http%3a") || strings.HasPrefix(lower, "https%3a") {
+			if unescaped, err := url.QueryUnescape(target); err == nil {
+				target = unescaped
+			}
+		}
+		if t, err := url.Parse(target); err == nil && (t.Scheme == "http" || t.Scheme == "https") && t.Host != "" {
+			return target
+		}
+	}
+	return ""
+}
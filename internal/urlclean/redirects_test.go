@@ -0,0 +1,28 @@
+package urlclean
+
+import "testing"
+
+func TestUnwrapRedirects(t *testing.T) {
+	s := CleaningSettings{Redirects: []RedirectRule{
+		{Domains: []string{"news.example"}, Path: "/out", Param: "to"},
+	}}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://www.google.com/url?sa=t&q=https://go.dev/doc/&usg=x", "https://go.dev/doc/"},
+		{"https://www.google.co.uk/url?url=https%3A%2F%2Fexample.com%2Fa%3Fb%3D1", "https://example.com/a?b=1"},
+		{"https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2F%3Ffbclid%3D1&h=AT0", "https://example.com/"},
+		{"https://out.reddit.com/t3_abc?url=https%253A%252F%252Fexample.com%252Fpost&token=x", "https://example.com/post"},
+		{"https://duckduckgo.com/l/?uddg=https%3A%2F%2Fexample.com%2F&rut=1", "https://example.com/"},
+		{"https://news.example/out?to=https%3A%2F%2Fwww.google.com%2Furl%3Fq%3Dhttps%3A%2F%2Fexample.com%2Fnested", "https://example.com/nested"},
+		{"https://www.google.com/url?q=javascript:alert(1)", "https://www.google.com/url?q=javascript:alert(1)"},
+		{"https://www.google.com/search?q=https://example.com", "https://www.google.com/search?q=https://example.com"},
+	}
+	for _, tt := range tests {
+		if actual := s.Clean(nil, tt.input); actual != tt.expected {
+			t.Errorf("Clean(%q) = %q, want %q", tt.input, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package urlclean strips tracking from URLs as settings.cleaning of a
+// plumber config describes, then normalizes them with settings.normalize.
+// plumber routes the result, and url-hash hashes it, so a URL and its
+// tracked copies share a hash.
+package urlclean
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"browser-pipes/internal/urlnorm"
+)
+
+// defaultParams are stripped from every URL unless settings.cleaning lists
+// its own params.
+var defaultParams = []string{"utm_*", "fbclid", "gclid", "ref"}
+
+// CleaningSettings control which query parameters plumber strips from URLs
+// before routing them. Every domain rule matching a URL applies on top of
+// Params.
+type CleaningSettings struct {
+	Params    []string          `yaml:"params" json:"params,omitempty" jsonschema:"description=Query parameters removed from every URL (default: utm_* fbclid gclid ref); a trailing * matches a prefix"`
+	Domains   []DomainCleaning  `yaml:"domains" json:"domains,omitempty" jsonschema:"description=Per-domain cleaning rules"`
+	ClearURLs ClearURLsSettings `yaml:"clearurls" json:"clearurls,omitempty" jsonschema:"description=ClearURLs rule sets applied before params and domains"`
+	Redirects []RedirectRule    `yaml:"redirects" json:"redirects,omitempty" jsonschema:"description=Outbound redirect pages replaced by the target URL they carry; added to the built-in ones (google.com/url and l.facebook.com/l.php...)"`
+}
+
+// RedirectRule describes an interstitial redirect page that carries its
+// target in a query parameter, like google.com/url?q=.
+type RedirectRule struct {
+	Domains []string `yaml:"domains" json:"domains" jsonschema:"description=Hosts of the redirect page; subdomains included"`
+	Path    string   `yaml:"path" json:"path,omitempty" jsonschema:"description=Path prefix of the redirect page (default: any path)"`
+	Param   string   `yaml:"param" json:"param" jsonschema:"description=Query parameter holding the target URL"`
+}
+
+// ClearURLsSettings enable rule sets in the format of the ClearURLs browser
+// extension: per-provider tracking parameters and redirect URLs whose
+// target is extracted.
+type ClearURLsSettings struct {
+	Bundled bool     `yaml:"bundled" json:"bundled,omitempty" jsonschema:"description=Apply the rules bundled with plumber (a subset of the ClearURLs providers)"`
+	Files   []string `yaml:"files" json:"files,omitempty" jsonschema:"description=ClearURLs rule files such as a downloaded data.min.json; applied after the bundled rules"`
+}
+
+// DomainCleaning strips more parameters on some domains, or keeps only the
+// ones that identify the page.
+type DomainCleaning struct {
+	Domains  []string `yaml:"domains" json:"domains" jsonschema:"description=Hosts the rule applies to; subdomains included"`
+	Params   []string `yaml:"params" json:"params,omitempty" jsonschema:"description=Query parameters also removed on these hosts; a trailing * matches a prefix"`
+	KeepOnly []string `yaml:"keep_only" json:"keep_only,omitempty" jsonschema:"description=Remove every query parameter but these on these hosts"`
+}
+
+// NormalizeSettings choose the urlnorm normalizations applied to every URL
+// after cleaning, so equivalent URLs route and dedupe identically.
+type NormalizeSettings struct {
+	StripFragment bool   `yaml:"strip_fragment" json:"strip_fragment,omitempty" jsonschema:"description=Drop the #fragment"`
+	SortQuery     bool   `yaml:"sort_query" json:"sort_query,omitempty" jsonschema:"description=Order query parameters by name"`
+	LowercaseHost bool   `yaml:"lowercase_host" json:"lowercase_host,omitempty" jsonschema:"description=Lowercase the host name"`
+	DefaultPort   bool   `yaml:"default_port" json:"default_port,omitempty" jsonschema:"description=Drop :80 on http and :443 on https"`
+	TrailingSlash string `yaml:"trailing_slash" json:"trailing_slash,omitempty" jsonschema:"enum=keep,enum=add,enum=remove,description=Trailing slash policy for paths (default: keep)"`
+}
+
+// Options returns n as urlnorm options.
+func (n NormalizeSettings) Options() urlnorm.Options {
+	return urlnorm.Options{
+		StripFragment: n.StripFragment,
+		SortQuery:     n.SortQuery,
+		LowercaseHost: n.LowercaseHost,
+		DefaultPort:   n.DefaultPort,
+		TrailingSlash: n.TrailingSlash,
+	}
+}
+
+// Normalize applies n to rawURL.
+func (n NormalizeSettings) Normalize(rawURL string) string {
+	return urlnorm.Normalize(rawURL, n.Options())
+}
+
+// Validate reports rules that cannot apply to any URL. The ClearURLs rule
+// files are checked by loading them (see ClearURLsSettings.Load).
+func (s CleaningSettings) Validate() error {
+	for i, rule := range s.Redirects {
+		if len(rule.Domains) == 0 || rule.Param == "" {
+			return fmt.Errorf("settings.cleaning.redirects rule %d needs domains and param", i+1)
+		}
+	}
+	for i, rule := range s.Domains {
+		if len(rule.Domains) == 0 {
+			return fmt.Errorf("settings.cleaning.domains rule %d has no domains", i+1)
+		}
+		if len(rule.Params) == 0 && len(rule.KeepOnly) == 0 {
+			return fmt.Errorf("settings.cleaning.domains rule %d has no params or keep_only", i+1)
+		}
+	}
+	return nil
+}
+
+// Clean unwraps outbound redirects and applies the ClearURLs providers
+// (loaded from s.ClearURLs) to rawURL, then strips its query parameters.
+// The query is left untouched when nothing is removed, and so are non-web
+// URLs such as mailto: and magnet: links.
+func (s CleaningSettings) Clean(providers []Provider, rawURL string) string {
+	if !isWebURL(rawURL) {
+		return rawURL
+	}
+	rawURL = clearURLs(providers, s.UnwrapRedirects(rawURL))
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	remove := s.Params
+	if remove == nil {
+		remove = defaultParams
+	}
+	var keepOnly []string
+	for _, rule := range s.Domains {
+		if MatchesDomain(u, rule.Domains) {
+			remove = append(slices.Clip(remove), rule.Params...)
+			keepOnly = append(keepOnly, rule.KeepOnly...)
+		}
+	}
+
+	q := u.Query()
+	removed := false
+	for name := range q {
+		if slices.ContainsFunc(remove, func(p string) bool { return matchesParam(p, name) }) ||
+			(keepOnly != nil && !slices.Contains(keepOnly, name)) {
+			q.Del(name)
+			removed = true
+		}
+	}
+	if !removed {
+		return rawURL
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// matchesParam reports whether the query parameter name matches pattern,
+// where a trailing * matches any suffix.
+func matchesParam(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return pattern == name
+}
+
+// isWebURL reports whether rawURL is an http(s) URL, or has no scheme.
+// mailto:, magnet:, tel: and geo: URLs are not: their query is not form
+// encoded and cleaning must leave it alone.
+func isWebURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "" || scheme == "http" || scheme == "https"
+}
+
+// MatchesDomain reports whether u is on one of domains or their subdomains.
+func MatchesDomain(u *url.URL, domains []string) bool {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(d), "www.")
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
@@ -0,0 +1,47 @@
+package urlclean
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	s := CleaningSettings{Domains: []DomainCleaning{
+		{Domains: []string{"youtube.com"}, Params: []string{"si"}},
+		{Domains: []string{"amazon.com"}, KeepOnly: []string{"k"}},
+	}}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://example.com?utm_source=news&fbclid=1&keep=me", "https://example.com?keep=me"},
+		{"https://example.com?b=2&a=1", "https://example.com?b=2&a=1"},
+		{"https://www.youtube.com/watch?v=abc&si=xyz", "https://www.youtube.com/watch?v=abc"},
+		{"https://www.amazon.com/s?k=go&crid=1", "https://www.amazon.com/s?k=go"},
+		{"mailto:a@example.com?subject=hi&utm_source=x", "mailto:a@example.com?subject=hi&utm_source=x"},
+	}
+	for _, tt := range tests {
+		if actual := s.Clean(nil, tt.input); actual != tt.expected {
+			t.Errorf("Clean(%q) = %q, want %q", tt.input, actual, tt.expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		settings CleaningSettings
+		want     string
+	}{
+		{CleaningSettings{Redirects: []RedirectRule{{Domains: []string{"a.example"}}}}, "redirects rule 1 needs domains and param"},
+		{CleaningSettings{Domains: []DomainCleaning{{Params: []string{"x"}}}}, "domains rule 1 has no domains"},
+		{CleaningSettings{Domains: []DomainCleaning{{Domains: []string{"a.example"}}}}, "no params or keep_only"},
+	}
+	for _, tt := range tests {
+		if err := tt.settings.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("expected an error with %q, got %v", tt.want, err)
+		}
+	}
+	if err := (CleaningSettings{Params: []string{"utm_*"}}).Validate(); err != nil {
+		t.Errorf("expected valid settings, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+// Package urlhash computes the short URL hashes snapshot files and
+// workspaces are named after.
+package urlhash
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// DefaultAlgo, DefaultEncoding and DefaultLength give the 8-character
+// SHA-256 prefix the tools have always used.
+const (
+	DefaultAlgo     = "sha256"
+	DefaultEncoding = "hex"
+	DefaultLength   = 8
+)
+
+// Algorithms lists the digests url-hash --algo accepts.
+var Algorithms = []string{"sha256", "sha1", "blake2b", "xxhash"}
+
+// Encodings lists the digest encodings url-hash --encoding accepts. All are
+// safe in file names and URLs.
+var Encodings = []string{"hex", "base32", "base58"}
+
+// DefaultLengths is the number of characters of each encoding that keeps
+// about the 32 bits of the 8 hex characters of a SHA-256 digest. The first
+// base58 character of a 256-bit digest carries only 4 bits or so.
+var DefaultLengths = map[string]int{"hex": 8, "base32": 7, "base58": 6}
+
+// base32Encoding is RFC 4648 base32 in lowercase without padding, so that
+// hashes survive case-insensitive file systems.
+var base32Encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// base58Alphabet is the Bitcoin alphabet, which leaves out 0, O, I and l.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Digest returns the raw digest of s with algo: SHA-256, SHA-1, BLAKE2b-256
+// or the 64-bit xxHash (XXH64), big-endian.
+func Digest(algo, s string) ([]byte, error) {
+	switch algo {
+	case "sha256":
+		sum := sha256.Sum256([]byte(s))
+		return sum[:], nil
+	case "sha1":
+		sum := sha1.Sum([]byte(s))
+		return sum[:], nil
+	case "blake2b":
+		sum := blake2b.Sum256([]byte(s))
+		return sum[:], nil
+	case "xxhash":
+		return binary.BigEndian.AppendUint64(nil, xxhash.Sum64String(s)), nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q (use %s)", algo, strings.Join(Algorithms, ", "))
+}
+
+// Encode returns sum in encoding: lowercase hex, lowercase unpadded base32
+// or base58.
+func Encode(sum []byte, encoding string) (string, error) {
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(sum), nil
+	case "base32":
+		return base32Encoding.EncodeToString(sum), nil
+	case "base58":
+		return base58(sum), nil
+	}
+	return "", fmt.Errorf("unknown hash encoding %q (use %s)", encoding, strings.Join(Encodings, ", "))
+}
+
+// base58 encodes sum as a big-endian number, with a leading "1" for each
+// leading zero byte.
+func base58(sum []byte) string {
+	var out []byte
+	n := new(big.Int).SetBytes(sum)
+	radix, digit := big.NewInt(58), new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, digit)
+		out = append(out, base58Alphabet[digit.Int64()])
+	}
+	for _, b := range sum {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Hash returns the first length characters of the algo digest of s in
+// encoding, or all of them when length is 0.
+func Hash(s, algo, encoding string, length int) (string, error) {
+	sum, err := Digest(algo, s)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := Encode(sum, encoding)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || length > len(encoded) {
+		return "", fmt.Errorf("invalid length %d: the %s digest has %d %s characters", length, algo, len(encoded), encoding)
+	}
+	if length == 0 {
+		return encoded, nil
+	}
+	return encoded[:length], nil
+}
+
+// Short returns the default hash of s, which snapshot files, images and
+// workspaces are named after.
+func Short(s string) string {
+	h, _ := Hash(s, DefaultAlgo, DefaultEncoding, DefaultLength)
+	return h
+}
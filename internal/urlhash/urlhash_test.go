@@ -0,0 +1,53 @@
+package urlhash
+
+import "testing"
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		algo     string
+		encoding string
+		length   int
+		want     string
+	}{
+		{"sha256", "hex", DefaultLength, "ba7816bf"},
+		{"sha256", "hex", 0, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"sha1", "hex", 0, "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{"blake2b", "hex", 0, "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{"xxhash", "hex", 0, "44bc2cf5ad770999"},
+		{"xxhash", "hex", 4, "44bc"},
+		{"sha1", "base32", 0, "vgmt4nsha2awvor6evyxqugcnsonbwe5"},
+		{"sha256", "base32", DefaultLengths["base32"], "xj4bnp4"},
+		{"sha256", "base58", 0, "DYu3G8aGTMBW1WrTw76zxQJQU4DHLw9MLyy7peG4LKkY"},
+		{"sha256", "base58", DefaultLengths["base58"], "DYu3G8"},
+	}
+	for _, tt := range tests {
+		got, err := Hash("abc", tt.algo, tt.encoding, tt.length)
+		if err != nil || got != tt.want {
+			t.Errorf("Hash(%s, %s, %d) = %q, %v; want %q", tt.algo, tt.encoding, tt.length, got, err, tt.want)
+		}
+	}
+
+	if _, err := Hash("abc", "md5", "hex", 8); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+	if _, err := Hash("abc", "sha256", "base64", 8); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+	if _, err := Hash("abc", "xxhash", "hex", 17); err == nil {
+		t.Error("expected an error for a length beyond the digest")
+	}
+}
+
+func TestBase58(t *testing.T) {
+	tests := map[string]string{
+		"":                    "",
+		"\x00\x00\x01":        "112",
+		"Hello World!":        "2NEpo7TZRRrLZSi2U",
+		"\x00\xffHello World": "15pQkmbD8Sm4XJWt5y",
+	}
+	for in, want := range tests {
+		if got := base58([]byte(in)); got != want {
+			t.Errorf("base58(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
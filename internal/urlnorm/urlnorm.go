@@ -0,0 +1,93 @@
+// Package urlnorm rewrites equivalent spellings of a URL to one form, so
+// that plumber routes them identically and url-hash gives them the same
+// hash. Every normalization is opt-in.
+package urlnorm
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Trailing-slash policies.
+const (
+	SlashKeep   = "keep"   // leave paths alone
+	SlashAdd    = "add"    // "/docs" -> "/docs/", but not "/page.html"
+	SlashRemove = "remove" // "/docs/" -> "/docs"; the root path stays "/"
+)
+
+// Options select the normalizations Normalize applies.
+type Options struct {
+	StripFragment bool   // drop "#section"
+	SortQuery     bool   // order query parameters by name, keeping their encoding
+	LowercaseHost bool   // "Example.COM" -> "example.com"
+	DefaultPort   bool   // drop :80 on http and :443 on https
+	TrailingSlash string // SlashKeep (or ""), SlashAdd or SlashRemove
+}
+
+// Validate reports an unknown trailing-slash policy.
+func (o Options) Validate() error {
+	switch o.TrailingSlash {
+	case "", SlashKeep, SlashAdd, SlashRemove:
+		return nil
+	}
+	return fmt.Errorf("invalid trailing slash policy %q (use keep, add or remove)", o.TrailingSlash)
+}
+
+// Normalize applies o to rawURL. URLs that do not parse, or are not
+// absolute, are returned as they are.
+func Normalize(rawURL string, o Options) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	if o.LowercaseHost {
+		u.Host = strings.ToLower(u.Host)
+	}
+	if o.DefaultPort {
+		if host, port, err := net.SplitHostPort(u.Host); err == nil &&
+			((u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443")) {
+			u.Host = host
+			if strings.Contains(host, ":") {
+				u.Host = "[" + host + "]" // IPv6
+			}
+		}
+	}
+	if o.StripFragment {
+		u.Fragment, u.RawFragment = "", ""
+	}
+	if o.SortQuery && u.RawQuery != "" {
+		pairs := strings.Split(u.RawQuery, "&")
+		slices.SortStableFunc(pairs, func(a, b string) int {
+			ka, _, _ := strings.Cut(a, "=")
+			kb, _, _ := strings.Cut(b, "=")
+			return strings.Compare(ka, kb)
+		})
+		u.RawQuery = strings.Join(pairs, "&")
+	}
+
+	switch o.TrailingSlash {
+	case SlashAdd:
+		if u.Path == "" {
+			u.Path = "/"
+		} else if !strings.HasSuffix(u.Path, "/") && !strings.Contains(path.Base(u.Path), ".") {
+			u.Path += "/"
+			if u.RawPath != "" {
+				u.RawPath += "/"
+			}
+		}
+	case SlashRemove:
+		if len(u.Path) > 1 {
+			u.Path = strings.TrimRight(u.Path, "/")
+			u.RawPath = strings.TrimRight(u.RawPath, "/")
+			if u.Path == "" {
+				u.Path, u.RawPath = "/", ""
+			}
+		}
+	}
+	return u.String()
+}
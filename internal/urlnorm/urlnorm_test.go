@@ -0,0 +1,35 @@
+package urlnorm
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	all := Options{StripFragment: true, SortQuery: true, LowercaseHost: true, DefaultPort: true}
+	tests := []struct {
+		name  string
+		input string
+		opts  Options
+		want  string
+	}{
+		{"nothing selected", "HTTPS://Example.com:443/a/?b=2&a=1#top", Options{}, "https://Example.com:443/a/?b=2&a=1#top"},
+		{"all but slashes", "https://Example.COM:443/Docs/?b=2&a=1&a=0#top", all, "https://example.com/Docs/?a=1&a=0&b=2"},
+		{"non-default port kept", "http://example.com:8080/", all, "http://example.com:8080/"},
+		{"http default port", "http://example.com:80/x", all, "http://example.com/x"},
+		{"ipv6 default port", "http://[::1]:80/x", all, "http://[::1]/x"},
+		{"query encoding kept", "https://example.com/?q=a%20b&c=%2F", Options{SortQuery: true}, "https://example.com/?c=%2F&q=a%20b"},
+		{"add slash", "https://example.com/docs", Options{TrailingSlash: SlashAdd}, "https://example.com/docs/"},
+		{"add slash to host", "https://example.com", Options{TrailingSlash: SlashAdd}, "https://example.com/"},
+		{"no slash after a file", "https://example.com/page.html", Options{TrailingSlash: SlashAdd}, "https://example.com/page.html"},
+		{"remove slash", "https://example.com/docs//?x=1", Options{TrailingSlash: SlashRemove}, "https://example.com/docs?x=1"},
+		{"root keeps its slash", "https://example.com/", Options{TrailingSlash: SlashRemove}, "https://example.com/"},
+		{"not absolute", "example.com/Docs", all, "example.com/Docs"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.input, tt.opts); got != tt.want {
+			t.Errorf("%s: Normalize(%q) = %q, want %q", tt.name, tt.input, got, tt.want)
+		}
+	}
+
+	if err := (Options{TrailingSlash: "always"}).Validate(); err == nil {
+		t.Error("expected an error for an unknown trailing slash policy")
+	}
+}
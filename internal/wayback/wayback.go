@@ -0,0 +1,59 @@
+// Package wayback looks up captures in the Wayback Machine, for plumber
+// audit filling dead snapshots and go-read-md --archive-fallback.
+package wayback
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Endpoint is the base URL of the Wayback Machine availability API.
+const Endpoint = "https://archive.org"
+
+// Closest asks the availability API at endpoint for the capture of target
+// closest to now. It returns "" if there is none.
+func Closest(client *http.Client, endpoint, target string) (string, error) {
+	resp, err := client.Get(strings.TrimSuffix(endpoint, "/") + "/wayback/available?url=" + url.QueryEscape(target))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+
+	var result struct {
+		ArchivedSnapshots struct {
+			Closest struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	closest := result.ArchivedSnapshots.Closest
+	if !closest.Available {
+		return "", nil
+	}
+	return closest.URL, nil
+}
+
+// Raw turns a capture URL (.../web/<timestamp>/<url>) into the URL of the
+// page as archived, without the Wayback Machine toolbar and rewritten
+// links.
+func Raw(capture string) string {
+	before, after, ok := strings.Cut(capture, "/web/")
+	if !ok {
+		return capture
+	}
+	timestamp, rest, ok := strings.Cut(after, "/")
+	if !ok || strings.HasSuffix(timestamp, "id_") {
+		return capture
+	}
+	return before + "/web/" + timestamp + "id_/" + rest
+}
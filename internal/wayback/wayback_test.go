@@ -0,0 +1,45 @@
+package wayback
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClosest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wayback/available" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("url") == "https://example.com/a" {
+			fmt.Fprint(w, `{"archived_snapshots":{"closest":{"available":true,"url":"http://web.archive.org/web/20240101000000/https://example.com/a"}}}`)
+		} else {
+			fmt.Fprint(w, `{"archived_snapshots":{}}`)
+		}
+	}))
+	defer ts.Close()
+
+	if got, err := Closest(ts.Client(), ts.URL, "https://example.com/a"); err != nil || got != "http://web.archive.org/web/20240101000000/https://example.com/a" {
+		t.Errorf("unexpected capture %q (%v)", got, err)
+	}
+	if got, err := Closest(ts.Client(), ts.URL, "https://example.com/b"); err != nil || got != "" {
+		t.Errorf("expected no capture, got %q (%v)", got, err)
+	}
+	if _, err := Closest(ts.Client(), ts.URL+"/missing", "https://example.com/a"); err == nil {
+		t.Error("expected an error for a failed lookup")
+	}
+}
+
+func TestRaw(t *testing.T) {
+	for in, want := range map[string]string{
+		"http://web.archive.org/web/20240101000000/https://example.com/a":    "http://web.archive.org/web/20240101000000id_/https://example.com/a",
+		"http://web.archive.org/web/20240101000000id_/https://example.com/a": "http://web.archive.org/web/20240101000000id_/https://example.com/a",
+		"https://example.com/other":                                          "https://example.com/other",
+	} {
+		if got := Raw(in); got != want {
+			t.Errorf("Raw(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
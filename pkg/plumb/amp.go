@@ -0,0 +1,131 @@
+package plumb
+
+import (
+	"bytes"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"browser-pipes/internal/urlclean"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ampCanonical rewrites an AMP URL to the article it is a copy of. AMP cache
+// URLs (google.com/amp/s/..., *.cdn.ampproject.org/c/s/...) carry the
+// original URL in their path; other AMP pages point at it with their
+// <link rel="canonical">, read from html (the page the browser sent) or, with
+// settings.amp.fetch, from the fetched page unless it is on the blocklist.
+func (c *Config) ampCanonical(rawURL, html string) string {
+	u := parseURL(rawURL)
+	if !c.Settings.AMP.Enabled || u == nil {
+		return rawURL
+	}
+
+	target := rawURL
+	if original := ampCacheOrigin(u); original != "" {
+		target = original
+		u = parseURL(target)
+	}
+	if u != nil && isAMP(u) {
+		page := []byte(html)
+		if html == "" && c.Settings.AMP.Fetch && c.blocked(target) {
+			log.Printf("   🚫 Not fetching blocked AMP page %s", target)
+		} else if html == "" && c.Settings.AMP.Fetch {
+			client, err := c.httpClient(10 * time.Second)
+			if err == nil {
+				page, err = fetchPage(client, target)
+			}
+			if err != nil {
+				log.Printf("   ⚠️ Failed to fetch AMP page %s: %v", target, err)
+			}
+		}
+		if canonical := canonicalLink(page, target); canonical != "" {
+			target = canonical
+		}
+	}
+
+	if target != rawURL {
+		log.Printf("   ⚡ AMP page %s -> %s", rawURL, target)
+	}
+	return target
+}
+
+// ampCacheOrigin returns the original URL of an AMP cache URL, or "".
+func ampCacheOrigin(u *url.URL) string {
+	var rest string
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case strings.HasSuffix(host, ".cdn.ampproject.org"):
+		// /c/ is a page, /v/ a viewer, /i/ an image; /s/ means https.
+		parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+		if len(parts) < 2 || !slices.Contains([]string{"c", "v", "i"}, parts[0]) {
+			return ""
+		}
+		rest = parts[1]
+	case urlclean.MatchesDomain(u, urlclean.GoogleDomains) && strings.HasPrefix(u.Path, "/amp/"):
+		rest = strings.TrimPrefix(u.Path, "/amp/")
+	default:
+		return ""
+	}
+
+	scheme := "http://"
+	if after, ok := strings.CutPrefix(rest, "s/"); ok {
+		scheme, rest = "https://", after
+	}
+	original := parseURL(scheme + rest)
+	if original == nil || original.Host == "" {
+		return ""
+	}
+	original.RawQuery = u.RawQuery
+	return original.String()
+}
+
+// isAMP reports whether u looks like the AMP version of a page: an amp path
+// segment (/amp/ or /post.amp.html), an amp or outputType=amp query
+// parameter, or an amp. subdomain.
+func isAMP(u *url.URL) bool {
+	if strings.HasPrefix(strings.ToLower(u.Hostname()), "amp.") {
+		return true
+	}
+	q := u.Query()
+	if q.Has("amp") || strings.EqualFold(q.Get("outputType"), "amp") {
+		return true
+	}
+	for _, segment := range strings.Split(strings.ToLower(u.Path), "/") {
+		if segment == "amp" || strings.HasSuffix(segment, ".amp") || strings.HasSuffix(segment, ".amp.html") {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalLink returns the <link rel="canonical"> of page resolved against
+// base, or "" when it has none that is an http(s) URL.
+func canonicalLink(page []byte, base string) string {
+	if len(page) == 0 {
+		return ""
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return ""
+	}
+	href := strings.TrimSpace(doc.Find("link[rel='canonical']").First().AttrOr("href", ""))
+	return resolveHTTP(base, href)
+}
+
+// resolveHTTP resolves ref against base and returns it when it is an
+// absolute http(s) URL.
+func resolveHTTP(base, ref string) string {
+	b := parseURL(base)
+	r := parseURL(ref)
+	if ref == "" || b == nil || r == nil {
+		return ""
+	}
+	resolved := b.ResolveReference(r)
+	if (resolved.Scheme != "http" && resolved.Scheme != "https") || resolved.Host == "" {
+		return ""
+	}
+	return resolved.String()
+}
@@ -0,0 +1,68 @@
+package plumb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAMPCanonical(t *testing.T) {
+	cfg := &Config{Settings: Settings{AMP: AMPSettings{Enabled: true}}}
+
+	tests := []struct {
+		input    string
+		html     string
+		expected string
+	}{
+		{"https://www.google.com/amp/s/www.example.com/2024/01/post.html", "", "https://www.example.com/2024/01/post.html"},
+		{"https://www-example-com.cdn.ampproject.org/c/s/www.example.com/post?id=1", "", "https://www.example.com/post?id=1"},
+		{"https://www-example-com.cdn.ampproject.org/v/www.example.com/post", "", "http://www.example.com/post"},
+		{"https://www.example.com/news/story/amp/", `<link rel="canonical" href="/news/story/">`, "https://www.example.com/news/story/"},
+		{"https://www.google.com/amp/s/www.example.com/story.amp.html", `<link rel="canonical" href="https://www.example.com/story.html">`, "https://www.example.com/story.html"},
+		{"https://www.example.com/news/story/amp/", "", "https://www.example.com/news/story/amp/"},
+		{"https://www.example.com/news/story/", `<link rel="canonical" href="https://other.example/">`, "https://www.example.com/news/story/"},
+	}
+	for _, tt := range tests {
+		if actual := cfg.ampCanonical(tt.input, tt.html); actual != tt.expected {
+			t.Errorf("ampCanonical(%q) = %q, want %q", tt.input, actual, tt.expected)
+		}
+	}
+
+	cfg.Settings.AMP.Enabled = false
+	if got := cfg.ampCanonical(tests[0].input, ""); got != tests[0].input {
+		t.Errorf("expected no rewrite when disabled, got %q", got)
+	}
+}
+
+func TestAMPCanonicalFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head><link rel="canonical" href="http://%s/article"></head></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{Settings: Settings{AMP: AMPSettings{Enabled: true, Fetch: true}}}
+	if got := cfg.ampCanonical(srv.URL+"/article?amp=1", ""); got != srv.URL+"/article" {
+		t.Errorf("expected the canonical link of the fetched page, got %q", got)
+	}
+}
+
+func TestAMPCanonicalFetch_Blocked(t *testing.T) {
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		fmt.Fprintf(w, `<html><head><link rel="canonical" href="http://%s/article"></head></html>`, r.Host)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{Settings: Settings{
+		AMP:       AMPSettings{Enabled: true, Fetch: true},
+		Blocklist: []BlockRule{{Domains: []string{"127.0.0.1"}}},
+	}}
+	if got := cfg.ampCanonical(srv.URL+"/article?amp=1", ""); got != srv.URL+"/article?amp=1" {
+		t.Errorf("expected the blocked URL unchanged, got %q", got)
+	}
+	if requested {
+		t.Error("expected the blocked AMP page not to be fetched")
+	}
+}
@@ -0,0 +1,267 @@
+package plumb
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"browser-pipes/internal/history"
+	"browser-pipes/internal/wayback"
+)
+
+// Outcomes of a liveness check.
+const (
+	auditAlive   = "alive"
+	auditDead    = "dead"    // 404, 410 or a domain that no longer resolves
+	auditUnknown = "unknown" // any other failure, e.g. a timeout or a 5xx
+)
+
+// auditResult is the outcome of checking one snapshotted URL.
+type auditResult struct {
+	URL     string
+	State   string
+	Reason  string
+	Gap     bool   // no snapshot of the URL is left on disk
+	Capture string // closest Wayback Machine capture, if looked up
+}
+
+// runAudit implements "plumber audit": it re-checks every URL with a
+// snapshot in the history, reports the dead ones and records the outcome as
+// audit entries. With --wayback, dead URLs are looked up in the Wayback
+// Machine; with --fill, the capture of a dead URL whose snapshot is missing
+// is run through a job, so the snapshot folder keeps a copy.
+func runAudit(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "History file (default: settings.history.path or ~/.local/share/browser-pipes/history.db)")
+	domain := fs.String("domain", "", "Only check URLs on this domain (and its subdomains)")
+	since := fs.String("since", "", "Only check URLs snapshotted since a date (2006-01-02) or age (7d, 36h)")
+	timeout := fs.Duration("timeout", 15*time.Second, "Timeout for each request")
+	concurrency := fs.Int("concurrency", 4, "Number of URLs checked at once")
+	lookup := fs.Bool("wayback", false, "Look up dead URLs in the Wayback Machine")
+	fill := fs.String("fill", "", "Job run with the Wayback capture of dead URLs whose snapshot is missing (implies --wayback)")
+	endpoint := fs.String("wayback-endpoint", wayback.Endpoint, "Wayback Machine availability API base URL")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: plumber audit [--domain d] [--since 30d] [--wayback] [--fill job]")
+	}
+
+	var job Job
+	if *fill != "" {
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration is invalid: %w", err)
+		}
+		var ok bool
+		if job, ok = cfg.Jobs[*fill]; !ok {
+			return fmt.Errorf("undefined job '%s'", *fill)
+		}
+		*lookup = true
+	}
+
+	path, err := historyFile(cfg, *file)
+	if err != nil {
+		return err
+	}
+	sinceTime, err := history.ParseSince(*since, time.Now())
+	if err != nil {
+		return err
+	}
+	entries, err := history.Query(path, history.Filter{
+		Kind:   history.KindSnapshot,
+		Domain: *domain,
+		Since:  sinceTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	urls, kept := snapshotURLs(entries)
+	if len(urls) == 0 {
+		log.Printf("📭 No snapshots to audit in %s", path)
+		return nil
+	}
+
+	log.Printf("🩺 Checking %d snapshotted URLs...", len(urls))
+	client, err := cfg.httpClient(*timeout)
+	if err != nil {
+		return err
+	}
+	results := checkURLs(client, urls, max(*concurrency, 1))
+
+	dead := 0
+	for i := range results {
+		r := &results[i]
+		if r.State != auditDead {
+			continue
+		}
+		dead++
+		r.Gap = !kept[r.URL]
+		if !*lookup {
+			continue
+		}
+		if r.Capture, err = wayback.Closest(client, *endpoint, r.URL); err != nil {
+			log.Printf("   ⚠️ Wayback lookup failed for %s: %v", r.URL, err)
+			continue
+		}
+		if r.Capture == "" || !r.Gap || *fill == "" {
+			continue
+		}
+		if err := fillFromCapture(cfg, client, *fill, job, *r); err != nil {
+			log.Printf("   ❌ Failed to fill %s: %v", r.URL, err)
+		} else {
+			r.Gap = false
+		}
+	}
+
+	for _, r := range results {
+		e := history.Entry{
+			Kind:   history.KindAudit,
+			URL:    r.URL,
+			Status: history.StatusSuccess,
+			Link:   r.Capture,
+		}
+		if r.State != auditAlive {
+			e.Status = history.StatusError
+			e.Error = r.Reason
+		}
+		if err := history.Append(path, e); err != nil {
+			log.Printf("   ⚠️ Failed to record history: %v", err)
+			break
+		}
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tREASON\tSNAPSHOT\tWAYBACK\tURL")
+	for _, r := range results {
+		snapshot := "kept"
+		if r.Gap {
+			snapshot = "missing"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.State, dash(r.Reason), snapshot, dash(r.Capture), r.URL)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	log.Printf("✅ Audited %d URLs: %d dead", len(results), dead)
+	return nil
+}
+
+// snapshotURLs returns the distinct URLs of snapshot entries in first-seen
+// order, and whether a successful snapshot of each is still on disk.
+func snapshotURLs(entries []history.Entry) ([]string, map[string]bool) {
+	var urls []string
+	kept := map[string]bool{}
+	for _, e := range entries {
+		if _, seen := kept[e.URL]; !seen {
+			urls = append(urls, e.URL)
+			kept[e.URL] = false
+		}
+		if e.Status != history.StatusSuccess || len(e.Files) == 0 {
+			continue
+		}
+		if _, err := os.Stat(e.Files[0]); err == nil {
+			kept[e.URL] = true
+		}
+	}
+	return urls, kept
+}
+
+// checkURLs checks urls with n workers, returning results in the same order.
+func checkURLs(client *http.Client, urls []string, n int) []auditResult {
+	results := make([]auditResult, len(urls))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = checkURL(client, urls[i])
+			}
+		}()
+	}
+	for i := range urls {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+func checkURL(client *http.Client, target string) auditResult {
+	r := auditResult{URL: target}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		r.State, r.Reason = auditUnknown, err.Error()
+		return r
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; browser-pipes audit)")
+	resp, err := client.Do(req)
+	if err != nil {
+		r.State, r.Reason = classifyError(err)
+		return r
+	}
+	resp.Body.Close()
+
+	r.State, r.Reason = classifyStatus(resp.StatusCode), resp.Status
+	if r.State == auditAlive {
+		r.Reason = ""
+	}
+	return r
+}
+
+func classifyStatus(code int) string {
+	switch {
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return auditDead
+	case code < 400:
+		return auditAlive
+	}
+	// 401/403 and 429 are mostly bot protection, 5xx may be temporary.
+	return auditUnknown
+}
+
+// classifyError treats a domain that no longer resolves (NXDOMAIN) as dead
+// and any other network failure as unknown.
+func classifyError(err error) (state, reason string) {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return auditDead, "no such host"
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return auditUnknown, err.Error()
+}
+
+// fillFromCapture runs job with the archived page of a dead URL, as if the
+// page had been sent from the browser.
+func fillFromCapture(cfg *Config, client *http.Client, jobName string, job Job, r auditResult) error {
+	body, err := fetchPage(client, wayback.Raw(r.Capture))
+	if err != nil {
+		return err
+	}
+	log.Printf("   🏛️ Filling %s from %s", r.URL, r.Capture)
+	params := map[string]string{
+		"tags":            strings.Join(cfg.tagsFor(r.URL), ","),
+		"wayback_capture": r.Capture,
+	}
+	start := time.Now()
+	err = runJob(cfg, newRouteState(context.Background(), "audit"), jobName, job, params, r.URL, string(body))
+	recordRoute(cfg, Envelope{URL: r.URL, Origin: "audit"}, r.URL, []string{jobName}, time.Since(start), err)
+	return err
+}
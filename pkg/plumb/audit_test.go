@@ -0,0 +1,107 @@
+package plumb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"browser-pipes/internal/history"
+)
+
+func TestClassify(t *testing.T) {
+	for code, want := range map[int]string{200: auditAlive, 301: auditAlive, 404: auditDead, 410: auditDead, 403: auditUnknown, 503: auditUnknown} {
+		if got := classifyStatus(code); got != want {
+			t.Errorf("classifyStatus(%d) = %s, want %s", code, got, want)
+		}
+	}
+	nx := fmt.Errorf("dial: %w", &net.DNSError{Err: "no such host", Name: "gone.example", IsNotFound: true})
+	if state, _ := classifyError(nx); state != auditDead {
+		t.Errorf("expected NXDOMAIN to be dead, got %s", state)
+	}
+	if state, _ := classifyError(errors.New("connection reset")); state != auditUnknown {
+		t.Errorf("expected other errors to be unknown, got %s", state)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/alive" || r.URL.Path == "/kept":
+			fmt.Fprint(w, "ok")
+		case r.URL.Path == "/wayback/available":
+			if strings.HasSuffix(r.URL.Query().Get("url"), "/gone") {
+				fmt.Fprintf(w, `{"archived_snapshots":{"closest":{"available":true,"url":"%s/web/20240101000000/%s"}}}`, ts.URL, r.URL.Query().Get("url"))
+			} else {
+				fmt.Fprint(w, `{"archived_snapshots":{}}`)
+			}
+		case strings.HasPrefix(r.URL.Path, "/web/20240101000000id_/"):
+			fmt.Fprint(w, "<html><body><p>archived copy</p></body></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	historyPath := filepath.Join(dir, "history.db")
+	keptFile := filepath.Join(dir, "kept.md")
+	os.WriteFile(keptFile, []byte("# Kept"), 0600)
+	for _, e := range []history.Entry{
+		{Kind: history.KindSnapshot, URL: ts.URL + "/alive", Status: history.StatusSuccess, Files: []string{filepath.Join(dir, "alive.md")}},
+		{Kind: history.KindSnapshot, URL: ts.URL + "/kept", Status: history.StatusSuccess, Files: []string{keptFile}},
+		{Kind: history.KindSnapshot, URL: ts.URL + "/gone", Status: history.StatusError},
+		{Kind: history.KindSnapshot, URL: ts.URL + "/gone", Status: history.StatusError},
+		{Kind: history.KindRoute, URL: ts.URL + "/routed", Status: history.StatusSuccess},
+	} {
+		if err := history.Append(historyPath, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filled := filepath.Join(dir, "filled.html")
+	cfg := &Config{
+		Version:  "2",
+		Settings: Settings{History: HistorySettings{Path: historyPath}},
+		Jobs: map[string]Job{"snap": {Steps: []Step{
+			{Name: "run", Args: "cp '<<parameters.html_file>>' " + filled},
+		}}},
+	}
+
+	var stdout bytes.Buffer
+	err := runAudit([]string{"--wayback-endpoint", ts.URL, "--fill", "snap"}, cfg, &stdout, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and 3 URLs, got:\n%s", stdout.String())
+	}
+	for i, want := range []string{"alive", "alive", "dead"} {
+		if !strings.HasPrefix(lines[i+1], want) {
+			t.Errorf("expected %s in %q", want, lines[i+1])
+		}
+	}
+	if !strings.Contains(lines[3], "404 Not Found") || !strings.Contains(lines[3], "/web/20240101000000/") || !strings.Contains(lines[3], "kept") {
+		t.Errorf("expected the dead URL to be filled from the Wayback Machine, got %q", lines[3])
+	}
+	if data, _ := os.ReadFile(filled); !strings.Contains(string(data), "archived copy") {
+		t.Errorf("expected the fill job to get the raw capture, got %q", data)
+	}
+
+	audits, _ := history.Query(historyPath, history.Filter{Kind: history.KindAudit})
+	if len(audits) != 3 {
+		t.Fatalf("expected 3 audit entries, got %+v", audits)
+	}
+	if gone := audits[2]; gone.Status != history.StatusError || gone.Link == "" {
+		t.Errorf("expected the dead URL recorded with its capture, got %+v", gone)
+	}
+}
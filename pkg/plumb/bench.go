@@ -0,0 +1,207 @@
+package plumb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// benchConfig has the shape of a typical config: a few workflows whose
+// regexes the URLs are matched against, and jobs without steps, so that
+// only plumber's own work is measured.
+const benchConfig = `version: "2"
+jobs:
+  noop:
+    steps: []
+workflows:
+  video:
+    jobs:
+      - noop:
+          match: "^https://(www\\.)?(youtube\\.com|youtu\\.be|vimeo\\.com)/"
+  reading:
+    jobs:
+      - noop:
+          match: "^https://[^/]+/(blog|posts?|articles?)/"
+          tags: [reading]
+  default:
+    jobs:
+      - noop:
+          match: "^https?://"
+`
+
+// benchURLs are the URLs the benchmark cycles through: tracking parameters
+// to clean, outbound redirects to unwrap and hosts for each workflow.
+var benchURLs = []string{
+	"https://www.youtube.com/watch?v=dQw4w9WgXcQ&utm_source=twitter&utm_medium=social",
+	"https://example.com/blog/2024/05/some-article?ref=hn&fbclid=IwAR0abc",
+	"https://www.google.com/url?q=https://news.example.org/articles/42&sa=D",
+	"https://docs.example.net/guide/install.html#linux",
+	"https://shop.example.com/item/123?gclid=Cj0KCQ&color=blue&size=m",
+}
+
+// benchStages are the stages of handling a message, in order.
+var benchStages = []string{"decode", "clean", "match", "dispatch"}
+
+// BenchStage is the latency of one stage over all messages.
+type BenchStage struct {
+	Stage string        `json:"stage"`
+	Mean  time.Duration `json:"mean_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P95   time.Duration `json:"p95_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// BenchReport is what plumber bench measured.
+type BenchReport struct {
+	Messages       int           `json:"messages"`
+	Elapsed        time.Duration `json:"elapsed_ns"`
+	MessagesPerSec float64       `json:"messages_per_sec"`
+	Stages         []BenchStage  `json:"stages"`
+}
+
+// runBench implements "plumber bench": it measures how many messages per
+// second the native messaging loop handles with a no-op job, and the
+// latency of each stage (decode, clean, match, dispatch), so regressions
+// in the routing engine show up. Like selftest it uses a throwaway config.
+func runBench(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	messages := fs.Int("messages", 2000, "Number of messages to send through the loop")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *messages < 1 {
+		return fmt.Errorf("--messages must be at least 1")
+	}
+
+	dir, err := os.MkdirTemp("", "plumber-bench-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "plumber.yaml")
+	if err := os.WriteFile(configPath, []byte(benchConfig), 0600); err != nil {
+		return err
+	}
+
+	// Routing logs several lines per message; writing them would be most
+	// of what is measured.
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(stderr)
+
+	var cfg Config
+	if err := loadConfig(configPath, &cfg, io.Discard); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("bench config is invalid: %w", err)
+	}
+
+	report, err := bench(&cfg, *messages)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	fmt.Fprintf(stdout, "📊 %d messages in %v: %.0f messages/sec\n\n", report.Messages, report.Elapsed.Round(time.Millisecond), report.MessagesPerSec)
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE\tMEAN\tP50\tP95\tP99\tMAX")
+	for _, s := range report.Stages {
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t%v\n", s.Stage, s.Mean, s.P50, s.P95, s.P99, s.Max)
+	}
+	return w.Flush()
+}
+
+// bench sends n envelopes through the loop for the throughput, then times
+// each stage of handling them one by one.
+func bench(cfg *Config, n int) (BenchReport, error) {
+	var stdin bytes.Buffer
+	frames := make([][]byte, n)
+	for i := range frames {
+		frames[i] = envelopeFrame(Envelope{ID: fmt.Sprint(i), Origin: "bench", URL: benchURLs[i%len(benchURLs)]})
+		stdin.Write(frames[i])
+	}
+
+	var stdout bytes.Buffer
+	start := time.Now()
+	startLoop(&stdin, &stdout, cfg, nil)
+	report := BenchReport{Messages: n, Elapsed: time.Since(start)}
+	report.MessagesPerSec = float64(n) / report.Elapsed.Seconds()
+	if failed := bytes.Count(stdout.Bytes(), []byte(`"status":"error"`)); failed > 0 {
+		return report, fmt.Errorf("%d of %d messages failed", failed, n)
+	}
+
+	timings := make(map[string][]time.Duration)
+	lap := func(stage string, start time.Time) time.Time {
+		now := time.Now()
+		timings[stage] = append(timings[stage], now.Sub(start))
+		return now
+	}
+	for _, f := range frames {
+		t := time.Now()
+		env, _, err := decodeEnvelope(f[4:])
+		if err != nil {
+			return report, err
+		}
+		t = lap("decode", t)
+
+		url := cfg.prepareURL(env.URL, env.HTML)
+		t = lap("clean", t)
+
+		var matched []WorkflowJob
+		for _, wf := range cfg.Workflows {
+			for _, jobRef := range wf.Jobs {
+				if jobRef.matchesURL(url) {
+					matched = append(matched, jobRef)
+				}
+			}
+		}
+		t = lap("match", t)
+
+		rs := newRouteState(context.Background(), env.Origin)
+		for _, jobRef := range matched {
+			if err := executeJob(cfg, rs, cfg.Jobs[jobRef.Name], jobRef.Params, url, env.HTML); err != nil {
+				return report, err
+			}
+		}
+		lap("dispatch", t)
+	}
+
+	for _, stage := range benchStages {
+		report.Stages = append(report.Stages, stageLatency(stage, timings[stage]))
+	}
+	return report, nil
+}
+
+// stageLatency summarizes the durations of a stage.
+func stageLatency(stage string, d []time.Duration) BenchStage {
+	slices.Sort(d)
+	var total time.Duration
+	for _, v := range d {
+		total += v
+	}
+	at := func(q float64) time.Duration { return d[int(q*float64(len(d)-1))] }
+	return BenchStage{
+		Stage: stage,
+		Mean:  total / time.Duration(len(d)),
+		P50:   at(0.50),
+		P95:   at(0.95),
+		P99:   at(0.99),
+		Max:   d[len(d)-1],
+	}
+}
@@ -0,0 +1,52 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMainRun_Bench(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	if err := Run([]string{"bench", "--messages", "20", "--json"}, nil, stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var report BenchReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("expected a JSON report, got %q: %v", stdout, err)
+	}
+	if report.Messages != 20 || report.MessagesPerSec <= 0 || len(report.Stages) != len(benchStages) {
+		t.Errorf("unexpected report %+v", report)
+	}
+	for i, s := range report.Stages {
+		if s.Stage != benchStages[i] || s.Max < s.P50 {
+			t.Errorf("unexpected stage %+v", s)
+		}
+	}
+
+	stdout.Reset()
+	if err := Run([]string{"bench", "--messages", "5"}, nil, stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "messages/sec") || !strings.Contains(stdout.String(), "dispatch") {
+		t.Errorf("expected a table, got %q", stdout.String())
+	}
+
+	if err := Run([]string{"bench", "--messages", "0"}, nil, io.Discard, io.Discard); err == nil {
+		t.Error("expected an error for --messages 0")
+	}
+}
+
+func TestStageLatency(t *testing.T) {
+	var d []time.Duration
+	for i := 100; i >= 1; i-- {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+	s := stageLatency("clean", d)
+	if s.Mean != 50500*time.Microsecond || s.P50 != 50*time.Millisecond || s.P95 != 95*time.Millisecond || s.P99 != 99*time.Millisecond || s.Max != 100*time.Millisecond {
+		t.Errorf("unexpected latency %+v", s)
+	}
+}
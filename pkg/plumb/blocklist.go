@@ -0,0 +1,98 @@
+package plumb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"browser-pipes/internal/urlclean"
+)
+
+// Blocklist actions.
+const (
+	blockDrop = "drop" // route nothing and answer with an error
+	blockWarn = "warn" // route as usual but say so in the response
+	blockJob  = "job"  // run only the rule's job instead of the workflows
+)
+
+// blockRule returns the first settings.blocklist rule matching any of urls,
+// or nil. Several URLs are checked so that a blocked site is caught both as
+// the browser sent it and after it was cleaned and rewritten.
+func (c *Config) blockRule(urls ...string) *BlockRule {
+	for i := range c.Settings.Blocklist {
+		rule := &c.Settings.Blocklist[i]
+		for _, raw := range urls {
+			if rule.matches(raw) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// blocked reports whether rawURL matches a rule that keeps it from being
+// opened, i.e. any rule but a warning.
+func (c *Config) blocked(rawURL string) bool {
+	rule := c.blockRule(rawURL)
+	return rule != nil && rule.action() != blockWarn
+}
+
+// matches reports whether rawURL is on one of the rule's domains or matches
+// its regex.
+func (r BlockRule) matches(rawURL string) bool {
+	if u := parseURL(rawURL); u != nil && urlclean.MatchesDomain(u, r.Domains) {
+		return true
+	}
+	return matches(r.Match, rawURL)
+}
+
+// action returns the rule's action, drop unless it sets another.
+func (r BlockRule) action() string {
+	if r.Action == "" {
+		return blockDrop
+	}
+	return r.Action
+}
+
+// reason explains the block to the extension.
+func (r BlockRule) reason() string {
+	if r.Reason != "" {
+		return r.Reason
+	}
+	return "on the blocklist"
+}
+
+// runBlockJob runs the job of an action: job rule in place of the
+// workflows.
+func runBlockJob(cfg *Config, rs *routeState, name, url, html string) error {
+	job, ok := cfg.Jobs[name]
+	if !ok {
+		return fmt.Errorf("job %s not found", name)
+	}
+	params := map[string]string{"tags": strings.Join(cfg.tagsFor(url), ",")}
+	return runJob(cfg, rs, name, job, params, url, html)
+}
+
+func (r BlockRule) validate(jobs map[string]Job) error {
+	if r.Match == "" && len(r.Domains) == 0 {
+		return fmt.Errorf("needs match or domains")
+	}
+	if r.Match != "" {
+		if _, err := regexp.Compile(r.Match); err != nil {
+			return fmt.Errorf("has invalid match regex '%s'", r.Match)
+		}
+	}
+	switch r.action() {
+	case blockDrop, blockWarn:
+		if r.Job != "" {
+			return fmt.Errorf("sets job but its action is %s", r.action())
+		}
+	case blockJob:
+		if _, ok := jobs[r.Job]; !ok {
+			return fmt.Errorf("references undefined job '%s'", r.Job)
+		}
+	default:
+		return fmt.Errorf("has invalid action '%s' (use drop, warn or job)", r.Action)
+	}
+	return nil
+}
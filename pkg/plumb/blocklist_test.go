@@ -0,0 +1,126 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBlocklist(t *testing.T) {
+	dir := t.TempDir()
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`
+version: "2"
+settings:
+  blocklist:
+    - domains: [malware.example]
+      reason: "known malware"
+    - match: "tracker\\.example/pixel"
+      action: warn
+    - domains: [casino.example]
+      action: job
+      job: quarantine
+jobs:
+  open:
+    steps:
+      - run: "touch `+filepath.Join(dir, "opened")+`"
+  quarantine:
+    steps:
+      - run: "touch `+filepath.Join(dir, "quarantined")+`"
+workflows:
+  main:
+    jobs:
+      - open
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		status  string
+		message string
+		ran     string
+	}{
+		{"drop", "https://cdn.malware.example/x", "error", "Blocked: known malware", ""},
+		{"drop after unwrapping", "https://www.google.com/url?q=https%3A%2F%2Fmalware.example%2F", "error", "Blocked: known malware", ""},
+		{"warn", "https://tracker.example/pixel?id=1", "success", "Warning: on the blocklist", "opened"},
+		{"job", "https://casino.example/", "success", "ran job quarantine", "quarantined"},
+		{"not blocked", "https://example.com/", "success", "Workflow executed", "opened"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(filepath.Join(dir, "opened"))
+			os.Remove(filepath.Join(dir, "quarantined"))
+
+			stdout := &bytes.Buffer{}
+			handleMessage(Envelope{URL: tt.url, Origin: "test"}, stdout, &cfg)
+
+			var n uint32
+			binary.Read(stdout, binary.LittleEndian, &n)
+			var resp Response
+			if err := json.Unmarshal(stdout.Next(int(n)), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.status || !strings.Contains(resp.Message, tt.message) {
+				t.Errorf("expected %s %q, got %s %q", tt.status, tt.message, resp.Status, resp.Message)
+			}
+			for _, job := range []string{"opened", "quarantined"} {
+				_, err := os.Stat(filepath.Join(dir, job))
+				if ran := err == nil; ran != (job == tt.ran) {
+					t.Errorf("%s: ran=%v", job, ran)
+				}
+			}
+		})
+	}
+}
+
+func TestBlocklistValidation(t *testing.T) {
+	jobs := map[string]Job{"quarantine": {}}
+	for _, rule := range []BlockRule{
+		{},
+		{Match: "(", Action: blockDrop},
+		{Domains: []string{"a.example"}, Action: "open"},
+		{Domains: []string{"a.example"}, Action: blockJob, Job: "missing"},
+		{Domains: []string{"a.example"}, Action: blockWarn, Job: "quarantine"},
+	} {
+		if err := rule.validate(jobs); err == nil {
+			t.Errorf("expected %+v to be rejected", rule)
+		}
+	}
+	if err := (BlockRule{Domains: []string{"a.example"}, Action: blockJob, Job: "quarantine"}).validate(jobs); err != nil {
+		t.Errorf("expected a valid rule, got %v", err)
+	}
+}
+
+func TestUnshortenStopsAtBlockedHop(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		http.Redirect(w, r, "/blocked", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{Settings: Settings{
+		Unshorten: UnshortenSettings{Enabled: true, Domains: []string{"127.0.0.1"}},
+		Blocklist: []BlockRule{{Match: "/blocked$"}},
+	}}
+	if got := cfg.unshortenURL(srv.URL + "/s"); got != srv.URL+"/blocked" {
+		t.Errorf("expected the blocked hop, got %q", got)
+	}
+	if len(requested) != 1 {
+		t.Errorf("expected the blocked hop not to be requested, got %v", requested)
+	}
+}
@@ -0,0 +1,377 @@
+package plumb
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// browserParams are the parameters of the built-in open step.
+var browserParams = []string{"browser", "flatpak", "snap", "profile", "container", "private", "window", "app_mode", "args", "host", "display", "workspace", "output", "cdp", "marionette"}
+
+// openJobParams are the open step parameters that default to the job's
+// parameter of the same name, so workflow job refs can set them.
+var openJobParams = []string{"profile", "container", "private", "window", "app_mode", "host"}
+
+// Browser families, recognised by name in the browser command, e.g.
+// "google-chrome" or "flatpak run org.mozilla.firefox".
+var (
+	firefoxBrowsers  = []string{"firefox", "librewolf", "waterfox", "floorp", "zen"}
+	chromiumBrowsers = []string{"chrome", "chromium", "brave", "edge", "vivaldi", "opera"}
+)
+
+// startGrace is how long a local browser is watched after it started: one
+// that exits with an error by then failed, and the next one is tried.
+const startGrace = 500 * time.Millisecond
+
+// executeOpen runs the built-in open step, which opens the URL in a
+// browser profile, a Firefox container, a private window or an app window:
+//
+//   - open:
+//     browser: "google-chrome"
+//     profile: "Profile 1"
+//     private: "true"
+//     window: new
+//
+// Instead of a browser command, flatpak or snap name a packaged browser.
+// Each may be a comma-separated fallback chain: browsers that are missing or
+// fail to start are skipped, browser commands first, then Flatpak apps, then
+// Snaps, and the one that opened the URL is returned. With cdp or
+// marionette the URL opens in a tab of a browser that is already running,
+// which also allows window: background; the browsers are only started when
+// it is not reachable. With host the browser is started on that machine
+// over SSH instead, and with workspace (and output) the window manager
+// switches there first. The openJobParams default to the job's parameters,
+// so workflow job refs can pick them. A local browser is started in the
+// background.
+func executeOpen(cfg *Config, rs *routeState, step Step, scopeParams map[string]string, url string, workspace string) (string, error) {
+	param := func(name string) string {
+		if _, ok := step.Params[name]; !ok && slices.Contains(openJobParams, name) {
+			return scopeParams[name]
+		}
+		return resolveParams(step.Params[name], scopeParams)
+	}
+
+	browsers := browserChain(param("browser"), param("flatpak"), param("snap"))
+	cdp, marionette := param("cdp"), param("marionette")
+	if len(browsers) == 0 && cdp == "" && marionette == "" {
+		return "", fmt.Errorf("open step needs a browser, flatpak, snap, cdp or marionette")
+	}
+	host, wsName, output := param("host"), param("workspace"), param("output")
+	if cdp != "" || marionette != "" {
+		if cdp != "" && marionette != "" {
+			return "", fmt.Errorf("open step cannot use both cdp and marionette")
+		}
+		for _, name := range []string{"profile", "container", "private", "app_mode", "host"} {
+			if v := param(name); v != "" && v != "false" {
+				return "", fmt.Errorf("open step cannot use %s with a running browser (cdp or marionette)", name)
+			}
+		}
+	}
+	if strings.HasPrefix(host, "-") {
+		return "", fmt.Errorf("open step has invalid host '%s'", host)
+	}
+	if host != "" && (wsName != "" || output != "") {
+		return "", fmt.Errorf("open step cannot choose the workspace on another host")
+	}
+	if wsName != "" || output != "" {
+		if err := placeWindow(cfg, rs, url, wsName, output); err != nil {
+			return "", err
+		}
+	}
+
+	var failures []string
+	if cdp != "" || marionette != "" {
+		name, err := openRemote(cdp, marionette, url, param("window"))
+		if err == nil || len(browsers) == 0 {
+			return name, err
+		}
+		log.Printf("   ⚠️ %v; starting the browser", err)
+		failures = append(failures, err.Error())
+	}
+
+	for _, b := range browsers {
+		err := launchBrowser(cfg, rs, b.command, url, param, workspace)
+		if err == nil {
+			return b.name, nil
+		}
+		if len(browsers) == 1 && len(failures) == 0 {
+			return "", err
+		}
+		log.Printf("   ⚠️ %v; trying the next browser", err)
+		failures = append(failures, err.Error())
+	}
+	return "", fmt.Errorf("no browser could open the URL: %s", strings.Join(failures, "; "))
+}
+
+// chainedBrowser is one browser of an open step's fallback chain.
+type chainedBrowser struct {
+	name    string // as written in the step
+	command string // what starts it
+}
+
+// browserChain returns the browsers to try in order: the comma-separated
+// browser commands, then the Flatpak apps run with "flatpak run", then the
+// Snaps run with "snap run".
+func browserChain(browser, flatpak, snap string) []chainedBrowser {
+	var chain []chainedBrowser
+	for _, list := range []struct{ names, prefix string }{{browser, ""}, {flatpak, "flatpak run "}, {snap, "snap run "}} {
+		for _, name := range strings.Split(list.names, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			command := name
+			if list.prefix != "" {
+				command = list.prefix + shellQuote(name)
+			}
+			chain = append(chain, chainedBrowser{name, command})
+		}
+	}
+	return chain
+}
+
+// launchBrowser opens url in browser with the flags the step's parameters
+// ask for. A local browser that is not installed, or exits with an error
+// within startGrace, is reported as failed.
+func launchBrowser(cfg *Config, rs *routeState, browser, url string, param func(string) string, workspace string) error {
+	pageURL := url // as the command log records it, before containerURL
+	profile, container, private := param("profile"), param("container"), param("private") == "true"
+	appMode := param("app_mode") == "true"
+	if appMode && !browserFamily(browser, chromiumBrowsers) {
+		return fmt.Errorf("open step cannot use app mode in %s (Chromium-based browsers only)", browser)
+	}
+	if container != "" {
+		if !isFirefox(browser) {
+			return fmt.Errorf("open step cannot use a container in %s (Firefox only)", browser)
+		}
+		if private {
+			return fmt.Errorf("open step cannot use a container in a private window")
+		}
+		url = containerURL(container, url)
+	}
+
+	args := []string{browser}
+	if profile != "" {
+		flags, err := profileArgs(browser, profile)
+		if err != nil {
+			return err
+		}
+		args = append(args, flags...)
+	}
+	if extra := param("args"); extra != "" {
+		args = append(args, extra)
+	}
+	window := param("window")
+	if window == "background" {
+		// Only a running browser can open a tab without the focus.
+		window = "tab"
+	}
+	if (private && isFirefox(browser)) || appMode {
+		// --private-window and --app take the URL as their argument and
+		// always open a new window.
+		window = ""
+	}
+	flags, err := windowArgs(browser, window)
+	if err != nil {
+		return err
+	}
+	args = append(args, flags...)
+	if private {
+		flag, err := privateFlag(browser)
+		if err != nil {
+			return err
+		}
+		args = append(args, flag)
+	}
+	if appMode {
+		args = append(args, shellQuote("--app="+url))
+	} else {
+		args = append(args, shellQuote(url))
+	}
+	script := strings.Join(args, " ")
+
+	host := param("host")
+	if host != "" {
+		script = sshScript(host, param("display"), script)
+	} else if _, err := exec.LookPath(strings.Fields(browser)[0]); err != nil {
+		return fmt.Errorf("%s is not installed", browser)
+	}
+
+	log.Printf("   🌐 Opening: %s", script)
+
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = os.Environ()
+	cmd.Dir = workspace
+	cmd.Stderr = os.Stderr
+	if host != "" {
+		// ssh returns once the remote browser is detached, so a host that
+		// is down is reported.
+		err := cmd.Run()
+		cfg.logCommand(rs, cmd, pageURL, err)
+		if err != nil {
+			return fmt.Errorf("open step failed on %s: %w", host, err)
+		}
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		cfg.logCommand(rs, cmd, pageURL, err)
+		return fmt.Errorf("%s failed to start: %w", browser, err)
+	}
+	cfg.logCommand(rs, cmd, pageURL, nil)
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s failed to start: %w", browser, err)
+		}
+	case <-time.After(startGrace):
+	}
+	return nil
+}
+
+// placeWindow focuses workspace, on output, so that the browser window
+// opened next lands there and has the focus: with swaymsg or i3-msg under
+// sway or i3, else with wmctrl on X11, where output is not supported and
+// workspace is a desktop number.
+func placeWindow(cfg *Config, rs *routeState, url, workspace, output string) error {
+	var args []string
+	switch {
+	case os.Getenv("SWAYSOCK") != "" || os.Getenv("I3SOCK") != "" || strings.EqualFold(os.Getenv("XDG_CURRENT_DESKTOP"), "i3"):
+		msg := "i3-msg"
+		if os.Getenv("SWAYSOCK") != "" {
+			msg = "swaymsg"
+		}
+		var commands []string
+		if output != "" {
+			commands = append(commands, "focus output "+wmQuote(output))
+		}
+		if workspace != "" {
+			commands = append(commands, "workspace --no-auto-back-and-forth "+wmQuote(workspace))
+		}
+		args = []string{msg, strings.Join(commands, "; ")}
+	case os.Getenv("DISPLAY") != "":
+		if output != "" {
+			return fmt.Errorf("open step can only choose the output under sway or i3")
+		}
+		if _, err := strconv.Atoi(workspace); err != nil {
+			return fmt.Errorf("open step needs a desktop number as workspace for wmctrl, got '%s'", workspace)
+		}
+		args = []string{"wmctrl", "-s", workspace}
+	default:
+		return fmt.Errorf("open step cannot choose the workspace: no sway, i3 or X11 session")
+	}
+
+	log.Printf("   🪟 Placing: %s", strings.Join(args, " "))
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	cfg.logCommand(rs, cmd, url, err)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", args[0], err)
+	}
+	return nil
+}
+
+// wmQuote quotes a workspace or output name for an i3/sway command.
+func wmQuote(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
+
+// sshScript wraps the command that opens the browser so it runs on host.
+// An SSH session has no display, so the remote command uses display
+// (default :0) and the default Wayland socket of the user's session when
+// there is one, and detaches the browser from the session.
+func sshScript(host, display, command string) string {
+	if display == "" {
+		display = ":0"
+	}
+	remote := "export DISPLAY=" + shellQuote(display) + ` XDG_RUNTIME_DIR="${XDG_RUNTIME_DIR:-/run/user/$(id -u)}"; ` +
+		`[ -n "$WAYLAND_DISPLAY" ] || [ ! -S "$XDG_RUNTIME_DIR/wayland-0" ] || export WAYLAND_DISPLAY=wayland-0; ` +
+		"nohup " + command + " </dev/null >/dev/null 2>&1 &"
+	return "ssh -o BatchMode=yes -o ConnectTimeout=10 " + shellQuote(host) + " " + shellQuote(remote)
+}
+
+// profileArgs returns the shell-quoted flags that select profile in
+// browser: -P <name> for Firefox, or --profile <dir> when profile is a
+// path, and --profile-directory=<dir> for Chromium-based browsers.
+func profileArgs(browser, profile string) ([]string, error) {
+	switch {
+	case isFirefox(browser):
+		if strings.Contains(profile, "/") {
+			return []string{"--profile", shellQuote(expandHome(profile))}, nil
+		}
+		return []string{"-P", shellQuote(profile)}, nil
+	case browserFamily(browser, chromiumBrowsers):
+		return []string{shellQuote("--profile-directory=" + profile)}, nil
+	}
+	return nil, fmt.Errorf("open step cannot select a profile for %s (use args)", browser)
+}
+
+// privateFlag returns the flag that opens a private window in browser.
+func privateFlag(browser string) (string, error) {
+	switch {
+	case browserFamily(browser, []string{"edge"}):
+		return "--inprivate", nil
+	case browserFamily(browser, chromiumBrowsers):
+		return "--incognito", nil
+	case isFirefox(browser):
+		return "--private-window", nil
+	}
+	return "", fmt.Errorf("open step cannot open a private window in %s (use args)", browser)
+}
+
+// windowArgs returns the flags that place the URL as window asks: "new" for
+// a new window, "tab" for a new tab in the last window, and "current" or ""
+// to leave it to the browser's own setting.
+func windowArgs(browser, window string) ([]string, error) {
+	switch window {
+	case "", "current":
+		return nil, nil
+	case "new":
+		if isFirefox(browser) || browserFamily(browser, chromiumBrowsers) {
+			return []string{"--new-window"}, nil
+		}
+	case "tab":
+		if isFirefox(browser) {
+			return []string{"--new-tab"}, nil
+		}
+		// Chromium-based browsers open a tab unless told otherwise.
+		if browserFamily(browser, chromiumBrowsers) {
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("open step has invalid window '%s' (use new, tab or current)", window)
+	}
+	return nil, fmt.Errorf("open step cannot choose the window in %s (use args)", browser)
+}
+
+// containerURL wraps rawURL in the ext+container: scheme of the "Open
+// external links in a container" extension, which opens it in the named
+// Multi-Account Container (created if missing).
+func containerURL(container, rawURL string) string {
+	q := url.Values{"name": {container}, "url": {rawURL}}
+	return "ext+container:" + q.Encode()
+}
+
+// isFirefox reports whether browser is Firefox or one of its forks.
+func isFirefox(browser string) bool {
+	return browserFamily(browser, firefoxBrowsers)
+}
+
+// browserFamily reports whether the browser command names one of names.
+func browserFamily(browser string, names []string) bool {
+	fields := strings.Fields(browser)
+	if len(fields) == 0 {
+		return false
+	}
+	name := strings.ToLower(filepath.Base(fields[len(fields)-1]))
+	return slices.ContainsFunc(names, func(n string) bool { return strings.Contains(name, n) })
+}
@@ -0,0 +1,323 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestProfileArgs(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	tests := []struct {
+		browser string
+		profile string
+		want    string
+	}{
+		{"firefox", "work", "-P 'work'"},
+		{"/usr/bin/librewolf", "~/profiles/work", "--profile '" + home + "/profiles/work'"},
+		{"flatpak run io.github.zen_browser.zen", "Personal", "-P 'Personal'"},
+		{"google-chrome-stable", "Profile 1", "'--profile-directory=Profile 1'"},
+		{"flatpak run com.brave.Browser", "Default", "'--profile-directory=Default'"},
+	}
+	for _, tt := range tests {
+		got, err := profileArgs(tt.browser, tt.profile)
+		if err != nil || strings.Join(got, " ") != tt.want {
+			t.Errorf("profileArgs(%q, %q) = %q, %v; want %q", tt.browser, tt.profile, got, err, tt.want)
+		}
+	}
+	if _, err := profileArgs("epiphany", "work"); err == nil {
+		t.Error("expected an unknown browser to be rejected")
+	}
+}
+
+func TestBrowserChain(t *testing.T) {
+	chain := browserChain("brave-browser, google-chrome", "org.mozilla.firefox", "chromium")
+	var got []string
+	for _, b := range chain {
+		got = append(got, b.name+"="+b.command)
+	}
+	want := "brave-browser=brave-browser|google-chrome=google-chrome|org.mozilla.firefox=flatpak run 'org.mozilla.firefox'|chromium=snap run 'chromium'"
+	if strings.Join(got, "|") != want {
+		t.Errorf("expected %s, got %s", want, strings.Join(got, "|"))
+	}
+	if len(browserChain(" , ", "", "")) != 0 {
+		t.Error("expected an empty chain")
+	}
+
+	// Packaged browsers are recognised by their app ID.
+	if flags, err := profileArgs(chain[2].command, "work"); err != nil || strings.Join(flags, " ") != "-P 'work'" {
+		t.Errorf("expected a Firefox profile flag for the Flatpak, got %q, %v", flags, err)
+	}
+}
+
+func TestPrivateFlag(t *testing.T) {
+	for browser, want := range map[string]string{
+		"chromium":                      "--incognito",
+		"flatpak run com.brave.Browser": "--incognito",
+		"microsoft-edge-stable":         "--inprivate",
+		"librewolf":                     "--private-window",
+	} {
+		if got, err := privateFlag(browser); err != nil || got != want {
+			t.Errorf("privateFlag(%q) = %q, %v; want %q", browser, got, err, want)
+		}
+	}
+	if _, err := privateFlag("epiphany"); err == nil {
+		t.Error("expected an unknown browser to be rejected")
+	}
+
+	var ref WorkflowJob
+	if err := yaml.Unmarshal([]byte("sketchy:\n  private: true\n"), &ref); err != nil || ref.Params["private"] != "true" {
+		t.Errorf("expected private: true as a job ref parameter, got %v (%v)", ref.Params, err)
+	}
+}
+
+func TestWindowArgs(t *testing.T) {
+	tests := []struct {
+		browser string
+		window  string
+		want    string
+	}{
+		{"firefox", "new", "--new-window"},
+		{"firefox", "tab", "--new-tab"},
+		{"firefox", "current", ""},
+		{"google-chrome", "new", "--new-window"},
+		{"google-chrome", "tab", ""},
+		{"vivaldi", "", ""},
+	}
+	for _, tt := range tests {
+		got, err := windowArgs(tt.browser, tt.window)
+		if err != nil || strings.Join(got, " ") != tt.want {
+			t.Errorf("windowArgs(%q, %q) = %q, %v; want %q", tt.browser, tt.window, got, err, tt.want)
+		}
+	}
+	if _, err := windowArgs("firefox", "popup"); err == nil {
+		t.Error("expected an invalid window to be rejected")
+	}
+	if _, err := windowArgs("epiphany", "new"); err == nil {
+		t.Error("expected an unknown browser to be rejected")
+	}
+}
+
+func TestExecuteOpen(t *testing.T) {
+	bin := t.TempDir()
+	argsFile := filepath.Join(bin, "args")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + ".tmp && mv " + argsFile + ".tmp " + argsFile + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "firefox"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The job ref picks the profile.
+	scope := map[string]string{"profile": "work"}
+	step := Step{Name: "open", Params: map[string]string{"browser": "firefox", "args": "--new-window"}}
+	if _, err := executeOpen(&Config{}, &routeState{}, step, scope, "https://example.com/?a=1&b=2", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "-P\nwork\n--new-window\nhttps://example.com/?a=1&b=2\n"
+	if data := waitForFile(argsFile); string(data) != want {
+		t.Errorf("expected firefox arguments %q, got %q", want, data)
+	}
+
+	os.Remove(argsFile)
+	scope = map[string]string{"container": "My Work"}
+	step = Step{Name: "open", Params: map[string]string{"browser": "firefox"}}
+	if _, err := executeOpen(&Config{}, &routeState{}, step, scope, "https://example.com/?a=1&b=2", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	want = "ext+container:name=My+Work&url=https%3A%2F%2Fexample.com%2F%3Fa%3D1%26b%3D2\n"
+	if data := waitForFile(argsFile); string(data) != want {
+		t.Errorf("expected the URL wrapped for the container, got %q", data)
+	}
+
+	step.Params["browser"] = "google-chrome"
+	if _, err := executeOpen(&Config{}, &routeState{}, step, scope, "https://example.com", t.TempDir()); err == nil {
+		t.Error("expected a container outside Firefox to fail")
+	}
+	scope["private"] = "true"
+	step.Params["browser"] = "firefox"
+	if _, err := executeOpen(&Config{}, &routeState{}, step, scope, "https://example.com", t.TempDir()); err == nil {
+		t.Error("expected a container in a private window to fail")
+	}
+
+	os.Remove(argsFile)
+	scope = map[string]string{"private": "true", "window": "new"}
+	if _, err := executeOpen(&Config{}, &routeState{}, step, scope, "https://example.com/", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	want = "--private-window\nhttps://example.com/\n"
+	if data := waitForFile(argsFile); string(data) != want {
+		t.Errorf("expected a private window, got %q", data)
+	}
+	if _, err := executeOpen(&Config{}, &routeState{}, Step{Name: "open"}, scope, "https://example.com", t.TempDir()); err == nil {
+		t.Error("expected an open step without a browser to fail")
+	}
+}
+
+// waitForFile returns the content of a file written by a background process,
+// or nil when it does not show up within two seconds.
+func waitForFile(path string) []byte {
+	for range 100 {
+		if data, err := os.ReadFile(path); err == nil {
+			return data
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestExecuteOpenSSH(t *testing.T) {
+	bin := t.TempDir()
+	out := filepath.Join(bin, "out")
+	// The fake ssh records its arguments and runs the remote command
+	// locally; the fake firefox records its arguments and display.
+	ssh := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + out + ".ssh\neval \"remote=\\${$#}\"\nexec sh -c \"$remote\"\n"
+	firefox := "#!/bin/sh\nprintf '%s\\n' \"$DISPLAY\" \"$@\" > " + out + ".tmp && mv " + out + ".tmp " + out + "\n"
+	os.WriteFile(filepath.Join(bin, "ssh"), []byte(ssh), 0755)
+	os.WriteFile(filepath.Join(bin, "firefox"), []byte(firefox), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	scope := map[string]string{"host": "me@desktop"}
+	step := Step{Name: "open", Params: map[string]string{"browser": "firefox", "window": "new"}}
+	if _, err := executeOpen(&Config{}, &routeState{}, step, scope, "https://example.com/it's", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	want := ":0\n--new-window\nhttps://example.com/it's\n"
+	if data := waitForFile(out); string(data) != want {
+		t.Errorf("expected the remote firefox to get %q, got %q", want, data)
+	}
+	if data, _ := os.ReadFile(out + ".ssh"); !strings.Contains(string(data), "BatchMode=yes\n-o\nConnectTimeout=10\nme@desktop\n") {
+		t.Errorf("unexpected ssh arguments:\n%s", data)
+	}
+
+	scope["host"] = "-oProxyCommand=evil"
+	if _, err := executeOpen(&Config{}, &routeState{}, step, scope, "https://example.com", t.TempDir()); err == nil {
+		t.Error("expected a host that looks like an ssh option to be rejected")
+	}
+}
+
+func TestPlaceWindow(t *testing.T) {
+	bin := t.TempDir()
+	out := filepath.Join(bin, "out")
+	record := "#!/bin/sh\nprintf '%s\\n' \"$(basename \"$0\")\" \"$@\" > " + out + "\n"
+	for _, name := range []string{"swaymsg", "i3-msg", "wmctrl"} {
+		os.WriteFile(filepath.Join(bin, name), []byte(record), 0755)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("I3SOCK", "")
+	t.Setenv("XDG_CURRENT_DESKTOP", "")
+	t.Setenv("DISPLAY", ":0")
+
+	t.Setenv("SWAYSOCK", "/run/user/1000/sway.sock")
+	if err := placeWindow(&Config{}, &routeState{}, "https://example.com/", `9: "media"`, "HDMI-A-1"); err != nil {
+		t.Fatal(err)
+	}
+	want := "swaymsg\nfocus output \"HDMI-A-1\"; workspace --no-auto-back-and-forth \"9: \\\"media\\\"\"\n"
+	if data, _ := os.ReadFile(out); string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+
+	t.Setenv("SWAYSOCK", "")
+	t.Setenv("XDG_CURRENT_DESKTOP", "i3")
+	if err := placeWindow(&Config{}, &routeState{}, "https://example.com/", "2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "i3-msg\nworkspace --no-auto-back-and-forth \"2\"\n" {
+		t.Errorf("unexpected i3-msg call %q", data)
+	}
+
+	t.Setenv("XDG_CURRENT_DESKTOP", "GNOME")
+	if err := placeWindow(&Config{}, &routeState{}, "https://example.com/", "2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "wmctrl\n-s\n2\n" {
+		t.Errorf("unexpected wmctrl call %q", data)
+	}
+	if err := placeWindow(&Config{}, &routeState{}, "https://example.com/", "media", ""); err == nil {
+		t.Error("expected wmctrl to need a desktop number")
+	}
+	if err := placeWindow(&Config{}, &routeState{}, "https://example.com/", "2", "HDMI-A-1"); err == nil {
+		t.Error("expected wmctrl to reject an output")
+	}
+
+	t.Setenv("DISPLAY", "")
+	if err := placeWindow(&Config{}, &routeState{}, "https://example.com/", "2", ""); err == nil {
+		t.Error("expected an error without a window manager")
+	}
+}
+
+func TestOpenFallback(t *testing.T) {
+	bin := t.TempDir()
+	out := filepath.Join(bin, "out")
+	os.WriteFile(filepath.Join(bin, "zen-browser"), []byte("#!/bin/sh\nexit 1\n"), 0755)
+	os.WriteFile(filepath.Join(bin, "firefox"), []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > "+out+"\n"), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cfg := &Config{Jobs: map[string]Job{"browse": {Steps: []Step{{Name: "open", Params: map[string]string{
+		"browser": "no-such-browser, zen-browser, firefox",
+	}}}}}, Workflows: map[string]Workflow{"main": {Jobs: []WorkflowJob{{Name: "browse"}}}}}
+
+	stdout := &bytes.Buffer{}
+	handleMessage(Envelope{URL: "https://example.com/", Origin: "test"}, stdout, cfg)
+	var n uint32
+	binary.Read(stdout, binary.LittleEndian, &n)
+	var resp Response
+	json.Unmarshal(stdout.Next(int(n)), &resp)
+	if resp.Status != "success" || !strings.Contains(resp.Message, "(opened in firefox)") {
+		t.Errorf("expected firefox to be reported, got %s %q", resp.Status, resp.Message)
+	}
+	if data := waitForFile(out); string(data) != "https://example.com/\n" {
+		t.Errorf("expected firefox to open the URL, got %q", data)
+	}
+
+	step := Step{Name: "open", Params: map[string]string{"browser": "no-such-browser, zen-browser"}}
+	if _, err := executeOpen(&Config{}, &routeState{}, step, map[string]string{}, "https://example.com/", t.TempDir()); err == nil ||
+		!strings.Contains(err.Error(), "no-such-browser is not installed") || !strings.Contains(err.Error(), "zen-browser failed to start") {
+		t.Errorf("expected both failures reported, got %v", err)
+	}
+}
+
+func TestExecuteOpenAppMode(t *testing.T) {
+	bin := t.TempDir()
+	argsFile := filepath.Join(bin, "args")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + ".tmp && mv " + argsFile + ".tmp " + argsFile + "\n"
+	for _, name := range []string{"chromium", "firefox"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The job ref asks for an app window; window does not apply to it.
+	scope := map[string]string{"app_mode": "true", "window": "tab", "profile": "Work"}
+	step := Step{Name: "open", Params: map[string]string{"browser": "chromium"}}
+	if _, err := executeOpen(&Config{}, &routeState{}, step, scope, "https://calendar.example.com/?view=week", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	want := "--profile-directory=Work\n--app=https://calendar.example.com/?view=week\n"
+	if data := waitForFile(argsFile); string(data) != want {
+		t.Errorf("expected chromium arguments %q, got %q", want, data)
+	}
+
+	step.Params["browser"] = "firefox"
+	if _, err := executeOpen(&Config{}, &routeState{}, step, map[string]string{"app_mode": "true"}, "https://example.com/", t.TempDir()); err == nil || !strings.Contains(err.Error(), "app mode") {
+		t.Errorf("expected app mode in Firefox to fail, got %v", err)
+	}
+
+	// In a fallback chain, browsers without app mode are skipped.
+	os.Remove(argsFile)
+	step.Params["browser"] = "firefox, chromium"
+	if name, err := executeOpen(&Config{}, &routeState{}, step, map[string]string{"app_mode": "true"}, "https://example.com/", t.TempDir()); err != nil || name != "chromium" {
+		t.Fatalf("expected chromium to open the app window, got %q, %v", name, err)
+	}
+	if data := waitForFile(argsFile); string(data) != "--app=https://example.com/\n" {
+		t.Errorf("expected an app window, got %q", data)
+	}
+}
@@ -0,0 +1,61 @@
+package plumb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClearURLsBundled(t *testing.T) {
+	cfg := &Config{Version: "2", Settings: Settings{Cleaning: CleaningSettings{ClearURLs: ClearURLsSettings{Bundled: true}}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://www.youtube.com/watch?v=abc&si=xyz", "https://www.youtube.com/watch?v=abc"},
+		{"https://www.amazon.com/dp/B0123/ref=sr_1_1?crid=1&keywords=go&qid=2", "https://www.amazon.com/dp/B0123"},
+		{"https://example.com/post?mc_eid=1&msclkid=2&page=3", "https://example.com/post?page=3"},
+		{"https://www.google.com/url?sa=t&url=https%3A%2F%2Fgo.dev%2Fdoc%3Futm_source%3Dgoogle&usg=x", "https://go.dev/doc"},
+		{"https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2F%3Ffbclid%3D1&h=AT0", "https://example.com/"},
+		{"https://out.reddit.com/t3_abc?url=https%3A%2F%2Fexample.com%2Fa&token=x", "https://example.com/a"},
+		{"https://accounts.google.com/o/oauth2/auth?ved=1", "https://accounts.google.com/o/oauth2/auth?ved=1"},
+		{"https://example.com/?b=2&a=1", "https://example.com/?b=2&a=1"},
+	}
+	for _, tt := range tests {
+		if actual := cfg.cleanURL(tt.input); actual != tt.expected {
+			t.Errorf("cleanURL(%q) = %q, want %q", tt.input, actual, tt.expected)
+		}
+	}
+}
+
+func TestClearURLsFile(t *testing.T) {
+	rules := []byte(`{"providers": {"news": {
+		"urlPattern": "^https?:\\/\\/(?:[a-z0-9-]+\\.)*?news\\.example",
+		"rules": ["share_[a-z]+"],
+		"rawRules": ["\\/amp(?=\\/)"],
+		"redirections": ["^https?:\\/\\/news\\.example\\/out\\?to=([^&]*)"]
+	}}}`)
+	path := filepath.Join(t.TempDir(), "data.min.json")
+	os.WriteFile(path, rules, 0644)
+
+	cfg := &Config{Settings: Settings{Cleaning: CleaningSettings{
+		Params:    []string{},
+		ClearURLs: ClearURLsSettings{Files: []string{path}},
+	}}}
+	if got := cfg.cleanURL("https://news.example/story?share_id=1&id=7"); got != "https://news.example/story?id=7" {
+		t.Errorf("expected the file's rules applied, got %q", got)
+	}
+	if got := cfg.cleanURL("https://news.example/out?to=https%3A%2F%2Fnews.example%2Fs%3Fshare_src%3Dx"); got != "https://news.example/s" {
+		t.Errorf("expected the redirect unwrapped and cleaned, got %q", got)
+	}
+
+	cfg = &Config{Version: "2", Settings: Settings{Cleaning: CleaningSettings{ClearURLs: ClearURLsSettings{Files: []string{filepath.Join(t.TempDir(), "missing.json")}}}}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "clearurls") {
+		t.Errorf("expected an error for a missing rule file, got %v", err)
+	}
+}
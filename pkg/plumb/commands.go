@@ -0,0 +1,129 @@
+package plumb
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"browser-pipes/internal/cmdlog"
+)
+
+// CommandLogSettings control the command log (see internal/cmdlog), which
+// records every external command plumber runs for a URL: run and ytdlp
+// steps, browsers the open steps start, window placement and notifications.
+type CommandLogSettings struct {
+	Enabled bool   `yaml:"enabled" json:"enabled,omitempty" jsonschema:"description=Append every command plumber runs with its arguments and working directory and exit code and the URL and origin that triggered it"`
+	Path    string `yaml:"path" json:"path,omitempty" jsonschema:"description=Command log (default: commands.jsonl next to the history file)"`
+	Chain   bool   `yaml:"chain" json:"chain,omitempty" jsonschema:"description=Chain the entries by SHA-256 so that plumber commands --verify detects edited or deleted lines"`
+}
+
+// commandLogPath returns the command log to append to, or "" when it is
+// disabled.
+func (c *Config) commandLogPath() string {
+	if !c.Settings.CommandLog.Enabled {
+		return ""
+	}
+	if c.Settings.CommandLog.Path != "" {
+		return expandHome(c.Settings.CommandLog.Path)
+	}
+	return filepath.Join(c.dataDir(), "commands.jsonl")
+}
+
+// logCommand appends cmd, run for url, to the command log. err is what
+// running (or starting) it returned; a command that was only started is
+// logged without an exit code. A log that cannot be written only costs a
+// warning.
+func (c *Config) logCommand(rs *routeState, cmd *exec.Cmd, url string, err error) {
+	path := c.commandLogPath()
+	if path == "" {
+		return
+	}
+	e := cmdlog.Entry{Argv: cmd.Args, Dir: cmd.Dir, URL: url, Origin: rs.origin, Job: rs.job}
+	if e.Dir == "" {
+		e.Dir, _ = os.Getwd()
+	}
+	if cmd.ProcessState != nil {
+		code := cmd.ProcessState.ExitCode()
+		e.ExitCode = &code
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := cmdlog.Append(path, e, c.Settings.CommandLog.Chain); err != nil {
+		log.Printf("   ⚠️ Failed to log command: %v", err)
+	}
+}
+
+// runCommands implements "plumber commands": it lists the most recent
+// entries of the command log, or verifies its chain.
+func runCommands(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("commands", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "Command log (default: settings.command_log.path or commands.jsonl next to the history file)")
+	limit := fs.Int("limit", 20, "Maximum number of entries to show (0 for all)")
+	verify := fs.Bool("verify", false, "Check the hash chain of the log instead of listing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path := *file
+	if path == "" {
+		if path = cfg.commandLogPath(); path == "" {
+			path = filepath.Join(cfg.dataDir(), "commands.jsonl")
+		}
+	}
+
+	if *verify {
+		n, err := cmdlog.Verify(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w after %d intact entries", path, err, n)
+		}
+		if n == 0 {
+			log.Printf("📭 No chained entries in %s", path)
+			return nil
+		}
+		log.Printf("🔗 The chain of %d entries in %s is intact", n, path)
+		return nil
+	}
+
+	entries, err := cmdlog.Read(path)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		log.Printf("📭 No commands in %s", path)
+		return nil
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tEXIT\tORIGIN\tJOB\tURL\tCOMMAND")
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		exit := "-"
+		if e.ExitCode != nil {
+			exit = strconv.Itoa(*e.ExitCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), exit, dash(e.Origin), dash(e.Job), dash(e.URL), commandLine(e.Argv))
+	}
+	return tw.Flush()
+}
+
+// commandLine renders argv on one line: the script of sh -c, else the
+// arguments joined by spaces.
+func commandLine(argv []string) string {
+	if len(argv) >= 3 && argv[0] == "sh" && argv[1] == "-c" {
+		argv = argv[2:]
+	}
+	return strings.Join(strings.Fields(strings.Join(argv, " ")), " ")
+}
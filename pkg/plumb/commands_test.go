@@ -0,0 +1,185 @@
+package plumb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/cmdlog"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCommandLog(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "commands.jsonl")
+	configPath := filepath.Join(dir, "plumber.yaml")
+	os.WriteFile(configPath, []byte(`
+version: "2"
+settings:
+  history:
+    path: "`+filepath.Join(dir, "history.db")+`"
+  command_log:
+    enabled: true
+    chain: true
+jobs:
+  save:
+    steps:
+      - run: "test -n '<< parameters.url >>'"
+      - run:
+          command: "sleep 0"
+          background: true
+  broken:
+    steps:
+      - run: "exit 3"
+workflows:
+  main:
+    jobs:
+      - save:
+          match: "/ok"
+      - broken:
+          match: "/broken"
+`), 0644)
+
+	var stdin bytes.Buffer
+	for _, url := range []string{"https://example.com/ok", "https://example.com/broken"} {
+		stdin.Write(envelopeFrame(Envelope{ID: "1", Origin: "chrome", URL: url}))
+	}
+	if err := Run([]string{"-config", configPath, "run"}, &stdin, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := cmdlog.Read(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 commands, got %+v", entries)
+	}
+	want := []struct {
+		command, url, job string
+		exit              int // -1 for none
+	}{
+		{"test -n 'https://example.com/ok'", "https://example.com/ok", "save", 0},
+		{"sleep 0", "https://example.com/ok", "save", -1},
+		{"exit 3", "https://example.com/broken", "broken", 3},
+	}
+	for i, w := range want {
+		e := entries[i]
+		if strings.Join(e.Argv, " ") != "sh -c "+w.command || e.URL != w.url || e.Job != w.job || e.Origin != "chrome" {
+			t.Errorf("entry %d: expected %s for %s in job %s from chrome, got %+v", i, w.command, w.url, w.job, e)
+		}
+		if !strings.Contains(e.Dir, "plumber-job-") {
+			t.Errorf("entry %d: expected the job workspace as cwd, got %q", i, e.Dir)
+		}
+		if (w.exit < 0) != (e.ExitCode == nil) || (e.ExitCode != nil && *e.ExitCode != w.exit) {
+			t.Errorf("entry %d: expected exit code %d, got %v", i, w.exit, e.ExitCode)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := Run([]string{"-config", configPath, "commands", "--limit", "2"}, nil, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "exit 3") || !strings.Contains(lines[2], "sleep 0") {
+		t.Errorf("expected the 2 most recent commands, newest first, got:\n%s", stdout.String())
+	}
+
+	stderr.Reset()
+	if err := Run([]string{"-config", configPath, "commands", "--verify"}, nil, io.Discard, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr.String(), "chain of 3 entries") {
+		t.Errorf("expected an intact chain, got %q", stderr.String())
+	}
+
+	data, _ := os.ReadFile(logPath)
+	os.WriteFile(logPath, bytes.Replace(data, []byte(`"exit_code":3`), []byte(`"exit_code":0`), 1), 0600)
+	if err := Run([]string{"-config", configPath, "commands", "--verify"}, nil, io.Discard, io.Discard); err == nil || !strings.Contains(err.Error(), "line 3 was modified") {
+		t.Errorf("expected the edit to be detected, got %v", err)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		argv []string
+		want string
+	}{
+		{[]string{"sh", "-c", "echo  'a b'\n"}, "echo 'a b'"},
+		{[]string{"wmctrl", "-s", "2"}, "wmctrl -s 2"},
+		{[]string{"sh"}, "sh"},
+	}
+	for _, tt := range tests {
+		if got := commandLine(tt.argv); got != tt.want {
+			t.Errorf("commandLine(%q) = %q, want %q", tt.argv, got, tt.want)
+		}
+	}
+}
+
+func TestCommandLog_ConcurrentRoutes(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "commands.jsonl")
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(`
+version: "2"
+settings:
+  command_log:
+    enabled: true
+    path: "`+logPath+`"
+jobs:
+  slow:
+    steps:
+      - run: "sleep 0.2"
+  fast:
+    steps:
+      - run: "true"
+workflows:
+  main:
+    jobs:
+      - slow:
+          match: "/slow"
+      - fast:
+          match: "/fast"
+`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	// As Engine.Load does, so the routes share the compiled rules.
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The route state is not on the Config, so each route logs its own
+	// origin and job while the other runs.
+	var wg sync.WaitGroup
+	for _, origin := range []string{"slow", "fast"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := route(context.Background(), &cfg, Envelope{Origin: origin, URL: "https://example.com/" + origin}); err != nil {
+				t.Error(err)
+			}
+		}()
+		time.Sleep(50 * time.Millisecond)
+	}
+	wg.Wait()
+
+	entries, err := cmdlog.Read(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 commands, got %+v", entries)
+	}
+	for _, e := range entries {
+		if e.Origin != e.Job || e.URL != "https://example.com/"+e.Job {
+			t.Errorf("expected the origin and job of the route of %s, got %+v", e.URL, e)
+		}
+	}
+}
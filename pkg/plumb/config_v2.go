@@ -0,0 +1,915 @@
+package plumb
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"browser-pipes/internal/history"
+	"browser-pipes/internal/proxy"
+	"browser-pipes/internal/urlclean"
+	"browser-pipes/pkg/readmd"
+	"github.com/andybalholm/cascadia"
+	"github.com/invopop/jsonschema"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config represents the new CircleCI-inspired configuration (V2).
+type Config struct {
+	Version   string              `yaml:"version" json:"version" jsonschema:"enum=2,description=Configuration version must be '2'"`
+	Commands  map[string]Command  `yaml:"commands" json:"commands" jsonschema:"description=Reusable command definitions"`
+	Jobs      map[string]Job      `yaml:"jobs" json:"jobs" jsonschema:"description=Job definitions"`
+	Workflows map[string]Workflow `yaml:"workflows" json:"workflows" jsonschema:"description=Workflow definitions mapping jobs to URL patterns"`
+	Settings  Settings            `yaml:"settings" json:"settings,omitempty" jsonschema:"description=Global plumber settings"`
+
+	clearURLs []urlclean.Provider   // compiled settings.cleaning.clearurls, see clearURLProviders
+	steps     map[string]customStep // steps registered with Engine.Register
+	path      string                // file the config was loaded from
+	plumber   string                // the plumber binary, which Run sets for notifications to rerun jobs with
+}
+
+// clearURLProviders returns the compiled ClearURLs rules, loading them on
+// first use. Validate loads them, so an Engine's routes and CleanURL only
+// read them.
+func (c *Config) clearURLProviders() ([]urlclean.Provider, error) {
+	if c.clearURLs == nil {
+		providers, err := c.Settings.Cleaning.ClearURLs.Load()
+		if err != nil {
+			return nil, err
+		}
+		c.clearURLs = append([]urlclean.Provider{}, providers...) // non-nil even without rules
+	}
+	return c.clearURLs, nil
+}
+
+// Settings holds global behaviour that is not tied to a single job.
+type Settings struct {
+	History    HistorySettings    `yaml:"history" json:"history,omitempty" jsonschema:"description=History of routed URLs and snapshots"`
+	Snapshot   SnapshotSettings   `yaml:"snapshot" json:"snapshot,omitempty" jsonschema:"description=Defaults exposed to snapshot steps as << parameters.snapshot_* >>"`
+	Feed       FeedSettings       `yaml:"feed" json:"feed,omitempty" jsonschema:"description=Atom feed of the snapshots in the history log"`
+	Tagging    []TagRule          `yaml:"tagging" json:"tagging,omitempty" jsonschema:"description=Rules that tag URLs matching a regex; exposed to steps as << parameters.tags >>"`
+	SiteRules  []SiteRule         `yaml:"site_rules" json:"site_rules,omitempty" jsonschema:"description=CSS selectors for sites where readability fails; exposed to steps as << parameters.site_rule >>"`
+	Watch      WatchSettings      `yaml:"watch" json:"watch,omitempty" jsonschema:"description=Page-change monitoring with plumber watch"`
+	Retention  RetentionSettings  `yaml:"retention" json:"retention,omitempty" jsonschema:"description=Which snapshots plumber prune deletes or archives"`
+	Cleaning   CleaningSettings   `yaml:"cleaning" json:"cleaning,omitempty" jsonschema:"description=Query parameters stripped from URLs before they are routed"`
+	Normalize  NormalizeSettings  `yaml:"normalize" json:"normalize,omitempty" jsonschema:"description=Rewrite equivalent spellings of a URL to one form before matching and hashing"`
+	Frontends  FrontendSettings   `yaml:"frontends" json:"frontends,omitempty" jsonschema:"description=Privacy frontends (Invidious and Nitter...) for YouTube and Twitter/X and Reddit and Medium URLs"`
+	AMP        AMPSettings        `yaml:"amp" json:"amp,omitempty" jsonschema:"description=Route and snapshot the canonical article instead of its AMP copy"`
+	Unshorten  UnshortenSettings  `yaml:"unshorten" json:"unshorten,omitempty" jsonschema:"description=Resolve short links (t.co and bit.ly...) before URLs are cleaned and routed"`
+	Files      FileSettings       `yaml:"files" json:"files,omitempty" jsonschema:"description=Local files that may be plumbed as file:// URLs"`
+	Blocklist  []BlockRule        `yaml:"blocklist" json:"blocklist,omitempty" jsonschema:"description=URLs that are never routed as they are; the first matching rule decides"`
+	Tracing    TracingSettings    `yaml:"tracing" json:"tracing,omitempty" jsonschema:"description=OpenTelemetry spans of every route sent to an OTLP collector"`
+	Notify     NotifySettings     `yaml:"notify" json:"notify,omitempty" jsonschema:"description=Desktop notifications when a job fails"`
+	CommandLog CommandLogSettings `yaml:"command_log" json:"command_log,omitempty" jsonschema:"description=Append-only log of the commands plumber runs for URLs"`
+}
+
+// FileSettings allow file:// URLs. They are refused unless the file lies in
+// one of the Allow directories, symlinks resolved.
+type FileSettings struct {
+	Allow []string `yaml:"allow" json:"allow,omitempty" jsonschema:"description=Directories whose files may be routed (subdirectories included)"`
+}
+
+// BlockRule keeps URLs on Domains, or matching the Match regex, from being
+// opened or snapshotted by accident. Action drop (the default) routes
+// nothing, warn routes the URL anyway and job runs only Job.
+type BlockRule struct {
+	Match   string   `yaml:"match" json:"match,omitempty" jsonschema:"format=regex"`
+	Domains []string `yaml:"domains" json:"domains,omitempty" jsonschema:"description=Hosts the rule applies to; subdomains included"`
+	Action  string   `yaml:"action" json:"action,omitempty" jsonschema:"enum=drop,enum=warn,enum=job,description=What happens to a matching URL (default: drop)"`
+	Job     string   `yaml:"job" json:"job,omitempty" jsonschema:"description=Job run instead of the workflows when action is job"`
+	Reason  string   `yaml:"reason" json:"reason,omitempty" jsonschema:"description=Explanation sent back to the extension"`
+}
+
+// The settings.cleaning and settings.normalize types live in urlclean, so
+// url-hash cleans URLs the same way without importing plumb.
+type (
+	CleaningSettings  = urlclean.CleaningSettings
+	RedirectRule      = urlclean.RedirectRule
+	ClearURLsSettings = urlclean.ClearURLsSettings
+	DomainCleaning    = urlclean.DomainCleaning
+	NormalizeSettings = urlclean.NormalizeSettings
+)
+
+// normalizeURL applies settings.normalize to rawURL.
+func (c *Config) normalizeURL(rawURL string) string {
+	return c.Settings.Normalize.Normalize(rawURL)
+}
+
+// FrontendSettings map services to privacy frontend instances. Steps get
+// the rewritten URL as << parameters.frontend_url >>; with Global the URL is
+// rewritten before routing.
+type FrontendSettings struct {
+	Enabled   bool              `yaml:"enabled" json:"enabled,omitempty" jsonschema:"description=Turn the frontend rewrites on"`
+	Global    bool              `yaml:"global" json:"global,omitempty" jsonschema:"description=Rewrite URLs before routing instead of only exposing << parameters.frontend_url >>"`
+	Instances map[string]string `yaml:"instances" json:"instances,omitempty" jsonschema:"description=Frontend instance URL per service: youtube (Invidious) twitter (Nitter) reddit (Redlib) or medium (Scribe)"`
+}
+
+// AMPSettings rewrite AMP URLs to the canonical article before routing.
+type AMPSettings struct {
+	Enabled bool `yaml:"enabled" json:"enabled,omitempty" jsonschema:"description=Rewrite AMP cache URLs and AMP pages to their canonical URL"`
+	Fetch   bool `yaml:"fetch" json:"fetch,omitempty" jsonschema:"description=Fetch AMP pages to read their canonical link when the browser did not send the page"`
+}
+
+// UnshortenSettings make plumber follow the redirects of short links and
+// route the URL they end at.
+type UnshortenSettings struct {
+	Enabled bool     `yaml:"enabled" json:"enabled,omitempty" jsonschema:"description=Resolve short links before routing"`
+	Domains []string `yaml:"domains" json:"domains,omitempty" jsonschema:"description=Shortener hosts to resolve (default: t.co bit.ly lnkd.in amzn.to and other common ones)"`
+	MaxHops int      `yaml:"max_hops" json:"max_hops,omitempty" jsonschema:"description=Maximum number of redirects followed (default: 5)"`
+	Timeout string   `yaml:"timeout" json:"timeout,omitempty" jsonschema:"description=Time limit for resolving one link (default: 5s)"`
+}
+
+// SiteRule tells go-read-md where the article is on the pages of some
+// domains, in the spirit of Wallabag's site config. The first rule listing
+// a URL's domain applies.
+type SiteRule struct {
+	Domains []string `yaml:"domains" json:"domains" jsonschema:"description=Hosts the rule applies to; subdomains included"`
+	Content string   `yaml:"content" json:"content,omitempty" jsonschema:"description=CSS selector for the article body (used instead of readability when it matches)"`
+	Title   string   `yaml:"title" json:"title,omitempty" jsonschema:"description=CSS selector for the article title"`
+	Author  string   `yaml:"author" json:"author,omitempty" jsonschema:"description=CSS selector for the article author"`
+}
+
+// TagRule adds Tags to every URL matching the Match regex.
+type TagRule struct {
+	Match string  `yaml:"match" json:"match" jsonschema:"format=regex"`
+	Tags  TagList `yaml:"tags" json:"tags"`
+}
+
+// TagList is a list of tags, written either as a YAML list or as a
+// comma-separated string.
+type TagList []string
+
+// UnmarshalYAML accepts both "tags: [a, b]" and "tags: a, b".
+func (t *TagList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*t = nil
+		for _, tag := range strings.Split(value.Value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				*t = append(*t, tag)
+			}
+		}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return fmt.Errorf("tags must be a list or a comma-separated string: %w", err)
+	}
+	*t = list
+	return nil
+}
+
+// JSONSchema describes the two forms accepted by UnmarshalYAML.
+func (TagList) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		OneOf: []*jsonschema.Schema{
+			{Type: "string", Description: "Comma-separated tags"},
+			{Type: "array", Items: &jsonschema.Schema{Type: "string"}},
+		},
+	}
+}
+
+// tagsFor returns the tags of the tagging rules matching url, followed by
+// extra, without duplicates.
+func (c *Config) tagsFor(url string, extra ...string) []string {
+	var tags []string
+	for _, rule := range c.Settings.Tagging {
+		if matches(rule.Match, url) {
+			tags = append(tags, rule.Tags...)
+		}
+	}
+	return uniqueTags(append(tags, extra...))
+}
+
+// siteRuleFlags returns the go-read-md selector flags of the first site rule
+// for rawURL's domain, or "" when none applies.
+func (c *Config) siteRuleFlags(rawURL string) string {
+	u := parseURL(rawURL)
+	if u == nil {
+		return ""
+	}
+	for _, rule := range c.Settings.SiteRules {
+		if !urlclean.MatchesDomain(u, rule.Domains) {
+			continue
+		}
+		var flags []string
+		for _, f := range []struct{ name, selector string }{
+			{"--content-selector", rule.Content},
+			{"--title-selector", rule.Title},
+			{"--author-selector", rule.Author},
+		} {
+			if f.selector != "" {
+				flags = append(flags, f.name+" "+shellQuote(f.selector))
+			}
+		}
+		return strings.Join(flags, " ")
+	}
+	return ""
+}
+
+func uniqueTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		if t != "" && !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// SnapshotSettings are passed to snapshot commands (go-read-md) through
+// system parameters, so every save step in the config shares them. Jobs and
+// steps may override any of them, e.g. to send recipes to their own folder.
+type SnapshotSettings struct {
+	Folder           string              `yaml:"folder" json:"folder,omitempty" jsonschema:"description=Default snapshot folder (<< parameters.snapshot_folder >>)"`
+	Formats          string              `yaml:"formats" json:"formats,omitempty" jsonschema:"description=Default snapshot formats as a comma-separated list of md org html json epub warc png (<< parameters.snapshot_formats >>; default: md)"`
+	Frontmatter      bool                `yaml:"frontmatter" json:"frontmatter,omitempty" jsonschema:"description=Write YAML frontmatter instead of the bold metadata block (<< parameters.snapshot_frontmatter >>)"`
+	Cookies          string              `yaml:"cookies" json:"cookies,omitempty" jsonschema:"description=Netscape cookies.txt sent with snapshot fetches for sites you are logged into (<< parameters.snapshot_cookies >>)"`
+	Proxy            string              `yaml:"proxy" json:"proxy,omitempty" jsonschema:"description=Proxy for snapshot fetches and every fetch plumber makes itself (unshorten and AMP and watch and audit): http:// or socks5h:// e.g. Tor (<< parameters.snapshot_proxy >>; default: HTTP_PROXY and ALL_PROXY)"`
+	OnConflict       string              `yaml:"on_conflict" json:"on_conflict,omitempty" jsonschema:"enum=skip,enum=overwrite,enum=version,description=What snapshot steps do when the file they would write exists (<< parameters.snapshot_on_conflict >>; default: each tool's own)"`
+	FilenameTemplate string              `yaml:"filename_template" json:"filename_template,omitempty" jsonschema:"description=Snapshot filename pattern with {date} {time} {domain} {title} {url_hash}; may contain / for subfolders (<< parameters.snapshot_filename_template >>)"`
+	Readability      ReadabilitySettings `yaml:"readability" json:"readability,omitempty" jsonschema:"description=go-readability tuning passed to go-read-md as << parameters.snapshot_readability >>"`
+	Markdown         MarkdownSettings    `yaml:"markdown" json:"markdown,omitempty" jsonschema:"description=html-to-markdown options passed to go-read-md as << parameters.snapshot_markdown >>"`
+	Encryption       EncryptionSettings  `yaml:"encryption" json:"encryption,omitempty" jsonschema:"description=age recipients snapshot files are encrypted to; passed to go-read-md as << parameters.snapshot_encryption >>"`
+}
+
+// ReadabilitySettings tunes article extraction for sites the go-readability
+// defaults mangle. Steps get them as go-read-md flags in one parameter, so a
+// job or step can override the whole set.
+type ReadabilitySettings struct {
+	MinChars        int      `yaml:"min_chars" json:"min_chars,omitempty" jsonschema:"description=Minimum article length before extraction retries with looser rules (default: 500)"`
+	TopCandidates   int      `yaml:"top_candidates" json:"top_candidates,omitempty" jsonschema:"description=Number of top-scoring content candidates compared (default: 5)"`
+	KeepClasses     bool     `yaml:"keep_classes" json:"keep_classes,omitempty" jsonschema:"description=Keep class attributes in the extracted HTML"`
+	PreserveClasses []string `yaml:"preserve_classes" json:"preserve_classes,omitempty" jsonschema:"description=Class attributes kept even without keep_classes"`
+	Preserve        []string `yaml:"preserve" json:"preserve,omitempty" jsonschema:"description=Elements protected from cleanup: tables and figures and images"`
+	Debug           bool     `yaml:"debug" json:"debug,omitempty" jsonschema:"description=Log candidate scoring and removed elements to stderr"`
+}
+
+// cssClassRe matches a class name that is safe to put on a command line.
+var cssClassRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// flags renders r as go-read-md flags, empty when nothing is tuned.
+func (r ReadabilitySettings) flags() string {
+	var flags []string
+	if r.MinChars > 0 {
+		flags = append(flags, "--min-chars "+strconv.Itoa(r.MinChars))
+	}
+	if r.TopCandidates > 0 {
+		flags = append(flags, "--top-candidates "+strconv.Itoa(r.TopCandidates))
+	}
+	if r.KeepClasses {
+		flags = append(flags, "--keep-classes")
+	}
+	if len(r.PreserveClasses) > 0 {
+		flags = append(flags, "--preserve-classes "+strings.Join(r.PreserveClasses, ","))
+	}
+	if len(r.Preserve) > 0 {
+		flags = append(flags, "--preserve "+strings.Join(r.Preserve, ","))
+	}
+	if r.Debug {
+		flags = append(flags, "--debug-readability")
+	}
+	return strings.Join(flags, " ")
+}
+
+// options returns r for extracting articles in plumber itself, as go-read-md
+// does with flags.
+func (r ReadabilitySettings) options() readmd.Options {
+	return readmd.Options{
+		MinChars:        r.MinChars,
+		TopCandidates:   r.TopCandidates,
+		KeepClasses:     r.KeepClasses,
+		PreserveClasses: r.PreserveClasses,
+		Preserve:        r.Preserve,
+		Debug:           r.Debug,
+	}
+}
+
+// validate checks the values flags puts on the command line unquoted.
+func (r ReadabilitySettings) validate() error {
+	for _, kind := range r.Preserve {
+		if !slices.Contains(readmd.PreserveKinds, kind) {
+			return fmt.Errorf("settings.snapshot.readability.preserve has unknown element kind '%s' (use %s)", kind, strings.Join(readmd.PreserveKinds, ", "))
+		}
+	}
+	for _, class := range r.PreserveClasses {
+		if !cssClassRe.MatchString(class) {
+			return fmt.Errorf("settings.snapshot.readability.preserve_classes has invalid class name '%s'", class)
+		}
+	}
+	return nil
+}
+
+// MarkdownSettings choose the html-to-markdown extensions and code fence of
+// markdown snapshots. Like readability, steps get them as go-read-md flags.
+type MarkdownSettings struct {
+	Plugins   []string `yaml:"plugins" json:"plugins,omitempty" jsonschema:"description=GitHub Flavored Markdown extensions: tables and strikethrough and task-lists and footnotes (or gfm for all)"`
+	CodeFence string   `yaml:"code_fence" json:"code_fence,omitempty" jsonschema:"enum=backticks,enum=tildes,description=Code block fence (default: backticks)"`
+}
+
+// flags renders m as go-read-md flags, empty when nothing is set.
+func (m MarkdownSettings) flags() string {
+	var flags []string
+	if len(m.Plugins) > 0 {
+		flags = append(flags, "--markdown-plugins "+strings.Join(m.Plugins, ","))
+	}
+	if m.CodeFence != "" {
+		flags = append(flags, "--code-fence "+m.CodeFence)
+	}
+	return strings.Join(flags, " ")
+}
+
+// validate checks the values flags puts on the command line unquoted.
+func (m MarkdownSettings) validate() error {
+	for _, p := range m.Plugins {
+		if p != "gfm" && !slices.Contains(readmd.MarkdownPlugins, p) {
+			return fmt.Errorf("settings.snapshot.markdown.plugins has unknown plugin '%s' (use %s or gfm)", p, strings.Join(readmd.MarkdownPlugins, ", "))
+		}
+	}
+	if m.CodeFence != "" && !slices.Contains(readmd.CodeFences, m.CodeFence) {
+		return fmt.Errorf("settings.snapshot.markdown.code_fence must be %s", strings.Join(readmd.CodeFences, " or "))
+	}
+	return nil
+}
+
+// EncryptionSettings encrypt snapshots at rest with age, for archives kept
+// in synced cloud folders. Identity is only read by plumber decrypt; the
+// private key never reaches the snapshot steps.
+type EncryptionSettings struct {
+	Recipients     []string `yaml:"recipients" json:"recipients,omitempty" jsonschema:"description=age public keys (age1...) or SSH public keys to encrypt to"`
+	RecipientsFile string   `yaml:"recipients_file" json:"recipients_file,omitempty" jsonschema:"description=File of recipients one per line (like age -R)"`
+	Identity       string   `yaml:"identity" json:"identity,omitempty" jsonschema:"description=age identity file used by plumber decrypt (like age -i)"`
+}
+
+// flags renders e as go-read-md flags, empty when encryption is off.
+func (e EncryptionSettings) flags() string {
+	var flags []string
+	if len(e.Recipients) > 0 {
+		flags = append(flags, "--encrypt-to "+shellQuote(strings.Join(e.Recipients, ",")))
+	}
+	if e.RecipientsFile != "" {
+		flags = append(flags, "--encrypt-to-file "+shellQuote(expandHome(e.RecipientsFile)))
+	}
+	return strings.Join(flags, " ")
+}
+
+func (e EncryptionSettings) validate() error {
+	for _, r := range e.Recipients {
+		if strings.Contains(r, ",") || (!strings.HasPrefix(r, "age1") && !strings.HasPrefix(r, "ssh-")) {
+			return fmt.Errorf("settings.snapshot.encryption has invalid recipient '%s' (use an age1... or ssh- public key)", r)
+		}
+	}
+	return nil
+}
+
+// WatchSettings configures "plumber watch", which re-fetches the URLs of a
+// watchlist and runs Job when their content changed.
+type WatchSettings struct {
+	Path     string `yaml:"path" json:"path,omitempty" jsonschema:"description=Watchlist file (default: watchlist.json next to the history file)"`
+	Interval string `yaml:"interval" json:"interval,omitempty" jsonschema:"description=How often a URL is checked unless it sets its own (Go duration; default: 24h)"`
+	Job      string `yaml:"job" json:"job,omitempty" jsonschema:"description=Job run when a watched page changed; gets << parameters.diff_file >> and the page as << parameters.html_file >>"`
+}
+
+// RetentionSettings bound the snapshot folder for "plumber prune". Snapshots
+// older than MaxAge go first, then the oldest ones until the snapshots fit
+// in MaxSize. Tag rules override MaxAge for snapshots carrying the tag.
+type RetentionSettings struct {
+	MaxAge  string         `yaml:"max_age" json:"max_age,omitempty" jsonschema:"description=Prune snapshots older than this age (e.g. 365d or 720h)"`
+	MaxSize string         `yaml:"max_size" json:"max_size,omitempty" jsonschema:"description=Prune the oldest snapshots until all of them fit in this size (e.g. 500MB or 5GB)"`
+	Archive string         `yaml:"archive" json:"archive,omitempty" jsonschema:"description=Move pruned snapshots to this folder instead of deleting them"`
+	Tags    []TagRetention `yaml:"tags" json:"tags,omitempty" jsonschema:"description=Per-tag retention; the most lenient rule of a snapshot's tags applies"`
+}
+
+// TagRetention overrides the retention of snapshots with Tag.
+type TagRetention struct {
+	Tag    string `yaml:"tag" json:"tag"`
+	MaxAge string `yaml:"max_age" json:"max_age,omitempty" jsonschema:"description=Maximum age of snapshots with the tag (empty: never pruned for age)"`
+	Keep   bool   `yaml:"keep" json:"keep,omitempty" jsonschema:"description=Never prune snapshots with the tag; not even for max_size"`
+}
+
+func (r RetentionSettings) validate() error {
+	if r.MaxAge != "" {
+		if _, err := parseAge(r.MaxAge); err != nil {
+			return fmt.Errorf("settings.retention has invalid max_age '%s'", r.MaxAge)
+		}
+	}
+	if r.MaxSize != "" {
+		if _, err := parseSize(r.MaxSize); err != nil {
+			return fmt.Errorf("settings.retention has invalid max_size '%s'", r.MaxSize)
+		}
+	}
+	for i, t := range r.Tags {
+		if t.Tag == "" {
+			return fmt.Errorf("settings.retention.tags rule %d has no tag", i+1)
+		}
+		if t.MaxAge != "" {
+			if _, err := parseAge(t.MaxAge); err != nil {
+				return fmt.Errorf("settings.retention.tags rule %d has invalid max_age '%s'", i+1, t.MaxAge)
+			}
+		}
+	}
+	return nil
+}
+
+// HistorySettings controls the history log (see internal/history).
+type HistorySettings struct {
+	Enabled bool   `yaml:"enabled" json:"enabled,omitempty" jsonschema:"description=Record every routed URL and expose the history file to steps as << parameters.history_file >>"`
+	Path    string `yaml:"path" json:"path,omitempty" jsonschema:"description=History file (default: ~/.local/share/browser-pipes/history.db)"`
+}
+
+// FeedSettings controls the Atom feed plumber keeps of saved snapshots. It is
+// rebuilt from the history log after every routed URL.
+type FeedSettings struct {
+	Enabled bool   `yaml:"enabled" json:"enabled,omitempty" jsonschema:"description=Rewrite the feed after every routed URL (needs settings.history.enabled)"`
+	Path    string `yaml:"path" json:"path,omitempty" jsonschema:"description=Feed file (default: feed.xml in settings.snapshot.folder)"`
+	Title   string `yaml:"title" json:"title,omitempty" jsonschema:"description=Feed title (default: Saved articles)"`
+	BaseURL string `yaml:"base_url" json:"base_url,omitempty" jsonschema:"description=URL the feed folder is served at; makes the feed and snapshot links absolute"`
+	Limit   int    `yaml:"limit" json:"limit,omitempty" jsonschema:"description=Maximum number of entries (default: 50; -1 for all)"`
+}
+
+// feedPath returns the feed file to write, or "" when none is configured.
+func (c *Config) feedPath() string {
+	if c.Settings.Feed.Path != "" {
+		return expandHome(c.Settings.Feed.Path)
+	}
+	if c.Settings.Snapshot.Folder != "" {
+		return filepath.Join(expandHome(c.Settings.Snapshot.Folder), "feed.xml")
+	}
+	return ""
+}
+
+// historyPath returns the history file to record into, or "" when history
+// is disabled.
+func (c *Config) historyPath() string {
+	if !c.Settings.History.Enabled {
+		return ""
+	}
+	if c.Settings.History.Path != "" {
+		return expandHome(c.Settings.History.Path)
+	}
+	path, err := history.DefaultPath()
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// snapshotParams returns the snapshot settings as system parameters. Unlike
+// url or url_hash they are defaults: a job reference or step that sets one
+// of them wins, and the value is inherited by the commands it calls.
+func (c *Config) snapshotParams() map[string]string {
+	formats := c.Settings.Snapshot.Formats
+	if formats == "" {
+		formats = "md"
+	}
+	return map[string]string{
+		"snapshot_folder":            c.Settings.Snapshot.Folder,
+		"snapshot_formats":           formats,
+		"snapshot_frontmatter":       strconv.FormatBool(c.Settings.Snapshot.Frontmatter),
+		"snapshot_filename_template": c.Settings.Snapshot.FilenameTemplate,
+		"snapshot_cookies":           c.Settings.Snapshot.Cookies,
+		"snapshot_proxy":             c.Settings.Snapshot.Proxy,
+		"snapshot_on_conflict":       c.Settings.Snapshot.OnConflict,
+		"snapshot_readability":       c.Settings.Snapshot.Readability.flags(),
+		"snapshot_markdown":          c.Settings.Snapshot.Markdown.flags(),
+		"snapshot_encryption":        c.Settings.Snapshot.Encryption.flags(),
+	}
+}
+
+// isSnapshotParam reports whether name is one of the overridable snapshot_*
+// system parameters, which any command step may set.
+func isSnapshotParam(name string) bool {
+	_, ok := (&Config{}).snapshotParams()[name]
+	return ok
+}
+
+// isInheritedParam reports whether a job-scope parameter is passed on to
+// the commands a job calls when the step does not set it: the snapshot_*
+// overrides, plus tags, html_file, site_rule and the openJobParams when they
+// have a value.
+func isInheritedParam(name, value string) bool {
+	if isSnapshotParam(name) {
+		return true
+	}
+	return (name == "tags" || name == "html_file" || name == "site_rule" || slices.Contains(openJobParams, name)) && value != ""
+}
+
+// builtinSteps are the steps plumber runs itself, with their parameters.
+var builtinSteps = map[string][]string{
+	"ytdlp":     ytdlpParams,
+	"open":      browserParams,
+	"summarize": summarizeParams,
+}
+
+// Validate checks the configuration for consistency.
+func (c *Config) Validate() error {
+	if c.Version == "" {
+		return fmt.Errorf("version is missing")
+	}
+
+	if c.Settings.Feed.Enabled {
+		if !c.Settings.History.Enabled {
+			return fmt.Errorf("settings.feed needs settings.history.enabled")
+		}
+		if c.feedPath() == "" {
+			return fmt.Errorf("settings.feed needs a path or settings.snapshot.folder")
+		}
+		if c.feedLeaks(c.feedPath()) {
+			return fmt.Errorf("settings.feed would list the encrypted snapshots in plaintext: set settings.feed.path outside the snapshot folders")
+		}
+	}
+
+	if _, err := proxy.Func(c.Settings.Snapshot.Proxy); err != nil {
+		return fmt.Errorf("settings.snapshot has an %w", err)
+	}
+	switch c.Settings.Snapshot.OnConflict {
+	case "", "skip", "overwrite", "version":
+	default:
+		return fmt.Errorf("settings.snapshot.on_conflict must be skip, overwrite or version")
+	}
+	if err := c.Settings.Snapshot.Readability.validate(); err != nil {
+		return err
+	}
+	if err := c.Settings.Snapshot.Markdown.validate(); err != nil {
+		return err
+	}
+	if err := c.Settings.Snapshot.Encryption.validate(); err != nil {
+		return err
+	}
+	if err := c.Settings.Retention.validate(); err != nil {
+		return err
+	}
+	if err := c.Settings.Tracing.validate(); err != nil {
+		return err
+	}
+	if err := c.Settings.Notify.validate(); err != nil {
+		return err
+	}
+
+	for _, dir := range c.Settings.Files.Allow {
+		if !filepath.IsAbs(expandHome(dir)) {
+			return fmt.Errorf("settings.files.allow has relative directory '%s'", dir)
+		}
+	}
+	for i, rule := range c.Settings.Blocklist {
+		if err := rule.validate(c.Jobs); err != nil {
+			return fmt.Errorf("settings.blocklist rule %d %w", i+1, err)
+		}
+	}
+
+	for i, rule := range c.Settings.Tagging {
+		if _, err := regexp.Compile(rule.Match); err != nil || rule.Match == "" {
+			return fmt.Errorf("settings.tagging rule %d has invalid match regex '%s'", i+1, rule.Match)
+		}
+	}
+
+	if c.Settings.Watch.Interval != "" {
+		if d, err := time.ParseDuration(c.Settings.Watch.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("settings.watch has invalid interval '%s'", c.Settings.Watch.Interval)
+		}
+	}
+	if job := c.Settings.Watch.Job; job != "" {
+		if _, ok := c.Jobs[job]; !ok {
+			return fmt.Errorf("settings.watch references undefined job '%s'", job)
+		}
+	}
+
+	for service, instance := range c.Settings.Frontends.Instances {
+		if _, ok := frontendServices[service]; !ok {
+			return fmt.Errorf("settings.frontends has unknown service '%s' (use %s)", service, strings.Join(frontendServiceNames(), ", "))
+		}
+		if !validFrontendInstance(instance) {
+			return fmt.Errorf("settings.frontends has invalid %s instance '%s'", service, instance)
+		}
+	}
+	if err := c.Settings.Normalize.Options().Validate(); err != nil {
+		return fmt.Errorf("settings.normalize: %w", err)
+	}
+	if t := c.Settings.Unshorten.Timeout; t != "" {
+		if d, err := time.ParseDuration(t); err != nil || d <= 0 {
+			return fmt.Errorf("settings.unshorten has invalid timeout '%s'", t)
+		}
+	}
+	if c.Settings.Unshorten.MaxHops < 0 {
+		return fmt.Errorf("settings.unshorten has invalid max_hops %d", c.Settings.Unshorten.MaxHops)
+	}
+	if _, err := c.clearURLProviders(); err != nil {
+		return fmt.Errorf("settings.cleaning.clearurls: %w", err)
+	}
+	if err := c.Settings.Cleaning.Validate(); err != nil {
+		return err
+	}
+
+	for i, rule := range c.Settings.SiteRules {
+		if len(rule.Domains) == 0 {
+			return fmt.Errorf("settings.site_rules rule %d has no domains", i+1)
+		}
+		if rule.Content == "" && rule.Title == "" && rule.Author == "" {
+			return fmt.Errorf("settings.site_rules rule %d has no selectors", i+1)
+		}
+		for _, selector := range []string{rule.Content, rule.Title, rule.Author} {
+			if _, err := cascadia.Compile(selector); selector != "" && err != nil {
+				return fmt.Errorf("settings.site_rules rule %d has invalid selector '%s': %v", i+1, selector, err)
+			}
+		}
+	}
+
+	// 1. Validate Workflows
+	for wfName, wf := range c.Workflows {
+		for _, jobRef := range wf.Jobs {
+			// Check if job exists
+			if _, ok := c.Jobs[jobRef.Name]; !ok {
+				return fmt.Errorf("workflow '%s' references undefined job '%s'", wfName, jobRef.Name)
+			}
+			// Validate Match Regex
+			if jobRef.Match != "" {
+				if _, err := regexp.Compile(jobRef.Match); err != nil {
+					return fmt.Errorf("workflow '%s' job '%s' has invalid match regex '%s': %v", wfName, jobRef.Name, jobRef.Match, err)
+				}
+			}
+			for _, scheme := range jobRef.Schemes {
+				if !schemeName.MatchString(strings.ToLower(scheme)) {
+					return fmt.Errorf("workflow '%s' job '%s' has invalid scheme '%s'", wfName, jobRef.Name, scheme)
+				}
+			}
+		}
+	}
+
+	// 2. Validate Jobs
+	for jobName, job := range c.Jobs {
+		for i, step := range job.Steps {
+			if step.Name == "run" {
+				continue
+			}
+			params, ok := builtinSteps[step.Name]
+			if custom, registered := c.steps[step.Name]; registered && !ok {
+				params, ok = custom.params, true
+			}
+			if ok {
+				for paramName := range step.Params {
+					if !slices.Contains(params, paramName) {
+						return fmt.Errorf("job '%s' step %d passes unknown parameter '%s' to %s (use %s)", jobName, i+1, paramName, step.Name, strings.Join(params, ", "))
+					}
+				}
+				continue
+			}
+			// Check if command exists
+			cmd, ok := c.Commands[step.Name]
+			if !ok {
+				return fmt.Errorf("job '%s' step %d references undefined command '%s'", jobName, i+1, step.Name)
+			}
+			// Check params (optional, could be stricter)
+			for paramName := range step.Params {
+				if _, ok := cmd.Parameters[paramName]; !ok && !isSnapshotParam(paramName) {
+					// Is this an error? Or just extra param? CircleCI errors on unknown params.
+					return fmt.Errorf("job '%s' step %d passes unknown parameter '%s' to command '%s'", jobName, i+1, paramName, step.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// GenerateJSONSchema returns a JSON Schema as a string describing the configuration.
+func GenerateJSONSchema() string {
+	r := new(jsonschema.Reflector)
+	r.ExpandedStruct = true // Expand structs for better readability in schema if needed
+	if err := r.AddGoComments("github.com/browser-pipes/plumber", "./pkg/plumb"); err != nil {
+		// Ignore error if comment parsing fails (not critical)
+	}
+
+	schema := r.Reflect(&Config{})
+
+	// Pretty print
+	bytes, _ := json.MarshalIndent(schema, "", "  ")
+	return string(bytes)
+}
+
+type Command struct {
+	Parameters map[string]Parameter `yaml:"parameters" json:"parameters,omitempty"`
+	Steps      []Step               `yaml:"steps" json:"steps"`
+}
+
+type Parameter struct {
+	Type    string `yaml:"type" json:"type" jsonschema:"enum=string"`
+	Default string `yaml:"default" json:"default"`
+}
+
+type Job struct {
+	Steps []Step `yaml:"steps" json:"steps"`
+}
+
+type Workflow struct {
+	Jobs []WorkflowJob `yaml:"jobs" json:"jobs"`
+}
+
+type WorkflowJob struct {
+	Name    string            `yaml:"-" json:"-"` // The key in the list or map
+	Match   string            `yaml:"match" json:"match,omitempty" jsonschema:"format=regex"`
+	Schemes []string          `yaml:"schemes" json:"schemes,omitempty"`
+	Tags    TagList           `yaml:"tags" json:"tags,omitempty"`
+	Params  map[string]string `yaml:",inline" json:"params,omitempty"`
+}
+
+// JSONSchema implements the jsonschema.JSONSchemaer interface for WorkflowJob
+// to describe its polymorphic nature (String or Object).
+func (WorkflowJob) JSONSchema() *jsonschema.Schema {
+	props := orderedmap.New[string, *jsonschema.Schema]()
+	props.Set("match", &jsonschema.Schema{
+		Type:        "string",
+		Format:      "regex",
+		Description: "Regex pattern to match URLs",
+	})
+	props.Set("schemes", &jsonschema.Schema{
+		Type:        "array",
+		Items:       &jsonschema.Schema{Type: "string"},
+		Description: "URL schemes the job applies to (default: http and https; e.g. mailto or magnet)",
+	})
+	props.Set("tags", &jsonschema.Schema{
+		Description: "Tags for URLs routed to this job (a list or a comma-separated string)",
+		OneOf:       TagList{}.JSONSchema().OneOf,
+	})
+
+	return &jsonschema.Schema{
+		OneOf: []*jsonschema.Schema{
+			{
+				Type:        "string",
+				Description: "Job name reference",
+			},
+			{
+				Type:        "object",
+				Description: "Job reference with configuration",
+				Properties:  props,
+				// We enforce string keys:
+				AdditionalProperties: &jsonschema.Schema{
+					Type: "string",
+				},
+				// Ensure min properties to disambiguate? No, user might just conform to struct.
+			},
+		},
+	}
+}
+
+type Step struct {
+	Name   string            `json:"-"`
+	Args   string            `json:"-"`
+	Params map[string]string `json:"-"`
+}
+
+// JSONSchema implements the jsonschema.JSONSchemaer interface for Step.
+func (Step) JSONSchema() *jsonschema.Schema {
+	minProps := uint64(1)
+	maxProps := uint64(1)
+
+	return &jsonschema.Schema{
+		OneOf: []*jsonschema.Schema{
+			{
+				Type:        "string",
+				Description: "Command name (e.g. 'checkout')",
+			},
+			{
+				Type:          "object",
+				Description:   "Command with parameters (e.g. 'run: ...' or 'my_command: ...')",
+				MinProperties: &minProps,
+				MaxProperties: &maxProps,
+				AdditionalProperties: &jsonschema.Schema{
+					OneOf: []*jsonschema.Schema{
+						{
+							Type:        "string",
+							Description: "For 'run' command, the script to execute",
+						},
+						{
+							Type:        "object",
+							Description: "Parameters for the command (for the built-in 'ytdlp' step: format, output, cookies, args, save_to; for 'open': browser or flatpak or snap, profile, container, private, window, args, host, display, workspace, output; for 'summarize': model, endpoint, token_file, prompt, timeout, file)",
+							AdditionalProperties: &jsonschema.Schema{
+								Type: "string",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// UnmarshalYAML implements custom unmarshalling for Step to handle
+// string ("command_name") vs map ({"command_name": params}).
+func (s *Step) UnmarshalYAML(value *yaml.Node) error {
+	// Case 1: Step is just a string (e.g. "- checkout")
+	if value.Kind == yaml.ScalarNode {
+		s.Name = value.Value
+		return nil
+	}
+
+	// Case 2: Step is a map (e.g. "- greeting: ...")
+	if value.Kind == yaml.MappingNode {
+		if len(value.Content) != 2 {
+			return fmt.Errorf("step map must have exactly one key (the command name)")
+		}
+		keyNode := value.Content[0]
+		valNode := value.Content[1]
+
+		s.Name = keyNode.Value
+
+		// If the value is a scalar, it depends on the command.
+		// For "run", it's the script.
+		if valNode.Kind == yaml.ScalarNode {
+			if s.Name == "run" {
+				s.Args = valNode.Value
+			} else {
+				return fmt.Errorf("unexpected string argument for command '%s' (only 'run' supports this)", s.Name)
+			}
+			return nil
+		}
+
+		// If value is a map, these are parameters
+		if valNode.Kind == yaml.MappingNode {
+			s.Params = make(map[string]string)
+			// Decode the map into s.Params
+			if err := valNode.Decode(&s.Params); err != nil {
+				return fmt.Errorf("failed to decode parameters for command '%s': %v", s.Name, err)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid step format")
+}
+
+// UnmarshalYAML for WorkflowJob to handle list of maps where key is name and value is details
+func (wj *WorkflowJob) UnmarshalYAML(value *yaml.Node) error {
+	// A job in a workflow is typically a map item:
+	// - my_job:
+	//     match: "..."
+	// Or just a string:
+	// - my_job
+
+	if value.Kind == yaml.ScalarNode {
+		wj.Name = value.Value
+		return nil
+	}
+
+	if value.Kind == yaml.MappingNode {
+		if len(value.Content) != 2 {
+			return fmt.Errorf("workflow job must have single key")
+		}
+		wj.Name = value.Content[0].Value
+
+		// Decode the rest into the struct fields (Match, Params)
+		// We can't decode directly into wj because we're inside UnmarshalYAML for wj.
+		// We'll decode into an alias to avoid recursion/inline issues or just a map.
+		type alias WorkflowJob
+		var tmp alias
+		if err := value.Content[1].Decode(&tmp); err != nil {
+			return err
+		}
+		wj.Match = tmp.Match
+		wj.Schemes = tmp.Schemes
+		wj.Tags = tmp.Tags
+		wj.Params = tmp.Params
+		return nil
+	}
+
+	return fmt.Errorf("invalid workflow job format")
+}
+
+// matchesURL reports whether the job ref applies to url: url has one of its
+// schemes, http(s) by default, and matches its regex. An empty match is a
+// catch-all.
+func (wj WorkflowJob) matchesURL(url string) bool {
+	return wj.matchesScheme(url) && (wj.Match == "" || matches(wj.Match, url))
+}
+
+// routeTags returns the tags of url: those of the tagging rules and of every
+// job ref it matches.
+func (c *Config) routeTags(url string) []string {
+	var extra []string
+	for _, wf := range c.Workflows {
+		for _, jobRef := range wf.Jobs {
+			if jobRef.matchesURL(url) {
+				extra = append(extra, jobRef.Tags...)
+			}
+		}
+	}
+	return c.tagsFor(url, extra...)
+}
+
+// Helper to check if a regular expression matches the input string
+func matches(pattern, input string) bool {
+	if pattern == "" {
+		return false
+	}
+	matched, err := regexp.MatchString(pattern, input)
+	if err != nil {
+		return false
+	}
+	return matched
+}
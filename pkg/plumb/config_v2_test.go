@@ -0,0 +1,380 @@
+package plumb
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConfigValidation(t *testing.T) {
+	t.Run("Success: Valid Config", func(t *testing.T) {
+		yamlData := `
+version: "2"
+commands:
+  say_hello:
+    parameters:
+      name:
+        type: string
+        default: "world"
+    steps:
+      - run: "echo hello <<parameters.name>>"
+jobs:
+  my_job:
+    steps:
+      - say_hello:
+          name: "human"
+workflows:
+  main:
+    jobs:
+      - my_job:
+          match: ".*example.com.*"
+`
+		var cfg Config
+		err := yaml.Unmarshal([]byte(yamlData), &cfg)
+		if err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected valid config, got error: %v", err)
+		}
+	})
+
+	t.Run("Error: Undefined Job", func(t *testing.T) {
+		yamlData := `
+version: "2"
+workflows:
+  main:
+    jobs:
+      - non_existent_job
+`
+		var cfg Config
+		err := yaml.Unmarshal([]byte(yamlData), &cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "references undefined job") {
+			t.Errorf("expected undefined job error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Undefined Command", func(t *testing.T) {
+		yamlData := `
+version: "2"
+jobs:
+  my_job:
+    steps:
+      - undefined_command
+`
+		var cfg Config
+		err := yaml.Unmarshal([]byte(yamlData), &cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "references undefined command") {
+			t.Errorf("expected undefined command error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Invalid Regex", func(t *testing.T) {
+		yamlData := `
+version: "2"
+jobs:
+  my_job:
+    steps:
+      - run: "id"
+workflows:
+  main:
+    jobs:
+      - my_job:
+          match: "[invalid regex"
+`
+		var cfg Config
+		err := yaml.Unmarshal([]byte(yamlData), &cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "invalid match regex") {
+			t.Errorf("expected invalid regex error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Feed Without History", func(t *testing.T) {
+		yamlData := `
+version: "2"
+settings:
+  snapshot:
+    folder: "/tmp/read"
+  feed:
+    enabled: true
+`
+		var cfg Config
+		if err := yaml.Unmarshal([]byte(yamlData), &cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "settings.history.enabled") {
+			t.Errorf("expected feed error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Unknown Readability Preserve", func(t *testing.T) {
+		yamlData := `
+version: "2"
+settings:
+  snapshot:
+    readability:
+      preserve: [tables, videos]
+`
+		var cfg Config
+		if err := yaml.Unmarshal([]byte(yamlData), &cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "videos") {
+			t.Errorf("expected preserve error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Invalid Encryption Recipient", func(t *testing.T) {
+		yamlData := `
+version: "2"
+settings:
+  snapshot:
+    encryption:
+      recipients: [age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p, "AGE-SECRET-KEY-1XYZ"]
+`
+		var cfg Config
+		if err := yaml.Unmarshal([]byte(yamlData), &cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "AGE-SECRET-KEY") {
+			t.Errorf("expected recipient error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Invalid Snapshot Proxy", func(t *testing.T) {
+		cfg := Config{Version: "2", Settings: Settings{Snapshot: SnapshotSettings{Proxy: "tor:9050"}}}
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), `settings.snapshot has an invalid proxy "tor:9050"`) {
+			t.Errorf("expected proxy error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Invalid Snapshot Conflict Policy", func(t *testing.T) {
+		cfg := Config{Version: "2", Settings: Settings{Snapshot: SnapshotSettings{OnConflict: "rename"}}}
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "settings.snapshot.on_conflict must be") {
+			t.Errorf("expected on_conflict error, got %v", err)
+		}
+	})
+
+	t.Run("Error: Invalid Retention Age", func(t *testing.T) {
+		yamlData := `
+version: "2"
+settings:
+  retention:
+    max_size: 5GB
+    tags:
+      - tag: news
+        max_age: 1 week
+`
+		var cfg Config
+		if err := yaml.Unmarshal([]byte(yamlData), &cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "1 week") {
+			t.Errorf("expected max_age error, got %v", err)
+		}
+	})
+}
+
+func TestSiteRuleFlags(t *testing.T) {
+	yamlData := `
+version: "2"
+settings:
+  site_rules:
+    - domains: [example.com]
+      content: "div.post-body"
+      author: "a[rel='author']"
+    - domains: [news.example.org, example.org]
+      title: "h1"
+`
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(yamlData), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"https://www.example.com/a":      `--content-selector 'div.post-body' --author-selector 'a[rel='\''author'\'']'`,
+		"https://blog.example.com/a":     `--content-selector 'div.post-body' --author-selector 'a[rel='\''author'\'']'`,
+		"https://news.example.org/a":     `--title-selector 'h1'`,
+		"https://notexample.com/a":       "",
+		"https://example.com.evil.net/a": "",
+	}
+	for url, want := range tests {
+		if got := cfg.siteRuleFlags(url); got != want {
+			t.Errorf("%s: expected %q, got %q", url, want, got)
+		}
+	}
+
+	cfg.Settings.SiteRules[0].Content = "div["
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid selector") {
+		t.Errorf("expected invalid selector error, got %v", err)
+	}
+}
+
+func TestReadabilityFlags(t *testing.T) {
+	if got := (ReadabilitySettings{}).flags(); got != "" {
+		t.Errorf("expected no flags by default, got %q", got)
+	}
+	r := ReadabilitySettings{MinChars: 200, KeepClasses: true, PreserveClasses: []string{"note", "aside"}, Preserve: []string{"tables", "figures"}}
+	want := "--min-chars 200 --keep-classes --preserve-classes note,aside --preserve tables,figures"
+	if got := r.flags(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestMarkdownFlags(t *testing.T) {
+	if got := (MarkdownSettings{}).flags(); got != "" {
+		t.Errorf("expected no flags by default, got %q", got)
+	}
+	m := MarkdownSettings{Plugins: []string{"tables", "task-lists"}, CodeFence: "tildes"}
+	want := "--markdown-plugins tables,task-lists --code-fence tildes"
+	if got := m.flags(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	for _, bad := range []MarkdownSettings{{Plugins: []string{"tables; rm -rf ~"}}, {CodeFence: "indented"}} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%+v: expected an error", bad)
+		}
+	}
+}
+
+func TestEncryptionFlags(t *testing.T) {
+	if got := (EncryptionSettings{Identity: "key.txt"}).flags(); got != "" {
+		t.Errorf("expected no flags without recipients, got %q", got)
+	}
+	e := EncryptionSettings{Recipients: []string{"age1abc", "ssh-ed25519 AAAA me@host"}, RecipientsFile: "/keys/recipients.txt"}
+	want := "--encrypt-to 'age1abc,ssh-ed25519 AAAA me@host' --encrypt-to-file '/keys/recipients.txt'"
+	if got := e.flags(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTagLists(t *testing.T) {
+	yamlData := `
+version: "2"
+settings:
+  tagging:
+    - match: "(?i)recipes?"
+      tags: [recipe, cooking]
+    - match: "arxiv\\.org"
+      tags: "paper, science"
+jobs:
+  read:
+    steps:
+      - run: "true"
+workflows:
+  main:
+    jobs:
+      - read:
+          match: ".*"
+          tags: reading
+          snapshot_folder: "/tmp"
+`
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(yamlData), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := cfg.Settings.Tagging
+	if len(rules) != 2 || strings.Join(rules[0].Tags, ",") != "recipe,cooking" || strings.Join(rules[1].Tags, ",") != "paper,science" {
+		t.Errorf("unexpected tagging rules %+v", rules)
+	}
+	ref := cfg.Workflows["main"].Jobs[0]
+	if strings.Join(ref.Tags, ",") != "reading" || ref.Params["snapshot_folder"] != "/tmp" || ref.Params["tags"] != "" {
+		t.Errorf("unexpected job ref %+v", ref)
+	}
+	if got := cfg.tagsFor("https://arxiv.org/abs/1", "paper", "mine"); strings.Join(got, ",") != "paper,science,mine" {
+		t.Errorf("unexpected tags %v", got)
+	}
+
+	cfg.Settings.Tagging = append(cfg.Settings.Tagging, TagRule{Match: "[bad", Tags: TagList{"x"}})
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "settings.tagging rule 3") {
+		t.Errorf("expected invalid tagging rule error, got %v", err)
+	}
+}
+
+func TestStepUnmarshaling(t *testing.T) {
+	t.Run("Simple Run Step", func(t *testing.T) {
+		yamlData := "- run: 'echo hi'"
+		var steps []Step
+		err := yaml.Unmarshal([]byte(yamlData), &steps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(steps) != 1 || steps[0].Name != "run" || steps[0].Args != "echo hi" {
+			t.Errorf("unexpected step: %+v", steps[0])
+		}
+	})
+
+	t.Run("Command Step with Params", func(t *testing.T) {
+		yamlData := `
+- my_cmd:
+    param1: val1
+    param2: val2
+`
+		var steps []Step
+		err := yaml.Unmarshal([]byte(yamlData), &steps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(steps) != 1 || steps[0].Name != "my_cmd" || steps[0].Params["param1"] != "val1" {
+			t.Errorf("unexpected step: %+v", steps[0])
+		}
+	})
+
+	t.Run("Error: Malformed Step", func(t *testing.T) {
+		yamlData := `
+- run: "hi"
+  extra: "invalid"
+`
+		var steps []Step
+		err := yaml.Unmarshal([]byte(yamlData), &steps)
+		if err == nil {
+			t.Error("expected error for multi-key step mapping, got nil")
+		}
+	})
+}
+
+func TestMatches(t *testing.T) {
+	if !matches(".*google.*", "https://google.com") {
+		t.Error("expected match")
+	}
+	if matches(".*google.*", "https://bing.com") {
+		t.Error("expected no match")
+	}
+	if matches("", "anything") {
+		t.Error("empty pattern should not match anything by default in matches function")
+	}
+}
@@ -0,0 +1,97 @@
+package plumb
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runDecrypt implements "plumber decrypt": it decrypts snapshots written
+// with settings.snapshot.encryption, using the age CLI. Each file.age is
+// decrypted next to itself (or into --output), and folders are searched for
+// .age files, so "plumber decrypt ~/Documents/ReadLater" restores a whole
+// archive. The encrypted files are kept.
+func runDecrypt(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	identity := fs.String("identity", cfg.Settings.Snapshot.Encryption.Identity, "age identity file (default: settings.snapshot.encryption.identity)")
+	output := fs.String("output", "", "Folder to decrypt into, keeping the relative paths, or - to print a single file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: plumber decrypt [--identity key.txt] [--output dir|-] <file.age|dir>...")
+	}
+	if *identity == "" {
+		return fmt.Errorf("no identity: use --identity or set settings.snapshot.encryption.identity")
+	}
+	if _, err := exec.LookPath("age"); err != nil {
+		return fmt.Errorf("plumber decrypt needs the age command in PATH (https://age-encryption.org)")
+	}
+	key := expandHome(*identity)
+
+	if *output == "-" {
+		if fs.NArg() != 1 || !strings.HasSuffix(fs.Arg(0), ".age") {
+			return fmt.Errorf("--output - needs a single .age file")
+		}
+		cmd := exec.Command("age", "-d", "-i", key, expandHome(fs.Arg(0)))
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return cmd.Run()
+	}
+
+	count := 0
+	for _, arg := range fs.Args() {
+		root := expandHome(arg)
+		info, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		base := filepath.Dir(root)
+		if info.IsDir() {
+			base = root
+		}
+		err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".age") {
+				return err
+			}
+			dst := strings.TrimSuffix(path, ".age")
+			if *output != "" {
+				rel, err := filepath.Rel(base, dst)
+				if err != nil {
+					return err
+				}
+				dst = filepath.Join(expandHome(*output), rel)
+			}
+			if err := decryptFile(key, path, dst); err != nil {
+				return err
+			}
+			count++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("🔓 Decrypted %d files", count)
+	return nil
+}
+
+// decryptFile writes the plaintext of src to dst, replacing dst only once
+// age succeeded.
+func decryptFile(identity, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(dst), err)
+	}
+	tmp := dst + ".tmp"
+	if output, err := exec.Command("age", "-d", "-i", identity, "-o", tmp, src).CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to decrypt %s: %v: %s", src, err, strings.TrimSpace(string(output)))
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,70 @@
+package plumb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeAge "decrypts" by dropping the first line of the file.
+const fakeAge = `#!/bin/sh
+out=/dev/stdout
+while [ $# -gt 1 ]; do
+	case "$1" in
+	-o) out=$2; shift 2 ;;
+	-i) shift 2 ;;
+	*) shift ;;
+	esac
+done
+tail -n +2 "$1" > "$out"
+`
+
+func TestDecrypt(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "age"), []byte(fakeAge), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "ReadLater")
+	os.MkdirAll(filepath.Join(archive, "assets"), 0755)
+	os.WriteFile(filepath.Join(archive, "post.md.age"), []byte("AGE\n# Post\n"), 0600)
+	os.WriteFile(filepath.Join(archive, "assets", "chart.png.age"), []byte("AGE\npng"), 0600)
+	os.WriteFile(filepath.Join(archive, "notes.txt"), []byte("plain"), 0600)
+
+	cfg := &Config{Settings: Settings{Snapshot: SnapshotSettings{Encryption: EncryptionSettings{Identity: filepath.Join(dir, "key.txt")}}}}
+	var stdout bytes.Buffer
+
+	if err := runDecrypt([]string{archive}, cfg, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(archive, "assets", "chart.png")); string(data) != "png" {
+		t.Errorf("expected the image decrypted in place, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(archive, "post.md.age")); err != nil {
+		t.Error("expected the encrypted file to be kept")
+	}
+
+	out := filepath.Join(dir, "plain")
+	if err := runDecrypt([]string{"--output", out, archive}, cfg, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(out, "post.md")); string(data) != "# Post\n" {
+		t.Errorf("expected the archive decrypted into --output, got %q", data)
+	}
+
+	if err := runDecrypt([]string{"--output", "-", filepath.Join(archive, "post.md.age")}, cfg, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "# Post\n" {
+		t.Errorf("expected the plaintext on stdout, got %q", stdout.String())
+	}
+
+	cfg.Settings.Snapshot.Encryption.Identity = ""
+	if err := runDecrypt([]string{archive}, cfg, &stdout, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "identity") {
+		t.Errorf("expected an error without an identity, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package plumb is the routing and workflow engine of browser-pipes. The
+// plumber command wraps it as a native messaging host; other Go programs,
+// such as a TUI or a feed reader, can embed it through Engine instead of
+// running the binary:
+//
+//	var e plumb.Engine
+//	e.Register("notify", []string{"title"}, notify)
+//	if err := e.Load(""); err != nil {
+//		return err
+//	}
+//	res, err := e.Route(ctx, plumb.Envelope{URL: u, Origin: "tui"})
+//
+// The engine logs through the standard log package, and run steps write to
+// os.Stdout and os.Stderr.
+package plumb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// StepFunc runs a step registered with Engine.Register.
+type StepFunc func(ctx context.Context, call StepCall) error
+
+// StepCall is one run of a registered step.
+type StepCall struct {
+	URL       string            // the URL being routed
+	HTML      string            // the page as the browser sent it, if any
+	Workspace string            // the job's temporary directory
+	Params    map[string]string // the step's parameters, resolved
+	Scope     map[string]string // the job's parameters; set one for later steps
+}
+
+// customStep is a step registered with Engine.Register.
+type customStep struct {
+	params []string
+	run    StepFunc
+}
+
+// Engine loads a config and routes URLs through it, one at a time, as the
+// native messaging host does. The zero value is ready to use.
+type Engine struct {
+	mu      sync.Mutex // held for the whole of a route
+	cfg     atomic.Pointer[Config]
+	stepsMu sync.Mutex
+	steps   map[string]customStep
+}
+
+// Register adds a step that jobs and commands can use by name, with the
+// parameters it accepts; it hides a command of the same name. Register
+// steps before Load, which validates the config against them.
+func (e *Engine) Register(name string, params []string, run StepFunc) error {
+	if _, ok := builtinSteps[name]; ok || name == "run" {
+		return fmt.Errorf("%s is a built-in step", name)
+	}
+	e.stepsMu.Lock()
+	defer e.stepsMu.Unlock()
+	if e.steps == nil {
+		e.steps = make(map[string]customStep)
+	}
+	e.steps[name] = customStep{params: slices.Clone(params), run: run}
+	return nil
+}
+
+// Load reads and validates the config at path, by default
+// ~/.config/browser-pipes/plumber.yaml, and routes later URLs through it.
+// A route in progress finishes with the config it started with.
+func (e *Engine) Load(path string) error {
+	var cfg Config
+	if err := loadConfig(path, &cfg, io.Discard); err != nil {
+		return err
+	}
+	e.stepsMu.Lock()
+	cfg.steps = maps.Clone(e.steps)
+	e.stepsMu.Unlock()
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("configuration is invalid: %w", err)
+	}
+	e.cfg.Store(&cfg)
+	return nil
+}
+
+// Route routes env.URL as if the extension had sent it. The error is the
+// one the extension would be told about, also described by Result.Message.
+// Cancelling ctx stops the route before its next step and kills the run
+// step in progress.
+func (e *Engine) Route(ctx context.Context, env Envelope) (Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cfg := e.cfg.Load()
+	if cfg == nil {
+		return Result{}, fmt.Errorf("no config loaded")
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	return route(ctx, cfg, env)
+}
+
+// CleanURL strips the tracking parameters of rawURL, unwraps outbound
+// redirects and normalizes it as the loaded config tells plumber to before
+// routing and hashing. Short links and AMP pages, which take a request to
+// resolve, are left alone. Without a config the default tracking
+// parameters are stripped and nothing is normalized. CleanURL does not wait
+// for a route in progress, so it is safe to call from a step.
+func (e *Engine) CleanURL(rawURL string) string {
+	cfg := e.cfg.Load()
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	return cfg.normalizeURL(cfg.cleanURL(rawURL))
+}
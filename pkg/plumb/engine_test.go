@@ -0,0 +1,133 @@
+package plumb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "plumber.yaml")
+	config := `version: "2"
+jobs:
+  notify:
+    steps:
+      - fetch_title:
+          selector: "h1"
+      - run: "echo '<< parameters.title >>' > ` + filepath.Join(dir, "title") + `"
+workflows:
+  main:
+    jobs:
+      - notify:
+          match: "example\\.com"
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var e Engine
+	if _, err := e.Route(context.Background(), Envelope{URL: "https://example.com/"}); err == nil {
+		t.Error("expected routing without a config to fail")
+	}
+	if err := e.Load(configPath); err == nil || !strings.Contains(err.Error(), "fetch_title") {
+		t.Errorf("expected the unregistered step to be rejected, got %v", err)
+	}
+	if err := e.Register("open", nil, nil); err == nil {
+		t.Error("expected a built-in step name to be rejected")
+	}
+
+	var got StepCall
+	err := e.Register("fetch_title", []string{"selector"}, func(ctx context.Context, call StepCall) error {
+		got = call
+		call.Scope["title"] = "Example"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Load(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := e.Route(context.Background(), Envelope{URL: "https://example.com/?utm_source=x", Origin: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.URL != "https://example.com/" || strings.Join(res.Jobs, ",") != "notify" || res.Message != "Workflow executed" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if got.URL != "https://example.com/" || got.Params["selector"] != "h1" || got.Workspace == "" {
+		t.Errorf("unexpected step call %+v", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "title")); string(data) != "Example\n" {
+		t.Errorf("expected later steps to see the step's parameter, got %q", data)
+	}
+
+	if _, err := e.Route(context.Background(), Envelope{URL: "https://other.org/"}); err == nil {
+		t.Error("expected a URL without jobs to fail")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.Route(ctx, Envelope{URL: "https://example.com/"}); err != context.Canceled {
+		t.Errorf("expected a cancelled route, got %v", err)
+	}
+}
+
+func TestEngine_CleanURLDuringRoute(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "plumber.yaml")
+	config := `version: "2"
+settings:
+  normalize:
+    strip_fragment: true
+jobs:
+  wait:
+    steps:
+      - wait
+workflows:
+  main:
+    jobs:
+      - wait:
+          match: ".*"
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var e Engine
+	started, release := make(chan struct{}), make(chan struct{})
+	e.Register("wait", nil, func(ctx context.Context, call StepCall) error {
+		close(started)
+		<-release
+		return nil
+	})
+	if err := e.Load(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := e.Route(context.Background(), Envelope{URL: "https://example.com/"})
+		done <- err
+	}()
+	<-started
+
+	cleaned := make(chan string)
+	go func() { cleaned <- e.CleanURL("https://example.com/a?utm_source=x#top") }()
+	select {
+	case got := <-cleaned:
+		if got != "https://example.com/a" {
+			t.Errorf("expected the loaded config's cleaning, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("CleanURL waited for the route")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,23 +1,39 @@
-package main
+package plumb
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
+// envelopeHTMLFile is the name of the page HTML from the envelope in the job
+// workspace (<< parameters.html_file >>).
+const envelopeHTMLFile = "page.dom.html"
+
 // ExecuteWorkflowV2 finds the matching job in the workflow and executes it.
 func ExecuteWorkflowV2(cfg *Config, url string, html string) error {
+	_, err := executeWorkflow(cfg, newRouteState(context.Background(), ""), url, html)
+	return err
+}
+
+// executeWorkflow runs every job matching url and returns the names of the
+// jobs that ran, including the one that failed, if any.
+func executeWorkflow(cfg *Config, rs *routeState, url string, html string) ([]string, error) {
 	// 1. Iterate over workflows (Currently assuming single active workflow or checking all)
 	// CircleCI usually runs all workflows that match triggers.
 	// For Plumber, we likely want the first match or all matches?
 	// Given "browser-pipes", let's assume we check all workflows.
 
-	matched := false
+	var ran []string
 	for wfName, wf := range cfg.Workflows {
 		log.Printf("🔍 Checking workflow: %s", wfName)
+		var wfSpan *span // started by the first matching job
 		for _, jobRef := range wf.Jobs {
 			// jobRef.Match contains the regex.
 			// If match is empty, treat as "match all" or fallback?
@@ -37,18 +53,13 @@ func ExecuteWorkflowV2(cfg *Config, url string, html string) error {
 			// Let's assume empty match = catch-all if explicitly defined as such, generally regex should be provided.
 			// Actually, in the user design prompt: "And instead of branches we can have the regex for matching a target (job or command)."
 
-			isMatch := matches(jobRef.Match, url)
-			if jobRef.Match == "" {
-				// matches() returns false for empty pattern.
-				// Should we treat empty match as false? Or true?
-				// If no match rule, maybe it always runs?
-				// CAUTION: If always runs, we might loop.
-				// Let's assume empty regex = match everything (fallback)
-				isMatch = true
-			}
+			isMatch := jobRef.matchesURL(url)
 
 			if isMatch {
 				log.Printf("   ✅ Matched Job Ref: %s (Regex: '%s')", jobRef.Name, jobRef.Match)
+				if wfSpan == nil {
+					wfSpan = rs.startSpan("workflow "+wfName, map[string]string{"plumber.workflow": wfName})
+				}
 
 				// Find the actual job definition
 				jobDef, ok := cfg.Jobs[jobRef.Name]
@@ -57,12 +68,20 @@ func ExecuteWorkflowV2(cfg *Config, url string, html string) error {
 					continue
 				}
 
+				// Job ref tags add to those of the tagging rules.
+				params := make(map[string]string, len(jobRef.Params)+1)
+				for k, v := range jobRef.Params {
+					params[k] = v
+				}
+				params["tags"] = strings.Join(cfg.tagsFor(url, jobRef.Tags...), ",")
+
 				// Execute Job
-				if err := executeJob(cfg, jobDef, jobRef.Params, url, html); err != nil {
+				ran = append(ran, jobRef.Name)
+				if err := runJob(cfg, rs, jobRef.Name, jobDef, params, url, html); err != nil {
 					log.Printf("   ❌ Job matched but failed: %v", err)
-					return err
+					rs.endSpan(wfSpan, err)
+					return ran, err
 				}
-				matched = true
 				// Should we break after one match per workflow? Or execute all matches?
 				// "Pipes" -> maybe multiple?
 				// But "Plumber" usually routes to ONE destination.
@@ -72,15 +91,30 @@ func ExecuteWorkflowV2(cfg *Config, url string, html string) error {
 				// Let's assume independent checks.
 			}
 		}
+		rs.endSpan(wfSpan, nil)
 	}
 
-	if !matched {
-		return fmt.Errorf("no matching jobs found for url: %s", url)
+	if len(ran) == 0 {
+		return nil, fmt.Errorf("no matching jobs found for url: %s", url)
 	}
-	return nil
+	return ran, nil
 }
 
-func executeJob(cfg *Config, job Job, params map[string]string, url string, html string) error {
+// runJob runs the job called name on url as a span of the route's trace,
+// and raises a notification when it fails.
+func runJob(cfg *Config, rs *routeState, name string, job Job, params map[string]string, url string, html string) error {
+	span := rs.startSpan("job "+name, map[string]string{"plumber.job": name, "plumber.tags": params["tags"]})
+	rs.failedOutput, rs.job = "", name
+	defer func() { rs.job = "" }()
+	err := executeJob(cfg, rs, job, params, url, html)
+	rs.endSpan(span, err)
+	if err != nil {
+		cfg.notifyFailure(rs, name, url, err)
+	}
+	return err
+}
+
+func executeJob(cfg *Config, rs *routeState, job Job, params map[string]string, url string, html string) error {
 	// Create a temporary workspace for the job
 	workspace, err := os.MkdirTemp("", "plumber-job-*")
 	if err != nil {
@@ -89,21 +123,34 @@ func executeJob(cfg *Config, job Job, params map[string]string, url string, html
 	defer os.RemoveAll(workspace)
 
 	// Initialize parameters with system values
-	jobParams := injectSystemParams(params, url)
+	jobParams := injectSystemParams(cfg, params, url)
+
+	// Hand the page as the browser rendered it to every step, so snapshots
+	// of paywalled or JS-rendered pages need no refetch.
+	if html != "" {
+		htmlFile := filepath.Join(workspace, envelopeHTMLFile)
+		if err := os.WriteFile(htmlFile, []byte(html), 0600); err != nil {
+			return fmt.Errorf("failed to write page HTML: %w", err)
+		}
+		jobParams["html_file"] = htmlFile
+	}
 
 	if os.Getenv("DEBUG") == "true" {
 		log.Printf("   📂 Job Workspace: %s", workspace)
 	}
 
 	for _, step := range job.Steps {
-		if err := executeStep(cfg, step, jobParams, url, html, workspace); err != nil {
+		if err := rs.context().Err(); err != nil {
+			return err
+		}
+		if err := executeStep(cfg, rs, step, jobParams, url, html, workspace); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func executeCommand(cfg *Config, cmdName string, cmdDef Command, callParams map[string]string, url string, html string, workspace string) error {
+func executeCommand(cfg *Config, rs *routeState, cmdName string, cmdDef Command, callParams map[string]string, url string, html string, workspace string) error {
 	// 1. Resolve Parameters
 	// Merge callParams with defaults
 	finalParams := make(map[string]string)
@@ -119,18 +166,24 @@ func executeCommand(cfg *Config, cmdName string, cmdDef Command, callParams map[
 	}
 
 	// Always inject system params into command scope
-	finalParams = injectSystemParams(finalParams, url)
+	finalParams = injectSystemParams(cfg, finalParams, url)
 
 	// 2. Execute Steps
 	for _, step := range cmdDef.Steps {
-		if err := executeStep(cfg, step, finalParams, url, html, workspace); err != nil {
+		if err := rs.context().Err(); err != nil {
+			return err
+		}
+		if err := executeStep(cfg, rs, step, finalParams, url, html, workspace); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func executeStep(cfg *Config, step Step, scopeParams map[string]string, url string, html string, workspace string) error {
+func executeStep(cfg *Config, rs *routeState, step Step, scopeParams map[string]string, url string, html string, workspace string) (err error) {
+	stepSpan := rs.startSpan("step "+step.Name, map[string]string{"plumber.step": step.Name})
+	defer func() { rs.endSpan(stepSpan, err) }()
+
 	// Case 1: "run" command
 	if step.Name == "run" {
 		var script string
@@ -167,6 +220,9 @@ func executeStep(cfg *Config, step Step, scopeParams map[string]string, url stri
 			script = strings.ReplaceAll(script, "{html}", tmpFile.Name())
 		}
 
+		stepSpan.set("process.command_line", script)
+		stepSpan.set("plumber.background", strconv.FormatBool(isBackground))
+
 		// Execute
 		if isBackground {
 			log.Printf("   🏃 Running (background): %s", script)
@@ -174,8 +230,12 @@ func executeStep(cfg *Config, step Step, scopeParams map[string]string, url stri
 			log.Printf("   🏃 Running: %s", script)
 		}
 
-		// Use sh -c for complex commands
+		// Use sh -c for complex commands. Background commands outlive the
+		// route, so only the others are cancelled with it.
 		cmd := exec.Command("sh", "-c", script)
+		if !isBackground {
+			cmd = exec.CommandContext(rs.context(), "sh", "-c", script)
+		}
 		cmd.Env = os.Environ() // Pass env
 		cmd.Dir = workspace    // Set current working directory to the workspace
 
@@ -186,17 +246,27 @@ func executeStep(cfg *Config, step Step, scopeParams map[string]string, url stri
 			cmd.Stdout = os.Stdout
 		}
 		cmd.Stderr = os.Stderr
+		// The end of what a failing step printed goes to the failure log.
+		var stderrTail tailWriter
+		if cfg.Settings.Notify.OnFailure && !isBackground {
+			cmd.Stderr = io.MultiWriter(os.Stderr, &stderrTail)
+		}
 
 		if isBackground {
 			// For background tasks, we don't want to wait for them or capture output
 			// to avoid blocking the plumber or hanging on open pipes.
-			if err := cmd.Start(); err != nil {
+			err := cmd.Start()
+			cfg.logCommand(rs, cmd, url, err)
+			if err != nil {
 				return fmt.Errorf("background run step failed to start: %w", err)
 			}
 			return nil
 		}
 
-		if err := cmd.Run(); err != nil {
+		err := cmd.Run()
+		cfg.logCommand(rs, cmd, url, err)
+		if err != nil {
+			rs.failedOutput = stderrTail.String()
 			return fmt.Errorf("run step failed: %w", err)
 		}
 
@@ -210,7 +280,35 @@ func executeStep(cfg *Config, step Step, scopeParams map[string]string, url stri
 		return nil
 	}
 
-	// Case 2: Reference to another command
+	// Case 2: Built-in yt-dlp download
+	if step.Name == "ytdlp" {
+		return executeYtdlp(cfg, rs, step, scopeParams, url, workspace)
+	}
+
+	// Case 3: Built-in browser launch with a profile
+	if step.Name == "open" {
+		browser, err := executeOpen(cfg, rs, step, scopeParams, url, workspace)
+		if err == nil {
+			rs.opened = append(rs.opened, browser)
+		}
+		return err
+	}
+
+	// Case 4: Built-in LLM summary of the snapshot
+	if step.Name == "summarize" {
+		return executeSummarize(cfg, rs, step, scopeParams, url)
+	}
+
+	// Case 5: Step registered by a program embedding the engine
+	if custom, ok := cfg.steps[step.Name]; ok {
+		params := make(map[string]string, len(step.Params))
+		for k, v := range step.Params {
+			params[k] = resolveParams(v, scopeParams)
+		}
+		return custom.run(rs.context(), StepCall{URL: url, HTML: html, Workspace: workspace, Params: params, Scope: scopeParams})
+	}
+
+	// Case 6: Reference to another command
 	cmdDef, ok := cfg.Commands[step.Name]
 	if ok {
 		// Resolve parameters for this call
@@ -220,8 +318,15 @@ func executeStep(cfg *Config, step Step, scopeParams map[string]string, url stri
 		for k, v := range step.Params {
 			resolvedCallParams[k] = resolveParams(v, scopeParams)
 		}
+		// Carry job-level snapshot overrides, tags and the page HTML into
+		// the command scope.
+		for k, v := range scopeParams {
+			if _, ok := resolvedCallParams[k]; !ok && isInheritedParam(k, v) {
+				resolvedCallParams[k] = v
+			}
+		}
 
-		return executeCommand(cfg, step.Name, cmdDef, resolvedCallParams, url, html, workspace)
+		return executeCommand(cfg, rs, step.Name, cmdDef, resolvedCallParams, url, html, workspace)
 	}
 
 	return fmt.Errorf("unknown command or step: %s", step.Name)
@@ -243,12 +348,34 @@ func resolveParams(input string, params map[string]string) string {
 	return result
 }
 
-func injectSystemParams(params map[string]string, url string) map[string]string {
+func injectSystemParams(cfg *Config, params map[string]string, url string) map[string]string {
 	res := make(map[string]string)
 	for k, v := range params {
 		res[k] = v
 	}
 	res["url"] = url
 	res["url_hash"] = hashURL(url)
+	res["frontend_url"] = cfg.frontendURL(url)
+	res["file_path"] = filePath(url)
+	res["history_file"] = cfg.historyPath()
+	for k, v := range cfg.snapshotParams() {
+		if _, ok := res[k]; !ok {
+			res[k] = v
+		}
+	}
+	// A quoted ~ is not expanded by the shell, so paths such as token files
+	// are expanded here and can be quoted in commands.
+	for k, v := range res {
+		res[k] = expandHome(v)
+	}
+	if _, ok := res["tags"]; !ok {
+		res["tags"] = strings.Join(cfg.tagsFor(url), ",")
+	}
+	if _, ok := res["html_file"]; !ok {
+		res["html_file"] = ""
+	}
+	if _, ok := res["site_rule"]; !ok {
+		res["site_rule"] = cfg.siteRuleFlags(url)
+	}
 	return res
 }
@@ -0,0 +1,403 @@
+package plumb
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExecuteWorkflowV2(t *testing.T) {
+	cfg := &Config{
+		Version: "2",
+		Commands: map[string]Command{
+			"test_cmd": {
+				Parameters: map[string]Parameter{},
+				Steps: []Step{
+					{Name: "run", Args: "echo 'hello from cmd' > output.txt"},
+				},
+			},
+		},
+		Jobs: map[string]Job{
+			"simple_job": {
+				Steps: []Step{
+					{Name: "run", Args: "echo 'step 1' > file1.txt"},
+					{Name: "run", Args: "cat file1.txt"},
+				},
+			},
+			"param_job": {
+				Steps: []Step{
+					{Name: "run", Args: "echo <<parameters.input_val>> > output.txt"},
+				},
+			},
+			"capture_job": {
+				Steps: []Step{
+					{Name: "run", Params: map[string]string{"command": "echo 'captured_value'", "save_to": "my_result"}},
+					{Name: "run", Args: "echo <<parameters.my_result>> > final.txt"},
+				},
+			},
+		},
+		Workflows: map[string]Workflow{
+			"main": {
+				Jobs: []WorkflowJob{
+					{Name: "simple_job", Match: ".*example.com.*"},
+					{Name: "param_job", Match: ".*params.com.*", Params: map[string]string{"input_val": "hello_params"}},
+				},
+			},
+		},
+	}
+
+	t.Run("Success: Workflow Match", func(t *testing.T) {
+		err := ExecuteWorkflowV2(cfg, "https://example.com", "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("Error: No Workflow Match", func(t *testing.T) {
+		err := ExecuteWorkflowV2(cfg, "https://nomatch.com", "")
+		if err == nil {
+			t.Fatal("expected error for no matching jobs, got nil")
+		}
+	})
+
+	t.Run("Success: Parameter Injection", func(t *testing.T) {
+		err := ExecuteWorkflowV2(cfg, "https://params.com", "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// We don't easily check the output here without more complex mocking,
+		// but we verify execution completed.
+	})
+}
+
+func TestParameterResolution(t *testing.T) {
+	params := map[string]string{
+		"foo": "bar",
+		"url": "http://test.com",
+	}
+
+	input := "echo <<parameters.foo>> at <<parameters.url>>"
+	expected := "echo bar at http://test.com"
+	actual := resolveParams(input, params)
+
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// Test no spaces
+	input2 := "<<parameters.foo>>"
+	expected2 := "bar"
+	actual2 := resolveParams(input2, params)
+	if actual2 != expected2 {
+		t.Errorf("expected %q, got %q", expected2, actual2)
+	}
+}
+
+func TestExecuteJob_Workspace(t *testing.T) {
+	// Verify that files share the same workspace across steps
+	cfg := &Config{}
+	job := Job{
+		Steps: []Step{
+			{Name: "run", Args: "echo 'cross-step-data' > shared.txt"},
+			{Name: "run", Args: "grep 'cross-step-data' shared.txt"},
+		},
+	}
+
+	err := executeJob(cfg, &routeState{}, job, nil, "http://test.com", "")
+	if err != nil {
+		t.Errorf("expected success in workspace sharing test, got %v", err)
+	}
+}
+
+func TestExecuteStep_SaveTo(t *testing.T) {
+	cfg := &Config{}
+	scopeParams := make(map[string]string)
+
+	// Step 1: Save output
+	step1 := Step{
+		Name: "run",
+		Params: map[string]string{
+			"command": "echo 'important_data'",
+			"save_to": "captured",
+		},
+	}
+
+	tmpDir, _ := os.MkdirTemp("", "plumber-test-*")
+	defer os.RemoveAll(tmpDir)
+
+	err := executeStep(cfg, &routeState{}, step1, scopeParams, "http://test.com", "", tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scopeParams["captured"] != "important_data" {
+		t.Errorf("expected 'important_data' in scopeParams, got %q", scopeParams["captured"])
+	}
+
+	// Step 2: Use saved output
+	step2 := Step{
+		Name: "run",
+		Args: "echo <<parameters.captured>>",
+	}
+	err = executeStep(cfg, &routeState{}, step2, scopeParams, "http://test.com", "", tmpDir)
+	if err != nil {
+		t.Errorf("expected success using captured param, got %v", err)
+	}
+}
+
+func TestExecuteStep_HTML(t *testing.T) {
+	cfg := &Config{}
+	htmlContent := "<html><body>Test</body></html>"
+
+	// Create a script that checks if the file provided by {html} exists and contains the content
+	step := Step{
+		Name: "run",
+		Args: "cat {html} | grep 'Test'",
+	}
+
+	tmpDir, _ := os.MkdirTemp("", "plumber-test-*")
+	defer os.RemoveAll(tmpDir)
+
+	err := executeStep(cfg, &routeState{}, step, nil, "http://test.com", htmlContent, tmpDir)
+	if err != nil {
+		t.Errorf("expected success and match in HTML substitution, got %v", err)
+	}
+}
+
+func TestInjectSystemParams(t *testing.T) {
+	params := map[string]string{"user": "alice"}
+	url := "http://example.com"
+
+	res := injectSystemParams(&Config{}, params, url)
+
+	if res["user"] != "alice" {
+		t.Error("lost user param")
+	}
+	if res["url"] != url {
+		t.Error("missing url")
+	}
+	if res["url_hash"] == "" {
+		t.Error("missing url_hash")
+	}
+	if v, ok := res["history_file"]; !ok || v != "" {
+		t.Errorf("expected empty history_file when history is disabled, got %q", v)
+	}
+
+	cfg := &Config{Settings: Settings{History: HistorySettings{Enabled: true, Path: "/tmp/h.jsonl"}}}
+	if res := injectSystemParams(cfg, nil, url); res["history_file"] != "/tmp/h.jsonl" {
+		t.Errorf("expected configured history_file, got %q", res["history_file"])
+	}
+	if res["snapshot_frontmatter"] != "false" {
+		t.Errorf("expected snapshot_frontmatter=false by default, got %q", res["snapshot_frontmatter"])
+	}
+	if v, ok := res["snapshot_cookies"]; !ok || v != "" {
+		t.Errorf("expected empty snapshot_cookies by default, got %q", v)
+	}
+	cfg.Settings.Snapshot.Frontmatter = true
+	cfg.Settings.Snapshot.FilenameTemplate = "{domain}/{title}"
+	cfg.Settings.Snapshot.Cookies = "/tmp/cookies.txt"
+	cfg.Settings.Snapshot.Proxy = "socks5h://127.0.0.1:9050"
+	cfg.Settings.Snapshot.Readability.Preserve = []string{"tables"}
+	res = injectSystemParams(cfg, nil, url)
+	if res["snapshot_readability"] != "--preserve tables" {
+		t.Errorf("expected snapshot_readability flags, got %q", res["snapshot_readability"])
+	}
+	if res["snapshot_cookies"] != "/tmp/cookies.txt" {
+		t.Errorf("expected snapshot_cookies, got %q", res["snapshot_cookies"])
+	}
+	if res["snapshot_proxy"] != "socks5h://127.0.0.1:9050" {
+		t.Errorf("expected snapshot_proxy, got %q", res["snapshot_proxy"])
+	}
+	if res["snapshot_frontmatter"] != "true" {
+		t.Errorf("expected snapshot_frontmatter=true, got %q", res["snapshot_frontmatter"])
+	}
+	if res["snapshot_filename_template"] != "{domain}/{title}" {
+		t.Errorf("expected snapshot_filename_template, got %q", res["snapshot_filename_template"])
+	}
+
+	home, _ := os.UserHomeDir()
+	if res := injectSystemParams(cfg, map[string]string{"token_file": "~/secrets/token"}, url); res["token_file"] != home+"/secrets/token" {
+		t.Errorf("expected ~ expanded so the path can be quoted, got %q", res["token_file"])
+	}
+}
+
+// TestExampleSnapshotCommands runs commands of plumber.example.yaml that save
+// through its snapshot command, with go-read-md and save-to replaced by
+// scripts that record their arguments.
+func TestExampleSnapshotCommands(t *testing.T) {
+	bin, home := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	for _, tool := range []string{"go-read-md", "save-to", "url-hash"} {
+		script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + filepath.Join(bin, tool+".args") + "\necho abcd1234\n"
+		if err := os.WriteFile(filepath.Join(bin, tool), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cfg Config
+	if err := loadConfig("../../plumber.example.yaml", &cfg, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	args := func(tool string) []string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(bin, tool+".args"))
+		if err != nil {
+			t.Fatalf("%s did not run: %v", tool, err)
+		}
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	flag := func(argv []string, name string) string {
+		t.Helper()
+		i := slices.Index(argv, name)
+		if i < 0 || i+1 == len(argv) {
+			t.Fatalf("expected %s in %q", name, argv)
+		}
+		return argv[i+1]
+	}
+
+	run := func(command string) {
+		t.Helper()
+		job := Job{Steps: []Step{{Name: command}}}
+		if err := executeJob(&cfg, &routeState{}, job, nil, "https://example.com/a", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("save_url_markdown")
+	argv := args("go-read-md")
+	if flag(argv, "--output") != filepath.Join(home, "Documents/ReadLater") || flag(argv, "--filename") != "abcd1234.md" || flag(argv, "--dedup") != "skip" || flag(argv, "--url") != "https://example.com/a" {
+		t.Errorf("unexpected save_url_markdown snapshot %q", argv)
+	}
+
+	run("obsidian_save")
+	argv = args("go-read-md")
+	if flag(argv, "--output") != filepath.Join(home, "Obsidian")+"/Clippings" || flag(argv, "--filename-template") != "{title}" || flag(argv, "--format") != "md" || !slices.Contains(argv, "--frontmatter=true") {
+		t.Errorf("unexpected obsidian_save snapshot %q", argv)
+	}
+	if flag(args("save-to"), "--vault") != filepath.Join(home, "Obsidian") {
+		t.Errorf("expected the expanded vault, got %q", args("save-to"))
+	}
+
+	run("wallabag_save")
+	if got := flag(args("save-to"), "--client-secret-file"); got != filepath.Join(home, ".config/browser-pipes/secrets/wallabag-client-secret") {
+		t.Errorf("expected the expanded client secret file, got %q", got)
+	}
+}
+
+func TestSnapshotParamOverrides(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{
+		Settings: Settings{Snapshot: SnapshotSettings{Folder: dir + "/default"}},
+		Commands: map[string]Command{
+			"save": {Steps: []Step{{Name: "run", Args: "mkdir -p '<<parameters.snapshot_folder>>' && echo <<parameters.snapshot_formats>> > '<<parameters.snapshot_folder>>/formats'"}}},
+		},
+		Jobs: map[string]Job{
+			"save_job": {Steps: []Step{{Name: "save"}}},
+			"step_job": {Steps: []Step{{Name: "save", Params: map[string]string{"snapshot_formats": "md,warc"}}}},
+		},
+	}
+
+	check := func(folder, want string) {
+		t.Helper()
+		data, err := os.ReadFile(folder + "/formats")
+		if err != nil || strings.TrimSpace(string(data)) != want {
+			t.Errorf("expected %q in %s, got %q (%v)", want, folder, data, err)
+		}
+	}
+
+	if err := executeJob(cfg, &routeState{}, cfg.Jobs["save_job"], nil, "https://example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	check(dir+"/default", "md")
+
+	// A job reference override is inherited by the commands the job calls.
+	if err := executeJob(cfg, &routeState{}, cfg.Jobs["save_job"], map[string]string{"snapshot_folder": dir + "/recipes"}, "https://example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	check(dir+"/recipes", "md")
+
+	if err := executeJob(cfg, &routeState{}, cfg.Jobs["step_job"], map[string]string{"snapshot_folder": dir + "/papers"}, "https://example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	check(dir+"/papers", "md,warc")
+
+	cfg.Version = "2"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("snapshot overrides on a command step should validate, got %v", err)
+	}
+}
+
+func TestWorkflowTags(t *testing.T) {
+	out := t.TempDir() + "/tags"
+	cfg := &Config{
+		Settings: Settings{Tagging: []TagRule{
+			{Match: `(?i)go\.dev/`, Tags: TagList{"golang"}},
+			{Match: `/blog/`, Tags: TagList{"blog", "golang"}},
+		}},
+		Commands: map[string]Command{
+			"save": {
+				Parameters: map[string]Parameter{"tags": {Type: "string", Default: "none"}},
+				Steps:      []Step{{Name: "run", Args: "echo '<<parameters.tags>>' > " + out}},
+			},
+		},
+		Jobs: map[string]Job{"read": {Steps: []Step{{Name: "save"}}}},
+		Workflows: map[string]Workflow{"main": {Jobs: []WorkflowJob{
+			{Name: "read", Match: `go\.dev`, Tags: TagList{"reading"}},
+		}}},
+	}
+
+	check := func(want string) {
+		t.Helper()
+		data, _ := os.ReadFile(out)
+		if got := strings.TrimSpace(string(data)); got != want {
+			t.Errorf("expected tags %q, got %q", want, got)
+		}
+	}
+
+	if _, err := executeWorkflow(cfg, &routeState{}, "https://go.dev/blog/x", ""); err != nil {
+		t.Fatal(err)
+	}
+	check("golang,blog,reading")
+	if tags := cfg.routeTags("https://go.dev/blog/x"); strings.Join(tags, ",") != "golang,blog,reading" {
+		t.Errorf("unexpected route tags %v", tags)
+	}
+
+	// Without tags the command's own default applies.
+	cfg.Workflows["main"].Jobs[0].Tags = nil
+	if _, err := executeWorkflow(cfg, &routeState{}, "https://go.dev.example.org/about", ""); err != nil {
+		t.Fatal(err)
+	}
+	check("none")
+}
+
+func TestEnvelopeHTMLFile(t *testing.T) {
+	out := t.TempDir() + "/out"
+	cfg := &Config{
+		Commands: map[string]Command{
+			"snapshot": {Steps: []Step{{Name: "run", Args: "if [ -n '<<parameters.html_file>>' ]; then cat '<<parameters.html_file>>'; else echo fetched; fi > " + out}}},
+		},
+		Jobs: map[string]Job{"read": {Steps: []Step{{Name: "snapshot"}}}},
+	}
+
+	check := func(want string) {
+		t.Helper()
+		data, _ := os.ReadFile(out)
+		if got := strings.TrimSpace(string(data)); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+
+	if err := executeJob(cfg, &routeState{}, cfg.Jobs["read"], nil, "https://example.com", "<p>as rendered</p>"); err != nil {
+		t.Fatal(err)
+	}
+	check("<p>as rendered</p>")
+
+	if err := executeJob(cfg, &routeState{}, cfg.Jobs["read"], nil, "https://example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	check("fetched")
+}
@@ -0,0 +1,371 @@
+package plumb
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"browser-pipes/internal/history"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exportSection is the content section snapshots are exported to, with one
+// subsection per year as the date index. Tag index pages come from the
+// generator's tags taxonomy.
+const exportSection = "snapshots"
+
+var (
+	// metaLineRe matches a line of the bold metadata block go-read-md
+	// writes without --frontmatter, e.g. "**Source:** [url](url)".
+	metaLineRe = regexp.MustCompile(`^\*\*[A-Za-z ]+:\*\* `)
+	// assetRe matches links to images go-read-md --download-images saved.
+	assetRe = regexp.MustCompile(`assets/[^\s)"'>]+`)
+	slugRe  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// exportPage is a snapshot as it is written to the static site.
+type exportPage struct {
+	Title     string
+	URL       string
+	Author    string
+	Summary   string
+	Published time.Time
+	Saved     time.Time
+	Tags      []string
+	Body      string
+}
+
+// runExport implements "plumber export": it converts the markdown snapshots
+// in the history into the content folder of a Hugo or Zola site, one page
+// bundle per snapshot under content/snapshots/<year>/. An existing site
+// config is left alone; otherwise a minimal one enabling the tags taxonomy
+// is written.
+func runExport(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "hugo", "Static site generator: hugo or zola")
+	file := fs.String("file", "", "History file (default: settings.history.path or ~/.local/share/browser-pipes/history.db)")
+	domain := fs.String("domain", "", "Only export URLs on this domain (and its subdomains)")
+	tag := fs.String("tag", "", "Only export snapshots with this tag")
+	lang := fs.String("lang", "", "Only export snapshots in this language (en, fr, ...)")
+	since := fs.String("since", "", "Only export snapshots since a date (2006-01-02) or age (7d, 36h)")
+	title := fs.String("title", "Saved articles", "Site title, for a new site config")
+	baseURL := fs.String("base-url", "https://example.com/", "Site URL, for a new site config")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: plumber export [--format hugo|zola] <dir>")
+	}
+	if *format != "hugo" && *format != "zola" {
+		return fmt.Errorf("unknown format %q (use hugo or zola)", *format)
+	}
+	dir := expandHome(fs.Arg(0))
+
+	path, err := historyFile(cfg, *file)
+	if err != nil {
+		return err
+	}
+	sinceTime, err := history.ParseSince(*since, time.Now())
+	if err != nil {
+		return err
+	}
+	entries, err := history.Query(path, history.Filter{
+		Kind:   history.KindSnapshot,
+		Domain: *domain,
+		Tag:    *tag,
+		Lang:   *lang,
+		Since:  sinceTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	content := filepath.Join(dir, "content", exportSection)
+	if err := writeSectionIndex(*format, content, "Snapshots"); err != nil {
+		return err
+	}
+
+	exported, skipped := 0, 0
+	slugs := make(map[string]bool)
+	years := make(map[string]bool)
+	for _, e := range latestSnapshots(entries) {
+		src := markdownFile(e)
+		if src == "" {
+			skipped++
+			continue
+		}
+		page, err := readExportPage(src, e)
+		if err != nil {
+			log.Printf("   ⚠️ Skipping %s: %v", e.URL, err)
+			skipped++
+			continue
+		}
+
+		year := page.Saved.Local().Format("2006")
+		if !years[year] {
+			years[year] = true
+			if err := writeSectionIndex(*format, filepath.Join(content, year), year); err != nil {
+				return err
+			}
+		}
+		slug := exportSlug(page.Title, e.URL)
+		if slugs[year+"/"+slug] {
+			slug += "-" + hashURL(e.URL)
+		}
+		slugs[year+"/"+slug] = true
+
+		bundle := filepath.Join(content, year, slug)
+		if err := writeExportPage(*format, bundle, page); err != nil {
+			return err
+		}
+		copyAssets(page.Body, filepath.Dir(src), bundle)
+		exported++
+	}
+
+	if err := writeSiteConfig(*format, dir, *title, *baseURL); err != nil {
+		return err
+	}
+	log.Printf("📦 Exported %d snapshots to %s (%s)", exported, content, *format)
+	if skipped > 0 {
+		log.Printf("   ⚠️ Skipped %d snapshots without a markdown file", skipped)
+	}
+	return nil
+}
+
+// latestSnapshots returns the latest successful snapshot of each URL, in the
+// order the URLs were first snapshotted.
+func latestSnapshots(entries []history.Entry) []history.Entry {
+	var out []history.Entry
+	index := make(map[string]int)
+	for _, e := range entries {
+		if e.Status != history.StatusSuccess {
+			continue
+		}
+		if i, ok := index[e.URL]; ok {
+			out[i] = e
+			continue
+		}
+		index[e.URL] = len(out)
+		out = append(out, e)
+	}
+	return out
+}
+
+// markdownFile returns the markdown file of a snapshot if it still exists.
+func markdownFile(e history.Entry) string {
+	for _, f := range e.Files {
+		if filepath.Ext(f) != ".md" {
+			continue
+		}
+		if _, err := os.Stat(f); err == nil {
+			return f
+		}
+	}
+	return ""
+}
+
+// readExportPage reads a markdown snapshot, taking the author, publication
+// date and summary from its frontmatter (go-read-md --frontmatter) and the
+// rest from the history entry. The title heading and the bold metadata block
+// are dropped from the body, since the site renders them from the
+// frontmatter.
+func readExportPage(path string, e history.Entry) (exportPage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return exportPage{}, err
+	}
+	page := exportPage{Title: e.Title, URL: e.URL, Saved: e.Time, Tags: e.Tags}
+
+	body := string(data)
+	if rest, ok := strings.CutPrefix(body, "---\n"); ok {
+		if front, after, ok := strings.Cut(rest, "\n---\n"); ok {
+			var meta struct {
+				Title     string    `yaml:"title"`
+				Author    string    `yaml:"author"`
+				Published time.Time `yaml:"published"`
+				Summary   string    `yaml:"summary"`
+			}
+			if err := yaml.Unmarshal([]byte(front), &meta); err != nil {
+				return exportPage{}, fmt.Errorf("invalid frontmatter: %w", err)
+			}
+			if page.Title == "" {
+				page.Title = meta.Title
+			}
+			page.Author, page.Published, page.Summary = meta.Author, meta.Published, meta.Summary
+			body = after
+		}
+	}
+	page.Body = stripHeader(body)
+	if page.Title == "" {
+		page.Title = e.URL
+	}
+	return page, nil
+}
+
+// stripHeader removes the leading "# Title" line and, if present, the bold
+// metadata block and the rule that ends it.
+func stripHeader(body string) string {
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	if i < len(lines) && strings.HasPrefix(lines[i], "# ") {
+		i++
+	}
+	start := i
+	meta := false
+	for j := i; j < len(lines); j++ {
+		line := strings.TrimSpace(lines[j])
+		if line == "" {
+			continue
+		}
+		if metaLineRe.MatchString(line) {
+			meta = true
+			continue
+		}
+		if meta && line == "---" {
+			start = j + 1
+		}
+		break
+	}
+	return strings.TrimSpace(strings.Join(lines[start:], "\n")) + "\n"
+}
+
+// exportSlug derives a URL-safe folder name from the title, falling back to
+// the URL hash.
+func exportSlug(title, url string) string {
+	slug := strings.Trim(slugRe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 80 {
+		slug = strings.TrimRight(slug[:80], "-")
+	}
+	if slug == "" {
+		return hashURL(url)
+	}
+	return slug
+}
+
+// quoteValue renders a string or a string slice as JSON, which is valid in
+// both YAML and TOML frontmatter.
+func quoteValue(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func writeExportPage(format, bundle string, p exportPage) error {
+	var b strings.Builder
+	date := p.Saved.UTC().Format(time.RFC3339)
+	tags := p.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	switch format {
+	case "hugo":
+		b.WriteString("---\n")
+		fmt.Fprintf(&b, "title: %s\ndate: %s\ntags: %s\n", quoteValue(p.Title), date, quoteValue(tags))
+		if p.Summary != "" {
+			fmt.Fprintf(&b, "summary: %s\n", quoteValue(p.Summary))
+		}
+		fmt.Fprintf(&b, "params:\n  source: %s\n", quoteValue(p.URL))
+		if p.Author != "" {
+			fmt.Fprintf(&b, "  author: %s\n", quoteValue(p.Author))
+		}
+		if !p.Published.IsZero() {
+			fmt.Fprintf(&b, "  published: %s\n", p.Published.UTC().Format(time.RFC3339))
+		}
+		b.WriteString("---\n\n")
+	case "zola":
+		b.WriteString("+++\n")
+		fmt.Fprintf(&b, "title = %s\ndate = %s\n", quoteValue(p.Title), date)
+		if p.Summary != "" {
+			fmt.Fprintf(&b, "description = %s\n", quoteValue(p.Summary))
+		}
+		fmt.Fprintf(&b, "\n[taxonomies]\ntags = %s\n", quoteValue(tags))
+		fmt.Fprintf(&b, "\n[extra]\nsource = %s\n", quoteValue(p.URL))
+		if p.Author != "" {
+			fmt.Fprintf(&b, "author = %s\n", quoteValue(p.Author))
+		}
+		if !p.Published.IsZero() {
+			fmt.Fprintf(&b, "published = %s\n", p.Published.UTC().Format(time.RFC3339))
+		}
+		b.WriteString("+++\n\n")
+	}
+	b.WriteString(p.Body)
+
+	if err := os.MkdirAll(bundle, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", bundle, err)
+	}
+	return os.WriteFile(filepath.Join(bundle, "index.md"), []byte(b.String()), 0644)
+}
+
+// writeSectionIndex writes the _index.md of a section, listing its pages
+// newest first.
+func writeSectionIndex(format, dir, title string) error {
+	var front string
+	switch format {
+	case "hugo":
+		front = fmt.Sprintf("---\ntitle: %s\n---\n", quoteValue(title))
+	case "zola":
+		front = fmt.Sprintf("+++\ntitle = %s\nsort_by = \"date\"\n+++\n", quoteValue(title))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return os.WriteFile(filepath.Join(dir, "_index.md"), []byte(front), 0644)
+}
+
+// writeSiteConfig writes a minimal site config with the tags taxonomy,
+// unless the site already has one.
+func writeSiteConfig(format, dir, title, baseURL string) error {
+	var name, config string
+	switch format {
+	case "hugo":
+		name = "hugo.toml"
+		config = fmt.Sprintf("baseURL = %s\ntitle = %s\n\n[taxonomies]\ntag = \"tags\"\n", quoteValue(baseURL), quoteValue(title))
+	case "zola":
+		name = "config.toml"
+		config = fmt.Sprintf("base_url = %s\ntitle = %s\ntaxonomies = [{ name = \"tags\" }]\n", quoteValue(baseURL), quoteValue(title))
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		return fmt.Errorf("failed to write site config: %w", err)
+	}
+	log.Printf("   📝 Wrote %s", path)
+	return nil
+}
+
+// copyAssets copies the downloaded images a snapshot links to into its page
+// bundle, where the relative links still resolve. Missing images are
+// skipped.
+func copyAssets(body, srcDir, bundle string) {
+	for _, rel := range assetRe.FindAllString(body, -1) {
+		if strings.Contains(rel, "..") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(srcDir, filepath.FromSlash(rel)))
+		if err != nil {
+			continue
+		}
+		dst := filepath.Join(bundle, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+			err = os.WriteFile(dst, data, 0644)
+		}
+		if err != nil {
+			log.Printf("   ⚠️ Failed to copy %s: %v", rel, err)
+		}
+	}
+}
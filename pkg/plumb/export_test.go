@@ -0,0 +1,116 @@
+package plumb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+func TestStripHeader(t *testing.T) {
+	body := "# Title\n\n**Author:** Ann\n\n**Source:** [u](u)\n\n---\n\nFirst paragraph.\n\n---\n\nMore.\n"
+	if got := stripHeader(body); got != "First paragraph.\n\n---\n\nMore.\n" {
+		t.Errorf("unexpected body %q", got)
+	}
+	if got := stripHeader("\n# Title\n\nText with **bold:** words.\n"); got != "Text with **bold:** words.\n" {
+		t.Errorf("unexpected body %q", got)
+	}
+}
+
+func TestExportSlug(t *testing.T) {
+	if got := exportSlug("Go 1.24: What's New?", "https://example.com"); got != "go-1-24-what-s-new" {
+		t.Errorf("unexpected slug %q", got)
+	}
+	if got := exportSlug("日本語", "https://example.com"); got != hashURL("https://example.com") {
+		t.Errorf("expected the URL hash for a title without ASCII, got %q", got)
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	snapshots := filepath.Join(dir, "snapshots")
+	os.MkdirAll(filepath.Join(snapshots, "assets"), 0755)
+	os.WriteFile(filepath.Join(snapshots, "assets", "chart.png"), []byte("png"), 0644)
+	os.WriteFile(filepath.Join(snapshots, "plain.md"), []byte("# Plain Post\n\n**Source:** [u](u)\n\n**Saved:** 2024\n\n---\n\nBody ![chart](assets/chart.png)\n"), 0644)
+	os.WriteFile(filepath.Join(snapshots, "front.md"), []byte("---\ntitle: \"Front: Matter\"\nauthor: \"Ann\"\npublished: 2023-05-01T10:00:00Z\nsummary: \"Short.\"\n---\n\n# Front: Matter\n\nFront body.\n"), 0644)
+
+	historyPath := filepath.Join(dir, "history.db")
+	saved := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, e := range []history.Entry{
+		{Time: saved, Kind: history.KindSnapshot, URL: "https://example.com/plain", Status: history.StatusSuccess, Title: "Old Title", Files: []string{filepath.Join(snapshots, "gone.md")}},
+		{Time: saved, Kind: history.KindSnapshot, URL: "https://example.com/plain", Status: history.StatusSuccess, Title: "Plain Post", Files: []string{filepath.Join(snapshots, "plain.md")}, Tags: []string{"go"}},
+		{Time: saved.AddDate(1, 0, 0), Kind: history.KindSnapshot, URL: "https://blog.test/front", Status: history.StatusSuccess, Files: []string{filepath.Join(snapshots, "front.md")}},
+		{Time: saved, Kind: history.KindSnapshot, URL: "https://example.com/html", Status: history.StatusSuccess, Files: []string{filepath.Join(snapshots, "page.html")}},
+	} {
+		history.Append(historyPath, e)
+	}
+	cfg := &Config{Settings: Settings{History: HistorySettings{Path: historyPath}}}
+
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	t.Run("Hugo", func(t *testing.T) {
+		site := filepath.Join(dir, "hugo")
+		if err := runExport([]string{"--format", "hugo", site}, cfg, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+		page := read(filepath.Join(site, "content", "snapshots", "2024", "plain-post", "index.md"))
+		want := "---\ntitle: \"Plain Post\"\ndate: 2024-03-01T12:00:00Z\ntags: [\"go\"]\nparams:\n  source: \"https://example.com/plain\"\n---\n\nBody ![chart](assets/chart.png)\n"
+		if page != want {
+			t.Errorf("unexpected page:\n%s", page)
+		}
+		if read(filepath.Join(site, "content", "snapshots", "2024", "plain-post", "assets", "chart.png")) != "png" {
+			t.Error("expected the image to be copied into the page bundle")
+		}
+		front := read(filepath.Join(site, "content", "snapshots", "2025", "front-matter", "index.md"))
+		for _, want := range []string{"title: \"Front: Matter\"", "summary: \"Short.\"", "  author: \"Ann\"", "  published: 2023-05-01T10:00:00Z", "---\n\nFront body.\n"} {
+			if !strings.Contains(front, want) {
+				t.Errorf("expected %q in page:\n%s", want, front)
+			}
+		}
+		if !strings.Contains(read(filepath.Join(site, "content", "snapshots", "2025", "_index.md")), `title: "2025"`) {
+			t.Error("expected a year index")
+		}
+		if !strings.Contains(read(filepath.Join(site, "hugo.toml")), `tag = "tags"`) {
+			t.Error("expected a site config with the tags taxonomy")
+		}
+	})
+
+	t.Run("Zola", func(t *testing.T) {
+		site := filepath.Join(dir, "zola")
+		os.MkdirAll(site, 0755)
+		os.WriteFile(filepath.Join(site, "config.toml"), []byte("# mine\n"), 0644)
+		if err := runExport([]string{"--format", "zola", "--tag", "go", site}, cfg, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+		page := read(filepath.Join(site, "content", "snapshots", "2024", "plain-post", "index.md"))
+		for _, want := range []string{"+++\ntitle = \"Plain Post\"\ndate = 2024-03-01T12:00:00Z\n", "[taxonomies]\ntags = [\"go\"]\n", "[extra]\nsource = \"https://example.com/plain\"\n"} {
+			if !strings.Contains(page, want) {
+				t.Errorf("expected %q in page:\n%s", want, page)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(site, "content", "snapshots", "2025")); err == nil {
+			t.Error("expected --tag to filter out untagged snapshots")
+		}
+		if !strings.Contains(read(filepath.Join(site, "content", "snapshots", "_index.md")), `sort_by = "date"`) {
+			t.Error("expected the section sorted by date")
+		}
+		if read(filepath.Join(site, "config.toml")) != "# mine\n" {
+			t.Error("expected the existing site config to be kept")
+		}
+	})
+
+	if err := runExport([]string{"--format", "jekyll", dir}, cfg, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
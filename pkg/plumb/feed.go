@@ -0,0 +1,133 @@
+package plumb
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"browser-pipes/internal/history"
+)
+
+const defaultFeedLimit = 50
+
+// updateFeed rebuilds the Atom feed after a routed URL, if the feed is
+// enabled. Like recordRoute, failing to write it never fails the route.
+func updateFeed(cfg *Config) {
+	if !cfg.Settings.Feed.Enabled || cfg.historyPath() == "" {
+		return
+	}
+	if cfg.feedLeaks(cfg.feedPath()) {
+		log.Printf("   ⚠️ Not updating the feed: it would list the encrypted snapshots in plaintext in the snapshot folder")
+		return
+	}
+	if err := writeFeed(cfg, cfg.historyPath(), cfg.feedPath(), cfg.Settings.Feed.Limit); err != nil {
+		log.Printf("   ⚠️ Failed to update feed: %v", err)
+	}
+}
+
+// feedLeaks reports whether a feed written to path would sit in a snapshot
+// folder while snapshots are encrypted. The feed lists the title, URL and
+// file of every snapshot in plaintext, which is what encryption keeps out of
+// synced folders.
+func (c *Config) feedLeaks(path string) bool {
+	if c.Settings.Snapshot.Encryption.flags() == "" || path == "" {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return true
+	}
+	folders := c.snapshotFolders()
+	if inFolders(abs, folders) {
+		return true
+	}
+	// inFolders resolves symlinks, so it misses folders not created yet.
+	for _, dir := range folders {
+		root, err := filepath.Abs(dir)
+		if err != nil {
+			return true
+		}
+		if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFeed renders the feed into path, replacing it atomically so a reader
+// polling the file never sees a partial feed.
+func writeFeed(cfg *Config, historyPath, path string, limit int) error {
+	var buf bytes.Buffer
+	if err := renderFeed(&buf, cfg, historyPath, filepath.Dir(path), limit); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create feed directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write feed: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// renderFeed writes the feed of the snapshots in the history log, with
+// snapshot links relative to dir. A limit of 0 means the default, below 0 all.
+func renderFeed(w io.Writer, cfg *Config, historyPath, dir string, limit int) error {
+	entries, err := history.Query(historyPath, history.Filter{Kind: history.KindSnapshot, Status: history.StatusSuccess})
+	if err != nil {
+		return err
+	}
+	if limit == 0 {
+		limit = defaultFeedLimit
+	}
+	return history.WriteFeed(w, entries, history.FeedOptions{
+		Title:   cfg.Settings.Feed.Title,
+		Dir:     dir,
+		BaseURL: cfg.Settings.Feed.BaseURL,
+		Limit:   max(limit, 0),
+	})
+}
+
+// runFeed implements "plumber feed": it writes the feed once, whether or
+// not settings.feed is enabled, e.g. from cron or after editing the history.
+func runFeed(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("feed", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "History file to build the feed from")
+	output := fs.String("output", "", "Feed file, or - for stdout (default: settings.feed.path or feed.xml in settings.snapshot.folder)")
+	limit := fs.Int("limit", cfg.Settings.Feed.Limit, "Maximum number of entries (default 50; -1 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	historyPath, err := historyFile(cfg, *file)
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		return renderFeed(stdout, cfg, historyPath, "", *limit)
+	}
+
+	path := expandHome(*output)
+	if path == "" {
+		path = cfg.feedPath()
+	}
+	if path == "" {
+		return fmt.Errorf("no feed path: use --output or set settings.feed.path or settings.snapshot.folder")
+	}
+	if cfg.feedLeaks(path) {
+		return fmt.Errorf("snapshots are encrypted: write the feed outside the snapshot folders or to stdout with --output -")
+	}
+	if err := writeFeed(cfg, historyPath, path, *limit); err != nil {
+		return err
+	}
+	log.Printf("📰 Wrote feed to %s", path)
+	return nil
+}
@@ -0,0 +1,121 @@
+package plumb
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"browser-pipes/internal/history"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestUpdateFeed(t *testing.T) {
+	dir := t.TempDir()
+	historyPath := filepath.Join(dir, "history.db")
+	history.Append(historyPath, history.Entry{Kind: history.KindSnapshot, URL: "https://a.com", Status: history.StatusSuccess, Title: "Article A", Files: []string{filepath.Join(dir, "read", "a.md")}})
+
+	cfg := &Config{Settings: Settings{
+		History:  HistorySettings{Enabled: true, Path: historyPath},
+		Snapshot: SnapshotSettings{Folder: filepath.Join(dir, "read")},
+	}}
+	feedPath := filepath.Join(dir, "read", "feed.xml")
+
+	updateFeed(cfg)
+	if _, err := os.Stat(feedPath); !os.IsNotExist(err) {
+		t.Fatalf("expected no feed while disabled, got %v", err)
+	}
+
+	cfg.Settings.Feed.Enabled = true
+	updateFeed(cfg)
+	data, err := os.ReadFile(feedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<title>Article A</title>") || !strings.Contains(string(data), `href="a.md"`) {
+		t.Errorf("unexpected feed:\n%s", data)
+	}
+}
+
+func TestRunFeed(t *testing.T) {
+	dir := t.TempDir()
+	historyPath := filepath.Join(dir, "history.db")
+	history.Append(historyPath, history.Entry{Kind: history.KindSnapshot, URL: "https://a.com", Status: history.StatusSuccess})
+	history.Append(historyPath, history.Entry{Kind: history.KindSnapshot, URL: "https://b.com", Status: history.StatusSuccess})
+	cfg := &Config{Settings: Settings{History: HistorySettings{Path: historyPath}, Feed: FeedSettings{Title: "Mine"}}}
+
+	stdout := &bytes.Buffer{}
+	if err := runFeed([]string{"--output", "-", "--limit", "1"}, cfg, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "<title>Mine</title>") || strings.Count(out, "<entry>") != 1 {
+		t.Errorf("unexpected feed:\n%s", out)
+	}
+
+	out := filepath.Join(dir, "out", "feed.xml")
+	if err := runFeed([]string{"--output", out}, cfg, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out); strings.Count(string(data), "<entry>") != 2 {
+		t.Errorf("unexpected feed file:\n%s", data)
+	}
+
+	if err := runFeed(nil, cfg, &bytes.Buffer{}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "no feed path") {
+		t.Errorf("expected missing path error, got %v", err)
+	}
+}
+
+func TestUpdateFeed_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	folder := filepath.Join(dir, "read")
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(`
+version: "2"
+settings:
+  history:
+    enabled: true
+    path: "`+filepath.Join(dir, "history.db")+`"
+  snapshot:
+    folder: "`+folder+`"
+    encryption:
+      recipients: ["age1qyqszqgpqyqszqgpqyqszqgpqyqszqgpqyqszqgpqyqszqgpqyqs3290gq"]
+  feed:
+    enabled: true
+jobs:
+  save:
+    steps:
+      - run: "mkdir -p '<< parameters.snapshot_folder >>'"
+workflows:
+  main:
+    jobs:
+      - save:
+          match: ".*"
+`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "plaintext") {
+		t.Errorf("expected a feed in the snapshot folder to be refused, got %v", err)
+	}
+
+	if _, err := route(context.Background(), &cfg, Envelope{URL: "https://example.com/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "feed.xml")); !os.IsNotExist(err) {
+		t.Errorf("expected no plaintext feed in the snapshot folder, got %v", err)
+	}
+	if err := runFeed(nil, &cfg, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected plumber feed to refuse the snapshot folder")
+	}
+
+	cfg.Settings.Feed.Path = filepath.Join(dir, "public", "feed.xml")
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected a feed outside the snapshot folder to be valid, got %v", err)
+	}
+	updateFeed(&cfg)
+	if _, err := os.Stat(cfg.Settings.Feed.Path); err != nil {
+		t.Errorf("expected the feed outside the snapshot folder, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package plumb
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// shellMetachars may not appear in the path of a file URL: file_path is
+// substituted into sh -c commands as it is, inside the quotes of the job.
+const shellMetachars = "'\"`$;\\"
+
+// checkFileURL vets a file:// URL before it is routed. It must name an
+// absolute local path without ".." segments, control characters or shell
+// metacharacters that, once symlinks are resolved, lies in one of the
+// settings.files.allow directories.
+// It returns the URL of the resolved path, so workflow patterns see where the
+// file really is. Other URLs are returned as they are.
+func (c *Config) checkFileURL(rawURL string) (string, error) {
+	u := parseURL(rawURL)
+	if u == nil || !strings.EqualFold(u.Scheme, "file") {
+		return rawURL, nil
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+		return "", fmt.Errorf("file URL on another host (%s)", u.Host)
+	}
+	if u.Opaque != "" || !filepath.IsAbs(u.Path) {
+		return "", fmt.Errorf("file URL without an absolute path")
+	}
+	if slices.Contains(strings.Split(u.Path, "/"), "..") {
+		return "", fmt.Errorf("file URL with a path traversal")
+	}
+	if strings.ContainsFunc(u.Path, unicode.IsControl) {
+		return "", fmt.Errorf("file URL with control characters")
+	}
+	if strings.ContainsAny(u.Path, shellMetachars) {
+		return "", fmt.Errorf("file URL with shell metacharacters")
+	}
+	if len(c.Settings.Files.Allow) == 0 {
+		return "", fmt.Errorf("file URLs are not allowed (see settings.files.allow)")
+	}
+
+	resolved, err := filepath.EvalSymlinks(u.Path)
+	if err != nil {
+		return "", fmt.Errorf("file not found: %s", u.Path)
+	}
+	if strings.ContainsAny(resolved, shellMetachars) {
+		return "", fmt.Errorf("file URL resolving to a path with shell metacharacters")
+	}
+	for _, dir := range c.Settings.Files.Allow {
+		allowed, err := filepath.EvalSymlinks(expandHome(dir))
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(allowed, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			clean := url.URL{Scheme: "file", Path: resolved, RawQuery: u.RawQuery, Fragment: u.Fragment}
+			return clean.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside settings.files.allow", resolved)
+}
+
+// filePath returns the local path of a file:// URL, or "" for other URLs.
+func filePath(rawURL string) string {
+	if u := parseURL(rawURL); u != nil && strings.EqualFold(u.Scheme, "file") {
+		return u.Path
+	}
+	return ""
+}
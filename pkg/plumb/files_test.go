@@ -0,0 +1,105 @@
+package plumb
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckFileURL(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	docs := filepath.Join(root, "docs")
+	private := filepath.Join(root, "private")
+	os.MkdirAll(filepath.Join(docs, "sub"), 0755)
+	os.MkdirAll(private, 0755)
+	os.WriteFile(filepath.Join(docs, "sub", "paper one.pdf"), []byte("%PDF"), 0644)
+	os.WriteFile(filepath.Join(private, "secret.html"), []byte("x"), 0644)
+	os.Symlink(filepath.Join(private, "secret.html"), filepath.Join(docs, "link.html"))
+	os.Symlink(filepath.Join(docs, "sub", "paper one.pdf"), filepath.Join(root, "shortcut.pdf"))
+
+	cfg := &Config{Settings: Settings{Files: FileSettings{Allow: []string{docs}}}}
+
+	tests := []struct {
+		url  string
+		want string // "" for refused
+	}{
+		{"file://" + docs + "/sub/paper%20one.pdf#page=3", "file://" + docs + "/sub/paper%20one.pdf#page=3"},
+		{"file://localhost" + docs + "/sub/paper%20one.pdf", "file://" + docs + "/sub/paper%20one.pdf"},
+		{"file://" + root + "/shortcut.pdf", "file://" + docs + "/sub/paper%20one.pdf"},
+		{"file://" + docs + "/../private/secret.html", ""},
+		{"file://" + docs + "/%2e%2e/private/secret.html", ""},
+		{"file://" + docs + "/link.html", ""},
+		{"file://" + private + "/secret.html", ""},
+		{"file://nas" + docs + "/sub/paper%20one.pdf", ""},
+		{"file:sub/paper.pdf", ""},
+		{"file://" + docs + "/a%27%3B%20cd%3B%20touch%20PWNED%3B%20%27.pdf", ""},
+		{"file://" + docs + "/%24%28reboot%29.pdf", ""},
+		{"file://" + docs + "/missing.pdf", ""},
+		{"https://example.com/a/../b", "https://example.com/a/../b"},
+	}
+	for _, tt := range tests {
+		got, err := cfg.checkFileURL(tt.url)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("expected %s to be refused, got %q", tt.url, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("checkFileURL(%s) = %q, %v; want %q", tt.url, got, err, tt.want)
+		}
+	}
+
+	if path := filePath("file://" + docs + "/sub/paper%20one.pdf"); path != filepath.Join(docs, "sub", "paper one.pdf") {
+		t.Errorf("expected the decoded local path, got %q", path)
+	}
+
+	cfg.Settings.Files.Allow = nil
+	if _, err := cfg.checkFileURL("file://" + docs + "/sub/paper%20one.pdf"); err == nil || !strings.Contains(err.Error(), "settings.files.allow") {
+		t.Errorf("expected file URLs refused without an allowlist, got %v", err)
+	}
+}
+
+func TestCheckFileURL_ShellInjection(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	docs, _ := filepath.EvalSymlinks(t.TempDir())
+	name := "a'; cd; touch PWNED; '.pdf"
+	os.WriteFile(filepath.Join(docs, name), []byte("%PDF"), 0644)
+	os.Symlink(filepath.Join(docs, name), filepath.Join(docs, "innocent.pdf"))
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(`
+version: "2"
+settings:
+  files:
+    allow: ["`+docs+`"]
+jobs:
+  view:
+    steps:
+      - run: "test -e '<<parameters.file_path>>'"
+workflows:
+  main:
+    jobs:
+      - view:
+          schemes: [file]
+`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{
+		(&url.URL{Scheme: "file", Path: filepath.Join(docs, name)}).String(),
+		"file://" + docs + "/innocent.pdf",
+	} {
+		if _, err := route(context.Background(), &cfg, Envelope{URL: raw}); err == nil {
+			t.Errorf("expected %s to be refused", raw)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, "PWNED")); err == nil {
+		t.Fatal("the file name was run as a shell command")
+	}
+}
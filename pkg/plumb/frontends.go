@@ -0,0 +1,84 @@
+package plumb
+
+import (
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+
+	"browser-pipes/internal/urlclean"
+)
+
+// frontendServices maps the services settings.frontends.instances may name
+// to the domains their URLs are on, e.g. youtube to an Invidious instance,
+// twitter to Nitter, reddit to Redlib and medium to Scribe.
+var frontendServices = map[string][]string{
+	"youtube": {"youtube.com", "youtu.be", "youtube-nocookie.com"},
+	"twitter": {"twitter.com", "x.com"},
+	"reddit":  {"reddit.com"},
+	"medium":  {"medium.com"},
+}
+
+// frontendServiceNames returns the known services, sorted.
+func frontendServiceNames() []string {
+	var names []string
+	for name := range frontendServices {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// frontendURL returns rawURL on the privacy frontend instance configured for
+// its service, or rawURL itself when there is none or settings.frontends is
+// not enabled.
+func (c *Config) frontendURL(rawURL string) string {
+	f := c.Settings.Frontends
+	u := parseURL(rawURL)
+	if !f.Enabled || u == nil || u.Host == "" {
+		return rawURL
+	}
+	for _, service := range frontendServiceNames() {
+		instance := f.Instances[service]
+		if instance == "" || !urlclean.MatchesDomain(u, frontendServices[service]) {
+			continue
+		}
+		base := parseURL(strings.TrimSuffix(instance, "/"))
+		if base == nil || base.Host == "" {
+			return rawURL
+		}
+
+		rewritten := *u
+		rewritten.Scheme, rewritten.Host, rewritten.User = base.Scheme, base.Host, nil
+		// youtu.be/ID is /watch?v=ID on Invidious.
+		if service == "youtube" && strings.EqualFold(u.Hostname(), "youtu.be") {
+			q := u.Query()
+			q.Set("v", strings.Trim(u.Path, "/"))
+			rewritten.Path, rewritten.RawPath, rewritten.RawQuery = "/watch", "", q.Encode()
+		}
+		rewritten.Path = strings.TrimSuffix(base.Path, "/") + rewritten.Path
+		rewritten.RawPath = ""
+		return rewritten.String()
+	}
+	return rawURL
+}
+
+// applyFrontends is the global pre-processor of settings.frontends.global:
+// it routes URLs on their frontend instead of the original site.
+func (c *Config) applyFrontends(rawURL string) string {
+	if !c.Settings.Frontends.Global {
+		return rawURL
+	}
+	rewritten := c.frontendURL(rawURL)
+	if rewritten != rawURL {
+		log.Printf("   🕶️ Frontend: %s -> %s", rawURL, rewritten)
+	}
+	return rewritten
+}
+
+// validFrontendInstance reports whether instance is an absolute http(s)
+// URL.
+func validFrontendInstance(instance string) bool {
+	u, err := url.Parse(instance)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,57 @@
+package plumb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFrontendURL(t *testing.T) {
+	cfg := &Config{Version: "2", Settings: Settings{Frontends: FrontendSettings{Enabled: true, Instances: map[string]string{
+		"youtube": "https://yewtu.be",
+		"twitter": "https://nitter.net/",
+		"reddit":  "https://example.org/redlib",
+		"medium":  "https://scribe.rip",
+	}}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://www.youtube.com/watch?v=abc&t=42", "https://yewtu.be/watch?v=abc&t=42"},
+		{"https://youtu.be/abc?t=42", "https://yewtu.be/watch?t=42&v=abc"},
+		{"https://x.com/golang/status/1", "https://nitter.net/golang/status/1"},
+		{"https://old.reddit.com/r/golang/", "https://example.org/redlib/r/golang/"},
+		{"https://blog.medium.com/some-post-123", "https://scribe.rip/some-post-123"},
+		{"https://example.com/watch?v=abc", "https://example.com/watch?v=abc"},
+	}
+	for _, tt := range tests {
+		if actual := cfg.frontendURL(tt.input); actual != tt.expected {
+			t.Errorf("frontendURL(%q) = %q, want %q", tt.input, actual, tt.expected)
+		}
+	}
+
+	// Only exposed to steps unless global.
+	if got := cfg.prepareURL("https://x.com/golang", ""); got != "https://x.com/golang" {
+		t.Errorf("expected routing on the original URL, got %q", got)
+	}
+	params := injectSystemParams(cfg, nil, "https://x.com/golang")
+	if params["frontend_url"] != "https://nitter.net/golang" {
+		t.Errorf("expected << parameters.frontend_url >>, got %q", params["frontend_url"])
+	}
+	cfg.Settings.Frontends.Global = true
+	if got := cfg.prepareURL("https://x.com/golang", ""); got != "https://nitter.net/golang" {
+		t.Errorf("expected routing on the frontend, got %q", got)
+	}
+	cfg.Settings.Frontends.Enabled = false
+	if got := cfg.prepareURL("https://x.com/golang", ""); got != "https://x.com/golang" {
+		t.Errorf("expected no rewrite when disabled, got %q", got)
+	}
+
+	cfg.Settings.Frontends.Instances = map[string]string{"tiktok": "https://proxitok.example"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "tiktok") {
+		t.Errorf("expected an unknown service error, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package plumb
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+// recordRoute appends the outcome of a routed envelope to the history log,
+// if history is enabled, with elapsed, the time its jobs took. Failing to
+// record never fails the route itself.
+func recordRoute(cfg *Config, env Envelope, originalURL string, jobs []string, elapsed time.Duration, runErr error) {
+	path := cfg.historyPath()
+	if path == "" {
+		return
+	}
+
+	e := history.Entry{
+		Kind:   history.KindRoute,
+		URL:    env.URL,
+		Hash:   hashURL(env.URL),
+		Origin: env.Origin,
+		Target: env.Target,
+		Jobs:   jobs,
+		Status: history.StatusSuccess,
+		Tags:   cfg.routeTags(env.URL),
+	}
+	if elapsed > 0 {
+		// Rounded up so that a job that ran always has a duration.
+		e.DurationMS = (elapsed + time.Millisecond - 1).Milliseconds()
+	}
+	if originalURL != env.URL {
+		e.OriginalURL = originalURL
+	}
+	if runErr != nil {
+		e.Status = history.StatusError
+		e.Error = runErr.Error()
+	}
+
+	if err := history.Append(path, e); err != nil {
+		log.Printf("   ⚠️ Failed to record history: %v", err)
+	}
+}
+
+// historyFile resolves the history log to read: an explicit path, then
+// settings.history.path, then the default location. Unlike historyPath it
+// does not care whether recording is enabled.
+func historyFile(cfg *Config, explicit string) (string, error) {
+	path := explicit
+	if path == "" {
+		path = cfg.Settings.History.Path
+	}
+	if path == "" {
+		return history.DefaultPath()
+	}
+	return expandHome(path), nil
+}
+
+// runHistory implements "plumber history": it prints the entries of the
+// history log matching the given filters, oldest first, as a table, JSON or
+// CSV, or re-plumbs one of them with --open.
+func runHistory(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "History file (default: settings.history.path or ~/.local/share/browser-pipes/history.db)")
+	domain := fs.String("domain", "", "Only show URLs on this domain (and its subdomains)")
+	target := fs.String("target", "", "Only show envelopes sent with this target")
+	kind := fs.String("kind", "", "Only show entries of this kind (route, snapshot, save, audit or hash)")
+	tag := fs.String("tag", "", "Only show entries with this tag")
+	lang := fs.String("lang", "", "Only show snapshots in this language (en, fr, ...)")
+	since := fs.String("since", "", "Only show entries since a date (2006-01-02) or age (7d, 36h)")
+	failed := fs.Bool("failed", false, "Only show entries that failed")
+	limit := fs.Int("limit", 50, "Show at most this many of the most recent entries (0 for all)")
+	format := fs.String("format", "table", "Output format: table, json or csv")
+	open := fs.Int("open", 0, "Route the URL of entry N again (the # column; 1 is the most recent) instead of listing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !slices.Contains([]string{"table", "json", "csv"}, *format) {
+		return fmt.Errorf("unknown format %q (use table, json or csv)", *format)
+	}
+
+	path, err := historyFile(cfg, *file)
+	if err != nil {
+		return err
+	}
+
+	sinceTime, err := history.ParseSince(*since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	filter := history.Filter{
+		Domain: *domain,
+		Target: *target,
+		Kind:   *kind,
+		Tag:    *tag,
+		Lang:   *lang,
+		Since:  sinceTime,
+		Limit:  max(*limit, 0),
+	}
+	if *failed {
+		filter.Status = history.StatusError
+	}
+	entries, err := history.Query(path, filter)
+	if err != nil {
+		return err
+	}
+
+	if *open != 0 {
+		if *open < 0 || *open > len(entries) {
+			return fmt.Errorf("no entry %d: %d entries match", *open, len(entries))
+		}
+		return replumb(cfg, entries[len(entries)-*open])
+	}
+
+	switch *format {
+	case "json":
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "csv":
+		w := csv.NewWriter(stdout)
+		w.Write([]string{"time", "status", "kind", "target", "jobs", "url", "title", "error"})
+		for _, e := range entries {
+			w.Write([]string{e.Time.Format(time.RFC3339), e.Status, e.Kind, e.Target, strings.Join(e.Jobs, ","), e.URL, e.Title, e.Error})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	if len(entries) == 0 {
+		log.Printf("📭 No history entries in %s", path)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tTIME\tSTATUS\tKIND\tTARGET\tJOBS\tURL")
+	for i, e := range entries {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			len(entries)-i,
+			e.Time.Local().Format("2006-01-02 15:04"),
+			e.Status,
+			e.Kind,
+			dash(e.Target),
+			dash(strings.Join(e.Jobs, ",")),
+			e.URL,
+		)
+	}
+	return tw.Flush()
+}
+
+// replumb routes the URL of a history entry again, with the target it was
+// sent with, as if the browser had sent it.
+func replumb(cfg *Config, e history.Entry) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("configuration is invalid: %w", err)
+	}
+	log.Printf("🔁 Re-plumbing %s", e.URL)
+	res, err := route(context.Background(), cfg, Envelope{Origin: "history", URL: e.URL, Target: e.Target, Timestamp: time.Now().Unix()})
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ %s", res.Message)
+	return nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,170 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/history"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRecordRoute(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	env := Envelope{URL: "https://example.com/a", Origin: "chrome", Target: "toggle"}
+
+	t.Run("Disabled", func(t *testing.T) {
+		recordRoute(&Config{}, env, env.URL, nil, 0, nil)
+		if entries, _ := history.Read(path); len(entries) != 0 {
+			t.Errorf("expected nothing recorded, got %v", entries)
+		}
+	})
+
+	cfg := &Config{Settings: Settings{
+		History: HistorySettings{Enabled: true, Path: path},
+		Tagging: []TagRule{{Match: "example", Tags: TagList{"test"}}},
+	}}
+	recordRoute(cfg, env, "https://example.com/a?utm_source=x", []string{"read"}, 1500*time.Microsecond, nil)
+	recordRoute(cfg, env, env.URL, []string{"read"}, 0, errors.New("boom"))
+
+	entries, err := history.Read(path)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v (%v)", entries, err)
+	}
+	if e := entries[0]; e.Status != history.StatusSuccess || e.OriginalURL == "" || e.Target != "toggle" || e.Jobs[0] != "read" || e.Tags[0] != "test" || e.DurationMS != 2 {
+		t.Errorf("unexpected success entry %+v", e)
+	}
+	if e := entries[1]; e.Status != history.StatusError || e.Error != "boom" || e.OriginalURL != "" {
+		t.Errorf("unexpected error entry %+v", e)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	history.Append(path, history.Entry{Kind: history.KindRoute, URL: "https://go.dev/doc", Target: "toggle", Status: history.StatusSuccess, Jobs: []string{"default_firefox"}})
+	history.Append(path, history.Entry{Kind: history.KindSnapshot, URL: "https://medium.com/p/1", Status: history.StatusSuccess})
+	history.Append(path, history.Entry{Kind: history.KindRoute, URL: "https://medium.com/p/2", Status: history.StatusError})
+
+	cfg := &Config{Settings: Settings{History: HistorySettings{Path: path}}}
+
+	t.Run("Filter by domain", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		if err := runHistory([]string{"--domain", "medium.com"}, cfg, stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		out := stdout.String()
+		if strings.Contains(out, "go.dev") || !strings.Contains(out, "medium.com/p/1") || !strings.Contains(out, "medium.com/p/2") {
+			t.Errorf("unexpected output:\n%s", out)
+		}
+	})
+
+	t.Run("Filter by target", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		if err := runHistory([]string{"--target", "toggle"}, cfg, stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(stdout.String(), "\n"); lines != 2 {
+			t.Errorf("expected header and one row, got:\n%s", stdout.String())
+		}
+		if !strings.Contains(stdout.String(), "default_firefox") {
+			t.Errorf("expected job name in output, got:\n%s", stdout.String())
+		}
+	})
+
+	t.Run("Limit keeps most recent", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		runHistory([]string{"--limit", "1"}, cfg, stdout, io.Discard)
+		if !strings.Contains(stdout.String(), "medium.com/p/2") || strings.Contains(stdout.String(), "go.dev") {
+			t.Errorf("expected only the latest entry, got:\n%s", stdout.String())
+		}
+	})
+
+	t.Run("Invalid since", func(t *testing.T) {
+		err := runHistory([]string{"--since", "yesterday-ish"}, cfg, io.Discard, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "invalid time") {
+			t.Errorf("expected invalid time error, got %v", err)
+		}
+	})
+
+	t.Run("Failed only", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		if err := runHistory([]string{"--failed"}, cfg, stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(stdout.String(), "medium.com/p/1") || !strings.Contains(stdout.String(), "medium.com/p/2") {
+			t.Errorf("expected only the failed entry, got:\n%s", stdout.String())
+		}
+	})
+
+	t.Run("JSON and CSV", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		if err := runHistory([]string{"--format", "json", "--kind", "route"}, cfg, stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		var entries []history.Entry
+		if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil || len(entries) != 2 || entries[0].Jobs[0] != "default_firefox" {
+			t.Errorf("unexpected JSON %q (%v)", stdout.String(), err)
+		}
+
+		stdout.Reset()
+		if err := runHistory([]string{"--format", "csv", "--target", "toggle"}, cfg, stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(stdout).ReadAll()
+		if err != nil || len(rows) != 2 || rows[0][0] != "time" || rows[1][4] != "default_firefox" || rows[1][5] != "https://go.dev/doc" {
+			t.Errorf("unexpected CSV %v (%v)", rows, err)
+		}
+
+		if err := runHistory([]string{"--format", "xml"}, cfg, io.Discard, io.Discard); err == nil {
+			t.Error("expected an error for an unknown format")
+		}
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		dir := t.TempDir()
+		var routeCfg Config
+		if err := yaml.Unmarshal([]byte(`
+version: "2"
+jobs:
+  open:
+    steps:
+      - run: "echo '<< parameters.url >>' > `+filepath.Join(dir, "opened")+`"
+workflows:
+  main:
+    jobs:
+      - open
+`), &routeCfg); err != nil {
+			t.Fatal(err)
+		}
+		routeCfg.Settings.History.Path = path
+
+		// Entry 2 is the second most recent: the snapshot of medium.com/p/1.
+		if err := runHistory([]string{"--open", "2"}, &routeCfg, io.Discard, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, "opened")); strings.TrimSpace(string(data)) != "https://medium.com/p/1" {
+			t.Errorf("expected the entry to be routed again, got %q", data)
+		}
+		if err := runHistory([]string{"--open", "4"}, &routeCfg, io.Discard, io.Discard); err == nil {
+			t.Error("expected an error for an entry out of range")
+		}
+	})
+
+	t.Run("Empty history", func(t *testing.T) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		empty := filepath.Join(t.TempDir(), "none.jsonl")
+		if err := runHistory([]string{"--file", empty}, cfg, stdout, stderr); err != nil {
+			t.Fatal(err)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("expected no table for empty history, got %q", stdout.String())
+		}
+	})
+}
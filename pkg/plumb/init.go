@@ -0,0 +1,356 @@
+package plumb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// nativeHostName must match NATIVE_HOST_NAME in extension/background.js.
+const nativeHostName = "com.github.browser_pipe"
+
+// knownBrowser is a browser plumber init looks for on PATH, as a Flatpak
+// app and as a Snap.
+type knownBrowser struct {
+	name    string // used in the job name, open_<name>
+	bins    []string
+	flatpak string
+	snap    string
+}
+
+var knownBrowsers = []knownBrowser{
+	{"firefox", []string{"firefox"}, "org.mozilla.firefox", "firefox"},
+	{"librewolf", []string{"librewolf"}, "io.gitlab.librewolf-community", ""},
+	{"zen", []string{"zen-browser", "zen"}, "io.github.zen_browser.zen", ""},
+	{"chrome", []string{"google-chrome-stable", "google-chrome"}, "com.google.Chrome", ""},
+	{"chromium", []string{"chromium", "chromium-browser"}, "org.chromium.Chromium", "chromium"},
+	{"brave", []string{"brave-browser", "brave"}, "com.brave.Browser", "brave"},
+	{"vivaldi", []string{"vivaldi-stable", "vivaldi"}, "com.vivaldi.Vivaldi", ""},
+	{"edge", []string{"microsoft-edge-stable", "microsoft-edge"}, "com.microsoft.Edge", ""},
+}
+
+// knownTools are the helpers the starter config has jobs for.
+var knownTools = []string{"mpv", "yt-dlp", "zathura", "aria2c", "go-read-md"}
+
+// nativeHostDirs are the config folders, under ~/.config, of the browsers
+// that can run the extension (as in make install-host).
+var nativeHostDirs = []string{"google-chrome", "chromium", "BraveSoftware/Brave-Browser", "microsoft-edge"}
+
+// detectedBrowser is an installed browser and how the open step starts it.
+type detectedBrowser struct {
+	Name   string
+	Source string // open step parameter: browser (on PATH), flatpak or snap
+	Target string // its value: the command, the Flatpak app ID or the Snap
+}
+
+// Via says where the browser was found.
+func (b detectedBrowser) Via() string {
+	if b.Source == "browser" {
+		return "PATH"
+	}
+	return b.Source
+}
+
+// runInit implements "plumber init": it looks for installed browsers and
+// tools and writes a commented starter config for them, plus the native
+// messaging manifest when the extension ID is known.
+func runInit(args []string, configPath string, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	extensionID := fs.String("extension-id", "", "Extension ID from chrome://extensions; registers plumber as its native messaging host")
+	force := fs.Bool("force", false, "Overwrite an existing config")
+	printOnly := fs.Bool("print", false, "Print the config instead of writing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	browsers := detectBrowsers()
+	tools := detectTools()
+	for _, b := range browsers {
+		log.Printf("🌐 Found %s (%s): %s", b.Name, b.Via(), b.Target)
+	}
+	if len(browsers) == 0 {
+		log.Printf("⚠️ No known browser found; the config opens URLs with xdg-open")
+	}
+	for _, tool := range knownTools {
+		if tools[tool] {
+			log.Printf("🧰 Found %s", tool)
+		}
+	}
+
+	config, err := starterConfig(browsers, tools, time.Now())
+	if err != nil {
+		return err
+	}
+	if *printOnly {
+		_, err := stdout.Write(config)
+		return err
+	}
+
+	if configPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		configPath = filepath.Join(home, ".config", "browser-pipes", "plumber.yaml")
+	}
+	if _, err := os.Stat(configPath); err == nil && !*force {
+		return fmt.Errorf("%s already exists (use --force to overwrite it)", configPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, config, 0644); err != nil {
+		return err
+	}
+	log.Printf("✅ Wrote %s", configPath)
+
+	if *extensionID == "" {
+		log.Printf("ℹ️ Pass --extension-id (from chrome://extensions) to register the native messaging host")
+		return nil
+	}
+	return installNativeHost(*extensionID)
+}
+
+// detectBrowsers returns the known browsers found on PATH, then as Flatpak
+// apps, then as Snaps; each browser is reported once, by its first source.
+func detectBrowsers() []detectedBrowser {
+	flatpaks := installedPackages("flatpak", "list", "--app", "--columns=application")
+	snaps := installedPackages("snap", "list")
+
+	var found []detectedBrowser
+	for _, kb := range knownBrowsers {
+		if i := slices.IndexFunc(kb.bins, func(bin string) bool { _, err := exec.LookPath(bin); return err == nil }); i >= 0 {
+			found = append(found, detectedBrowser{kb.name, "browser", kb.bins[i]})
+		} else if kb.flatpak != "" && flatpaks[kb.flatpak] {
+			found = append(found, detectedBrowser{kb.name, "flatpak", kb.flatpak})
+		} else if kb.snap != "" && snaps[kb.snap] {
+			found = append(found, detectedBrowser{kb.name, "snap", kb.snap})
+		}
+	}
+	return found
+}
+
+// installedPackages returns the first column of a package manager listing,
+// or nothing when the package manager is not installed.
+func installedPackages(name string, args ...string) map[string]bool {
+	packages := make(map[string]bool)
+	if _, err := exec.LookPath(name); err != nil {
+		return packages
+	}
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		log.Printf("⚠️ %s %s failed: %v", name, strings.Join(args, " "), err)
+		return packages
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			packages[fields[0]] = true
+		}
+	}
+	return packages
+}
+
+// detectTools reports which of the knownTools are on PATH.
+func detectTools() map[string]bool {
+	tools := make(map[string]bool)
+	for _, tool := range knownTools {
+		if _, err := exec.LookPath(tool); err == nil {
+			tools[tool] = true
+		}
+	}
+	return tools
+}
+
+var starterTemplate = template.Must(template.New("plumber.yaml").Parse(`# Starter config written by "plumber init" on {{.Date}}.
+{{- if .Browsers}}
+# Browsers found:{{range .Browsers}} {{.Name}} ({{.Via}}){{end}}
+{{- end}}
+# See plumber.example.yaml for every option, and check your edits with
+# "plumber validate".
+version: "2"
+
+settings:
+  # Every routed URL is logged; query it with "plumber history"
+  history:
+    enabled: true
+  snapshot:
+    folder: "~/Documents/browser-pipes"
+{{- if .Tools.zathura}}
+  # file:// URLs are only routed from these directories
+  files:
+    allow: ["~/Documents", "~/Downloads"]
+{{- end}}
+
+jobs:
+{{- range .Browsers}}
+  open_{{.Name}}:
+    steps:
+      - open:
+          {{.Source}}: "{{.Target}}"
+          # profile: "work"  # a profile of this browser
+          # private: "true"  # or a private window
+{{- else}}
+  open_default:
+    steps:
+      - run:
+          command: "xdg-open '<<parameters.url>>'"
+          background: "true"
+{{- end}}
+{{- if .Tools.mpv}}
+  play_video:
+    steps:
+      - run:
+          command: "mpv --no-terminal '<<parameters.url>>'"
+          background: "true"
+{{- end}}
+{{- if index .Tools "yt-dlp"}}
+  # Downloads into settings.snapshot.folder
+  download_video:
+    steps:
+      - ytdlp:
+          format: "bv*[height<=1080]+ba/b"
+{{- end}}
+{{- if index .Tools "go-read-md"}}
+  save_markdown:
+    steps:
+      - run: "go-read-md <<parameters.snapshot_markdown>> --output '<<parameters.snapshot_folder>>' --history '<<parameters.history_file>>' --tags '<<parameters.tags>>' '<<parameters.url>>'"
+{{- end}}
+{{- if .Tools.zathura}}
+  open_pdf:
+    steps:
+      - run:
+          command: "zathura '<<parameters.file_path>>'"
+          background: "true"
+{{- end}}
+{{- if .Tools.aria2c}}
+  add_torrent:
+    steps:
+      - run: "aria2c --dir ~/Downloads --seed-time=0 -D '<<parameters.url>>'"
+{{- end}}
+
+# Job refs run for every URL they match, in order; those without schemes
+# only see http(s) URLs.
+workflows:
+  main:
+    jobs:
+{{- if .Tools.mpv}}
+      - play_video:
+          match: "(?i)(youtube\\.com/watch|youtu\\.be/|vimeo\\.com/)"
+{{- end}}
+{{- if index .Tools "yt-dlp"}}
+      # - download_video:
+      #     match: "(?i)vimeo\\.com/"
+{{- end}}
+{{- if index .Tools "go-read-md"}}
+      # - save_markdown:
+      #     match: "(?i)(lwn\\.net|substack\\.com)"
+{{- end}}
+{{- if .Tools.zathura}}
+      - open_pdf:
+          schemes: [file]
+          match: "(?i)\\.pdf$"
+{{- end}}
+{{- if .Tools.aria2c}}
+      - add_torrent:
+          schemes: [magnet]
+{{- end}}
+{{- range $i, $b := .Browsers}}
+{{- if eq $i 0}}
+      # Everything else
+      - open_{{$b.Name}}:
+          match: ".*"
+{{- else}}
+      # - open_{{$b.Name}}:
+      #     match: "(?i)example\\.com"
+{{- end}}
+{{- else}}
+      - open_default:
+          match: ".*"
+{{- end}}
+`))
+
+// starterConfig renders the starter config for the browsers and tools found
+// and checks that plumber accepts it.
+func starterConfig(browsers []detectedBrowser, tools map[string]bool, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	err := starterTemplate.Execute(&buf, map[string]any{
+		"Date":     now.Format("2006-01-02"),
+		"Browsers": browsers,
+		"Tools":    tools,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(buf.Bytes(), &cfg); err != nil {
+		return nil, fmt.Errorf("generated config does not parse: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("generated config is invalid: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// installNativeHost registers this plumber binary as the native messaging
+// host of the extension in every browser config folder that exists.
+func installNativeHost(extensionID string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	manifest, err := json.MarshalIndent(map[string]any{
+		"name":            nativeHostName,
+		"description":     "Browser Pipes Plumber",
+		"path":            exe,
+		"type":            "stdio",
+		"allowed_origins": []string{"chrome-extension://" + extensionID + "/"},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	registered := 0
+	for _, dir := range nativeHostDirs {
+		browserDir := filepath.Join(home, ".config", dir)
+		if _, err := os.Stat(browserDir); err != nil {
+			continue
+		}
+		hostDir := filepath.Join(browserDir, "NativeMessagingHosts")
+		if err := os.MkdirAll(hostDir, 0755); err != nil {
+			return err
+		}
+		path := filepath.Join(hostDir, nativeHostName+".json")
+		if err := os.WriteFile(path, append(manifest, '\n'), 0644); err != nil {
+			return err
+		}
+		log.Printf("✅ Registered the native messaging host for %s", dir)
+		registered++
+	}
+	if registered == 0 {
+		return fmt.Errorf("no Chromium-based browser profile found in ~/.config (tried %s)", strings.Join(nativeHostDirs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package plumb
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunInit(t *testing.T) {
+	bin := t.TempDir()
+	for name, script := range map[string]string{
+		"firefox": "",
+		"mpv":     "",
+		"zathura": "",
+		"flatpak": "echo com.brave.Browser\necho org.mozilla.firefox\n",
+		"snap":    "echo 'Name Version Rev'\necho chromium 120 1\n",
+	} {
+		os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script), 0755)
+	}
+	t.Setenv("PATH", bin)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".config", "chromium"), 0755)
+
+	configPath := filepath.Join(home, ".config", "browser-pipes", "plumber.yaml")
+	if err := Run([]string{"-config", configPath, "init", "--extension-id", "abcdef"}, nil, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := string(data)
+	for _, want := range []string{
+		"# Browsers found: firefox (PATH) chromium (snap) brave (flatpak)",
+		`browser: "firefox"`,
+		`flatpak: "com.brave.Browser"`,
+		`snap: "chromium"`,
+		"      - play_video:",
+		"      - open_pdf:\n          schemes: [file]",
+		"      - open_firefox:\n          match: \".*\"",
+		"      # - open_brave:",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("expected %q in the config:\n%s", want, config)
+		}
+	}
+	if strings.Contains(config, "add_torrent") || strings.Contains(config, "download_video") {
+		t.Errorf("expected no jobs for tools that are missing:\n%s", config)
+	}
+	if err := Run([]string{"-config", configPath, "validate"}, nil, io.Discard, io.Discard); err != nil {
+		t.Errorf("expected the generated config to validate: %v", err)
+	}
+
+	var manifest struct {
+		Name           string   `json:"name"`
+		Path           string   `json:"path"`
+		AllowedOrigins []string `json:"allowed_origins"`
+	}
+	data, err = os.ReadFile(filepath.Join(home, ".config", "chromium", "NativeMessagingHosts", nativeHostName+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Name != nativeHostName || manifest.Path == "" || manifest.AllowedOrigins[0] != "chrome-extension://abcdef/" {
+		t.Errorf("unexpected manifest: %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".config", "google-chrome")); err == nil {
+		t.Error("expected no manifest for browsers that are not set up")
+	}
+
+	if err := Run([]string{"-config", configPath, "init"}, nil, io.Discard, io.Discard); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected an existing config to be kept, got %v", err)
+	}
+}
+
+func TestStarterConfigWithoutBrowsers(t *testing.T) {
+	data, err := starterConfig(nil, map[string]bool{"yt-dlp": true, "go-read-md": true, "aria2c": true}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "open_default:\n          match:") {
+		t.Errorf("expected xdg-open as the catch-all:\n%s", data)
+	}
+}
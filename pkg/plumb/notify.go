@@ -0,0 +1,189 @@
+package plumb
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+// NotifySettings raise a desktop notification when a job fails, so a
+// snapshot that was never saved does not go unnoticed for weeks. Clicking
+// it opens the failure log or runs the job again.
+type NotifySettings struct {
+	OnFailure bool   `yaml:"on_failure" json:"on_failure,omitempty" jsonschema:"description=Notify with notify-send when a job fails or times out"`
+	OnClick   string `yaml:"on_click" json:"on_click,omitempty" jsonschema:"enum=log,enum=rerun,description=What clicking the notification does: log opens the failure log and rerun runs the job on the URL again (default: log)"`
+}
+
+func (n NotifySettings) validate() error {
+	switch n.OnClick {
+	case "", "log", "rerun":
+		return nil
+	}
+	return fmt.Errorf("settings.notify.on_click must be log or rerun")
+}
+
+// notifyScript shows the notification and runs its arguments after the
+// title, body and action label when it is clicked. notify-send before
+// libnotify 0.7.9 has no --action; the notification then has no action.
+const notifyScript = `title=$1 body=$2 label=$3
+shift 3
+action=$(notify-send --app-name=plumber --urgency=critical --action="default=$label" --wait "$title" "$body") ||
+	exec notify-send --app-name=plumber --urgency=critical "$title" "$body"
+[ "$action" = default ] && exec "$@"`
+
+// failedOutputSize is how much of a failing step's stderr is kept for the
+// failure log.
+const failedOutputSize = 8 * 1024
+
+// notifyFailure writes the failure log of job and raises the notification
+// unless settings.notify.on_failure is off. The notification waits for a
+// click in the background; plumber does not.
+func (c *Config) notifyFailure(rs *routeState, job, url string, err error) {
+	if !c.Settings.Notify.OnFailure {
+		return
+	}
+	what := "failed"
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(rs.context().Err(), context.DeadlineExceeded) {
+		what = "timed out"
+	}
+	logPath, logErr := c.writeFailureLog(rs, job, url, what, err)
+	if logErr != nil {
+		log.Printf("   ⚠️ Failed to write the failure log: %v", logErr)
+	}
+	if _, err := exec.LookPath("notify-send"); err != nil {
+		log.Printf("   ⚠️ Cannot notify of the failure: notify-send is not installed")
+		return
+	}
+
+	label, action := "Open log", []string{"xdg-open", logPath}
+	if c.Settings.Notify.OnClick == "rerun" && c.plumber != "" && c.path != "" {
+		label, action = "Re-run", []string{c.plumber, "--config", c.path, "rerun", "--job", job, url}
+	} else if logPath == "" {
+		label, action = "Dismiss", []string{"true"}
+	}
+	title := fmt.Sprintf("plumber: job %s %s", job, what)
+	body := html.EscapeString(url + "\n" + err.Error())
+	args := append([]string{"-c", notifyScript, "plumber-notify", title, body, label}, action...)
+	cmd := exec.Command("sh", args...)
+	if err := cmd.Start(); err != nil {
+		c.logCommand(rs, cmd, url, err)
+		log.Printf("   ⚠️ Cannot notify of the failure: %v", err)
+		return
+	}
+	c.logCommand(rs, cmd, url, nil)
+	go cmd.Wait()
+	log.Printf("   🔔 Notified that job %s %s", job, what)
+}
+
+// writeFailureLog writes what is known of a failed job to a file of its own
+// in the failures folder next to the history file, and returns its path.
+func (c *Config) writeFailureLog(rs *routeState, job, url, what string, err error) (string, error) {
+	if c.dataDir() == "" {
+		return "", fmt.Errorf("no data folder")
+	}
+	dir := filepath.Join(c.dataDir(), "failures")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Job:   %s (%s)\n", job, what)
+	fmt.Fprintf(&b, "URL:   %s\n", url)
+	fmt.Fprintf(&b, "Time:  %s\n", now.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Error: %v\n", err)
+	if rs.failedOutput != "" {
+		fmt.Fprintf(&b, "\nOutput of the failed step:\n%s\n", strings.TrimRight(rs.failedOutput, "\n"))
+	}
+	if c.plumber != "" && c.path != "" {
+		fmt.Fprintf(&b, "\nRun it again with:\n%s --config %s rerun --job %s %s\n", c.plumber, shellQuote(c.path), shellQuote(job), shellQuote(url))
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.log", now.Format("20060102-150405"), hashURL(url)))
+	return path, os.WriteFile(path, []byte(b.String()), 0600)
+}
+
+// dataDir is the folder of the history file, whether or not the history is
+// enabled, where plumber keeps its other logs too.
+func (c *Config) dataDir() string {
+	path := expandHome(c.Settings.History.Path)
+	if path == "" {
+		var err error
+		if path, err = history.DefaultPath(); err != nil {
+			return ""
+		}
+	}
+	return filepath.Dir(path)
+}
+
+// tailWriter keeps the last failedOutputSize bytes written to it.
+type tailWriter struct {
+	buf []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - failedOutputSize; over > 0 {
+		t.buf = t.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (t *tailWriter) String() string {
+	return string(t.buf)
+}
+
+// runRerun implements "plumber rerun": it runs one job on a URL, with the
+// parameters of the workflow job ref that matches the URL if any, and
+// records it in the history. Failure notifications run it when clicked.
+func runRerun(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("rerun", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	name := fs.String("job", "", "Job to run (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || fs.NArg() != 1 {
+		return fmt.Errorf("usage: plumber rerun --job <name> <url>")
+	}
+	url := fs.Arg(0)
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("configuration is invalid: %w", err)
+	}
+	job, ok := cfg.Jobs[*name]
+	if !ok {
+		return fmt.Errorf("job %s not found", *name)
+	}
+
+	params := map[string]string{"tags": strings.Join(cfg.tagsFor(url), ",")}
+	for _, wf := range cfg.Workflows {
+		for _, jobRef := range wf.Jobs {
+			if jobRef.Name == *name && jobRef.matchesURL(url) {
+				for k, v := range jobRef.Params {
+					params[k] = v
+				}
+				params["tags"] = strings.Join(cfg.tagsFor(url, jobRef.Tags...), ",")
+			}
+		}
+	}
+
+	log.Printf("🔁 Running job %s on %s", *name, url)
+	start := time.Now()
+	err := runJob(cfg, newRouteState(context.Background(), "rerun"), *name, job, params, url, "")
+	recordRoute(cfg, Envelope{Origin: "rerun", URL: url}, url, []string{*name}, time.Since(start), err)
+	updateFeed(cfg)
+	if err != nil {
+		return fmt.Errorf("job %s failed: %w", *name, err)
+	}
+	log.Printf("✅ Job %s succeeded", *name)
+	return nil
+}
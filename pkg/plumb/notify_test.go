@@ -0,0 +1,161 @@
+package plumb
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"browser-pipes/internal/history"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeNotifier puts a notify-send that records its arguments and reports a
+// click, and an xdg-open that records what it opens, first in PATH.
+func fakeNotifier(t *testing.T) (notified, opened string) {
+	bin := t.TempDir()
+	notified, opened = filepath.Join(bin, "notified"), filepath.Join(bin, "opened")
+	scripts := map[string]string{
+		"notify-send": "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + notified + ".tmp && mv " + notified + ".tmp " + notified + "\necho default\n",
+		"xdg-open":    "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + opened + ".tmp && mv " + opened + ".tmp " + opened + "\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return notified, opened
+}
+
+func TestNotifyFailure(t *testing.T) {
+	notified, opened := fakeNotifier(t)
+	dir := t.TempDir()
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(`
+version: "2"
+settings:
+  history:
+    path: "`+filepath.Join(dir, "history.db")+`"
+  notify:
+    on_failure: true
+jobs:
+  save:
+    steps:
+      - run: "echo 'cannot reach example.com' >&2; exit 3"
+workflows:
+  main:
+    jobs:
+      - save
+`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := route(context.Background(), &cfg, Envelope{URL: "https://example.com/?a=1&b=2"}); err == nil {
+		t.Fatal("expected the route to fail")
+	}
+
+	// The last arguments are the title and the body, the URL and the error.
+	args := strings.Split(strings.TrimSpace(string(waitForFile(notified))), "\n")
+	if !strings.Contains(strings.Join(args, " "), "--action=default=Open log") {
+		t.Errorf("expected an open log action, got %q", args)
+	}
+	if got := args[len(args)-3]; got != "plumber: job save failed" {
+		t.Errorf("expected the job in the title, got %q", got)
+	}
+	if got := args[len(args)-2]; got != "https://example.com/?a=1&amp;b=2" {
+		t.Errorf("expected the escaped URL in the body, got %q", got)
+	}
+
+	logPath := strings.TrimSpace(string(waitForFile(opened)))
+	if filepath.Dir(logPath) != filepath.Join(dir, "failures") {
+		t.Fatalf("expected the failure log in %s, got %s", filepath.Join(dir, "failures"), logPath)
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Job:   save (failed)", "URL:   https://example.com/?a=1&b=2", "exit status 3", "cannot reach example.com"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in the failure log, got:\n%s", want, data)
+		}
+	}
+}
+
+func TestNotifyFailure_Rerun(t *testing.T) {
+	notified, _ := fakeNotifier(t)
+	cfg := Config{Settings: Settings{
+		History: HistorySettings{Path: filepath.Join(t.TempDir(), "history.db")},
+		Notify:  NotifySettings{OnFailure: true, OnClick: "rerun"},
+	}}
+	// Without the plumber binary the log is opened instead.
+	cfg.notifyFailure(&routeState{}, "save", "https://example.com/", io.ErrUnexpectedEOF)
+	if args := string(waitForFile(notified)); !strings.Contains(args, "--action=default=Open log") {
+		t.Errorf("expected an open log action, got %q", args)
+	}
+
+	os.Remove(notified)
+	cfg.plumber, cfg.path = "/bin/true", "/tmp/plumber.yaml"
+	cfg.notifyFailure(&routeState{}, "save", "https://example.com/", io.ErrUnexpectedEOF)
+	if args := string(waitForFile(notified)); !strings.Contains(args, "--action=default=Re-run") {
+		t.Errorf("expected a re-run action, got %q", args)
+	}
+}
+
+func TestRunRerun(t *testing.T) {
+	dir := t.TempDir()
+	historyPath := filepath.Join(dir, "history.db")
+	configPath := filepath.Join(dir, "plumber.yaml")
+	os.WriteFile(configPath, []byte(`
+version: "2"
+settings:
+  history:
+    enabled: true
+    path: "`+historyPath+`"
+jobs:
+  save:
+    steps:
+      - run: "echo '<< parameters.folder >> << parameters.url >>' >> '`+filepath.Join(dir, "saved")+`'"
+workflows:
+  main:
+    jobs:
+      - save:
+          match: "example\\.com"
+          folder: articles
+`), 0644)
+
+	if err := Run([]string{"-config", configPath, "rerun", "--job", "save", "https://example.com/a"}, nil, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "saved")); string(data) != "articles https://example.com/a\n" {
+		t.Errorf("expected the job ref's parameters, got %q", data)
+	}
+	entries, err := history.Read(historyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Origin != "rerun" || entries[0].Jobs[0] != "save" {
+		t.Errorf("expected the rerun in the history, got %+v", entries)
+	}
+
+	if err := Run([]string{"-config", configPath, "rerun", "--job", "nope", "https://example.com/a"}, nil, io.Discard, io.Discard); err == nil {
+		t.Error("expected an unknown job to fail")
+	}
+	if err := Run([]string{"-config", configPath, "rerun", "https://example.com/a"}, nil, io.Discard, io.Discard); err == nil {
+		t.Error("expected a missing --job to fail")
+	}
+}
+
+func TestTailWriter(t *testing.T) {
+	var w tailWriter
+	w.Write([]byte(strings.Repeat("a", failedOutputSize)))
+	w.Write([]byte("end"))
+	if s := w.String(); len(s) != failedOutputSize || !strings.HasSuffix(s, "aend") {
+		t.Errorf("expected the last %d bytes, got %d ending in %q", failedOutputSize, len(s), s[len(s)-4:])
+	}
+}
@@ -0,0 +1,403 @@
+package plumb
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+// snapshotAssetRe matches the local image links of go-read-md
+// --download-images in markdown and HTML snapshots.
+var snapshotAssetRe = regexp.MustCompile(`assets/([^\s)"'>/]+)`)
+
+// pruneUnit is one snapshot on disk: the files of the latest history entry
+// that wrote them.
+type pruneUnit struct {
+	entry  history.Entry
+	files  []string
+	size   int64
+	keep   bool
+	reason string // why it is pruned: "age" or "size"; "" to keep it
+}
+
+// runPrune implements "plumber prune": it applies settings.retention to the
+// snapshots in the history, deletes or archives the ones past it together
+// with images no other snapshot uses, and updates the history so the feed,
+// dedup and export never point at a pruned file.
+func runPrune(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "History file (default: settings.history.path or ~/.local/share/browser-pipes/history.db)")
+	dryRun := fs.Bool("dry-run", false, "Only list the snapshots that would be pruned")
+	archive := fs.String("archive", cfg.Settings.Retention.Archive, "Move pruned snapshots to this folder instead of deleting them (default: settings.retention.archive)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cfg.Settings.Retention.validate(); err != nil {
+		return err
+	}
+	r := cfg.Settings.Retention
+	if r.MaxAge == "" && r.MaxSize == "" && len(r.Tags) == 0 {
+		return fmt.Errorf("nothing to prune: set settings.retention max_age, max_size or tags")
+	}
+
+	path, err := historyFile(cfg, *file)
+	if err != nil {
+		return err
+	}
+	entries, err := history.Read(path)
+	if err != nil {
+		return err
+	}
+
+	units := pruneUnits(entries, cfg.snapshotFolders())
+	selectPruned(units, r, time.Now())
+
+	var pruned []*pruneUnit
+	var freed int64
+	for i := range units {
+		if units[i].reason != "" {
+			pruned = append(pruned, &units[i])
+			freed += units[i].size
+		}
+	}
+	if len(pruned) == 0 {
+		log.Printf("✅ Nothing to prune among %d snapshots", len(units))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REASON\tSIZE\tSAVED\tURL")
+	for _, u := range pruned {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", u.reason, formatBytes(float64(u.size)), u.entry.Time.Local().Format("2006-01-02"), u.entry.URL)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if *dryRun {
+		log.Printf("🧹 Would prune %d of %d snapshots (%s)", len(pruned), len(units), formatBytes(float64(freed)))
+		return nil
+	}
+
+	root := expandHome(cfg.Settings.Snapshot.Folder)
+	moved := make(map[string]string) // pruned file -> archived path, "" when deleted
+	for _, u := range pruned {
+		assets := assetRefs(u.files)
+		for _, f := range u.files {
+			dst, err := pruneFile(f, root, expandHome(*archive))
+			if err != nil {
+				return err
+			}
+			moved[f] = dst
+		}
+		for _, a := range assets {
+			if !inFolders(a, cfg.snapshotFolders()) || referenced(filepath.Dir(filepath.Dir(a)), filepath.Base(a)) {
+				continue
+			}
+			if _, err := pruneFile(a, root, expandHome(*archive)); err != nil {
+				log.Printf("   ⚠️ Failed to prune %s: %v", a, err)
+			}
+		}
+	}
+
+	if _, err := history.Rewrite(path, func(e *history.Entry) bool {
+		changed := false
+		var files []string
+		for _, f := range e.Files {
+			dst, ok := moved[f]
+			if !ok {
+				files = append(files, f)
+				continue
+			}
+			changed = true
+			if dst != "" {
+				files = append(files, dst)
+			}
+		}
+		if changed {
+			e.Files = files
+		}
+		return changed
+	}); err != nil {
+		return err
+	}
+	updateFeed(cfg)
+
+	verb := "Deleted"
+	if *archive != "" {
+		verb = "Archived"
+	}
+	log.Printf("🧹 %s %d of %d snapshots (%s)", verb, len(pruned), len(units), formatBytes(float64(freed)))
+	return nil
+}
+
+// pruneUnits returns the snapshots still on disk in folders, oldest first. A
+// file that was overwritten (go-read-md --dedup overwrite) belongs to its
+// latest entry. Files outside folders are left alone: the history may name
+// anything a job wrote, such as a note in a vault.
+func pruneUnits(entries []history.Entry, folders []string) []pruneUnit {
+	latest := make(map[string]int)
+	for i, e := range entries {
+		if e.Kind == history.KindSnapshot && e.Status == history.StatusSuccess {
+			for _, f := range e.Files {
+				latest[f] = i
+			}
+		}
+	}
+
+	var units []pruneUnit
+	for i, e := range entries {
+		u := pruneUnit{entry: e}
+		for _, f := range e.Files {
+			if latest[f] != i {
+				continue
+			}
+			if !inFolders(f, folders) {
+				log.Printf("   ⚠️ Not pruning %s: it is outside the snapshot folders", f)
+				continue
+			}
+			if info, err := os.Stat(f); err == nil {
+				u.files = append(u.files, f)
+				u.size += info.Size()
+			}
+		}
+		if len(u.files) > 0 {
+			units = append(units, u)
+		}
+	}
+	slices.SortStableFunc(units, func(a, b pruneUnit) int { return a.entry.Time.Compare(b.entry.Time) })
+	return units
+}
+
+// snapshotFolders returns the folders prune may delete from:
+// settings.snapshot.folder and the snapshot_folder of every workflow job.
+func (c *Config) snapshotFolders() []string {
+	var folders []string
+	add := func(dir string) {
+		if dir = expandHome(dir); dir != "" && !slices.Contains(folders, dir) {
+			folders = append(folders, dir)
+		}
+	}
+	add(c.Settings.Snapshot.Folder)
+	for _, name := range slices.Sorted(maps.Keys(c.Workflows)) {
+		for _, jobRef := range c.Workflows[name].Jobs {
+			add(jobRef.Params["snapshot_folder"])
+		}
+	}
+	return folders
+}
+
+// inFolders reports whether f lies in one of folders once symlinks are
+// resolved, so a link in a snapshot folder does not lead prune elsewhere.
+func inFolders(f string, folders []string) bool {
+	resolved, err := filepath.EvalSymlinks(filepath.Dir(f))
+	if err != nil {
+		return false
+	}
+	resolved = filepath.Join(resolved, filepath.Base(f))
+	for _, dir := range folders {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectPruned sets the reason of every unit past the retention: first by
+// age, then the oldest ones until the rest fits in max_size. Units with a
+// kept tag are never pruned.
+func selectPruned(units []pruneUnit, r RetentionSettings, now time.Time) {
+	var total int64
+	for i := range units {
+		u := &units[i]
+		maxAge, keep := r.maxAgeFor(u.entry.Tags)
+		u.keep = keep
+		if !keep && maxAge > 0 && now.Sub(u.entry.Time) > maxAge {
+			u.reason = "age"
+			continue
+		}
+		total += u.size
+	}
+
+	maxSize, _ := parseSize(r.MaxSize)
+	for i := range units {
+		if maxSize <= 0 || total <= maxSize {
+			return
+		}
+		if u := &units[i]; u.reason == "" && !u.keep {
+			u.reason = "size"
+			total -= u.size
+		}
+	}
+}
+
+// maxAgeFor returns the age limit of a snapshot with tags (0 for none) and
+// whether it is kept. The most lenient matching tag rule wins over max_age.
+func (r RetentionSettings) maxAgeFor(tags []string) (time.Duration, bool) {
+	matched := false
+	var limit time.Duration
+	for _, t := range r.Tags {
+		if !slices.Contains(tags, t.Tag) {
+			continue
+		}
+		if t.Keep {
+			return 0, true
+		}
+		age, _ := parseAge(t.MaxAge)
+		if !matched || age == 0 || (limit > 0 && age > limit) {
+			limit = age
+		}
+		matched = true
+	}
+	if matched {
+		return limit, false
+	}
+	age, _ := parseAge(r.MaxAge)
+	return age, false
+}
+
+// assetRefs returns the downloaded images the markdown and HTML files link
+// to, as paths next to them.
+func assetRefs(files []string) []string {
+	var assets []string
+	for _, f := range files {
+		if ext := filepath.Ext(f); ext != ".md" && ext != ".html" {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		for _, m := range snapshotAssetRe.FindAllStringSubmatch(string(data), -1) {
+			a := filepath.Join(filepath.Dir(f), "assets", m[1])
+			if !slices.Contains(assets, a) {
+				assets = append(assets, a)
+			}
+		}
+	}
+	return assets
+}
+
+// referenced reports whether a snapshot left in dir still links to the
+// image name. Encrypted snapshots cannot be searched, so their images are
+// always kept.
+func referenced(dir, name string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return true
+	}
+	for _, e := range entries {
+		switch filepath.Ext(e.Name()) {
+		case ".age":
+			return true
+		case ".md", ".html":
+			data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil || strings.Contains(string(data), "assets/"+name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pruneFile deletes f, or moves it into archive keeping its path relative
+// to the snapshot folder, and returns where it went ("" when deleted).
+func pruneFile(f, root, archive string) (string, error) {
+	if archive == "" {
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to delete %s: %w", f, err)
+		}
+		return "", nil
+	}
+
+	rel := filepath.Base(f)
+	if root != "" {
+		if r, err := filepath.Rel(root, f); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+		}
+	}
+	dst := filepath.Join(archive, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive folder: %w", err)
+	}
+	if err := os.Rename(f, dst); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return "", fmt.Errorf("failed to archive %s: %w", f, err)
+		}
+		// The archive is on another disk: copy, then delete.
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return "", fmt.Errorf("failed to archive %s: %w", f, err)
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return "", fmt.Errorf("failed to archive %s: %w", f, err)
+		}
+		if err := os.Remove(f); err != nil {
+			return "", fmt.Errorf("failed to delete %s: %w", f, err)
+		}
+	}
+	if abs, err := filepath.Abs(dst); err == nil {
+		dst = abs
+	}
+	return dst, nil
+}
+
+// parseAge parses a retention age: a number of days ("365d") or a Go
+// duration ("720h").
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return d, nil
+}
+
+// parseSize parses a size such as "500MB", "1.5GB" or "2G" (1024-based).
+func parseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := 1.0
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if rest, ok := strings.CutSuffix(s, unit); ok {
+			s = rest
+			mult = float64(int64(1) << (10 * (i + 1)))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * mult), nil
+}
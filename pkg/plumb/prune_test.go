@@ -0,0 +1,192 @@
+package plumb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	folder := filepath.Join(dir, "ReadLater")
+	historyPath := filepath.Join(dir, "history.db")
+	os.MkdirAll(filepath.Join(folder, "assets"), 0755)
+
+	write := func(name, content string) string {
+		p := filepath.Join(folder, name)
+		os.WriteFile(p, []byte(content), 0644)
+		return p
+	}
+	old := write("old.md", "# Old\n![chart](assets/chart.png)\n![logo](assets/logo.png)\n")
+	kept := write("kept.md", "# Kept\n![logo](assets/logo.png)\n")
+	recent := write("recent.md", "# Recent\n")
+	write("assets/chart.png", "png")
+	write("assets/logo.png", "png")
+
+	now := time.Now()
+	for _, e := range []history.Entry{
+		{Kind: history.KindSnapshot, Time: now.AddDate(-2, 0, 0), URL: "https://a.com/old", Status: history.StatusSuccess, Files: []string{old}},
+		{Kind: history.KindSnapshot, Time: now.AddDate(-2, 0, 0), URL: "https://a.com/kept", Status: history.StatusSuccess, Tags: []string{"reference"}, Files: []string{kept}},
+		{Kind: history.KindSnapshot, Time: now, URL: "https://a.com/recent", Status: history.StatusSuccess, Files: []string{recent}},
+	} {
+		if err := history.Append(historyPath, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &Config{Settings: Settings{
+		Snapshot:  SnapshotSettings{Folder: folder},
+		Retention: RetentionSettings{MaxAge: "365d", Tags: []TagRetention{{Tag: "reference", Keep: true}}},
+	}}
+
+	var stdout bytes.Buffer
+	if err := runPrune([]string{"--file", historyPath, "--dry-run"}, cfg, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "https://a.com/old") || strings.Contains(stdout.String(), "https://a.com/kept") {
+		t.Errorf("expected only the old snapshot listed, got:\n%s", stdout.String())
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Fatal("expected --dry-run to keep the files")
+	}
+
+	archive := filepath.Join(dir, "archive")
+	if err := runPrune([]string{"--file", historyPath, "--archive", archive}, cfg, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected the old snapshot to be moved")
+	}
+	if _, err := os.Stat(filepath.Join(archive, "old.md")); err != nil {
+		t.Error("expected the old snapshot in the archive")
+	}
+	if _, err := os.Stat(filepath.Join(archive, "assets", "chart.png")); err != nil {
+		t.Error("expected the image only the old snapshot used to be archived with it")
+	}
+	if _, err := os.Stat(filepath.Join(folder, "assets", "logo.png")); err != nil {
+		t.Error("expected the image a kept snapshot uses to stay")
+	}
+
+	entries, _ := history.Read(historyPath)
+	if len(entries) != 3 || len(entries[0].Files) != 1 || entries[0].Files[0] != filepath.Join(archive, "old.md") {
+		t.Errorf("expected the history to point at the archived file, got %+v", entries[0])
+	}
+	if entries[1].Files[0] != kept {
+		t.Errorf("expected other entries untouched, got %+v", entries[1])
+	}
+
+	// Delete once the folder is over max_size: the oldest unkept snapshot goes.
+	cfg.Settings.Retention = RetentionSettings{MaxSize: "10B", Tags: []TagRetention{{Tag: "reference", Keep: true}}}
+	if err := runPrune([]string{"--file", historyPath}, cfg, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(recent); !os.IsNotExist(err) {
+		t.Error("expected the recent snapshot deleted to fit max_size")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Error("expected the kept snapshot to survive max_size")
+	}
+	entries, _ = history.Read(historyPath)
+	if len(entries[2].Files) != 0 {
+		t.Errorf("expected the deleted file dropped from the history, got %+v", entries[2])
+	}
+}
+
+func TestRetentionMaxAgeFor(t *testing.T) {
+	r := RetentionSettings{MaxAge: "30d", Tags: []TagRetention{
+		{Tag: "news", MaxAge: "7d"},
+		{Tag: "longform", MaxAge: "730d"},
+		{Tag: "reference", Keep: true},
+	}}
+	day := 24 * time.Hour
+	for _, tc := range []struct {
+		tags []string
+		age  time.Duration
+		keep bool
+	}{
+		{nil, 30 * day, false},
+		{[]string{"news"}, 7 * day, false},
+		{[]string{"news", "longform"}, 730 * day, false},
+		{[]string{"news", "reference"}, 0, true},
+	} {
+		age, keep := r.maxAgeFor(tc.tags)
+		if age != tc.age || keep != tc.keep {
+			t.Errorf("maxAgeFor(%v) = %v, %v; want %v, %v", tc.tags, age, keep, tc.age, tc.keep)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{"512": 512, "10B": 10, "500MB": 500 << 20, "1.5GB": 3 << 29, "2G": 2 << 30, "1TiB": 1 << 40} {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"lots", "-1GB", "GB"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestPrune_OutsideSnapshotFolders(t *testing.T) {
+	dir := t.TempDir()
+	folder := filepath.Join(dir, "ReadLater")
+	recipes := filepath.Join(dir, "recipes")
+	vault := filepath.Join(dir, "vault")
+	historyPath := filepath.Join(dir, "history.db")
+	for _, d := range []string{folder, recipes, vault} {
+		os.MkdirAll(d, 0755)
+	}
+	os.Symlink(vault, filepath.Join(folder, "vault"))
+
+	write := func(p string) string {
+		os.WriteFile(p, []byte("# Old\n"), 0644)
+		return p
+	}
+	snapshot := write(filepath.Join(folder, "old.md"))
+	recipe := write(filepath.Join(recipes, "soup.md"))
+	note := write(filepath.Join(vault, "note.md"))
+	linked := write(filepath.Join(vault, "linked.md"))
+
+	old := time.Now().AddDate(-2, 0, 0)
+	for _, e := range []history.Entry{
+		{Kind: history.KindSnapshot, Time: old, URL: "https://a.com/old", Status: history.StatusSuccess, Files: []string{snapshot, note}},
+		{Kind: history.KindSnapshot, Time: old, URL: "https://a.com/soup", Status: history.StatusSuccess, Files: []string{recipe}},
+		{Kind: history.KindSnapshot, Time: old, URL: "https://a.com/linked", Status: history.StatusSuccess, Files: []string{filepath.Join(folder, "vault", "linked.md")}},
+	} {
+		if err := history.Append(historyPath, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &Config{
+		Settings: Settings{
+			Snapshot:  SnapshotSettings{Folder: folder},
+			Retention: RetentionSettings{MaxAge: "365d"},
+		},
+		Workflows: map[string]Workflow{"main": {Jobs: []WorkflowJob{{Name: "snapshot", Params: map[string]string{"snapshot_folder": recipes}}}}},
+	}
+	if err := runPrune([]string{"--file", historyPath}, cfg, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{snapshot, recipe} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be pruned", f)
+		}
+	}
+	for _, f := range []string{note, linked} {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("expected %s outside the snapshot folders to stay", f)
+		}
+	}
+	entries, _ := history.Read(historyPath)
+	if len(entries[0].Files) != 1 || entries[0].Files[0] != note {
+		t.Errorf("expected the history to keep the file left alone, got %+v", entries[0])
+	}
+}
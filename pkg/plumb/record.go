@@ -0,0 +1,60 @@
+package plumb
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Recorded is a line of a plumber --record file: an envelope received from
+// the browser and the response plumber sent back. mocker replays these
+// files, sending the envelopes again.
+type Recorded struct {
+	Time     time.Time `json:"time"`
+	Envelope Envelope  `json:"envelope"`
+	Response Response  `json:"response"`
+}
+
+// recorder appends Recorded lines to a JSONL file.
+type recorder struct {
+	f *os.File
+}
+
+// openRecorder opens path for appending, creating it and its folder.
+func openRecorder(path string) (*recorder, error) {
+	path = expandHome(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	return &recorder{f: f}, nil
+}
+
+// record appends env and resp. A nil recorder records nothing, and failing
+// to record never fails the message.
+func (r *recorder) record(env Envelope, resp Response) {
+	if r == nil {
+		return
+	}
+	line, err := json.Marshal(Recorded{Time: time.Now(), Envelope: env, Response: resp})
+	if err != nil {
+		log.Printf("   ⚠️ Failed to record envelope: %v", err)
+		return
+	}
+	if _, err := r.f.Write(append(line, '\n')); err != nil {
+		log.Printf("   ⚠️ Failed to record envelope: %v", err)
+	}
+}
+
+func (r *recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.f.Close()
+}
@@ -0,0 +1,68 @@
+package plumb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMainRun_Record(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	os.WriteFile(configPath, []byte(`
+version: "2"
+jobs:
+  default:
+    steps:
+      - run: "true"
+workflows:
+  main:
+    jobs:
+      - default:
+          match: "example\\.com"
+`), 0644)
+	recordPath := filepath.Join(tmpDir, "sessions", "record.jsonl")
+
+	var stdin bytes.Buffer
+	for _, env := range []Envelope{
+		{ID: "1", URL: "https://example.com/?utm_source=x", Origin: "test"},
+		{ID: "2", URL: "https://other.org/", Origin: "test", Target: "nowhere"},
+	} {
+		msg, _ := json.Marshal(env)
+		binary.Write(&stdin, binary.LittleEndian, uint32(len(msg)))
+		stdin.Write(msg)
+	}
+	if err := Run([]string{"-config", configPath, "-record", recordPath, "run"}, &stdin, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(recordPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []Recorded
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Recorded
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, r)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 recorded envelopes, got %d", len(lines))
+	}
+	// The envelope is recorded as the browser sent it, before cleaning.
+	if lines[0].Envelope.URL != "https://example.com/?utm_source=x" || lines[0].Response.Status != "success" || lines[0].Time.IsZero() {
+		t.Errorf("unexpected first line %+v", lines[0])
+	}
+	if lines[1].Envelope.Target != "nowhere" || lines[1].Response.Status != "error" {
+		t.Errorf("unexpected second line %+v", lines[1])
+	}
+}
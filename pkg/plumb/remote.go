@@ -0,0 +1,199 @@
+package plumb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// remoteTimeout bounds a whole conversation with a running browser.
+const remoteTimeout = 5 * time.Second
+
+// remoteAddr turns a port such as "9222" into a local address, and leaves
+// host:port alone.
+func remoteAddr(addr string) string {
+	if _, err := strconv.Atoi(addr); err == nil {
+		return net.JoinHostPort("127.0.0.1", addr)
+	}
+	return addr
+}
+
+// openRemote opens url in a tab of an already running browser instead of
+// starting one: through the DevTools protocol of a Chromium started with
+// --remote-debugging-port (cdp), or through Marionette in a Firefox started
+// with --marionette. window is new, background (a tab that does not take
+// the focus), or tab, current and "" for a focused tab.
+func openRemote(cdp, marionette, url, window string) (string, error) {
+	switch window {
+	case "", "current", "tab", "new", "background":
+	default:
+		return "", fmt.Errorf("open step has invalid window '%s' (use new, tab, background or current)", window)
+	}
+	if cdp != "" {
+		addr := remoteAddr(cdp)
+		if err := openCDP(addr, url, window); err != nil {
+			return "", fmt.Errorf("DevTools on %s: %w", addr, err)
+		}
+		return "Chromium on " + addr, nil
+	}
+	addr := remoteAddr(marionette)
+	if err := openMarionette(addr, url, window); err != nil {
+		return "", fmt.Errorf("Marionette on %s: %w", addr, err)
+	}
+	return "Firefox on " + addr, nil
+}
+
+// openCDP creates the tab with Target.createTarget on the browser's own
+// DevTools target, found through /json/version.
+func openCDP(addr, url, window string) error {
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Get("http://" + addr + "/json/version")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil || version.WebSocketDebuggerURL == "" {
+		return fmt.Errorf("no browser target in /json/version")
+	}
+
+	// Chromium only accepts this origin when started with
+	// --remote-allow-origins.
+	ws, err := websocket.Dial(version.WebSocketDebuggerURL, "", "http://127.0.0.1/")
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(remoteTimeout))
+
+	req := map[string]any{
+		"id":     1,
+		"method": "Target.createTarget",
+		"params": map[string]any{"url": url, "newWindow": window == "new", "background": window == "background"},
+	}
+	if err := websocket.JSON.Send(ws, req); err != nil {
+		return err
+	}
+	for {
+		var msg struct {
+			ID    int `json:"id"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return err
+		}
+		if msg.ID != 1 {
+			continue // an event
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("Target.createTarget: %s", msg.Error.Message)
+		}
+		return nil
+	}
+}
+
+// marionetteConn speaks the Marionette protocol: length-prefixed JSON
+// packets, with commands sent as [0, id, name, params] and answered as
+// [1, id, error, result].
+type marionetteConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	nextID int
+}
+
+func (m *marionetteConn) read() (json.RawMessage, error) {
+	size, err := m.r.ReadString(':')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, ":"))
+	if err != nil || n < 0 || n > 1<<20 {
+		return nil, fmt.Errorf("invalid packet length %q", size)
+	}
+	packet := make([]byte, n)
+	if _, err := io.ReadFull(m.r, packet); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+func (m *marionetteConn) call(name string, params any, result any) error {
+	m.nextID++
+	data, err := json.Marshal([]any{0, m.nextID, name, params})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(m.conn, "%d:%s", len(data), data); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	packet, err := m.read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	var reply []json.RawMessage
+	if err := json.Unmarshal(packet, &reply); err != nil || len(reply) != 4 {
+		return fmt.Errorf("%s: invalid reply %s", name, packet)
+	}
+	var failure *struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(reply[2], &failure); err == nil && failure != nil {
+		return fmt.Errorf("%s: %s: %s", name, failure.Error, failure.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply[3], result)
+}
+
+// openMarionette opens a tab (or window) in a WebDriver session, navigates
+// it without waiting for the page to load, and ends the session, which
+// leaves the tab open.
+func openMarionette(addr, url, window string) error {
+	conn, err := net.DialTimeout("tcp", addr, remoteTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(remoteTimeout))
+
+	m := &marionetteConn{conn: conn, r: bufio.NewReader(conn)}
+	if _, err := m.read(); err != nil { // the greeting
+		return err
+	}
+	if err := m.call("WebDriver:NewSession", map[string]any{
+		"capabilities": map[string]any{"alwaysMatch": map[string]any{"pageLoadStrategy": "none"}},
+	}, nil); err != nil {
+		return err
+	}
+	defer m.call("WebDriver:DeleteSession", map[string]any{}, nil)
+
+	kind, focus := "tab", window != "background"
+	if window == "new" {
+		kind = "window"
+	}
+	var created struct {
+		Handle string `json:"handle"`
+	}
+	if err := m.call("WebDriver:NewWindow", map[string]any{"type": kind, "focus": focus}, &created); err != nil {
+		return err
+	}
+	if err := m.call("WebDriver:SwitchToWindow", map[string]any{"handle": created.Handle, "focus": focus}, nil); err != nil {
+		return err
+	}
+	return m.call("WebDriver:Navigate", map[string]any{"url": url}, nil)
+}
@@ -0,0 +1,181 @@
+package plumb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// fakeCDP emulates the browser target of a Chromium DevTools endpoint and
+// records the parameters of Target.createTarget.
+func fakeCDP(t *testing.T, created chan<- map[string]any) *httptest.Server {
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+	mux.HandleFunc("/json/version", func(w http.ResponseWriter, r *http.Request) {
+		wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/devtools/browser/1"
+		fmt.Fprintf(w, `{"Browser":"Chrome/140.0","webSocketDebuggerUrl":%q}`, wsURL)
+	})
+	mux.Handle("/devtools/browser/1", websocket.Handler(func(ws *websocket.Conn) {
+		var req struct {
+			ID     int            `json:"id"`
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+		}
+		if err := websocket.JSON.Receive(ws, &req); err != nil {
+			return
+		}
+		if req.Method != "Target.createTarget" {
+			t.Errorf("unexpected method %s", req.Method)
+		}
+		created <- req.Params
+		websocket.Message.Send(ws, `{"method":"Target.targetCreated","params":{}}`)
+		websocket.Message.Send(ws, fmt.Sprintf(`{"id":%d,"result":{"targetId":"T1"}}`, req.ID))
+	}))
+	ts = httptest.NewServer(mux)
+	return ts
+}
+
+// fakeMarionette accepts one connection and records the commands it gets.
+func fakeMarionette(t *testing.T, commands chan<- string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		send := func(v any) {
+			data, _ := json.Marshal(v)
+			fmt.Fprintf(conn, "%d:%s", len(data), data)
+		}
+		send(map[string]any{"applicationType": "gecko", "marionetteProtocol": 3})
+		r := bufio.NewReader(conn)
+		for {
+			size, err := r.ReadString(':')
+			if err != nil {
+				close(commands)
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSuffix(size, ":"))
+			packet := make([]byte, n)
+			io.ReadFull(r, packet)
+			var cmd []json.RawMessage
+			json.Unmarshal(packet, &cmd)
+			var id int
+			var name string
+			json.Unmarshal(cmd[1], &id)
+			json.Unmarshal(cmd[2], &name)
+			commands <- name + " " + string(cmd[3])
+
+			var result any = map[string]any{"value": nil}
+			if name == "WebDriver:NewWindow" {
+				result = map[string]any{"handle": "42", "type": "tab"}
+			}
+			send([]any{1, id, nil, result})
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestOpenCDP(t *testing.T) {
+	created := make(chan map[string]any, 1)
+	ts := fakeCDP(t, created)
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	step := Step{Name: "open", Params: map[string]string{"cdp": addr}}
+	name, err := executeOpen(&Config{}, &routeState{}, step, map[string]string{"window": "background"}, "https://example.com/", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Chromium on "+addr {
+		t.Errorf("expected the DevTools endpoint to be reported, got %q", name)
+	}
+	params := <-created
+	if params["url"] != "https://example.com/" || params["background"] != true || params["newWindow"] != false {
+		t.Errorf("unexpected Target.createTarget parameters %v", params)
+	}
+}
+
+func TestOpenMarionette(t *testing.T) {
+	commands := make(chan string, 10)
+	addr := fakeMarionette(t, commands)
+
+	step := Step{Name: "open", Params: map[string]string{"marionette": addr, "window": "background"}}
+	if _, err := executeOpen(&Config{}, &routeState{}, step, map[string]string{}, "https://example.com/", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for c := range commands {
+		got = append(got, c)
+	}
+	want := []string{
+		`WebDriver:NewSession {"capabilities":{"alwaysMatch":{"pageLoadStrategy":"none"}}}`,
+		`WebDriver:NewWindow {"focus":false,"type":"tab"}`,
+		`WebDriver:SwitchToWindow {"focus":false,"handle":"42"}`,
+		`WebDriver:Navigate {"url":"https://example.com/"}`,
+		`WebDriver:DeleteSession {}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected commands\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestOpenRemoteFallback(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() // nothing listens there any more
+
+	bin := t.TempDir()
+	argsFile := filepath.Join(bin, "args")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + ".tmp && mv " + argsFile + ".tmp " + argsFile + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "firefox"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// Firefox is started when Marionette is not reachable; a started
+	// browser cannot open a background tab, so it opens a new one.
+	step := Step{Name: "open", Params: map[string]string{"marionette": addr, "browser": "firefox", "window": "background"}}
+	name, err := executeOpen(&Config{}, &routeState{}, step, map[string]string{}, "https://example.com/", t.TempDir())
+	if err != nil || name != "firefox" {
+		t.Fatalf("expected firefox to be started, got %q, %v", name, err)
+	}
+	if data := waitForFile(argsFile); string(data) != "--new-tab\nhttps://example.com/\n" {
+		t.Errorf("expected a new tab, got %q", data)
+	}
+
+	delete(step.Params, "browser")
+	if _, err := executeOpen(&Config{}, &routeState{}, step, map[string]string{}, "https://example.com/", t.TempDir()); err == nil || !strings.Contains(err.Error(), "Marionette on "+addr) {
+		t.Errorf("expected the unreachable Marionette to be reported, got %v", err)
+	}
+
+	step.Params["private"] = "true"
+	if _, err := executeOpen(&Config{}, &routeState{}, step, map[string]string{}, "https://example.com/", t.TempDir()); err == nil || !strings.Contains(err.Error(), "running browser") {
+		t.Errorf("expected private to be rejected with a running browser, got %v", err)
+	}
+	if _, err := openRemote("9222", "", "https://example.com/", "popup"); err == nil {
+		t.Error("expected an invalid window to be rejected")
+	}
+	if got := remoteAddr("9222"); got != "127.0.0.1:9222" {
+		t.Errorf("expected a port to be local, got %s", got)
+	}
+}
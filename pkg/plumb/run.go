@@ -0,0 +1,437 @@
+package plumb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Message Structures ---
+
+type Envelope struct {
+	ID        string `json:"id"`
+	Origin    string `json:"origin"`
+	URL       string `json:"url"`
+	Target    string `json:"target"`
+	Timestamp int64  `json:"timestamp"`
+	HTML      string `json:"html,omitempty"` // Optional HTML content for paywalled articles
+}
+
+// Run is the plumber command line: it runs the subcommand in args, by
+// default the native messaging host reading stdin.
+func Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("plumber", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	recordPath := fs.String("record", "", "Append every received envelope and its response to this JSONL file, which mocker can replay")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cmd := "run"
+	if fs.NArg() > 0 {
+		cmd = fs.Arg(0)
+	}
+
+	log.SetOutput(stderr)
+	log.SetFlags(0)
+
+	if cmd == "schema" {
+		fmt.Fprintln(stdout, GenerateJSONSchema())
+		return nil
+	}
+
+	if cmd == "init" {
+		return runInit(fs.Args()[1:], *configPath, stdout, stderr)
+	}
+
+	if cmd == "selftest" {
+		return runSelftest(fs.Args()[1:], stdout, stderr)
+	}
+
+	if cmd == "bench" {
+		return runBench(fs.Args()[1:], stdout, stderr)
+	}
+
+	log.Println("🔧 Plumber started...")
+
+	var cfg Config
+	if err := loadConfig(*configPath, &cfg, stderr); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg.plumber, _ = os.Executable()
+
+	if cmd == "validate" {
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration is invalid: %w", err)
+		}
+		log.Println("✅ Configuration is valid.")
+		return nil
+	}
+
+	if cmd == "run" {
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration is invalid: %w", err)
+		}
+		var rec *recorder
+		if *recordPath != "" {
+			var err error
+			if rec, err = openRecorder(*recordPath); err != nil {
+				return err
+			}
+			defer rec.Close()
+			log.Printf("⏺️ Recording envelopes to %s", *recordPath)
+		}
+		startLoop(stdin, stdout, &cfg, rec)
+		return nil
+	}
+
+	if cmd == "history" {
+		return runHistory(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "rerun" {
+		return runRerun(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "commands" {
+		return runCommands(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "stats" {
+		return runStats(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "search" {
+		return runSearch(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "feed" {
+		return runFeed(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "watch" {
+		return runWatch(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "audit" {
+		return runAudit(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "export" {
+		return runExport(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "decrypt" {
+		return runDecrypt(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	if cmd == "prune" {
+		return runPrune(fs.Args()[1:], &cfg, stdout, stderr)
+	}
+
+	return fmt.Errorf("unknown command: %s. usage: plumber [run|validate|schema|init|selftest|bench|history|stats|commands|rerun|search|feed|watch|audit|export|decrypt|prune]", cmd)
+}
+
+func loadConfig(explicitPath string, cfg *Config, stderr io.Writer) error {
+	var configPath string
+	if explicitPath != "" {
+		configPath = explicitPath
+	} else {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		configPath = filepath.Join(homeDir, ".config", "browser-pipes", "plumber.yaml")
+	}
+
+	log.Printf("📂 Loading config from: %s", configPath)
+
+	f, err := os.Open(configPath)
+	if err != nil {
+		return fmt.Errorf("could not open config file at %s: %w", configPath, err)
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(cfg); err != nil {
+		return fmt.Errorf("could not decode config: %w", err)
+	}
+	cfg.path, _ = filepath.Abs(configPath)
+
+	if cfg.Version == "" {
+		return fmt.Errorf("invalid config: missing 'version' (must be '2')")
+	}
+
+	return nil
+}
+
+// maxMessageSize is the largest native messaging message plumber reads.
+// Browsers send at most 64 MiB, but envelopes are a URL and at most a page
+// of HTML.
+const maxMessageSize = 10 * 1024 * 1024
+
+// Codes of the error responses to messages plumber could not read. A
+// response without a code comes from routing the envelope.
+const (
+	codeBadFrame = "bad_frame"      // the stream ended inside a header or body
+	codeTooLarge = "too_large"      // the message is over maxMessageSize and was skipped
+	codeEmpty    = "empty_message"  // a zero-length message
+	codeBadUTF8  = "bad_utf8"       // the message is not valid UTF-8
+	codeBadJSON  = "bad_json"       // the message is not a JSON envelope
+	codeInternal = "internal_error" // routing the envelope panicked
+)
+
+// startLoop reads framed envelopes from stdin and answers each until stdin
+// is closed. A message it cannot read gets an error response with a code
+// and the loop goes on with the next one; only a stream that ends inside a
+// frame, or fails, stops it.
+func startLoop(stdin io.Reader, stdout io.Writer, cfg *Config, rec *recorder) {
+	for {
+		var header [4]byte
+		n, err := io.ReadFull(stdin, header[:])
+		if err == io.EOF {
+			log.Println("🔌 Stdin closed, exiting.")
+			return
+		}
+		if err == io.ErrUnexpectedEOF {
+			log.Printf("❌ Stdin closed inside a message header (%d of 4 bytes)", n)
+			sendError(codeBadFrame, fmt.Sprintf("Truncated message header (%d of 4 bytes)", n), stdout)
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Error reading header: %v", err)
+			return
+		}
+
+		length := binary.LittleEndian.Uint32(header[:])
+		if length > maxMessageSize {
+			log.Printf("❌ Message too large: %d bytes (limit: %d)", length, maxMessageSize)
+			sendError(codeTooLarge, fmt.Sprintf("Message too large: %d bytes (limit: %d)", length, maxMessageSize), stdout)
+			if _, err := io.CopyN(io.Discard, stdin, int64(length)); err != nil {
+				log.Printf("❌ Error skipping message body: %v", err)
+				return
+			}
+			continue
+		}
+
+		msg := make([]byte, length)
+		if n, err := io.ReadFull(stdin, msg); err != nil {
+			log.Printf("❌ Error reading message body (%d of %d bytes): %v", n, length, err)
+			if err == io.ErrUnexpectedEOF || err == io.EOF {
+				sendError(codeBadFrame, fmt.Sprintf("Truncated message body (%d of %d bytes)", n, length), stdout)
+			}
+			return
+		}
+
+		env, code, err := decodeEnvelope(msg)
+		if err != nil {
+			log.Printf("❌ Invalid message: %v", err)
+			sendError(code, fmt.Sprintf("Invalid message: %v", err), stdout)
+			continue
+		}
+
+		rec.record(env, handleMessage(env, stdout, cfg))
+	}
+}
+
+// decodeEnvelope parses a message into an envelope, or returns the code of
+// the error response and the reason it cannot.
+func decodeEnvelope(msg []byte) (Envelope, string, error) {
+	var env Envelope
+	switch {
+	case len(msg) == 0:
+		return env, codeEmpty, fmt.Errorf("empty")
+	case !utf8.Valid(msg):
+		return env, codeBadUTF8, fmt.Errorf("not valid UTF-8")
+	}
+	if err := json.Unmarshal(msg, &env); err != nil {
+		return env, codeBadJSON, fmt.Errorf("not a JSON envelope: %v", err)
+	}
+	return env, "", nil
+}
+
+// handleMessage routes env and answers the browser, returning the response.
+// A panic while routing is answered as an internal error instead of
+// taking the host down.
+func handleMessage(env Envelope, stdout io.Writer, cfg *Config) (resp Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("❌ Routing %q panicked: %v", env.URL, r)
+			resp = sendError(codeInternal, fmt.Sprintf("Internal error: %v", r), stdout)
+		}
+	}()
+	res, err := route(context.Background(), cfg, env)
+	if err != nil {
+		return sendResponse("error", res.Message, stdout)
+	}
+	return sendResponse("success", res.Message, stdout)
+}
+
+// Result is what routing a URL did.
+type Result struct {
+	URL     string   // the URL as routed, after cleaning
+	Jobs    []string // the jobs that ran, including the one that failed
+	Opened  []string // the browsers open steps used
+	Message string   // the response the extension gets
+}
+
+// routeState is what handling one URL keeps track of. route creates one
+// and passes it down to the jobs and steps it runs, so that the Config
+// stays as it was loaded.
+type routeState struct {
+	ctx          context.Context // cancels the route, see Engine.Route
+	origin       string          // origin of the URL, for the command log
+	job          string          // job running, for the command log
+	opened       []string        // browsers the open steps used
+	trace        *tracer         // spans of the route, see startTrace
+	failedOutput string          // end of the stderr of the step that failed last, see runJob
+}
+
+// newRouteState returns the state of a route of a URL from origin, which
+// ctx cancels.
+func newRouteState(ctx context.Context, origin string) *routeState {
+	return &routeState{ctx: ctx, origin: origin}
+}
+
+// context returns the context of the route.
+func (rs *routeState) context() context.Context {
+	if rs.ctx == nil {
+		return context.Background()
+	}
+	return rs.ctx
+}
+
+// route runs env through cfg: the URL is prepared, checked against the
+// file allowlist and the blocklist, its jobs run, and the route is
+// recorded in the history and the feed. Cancelling ctx stops it.
+func route(ctx context.Context, cfg *Config, env Envelope) (Result, error) {
+	log.Printf("[%s] [%s] -> [%s] : [%s]",
+		time.Unix(env.Timestamp, 0).Format(time.RFC3339),
+		env.Origin,
+		env.Target,
+		env.URL,
+	)
+
+	originalURL := env.URL
+	cleanedURL := cfg.prepareURL(env.URL, env.HTML)
+	if cleanedURL != env.URL {
+		log.Printf("   Let's clean that up: %s -> %s", env.URL, cleanedURL)
+	}
+	env.URL = cleanedURL
+
+	resolved, err := cfg.checkFileURL(env.URL)
+	if err != nil {
+		log.Printf("   🚫 Refused %s: %v", env.URL, err)
+		recordRoute(cfg, env, originalURL, nil, 0, err)
+		return Result{URL: env.URL, Message: fmt.Sprintf("Refused: %v", err)}, err
+	}
+	env.URL = resolved
+
+	rule := cfg.blockRule(originalURL, env.URL)
+	if rule != nil && rule.action() == blockDrop {
+		log.Printf("   🚫 Blocked %s: %s", env.URL, rule.reason())
+		err := fmt.Errorf("blocked: %s", rule.reason())
+		recordRoute(cfg, env, originalURL, nil, 0, err)
+		return Result{URL: env.URL, Message: fmt.Sprintf("Blocked: %s", rule.reason())}, err
+	}
+
+	var jobs []string
+	rs := newRouteState(ctx, env.Origin)
+	message, warning := "Workflow executed", ""
+	start := time.Now()
+	root := cfg.startTrace(rs, env)
+	switch {
+	case rule != nil && rule.action() == blockJob:
+		log.Printf("   🚫 Blocked %s: %s; running job %s", env.URL, rule.reason(), rule.Job)
+		jobs, err = []string{rule.Job}, runBlockJob(cfg, rs, rule.Job, env.URL, env.HTML)
+		message = fmt.Sprintf("Blocked: %s; ran job %s", rule.reason(), rule.Job)
+	default:
+		if rule != nil {
+			log.Printf("   ⚠️ Blocklist warning for %s: %s", env.URL, rule.reason())
+			warning = rule.reason()
+		}
+		jobs, err = executeWorkflow(cfg, rs, env.URL, env.HTML)
+	}
+	recordRoute(cfg, env, originalURL, jobs, time.Since(start), err)
+	cfg.finishTrace(rs, root, err)
+	updateFeed(cfg)
+
+	res := Result{URL: env.URL, Jobs: jobs, Opened: rs.opened}
+	if err != nil {
+		log.Printf("   ❌ Workflow Execution Failed: %v", err)
+		res.Message = fmt.Sprintf("Workflow failed: %v", err)
+		return res, err
+	}
+	if len(rs.opened) > 0 {
+		message += fmt.Sprintf(" (opened in %s)", strings.Join(rs.opened, ", "))
+	}
+	if warning != "" {
+		message += ". Warning: " + warning
+	}
+	res.Message = message
+	return res, nil
+}
+
+// prepareURL turns the URL the browser sent into the one plumber routes.
+// Redirect pages are unwrapped before short links are resolved, as
+// l.facebook.com/l.php often carries a bit.ly link; then AMP copies are
+// replaced by their article, and the result is cleaned and normalized.
+// With settings.frontends.global it is then moved to its privacy frontend.
+func (c *Config) prepareURL(rawURL, html string) string {
+	rawURL = c.unshortenURL(c.Settings.Cleaning.UnwrapRedirects(rawURL))
+	rawURL = c.ampCanonical(rawURL, html)
+	return c.applyFrontends(c.normalizeURL(c.cleanURL(rawURL)))
+}
+
+// cleanURL unwraps outbound redirects and applies settings.cleaning to
+// rawURL (see urlclean.CleaningSettings.Clean).
+func (c *Config) cleanURL(rawURL string) string {
+	providers, err := c.clearURLProviders()
+	if err != nil {
+		log.Printf("   ⚠️ %v", err)
+	}
+	return c.Settings.Cleaning.Clean(providers, rawURL)
+}
+
+type Response struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"` // why a message could not be handled, for error responses
+}
+
+func sendResponse(status, message string, stdout io.Writer) Response {
+	return writeResponse(Response{Status: status, Message: message}, stdout)
+}
+
+// sendError answers a message plumber could not handle.
+func sendError(code, message string, stdout io.Writer) Response {
+	return writeResponse(Response{Status: "error", Message: message, Code: code}, stdout)
+}
+
+func writeResponse(resp Response, stdout io.Writer) Response {
+	bytes, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("❌ Failed to marshal response: %v", err)
+		return resp
+	}
+
+	if err := binary.Write(stdout, binary.LittleEndian, uint32(len(bytes))); err != nil {
+		log.Printf("❌ Failed to write response length: %v", err)
+		return resp
+	}
+
+	if _, err := stdout.Write(bytes); err != nil {
+		log.Printf("❌ Failed to write response body: %v", err)
+	}
+	return resp
+}
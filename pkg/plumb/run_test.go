@@ -0,0 +1,257 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMainRun(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "plumber-main-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	validConfigPath := filepath.Join(tmpDir, "valid.yaml")
+	validConfig := `
+version: "2"
+jobs:
+  default:
+    steps:
+      - run: "echo hello"
+workflows:
+  main:
+    jobs:
+      - default:
+          match: ".*"
+`
+	os.WriteFile(validConfigPath, []byte(validConfig), 0644)
+
+	t.Run("Command: schema", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		err := Run([]string{"schema"}, nil, stdout, io.Discard)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if !strings.Contains(stdout.String(), "\"$schema\"") {
+			t.Errorf("expected JSON schema in output, got %q", stdout.String())
+		}
+	})
+
+	t.Run("Command: validate success", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		err := Run([]string{"-config", validConfigPath, "validate"}, nil, io.Discard, stderr)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if !strings.Contains(stderr.String(), "✅ Configuration is valid.") {
+			t.Errorf("expected success message, got %q", stderr.String())
+		}
+	})
+
+	t.Run("Command: validate failure (missing version)", func(t *testing.T) {
+		invalidConfigPath := filepath.Join(tmpDir, "invalid.yaml")
+		os.WriteFile(invalidConfigPath, []byte("jobs: {}"), 0644)
+
+		err := Run([]string{"-config", invalidConfigPath, "validate"}, nil, io.Discard, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "missing 'version'") {
+			t.Errorf("expected validation error, got %v", err)
+		}
+	})
+
+	t.Run("Native Messaging Loop", func(t *testing.T) {
+		// Prepare a mock message
+		msg := Envelope{
+			URL:       "https://example.com?utm_source=test",
+			Timestamp: 1679800000,
+			Origin:    "test",
+		}
+		msgBytes, _ := json.Marshal(msg)
+
+		var stdin bytes.Buffer
+		binary.Write(&stdin, binary.LittleEndian, uint32(len(msgBytes)))
+		stdin.Write(msgBytes)
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+
+		// Run with the valid config
+		// Note: This will execute the workflow. Since it's a mock test,
+		// we just want to see it process one message and exit when stdin closes.
+		err := Run([]string{"-config", validConfigPath, "run"}, &stdin, stdout, stderr)
+		if err != nil {
+			t.Errorf("run failed: %v", err)
+		}
+
+		// Check if it cleaned the URL in the logs
+		if !strings.Contains(stderr.String(), "Let's clean that up") {
+			t.Errorf("expected URL cleaning log, got %q", stderr.String())
+		}
+
+		// Check if it sent a response
+		if stdout.Len() < 4 {
+			t.Fatal("no response sent to stdout")
+		}
+		var respLen uint32
+		binary.Read(stdout, binary.LittleEndian, &respLen)
+		respBytes := make([]byte, respLen)
+		stdout.Read(respBytes)
+
+		var resp Response
+		json.Unmarshal(respBytes, &resp)
+		if resp.Status != "success" {
+			t.Errorf("expected success status, got %q (message: %q)", resp.Status, resp.Message)
+		}
+	})
+}
+
+func TestMainRun_History(t *testing.T) {
+	tmpDir := t.TempDir()
+	historyPath := filepath.Join(tmpDir, "history.db")
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	os.WriteFile(configPath, []byte(`
+version: "2"
+settings:
+  history:
+    enabled: true
+    path: "`+historyPath+`"
+jobs:
+  default:
+    steps:
+      - run: "test -n '<<parameters.history_file>>'"
+workflows:
+  main:
+    jobs:
+      - default
+`), 0644)
+
+	msgBytes, _ := json.Marshal(Envelope{URL: "https://example.com/?fbclid=1", Origin: "test", Target: "toggle"})
+	var stdin bytes.Buffer
+	binary.Write(&stdin, binary.LittleEndian, uint32(len(msgBytes)))
+	stdin.Write(msgBytes)
+
+	if err := Run([]string{"-config", configPath, "run"}, &stdin, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := Run([]string{"-config", configPath, "history", "--target", "toggle"}, nil, stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "success") || !strings.Contains(stdout.String(), "https://example.com/") {
+		t.Errorf("expected routed URL in history output, got %q", stdout.String())
+	}
+}
+
+func TestCleanURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://example.com", "https://example.com"},
+		{"https://example.com?utm_source=news", "https://example.com"},
+		{"https://example.com?fbclid=123&keep=me", "https://example.com?keep=me"},
+		{"invalid-url", "invalid-url"},
+		{"https://example.com?utm_id=7&b=2&a=1", "https://example.com?a=1&b=2"},
+		{"https://example.com?b=2&a=1", "https://example.com?b=2&a=1"},
+	}
+
+	cfg := &Config{}
+	for _, tt := range tests {
+		actual := cfg.cleanURL(tt.input)
+		if actual != tt.expected {
+			t.Errorf("cleanURL(%q) = %q, want %q", tt.input, actual, tt.expected)
+		}
+	}
+}
+
+func TestCleanURLRules(t *testing.T) {
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(`
+version: "2"
+settings:
+  cleaning:
+    params: ["utm_*", igshid]
+    domains:
+      - domains: [youtube.com, youtu.be]
+        params: [si, pp]
+      - domains: [amazon.com]
+        keep_only: [k]
+`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://www.youtube.com/watch?v=abc&si=xyz&utm_source=share", "https://www.youtube.com/watch?v=abc"},
+		{"https://youtu.be/abc?si=xyz", "https://youtu.be/abc"},
+		{"https://www.instagram.com/p/abc/?igshid=1", "https://www.instagram.com/p/abc/"},
+		{"https://example.com/?si=1&fbclid=2", "https://example.com/?si=1&fbclid=2"},
+		{"https://www.amazon.com/s?k=go&crid=1&sprefix=go", "https://www.amazon.com/s?k=go"},
+	}
+	for _, tt := range tests {
+		if actual := cfg.cleanURL(tt.input); actual != tt.expected {
+			t.Errorf("cleanURL(%q) = %q, want %q", tt.input, actual, tt.expected)
+		}
+	}
+}
+
+func TestHandleMessage_Panic(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	// A nil config makes routing panic.
+	resp := handleMessage(Envelope{URL: "https://example.com/"}, stdout, nil)
+	if resp.Status != "error" || resp.Code != codeInternal {
+		t.Errorf("expected an internal error response, got %+v", resp)
+	}
+	if stdout.Len() == 0 {
+		t.Error("expected the response to be sent")
+	}
+}
+
+// FuzzStartLoop feeds arbitrary bytes to the native messaging loop, which
+// must return and answer only with well-formed responses.
+func FuzzStartLoop(f *testing.F) {
+	for _, tc := range selftestCases() {
+		if len(tc.stdin) < 1<<16 {
+			f.Add(tc.stdin)
+		}
+	}
+	f.Add(binary.LittleEndian.AppendUint32(nil, maxMessageSize+1))
+	f.Add(frame([]byte(`{"url":"file:///etc/passwd","html":"<link rel=canonical href=x>"}`)))
+	f.Add(frame([]byte(`null`)))
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	cfg := &Config{Version: "2"}
+	f.Fuzz(func(t *testing.T, stdin []byte) {
+		var stdout bytes.Buffer
+		startLoop(bytes.NewReader(stdin), &stdout, cfg, nil)
+		for stdout.Len() > 0 {
+			var length uint32
+			if err := binary.Read(&stdout, binary.LittleEndian, &length); err != nil || int(length) > stdout.Len() {
+				t.Fatalf("malformed response frame (%v)", err)
+			}
+			var resp Response
+			if err := json.Unmarshal(stdout.Next(int(length)), &resp); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if resp.Status != "success" && resp.Status != "error" {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package plumb
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// webSchemes are what a job ref applies to unless it lists its own schemes.
+// URLs without a scheme count as web URLs.
+var webSchemes = []string{"http", "https"}
+
+var schemeName = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// urlScheme returns the lowercased scheme of rawURL, or "" when it has none.
+func urlScheme(rawURL string) string {
+	u := parseURL(rawURL)
+	if u == nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// isWebURL reports whether rawURL is an http(s) URL, or has no scheme.
+// mailto:, magnet:, tel: and geo: URLs are not: their query is not form
+// encoded and cleaning must leave it alone.
+func isWebURL(rawURL string) bool {
+	scheme := urlScheme(rawURL)
+	return scheme == "" || slices.Contains(webSchemes, scheme)
+}
+
+// matchesScheme reports whether rawURL has one of the job ref's schemes, or
+// is a web URL when it lists none.
+func (wj WorkflowJob) matchesScheme(rawURL string) bool {
+	if len(wj.Schemes) == 0 {
+		return isWebURL(rawURL)
+	}
+	scheme := urlScheme(rawURL)
+	return slices.ContainsFunc(wj.Schemes, func(s string) bool { return strings.EqualFold(s, scheme) })
+}
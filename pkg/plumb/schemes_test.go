@@ -0,0 +1,76 @@
+package plumb
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSchemeRouting(t *testing.T) {
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(`
+version: "2"
+jobs:
+  mail: {steps: [{run: "true"}]}
+  torrent: {steps: [{run: "true"}]}
+  browser: {steps: [{run: "true"}]}
+workflows:
+  main:
+    jobs:
+      - mail:
+          schemes: [mailto]
+      - torrent:
+          schemes: [MAGNET]
+          match: "btih"
+      - browser:
+          match: ".*"
+`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		jobs []string
+	}{
+		{"mailto:me@example.com?subject=Hi", []string{"mail"}},
+		{"magnet:?xt=urn:btih:abc&dn=Linux+ISO", []string{"torrent"}},
+		{"magnet:?xt=urn:sha1:abc", nil},
+		{"tel:+15551234", nil},
+		{"https://example.com/", []string{"browser"}},
+		{"example.com/page", []string{"browser"}},
+	}
+	refs := cfg.Workflows["main"].Jobs
+	for _, tt := range tests {
+		var got []string
+		for _, ref := range refs {
+			if ref.matchesURL(tt.url) {
+				got = append(got, ref.Name)
+			}
+		}
+		if len(got) != len(tt.jobs) || (len(got) > 0 && got[0] != tt.jobs[0]) {
+			t.Errorf("%s: expected %v, got %v", tt.url, tt.jobs, got)
+		}
+	}
+
+	cfg.Workflows["main"].Jobs[0].Schemes = []string{"mail to"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an invalid scheme to be rejected")
+	}
+}
+
+func TestCleanURLSchemes(t *testing.T) {
+	cfg := &Config{}
+	for _, raw := range []string{
+		"mailto:me@example.com?subject=Hello%20there&body=a+b&utm_source=x",
+		"magnet:?xt=urn:btih:abc&dn=Linux+ISO&tr=udp%3A%2F%2Ftracker.example%3A80&ref=site",
+		"geo:37.78,-122.41?z=12",
+		"tel:+1-555-123",
+	} {
+		if got := cfg.prepareURL(raw, ""); got != raw {
+			t.Errorf("expected %q untouched, got %q", raw, got)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package plumb
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"browser-pipes/internal/history"
+	"browser-pipes/internal/search"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+// runSearch implements "plumber search": it refreshes the full-text index
+// over all markdown snapshots known to the history log (plus any --dir) and
+// prints the best matches for the query.
+func runSearch(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var dirs stringList
+	fs.Var(&dirs, "dir", "Also index markdown files in this directory (repeatable)")
+	file := fs.String("file", "", "History file listing the snapshots to index")
+	limit := fs.Int("limit", 10, "Maximum number of results")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		return fmt.Errorf("missing query. usage: plumber search [--dir DIR] <query>")
+	}
+
+	historyPath, err := historyFile(cfg, *file)
+	if err != nil {
+		return err
+	}
+	entries, err := history.Query(historyPath, history.Filter{Kind: history.KindSnapshot})
+	if err != nil {
+		return err
+	}
+
+	var sources []search.Source
+	for _, e := range entries {
+		for _, f := range e.Files {
+			if strings.EqualFold(filepath.Ext(f), ".md") {
+				sources = append(sources, search.Source{Path: f, Title: e.Title, URL: e.URL})
+			}
+		}
+	}
+	for _, dir := range dirs {
+		found, err := search.WalkDir(expandHome(dir))
+		if err != nil {
+			return err
+		}
+		sources = append(sources, found...)
+	}
+
+	indexPath := filepath.Join(filepath.Dir(historyPath), "search.idx")
+	idx := search.Load(indexPath)
+	updated, err := idx.Refresh(sources)
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		log.Printf("🗂️ Indexed %d new or changed snapshot(s)", updated)
+	}
+	if err := idx.Save(indexPath); err != nil {
+		log.Printf("⚠️ Failed to save search index: %v", err)
+	}
+
+	results := idx.Search(query, *limit)
+	if len(results) == 0 {
+		log.Printf("🔍 No snapshots match %q (%d indexed)", query, len(idx.Docs))
+		return nil
+	}
+
+	for i, r := range results {
+		fmt.Fprintf(stdout, "%d. %s\n", i+1, r.Doc.Title)
+		if r.Doc.URL != "" {
+			fmt.Fprintf(stdout, "   %s\n", r.Doc.URL)
+		}
+		fmt.Fprintf(stdout, "   %s\n", r.Doc.Path)
+		if r.Snippet != "" {
+			fmt.Fprintf(stdout, "   %s\n", r.Snippet)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package plumb
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"browser-pipes/internal/history"
+)
+
+func TestRunSearch(t *testing.T) {
+	dir := t.TempDir()
+	historyPath := filepath.Join(dir, "data", "history.db")
+	cfg := &Config{Settings: Settings{History: HistorySettings{Path: historyPath}}}
+
+	snap := filepath.Join(dir, "rust.md")
+	os.WriteFile(snap, []byte("# Ownership\n\nRust ownership and borrowing explained.\n"), 0644)
+	history.Append(historyPath, history.Entry{
+		Kind:   history.KindSnapshot,
+		URL:    "https://doc.rust-lang.org/book",
+		Title:  "The Book: Ownership",
+		Status: history.StatusSuccess,
+		Files:  []string{snap, filepath.Join(dir, "rust.warc")},
+	})
+
+	extra := filepath.Join(dir, "library")
+	os.MkdirAll(extra, 0755)
+	os.WriteFile(filepath.Join(extra, "old.md"), []byte("# Old Note\n\nborrowing a ladder from the neighbours\n"), 0644)
+
+	t.Run("History snapshots", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		if err := runSearch([]string{"ownership"}, cfg, stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		out := stdout.String()
+		for _, want := range []string{"1. The Book: Ownership", "https://doc.rust-lang.org/book", snap, "Rust ownership and borrowing"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected %q in output:\n%s", want, out)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "data", "search.idx")); err != nil {
+			t.Errorf("expected index next to the history file: %v", err)
+		}
+	})
+
+	t.Run("Extra directory", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		if err := runSearch([]string{"--dir", extra, "borrowing"}, cfg, stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(stdout.String(), "Old Note") || !strings.Contains(stdout.String(), "Ownership") {
+			t.Errorf("expected matches from both sources, got:\n%s", stdout.String())
+		}
+	})
+
+	t.Run("No matches", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		if err := runSearch([]string{"zebra"}, cfg, stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("expected no output, got %q", stdout.String())
+		}
+	})
+
+	t.Run("Missing query", func(t *testing.T) {
+		err := runSearch(nil, cfg, io.Discard, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "missing query") {
+			t.Errorf("expected usage error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// selftestConfig routes https://selftest.example/ URLs to a job that
+// appends them to the routed file, and nothing else.
+const selftestConfig = `version: "2"
+jobs:
+  record:
+    steps:
+      - run: "echo '<< parameters.url >>' >> '%s'"
+workflows:
+  main:
+    jobs:
+      - record:
+          match: "^https://selftest\\.example/"
+`
+
+// selftestCase is one native messaging session fed to the loop: the raw
+// bytes on stdin, the responses expected in order (the status, and the
+// code after a colon for messages plumber could not read), and the URLs
+// the workflow should have routed.
+type selftestCase struct {
+	name      string
+	stdin     []byte
+	responses []string
+	routed    []string
+}
+
+// frame returns msg with its native messaging length header.
+func frame(msg []byte) []byte {
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(msg))), msg...)
+}
+
+// envelopeFrame returns env as a framed message.
+func envelopeFrame(env Envelope) []byte {
+	msg, _ := json.Marshal(env)
+	return frame(msg)
+}
+
+func selftestCases() []selftestCase {
+	valid := envelopeFrame(Envelope{ID: "1", Origin: "selftest", URL: "https://selftest.example/a?utm_source=selftest"})
+	oversized := append(binary.LittleEndian.AppendUint32(nil, maxMessageSize+1), make([]byte, maxMessageSize+1)...)
+	truncated := append(binary.LittleEndian.AppendUint32(nil, 100), `{"url":"https://selftest.example/`...)
+	badUTF8 := frame([]byte("{\"url\":\"https://selftest.example/\xff\"}"))
+
+	return []selftestCase{
+		{"valid envelope", valid, []string{"success"}, []string{"https://selftest.example/a"}},
+		{"several envelopes", append(slices.Clone(valid), envelopeFrame(Envelope{ID: "2", Origin: "selftest", URL: "https://selftest.example/b"})...),
+			[]string{"success", "success"}, []string{"https://selftest.example/a", "https://selftest.example/b"}},
+		// Targets are hints from the extension; workflows decide the route.
+		{"unknown target", envelopeFrame(Envelope{ID: "3", Origin: "selftest", URL: "https://selftest.example/c", Target: "no-such-target"}),
+			[]string{"success"}, []string{"https://selftest.example/c"}},
+		{"unmatched URL", envelopeFrame(Envelope{ID: "4", Origin: "selftest", URL: "https://elsewhere.example/"}), []string{"error"}, nil},
+		{"empty URL", envelopeFrame(Envelope{ID: "5", Origin: "selftest"}), []string{"error"}, nil},
+		// A message plumber cannot read is answered and the next one still is.
+		{"malformed JSON", append(frame([]byte(`{"url": "https://selftest.example/`)), valid...),
+			[]string{"error:" + codeBadJSON, "success"}, []string{"https://selftest.example/a"}},
+		{"not an envelope", append(frame([]byte(`["https://selftest.example/"]`)), valid...),
+			[]string{"error:" + codeBadJSON, "success"}, []string{"https://selftest.example/a"}},
+		{"zero-length message", append(frame(nil), valid...), []string{"error:" + codeEmpty, "success"}, []string{"https://selftest.example/a"}},
+		{"invalid UTF-8", append(badUTF8, valid...), []string{"error:" + codeBadUTF8, "success"}, []string{"https://selftest.example/a"}},
+		{"oversized message", append(oversized, valid...), []string{"error:" + codeTooLarge, "success"}, []string{"https://selftest.example/a"}},
+		{"empty stream", nil, nil, nil},
+		{"truncated message", truncated, []string{"error:" + codeBadFrame}, nil},
+		{"partial header", []byte{0x10, 0x00}, []string{"error:" + codeBadFrame}, nil},
+	}
+}
+
+// runSelftest implements "plumber selftest": it runs the native messaging
+// loop with a temporary config on synthetic sessions, including malformed
+// and oversized frames, and reports which behave as expected. It touches
+// neither the user's config nor their history.
+func runSelftest(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	verbose := fs.Bool("verbose", false, "Show plumber's log for each case")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "plumber-selftest-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "plumber.yaml")
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(selftestConfig, filepath.Join(dir, "routed"))), 0600); err != nil {
+		return err
+	}
+
+	logs := io.Discard
+	if *verbose {
+		logs = stderr
+	}
+	log.SetOutput(logs)
+	defer log.SetOutput(stderr)
+
+	var cfg Config
+	if err := loadConfig(configPath, &cfg, logs); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("selftest config is invalid: %w", err)
+	}
+
+	cases := selftestCases()
+	failed := 0
+	for _, tc := range cases {
+		if err := runSelftestCase(&cfg, filepath.Join(dir, "routed"), tc); err != nil {
+			failed++
+			fmt.Fprintf(stdout, "❌ %s: %v\n", tc.name, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "✅ %s\n", tc.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d selftest cases failed", failed, len(cases))
+	}
+	fmt.Fprintf(stdout, "🎉 All %d selftest cases passed\n", len(cases))
+	return nil
+}
+
+// runSelftestCase feeds tc to the loop and compares the responses and the
+// routed URLs with what it expects. A panic fails the case.
+func runSelftestCase(cfg *Config, routedPath string, tc selftestCase) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	os.Remove(routedPath)
+
+	var out bytes.Buffer
+	startLoop(bytes.NewReader(tc.stdin), &out, cfg, nil)
+
+	var statuses []string
+	for out.Len() > 0 {
+		var length uint32
+		if err := binary.Read(&out, binary.LittleEndian, &length); err != nil {
+			return fmt.Errorf("malformed response header: %w", err)
+		}
+		var resp Response
+		if err := json.Unmarshal(out.Next(int(length)), &resp); err != nil {
+			return fmt.Errorf("malformed response: %w", err)
+		}
+		if resp.Code != "" {
+			resp.Status += ":" + resp.Code
+		}
+		statuses = append(statuses, resp.Status)
+	}
+	if strings.Join(statuses, ",") != strings.Join(tc.responses, ",") {
+		return fmt.Errorf("expected responses [%s], got [%s]", strings.Join(tc.responses, " "), strings.Join(statuses, " "))
+	}
+
+	data, _ := os.ReadFile(routedPath)
+	routed := strings.Fields(string(data))
+	if strings.Join(routed, ",") != strings.Join(tc.routed, ",") {
+		return fmt.Errorf("expected routed URLs [%s], got [%s]", strings.Join(tc.routed, " "), strings.Join(routed, " "))
+	}
+	return nil
+}
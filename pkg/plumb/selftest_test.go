@@ -0,0 +1,27 @@
+package plumb
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMainRun_Selftest(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	if err := Run([]string{"selftest"}, nil, stdout, io.Discard); err != nil {
+		t.Fatalf("selftest failed: %v\n%s", err, stdout)
+	}
+	if !strings.Contains(stdout.String(), "✅ oversized message") || !strings.Contains(stdout.String(), "All 13 selftest cases passed") {
+		t.Errorf("unexpected report %q", stdout.String())
+	}
+}
+
+func TestRunSelftestCase(t *testing.T) {
+	cfg := &Config{Version: "2"}
+	tc := selftestCase{name: "wrong", stdin: envelopeFrame(Envelope{URL: "https://selftest.example/"}), responses: []string{"success"}}
+	err := runSelftestCase(cfg, t.TempDir()+"/routed", tc)
+	if err == nil || !strings.Contains(err.Error(), "expected responses [success], got [error]") {
+		t.Errorf("expected a response mismatch, got %v", err)
+	}
+}
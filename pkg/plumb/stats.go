@@ -0,0 +1,187 @@
+package plumb
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+// Count is a name and how many history entries have it.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Stats summarizes a history log for plumber stats.
+type Stats struct {
+	Entries      int     `json:"entries"`
+	Failed       int     `json:"failed"`
+	FailureRate  float64 `json:"failure_rate"` // failed entries over all, from 0 to 1
+	Kinds        []Count `json:"kinds"`
+	TopDomains   []Count `json:"top_domains"`
+	Targets      []Count `json:"targets"`         // routes per envelope target; "" is left to the workflows
+	Jobs         []Count `json:"jobs"`            // routes that ran each job
+	Snapshots    []Count `json:"snapshots"`       // successful snapshots per ISO week, such as "2026-W07", oldest first
+	AvgJobTimeMS int64   `json:"avg_job_time_ms"` // mean time the jobs of a route took, over the routes that recorded it
+}
+
+// computeStats summarizes entries, keeping the top domains and the last
+// weeks of snapshots.
+func computeStats(entries []history.Entry, top, weeks int, now time.Time) Stats {
+	var s Stats
+	kinds, domains, targets, jobs, snapshots := map[string]int{}, map[string]int{}, map[string]int{}, map[string]int{}, map[string]int{}
+	var timed, totalMS int64
+	for _, e := range entries {
+		s.Entries++
+		kinds[e.Kind]++
+		if e.Status == history.StatusError {
+			s.Failed++
+		}
+		if d := e.Domain(); d != "" {
+			domains[d]++
+		}
+		switch e.Kind {
+		case history.KindRoute:
+			targets[e.Target]++
+			for _, j := range e.Jobs {
+				jobs[j]++
+			}
+			if e.DurationMS > 0 {
+				timed++
+				totalMS += e.DurationMS
+			}
+		case history.KindSnapshot:
+			if e.Status == history.StatusSuccess {
+				snapshots[isoWeek(e.Time)]++
+			}
+		}
+	}
+	if s.Entries > 0 {
+		s.FailureRate = float64(s.Failed) / float64(s.Entries)
+	}
+	if timed > 0 {
+		s.AvgJobTimeMS = totalMS / timed
+	}
+
+	s.Kinds = sortedCounts(kinds, 0)
+	s.TopDomains = sortedCounts(domains, top)
+	s.Targets = sortedCounts(targets, 0)
+	s.Jobs = sortedCounts(jobs, 0)
+	// Weeks without snapshots are listed too, so gaps show.
+	for i := weeks - 1; i >= 0; i-- {
+		week := isoWeek(now.AddDate(0, 0, -7*i))
+		s.Snapshots = append(s.Snapshots, Count{Name: week, Count: snapshots[week]})
+	}
+	return s
+}
+
+// sortedCounts returns counts, most frequent first and then by name, at most
+// limit of them unless limit is 0.
+func sortedCounts(counts map[string]int, limit int) []Count {
+	out := make([]Count, 0, len(counts))
+	for name, n := range counts {
+		out = append(out, Count{Name: name, Count: n})
+	}
+	slices.SortFunc(out, func(a, b Count) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// isoWeek names the ISO 8601 week of t, such as "2026-W07".
+func isoWeek(t time.Time) string {
+	year, week := t.Local().ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// runStats implements "plumber stats": it summarizes the history log (top
+// domains, routes per target and job, snapshots per week, the average job
+// time and the failure rate) as tables or as JSON.
+func runStats(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "History file (default: settings.history.path or ~/.local/share/browser-pipes/history.db)")
+	since := fs.String("since", "", "Only count entries since a date (2006-01-02) or age (7d, 36h)")
+	top := fs.Int("top", 10, "Number of domains to list")
+	weeks := fs.Int("weeks", 8, "Number of weeks of snapshots to list")
+	asJSON := fs.Bool("json", false, "Print the statistics as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *top < 1 || *weeks < 1 {
+		return fmt.Errorf("--top and --weeks must be at least 1")
+	}
+
+	path, err := historyFile(cfg, *file)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	sinceTime, err := history.ParseSince(*since, now)
+	if err != nil {
+		return err
+	}
+	entries, err := history.Query(path, history.Filter{Since: sinceTime})
+	if err != nil {
+		return err
+	}
+
+	s := computeStats(entries, *top, *weeks, now)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	if s.Entries == 0 {
+		log.Printf("📭 No history entries in %s", path)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Entries\t%d\n", s.Entries)
+	fmt.Fprintf(tw, "Failed\t%d (%.1f%%)\n", s.Failed, 100*s.FailureRate)
+	fmt.Fprintf(tw, "Average job time\t%s\n", dash(formatMS(s.AvgJobTimeMS)))
+	sections := []struct {
+		title  string
+		counts []Count
+	}{
+		{"KIND", s.Kinds},
+		{"DOMAIN", s.TopDomains},
+		{"TARGET", s.Targets},
+		{"JOB", s.Jobs},
+		{"WEEK", s.Snapshots},
+	}
+	for _, sec := range sections {
+		if len(sec.counts) == 0 {
+			continue
+		}
+		header := "COUNT"
+		if sec.title == "WEEK" {
+			header = "SNAPSHOTS"
+		}
+		fmt.Fprintf(tw, "\n%s\t%s\n", sec.title, header)
+		for _, c := range sec.counts {
+			fmt.Fprintf(tw, "%s\t%d\n", dash(c.Name), c.Count)
+		}
+	}
+	return tw.Flush()
+}
+
+// formatMS formats milliseconds as a duration, or "" for none.
+func formatMS(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return (time.Duration(ms) * time.Millisecond).String()
+}
@@ -0,0 +1,82 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+func TestComputeStats(t *testing.T) {
+	now := time.Date(2026, 3, 11, 12, 0, 0, 0, time.Local) // a Wednesday of 2026-W11
+	entries := []history.Entry{
+		{Time: now.AddDate(0, 0, -14), Kind: history.KindSnapshot, URL: "https://go.dev/a", Status: history.StatusSuccess},
+		{Time: now.AddDate(0, 0, -1), Kind: history.KindSnapshot, URL: "https://www.go.dev/b", Status: history.StatusSuccess},
+		{Time: now, Kind: history.KindSnapshot, URL: "https://go.dev/c", Status: history.StatusError},
+		{Time: now, Kind: history.KindRoute, URL: "https://blog.example.com/", Target: "toggle", Jobs: []string{"open"}, DurationMS: 100, Status: history.StatusSuccess},
+		{Time: now, Kind: history.KindRoute, URL: "https://example.com/", Jobs: []string{"open", "save"}, DurationMS: 300, Status: history.StatusError},
+		{Time: now, Kind: history.KindRoute, URL: "https://example.com/x", Status: history.StatusError},
+	}
+
+	s := computeStats(entries, 2, 3, now)
+	if s.Entries != 6 || s.Failed != 3 || s.FailureRate != 0.5 || s.AvgJobTimeMS != 200 {
+		t.Errorf("unexpected totals %+v", s)
+	}
+	checks := []struct {
+		name      string
+		got, want []Count
+	}{
+		{"kinds", s.Kinds, []Count{{"route", 3}, {"snapshot", 3}}},
+		{"domains", s.TopDomains, []Count{{"go.dev", 3}, {"example.com", 2}}},
+		{"targets", s.Targets, []Count{{"", 2}, {"toggle", 1}}},
+		{"jobs", s.Jobs, []Count{{"open", 2}, {"save", 1}}},
+		{"snapshots", s.Snapshots, []Count{{"2026-W09", 1}, {"2026-W10", 0}, {"2026-W11", 1}}},
+	}
+	for _, c := range checks {
+		if len(c.got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+			continue
+		}
+		for i := range c.got {
+			if c.got[i] != c.want[i] {
+				t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	history.Append(path, history.Entry{Kind: history.KindRoute, URL: "https://go.dev/doc", Jobs: []string{"open"}, DurationMS: 1500, Status: history.StatusSuccess})
+	history.Append(path, history.Entry{Kind: history.KindSnapshot, URL: "https://go.dev/blog", Status: history.StatusError})
+	cfg := &Config{Settings: Settings{History: HistorySettings{Path: path}}}
+
+	stdout := &bytes.Buffer{}
+	if err := runStats(nil, cfg, stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Failed            1 (50.0%)", "Average job time  1.5s", "go.dev", "open", "WEEK"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if err := runStats([]string{"--json", "--weeks", "1"}, cfg, stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var s Stats
+	if err := json.Unmarshal(stdout.Bytes(), &s); err != nil || s.Entries != 2 || len(s.Snapshots) != 1 || s.AvgJobTimeMS != 1500 {
+		t.Errorf("unexpected JSON %q (%v)", stdout.String(), err)
+	}
+
+	if err := runStats([]string{"--top", "0"}, cfg, io.Discard, io.Discard); err == nil {
+		t.Error("expected an error for --top 0")
+	}
+}
@@ -0,0 +1,262 @@
+package plumb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+// summarizeParams are the parameters of the built-in summarize step.
+var summarizeParams = []string{"model", "endpoint", "token_file", "prompt", "timeout", "file"}
+
+// summaryMaxChars bounds the snapshot text sent for summarization so long
+// pages fit the context window of small local models.
+const summaryMaxChars = 24000
+
+const (
+	defaultSummaryEndpoint = "http://localhost:11434/v1" // a local Ollama
+	defaultSummaryPrompt   = "Summarize the following article in 3 to 5 sentences. Reply with the summary only, in the language of the article."
+	defaultSummaryTimeout  = 2 * time.Minute
+)
+
+// executeSummarize runs the built-in summarize step:
+//
+//   - summarize:
+//     model: "llama3.2"
+//     endpoint: "https://api.openai.com/v1"
+//     token_file: "~/.config/browser-pipes/secrets/openai-key"
+//
+// It sends the markdown snapshot a step before it saved (file, or else the
+// newest one of the URL in the history) to an OpenAI-compatible chat
+// completions API, which Ollama also serves under /v1, and writes the reply
+// into the snapshot: a summary key in its frontmatter and a Summary section
+// under its title.
+func executeSummarize(cfg *Config, rs *routeState, step Step, scopeParams map[string]string, url string) error {
+	param := func(name string) string {
+		return resolveParams(step.Params[name], scopeParams)
+	}
+
+	model := param("model")
+	if model == "" {
+		return fmt.Errorf("summarize step needs a model")
+	}
+	file := expandHome(param("file"))
+	if file == "" {
+		var err error
+		if file, err = latestMarkdown(scopeParams["history_file"], url); err != nil {
+			return fmt.Errorf("summarize step: %w", err)
+		}
+	}
+	if strings.HasSuffix(file, ".age") {
+		return fmt.Errorf("summarize step cannot read the encrypted snapshot %s", file)
+	}
+	doc, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("summarize step: %w", err)
+	}
+
+	s := summarizer{
+		endpoint: strings.TrimSuffix(param("endpoint"), "/"),
+		model:    model,
+		prompt:   param("prompt"),
+		timeout:  defaultSummaryTimeout,
+	}
+	if s.endpoint == "" {
+		s.endpoint = defaultSummaryEndpoint
+	}
+	if s.prompt == "" {
+		s.prompt = defaultSummaryPrompt
+	}
+	if t := param("timeout"); t != "" {
+		if s.timeout, err = time.ParseDuration(t); err != nil || s.timeout <= 0 {
+			return fmt.Errorf("summarize step has invalid timeout '%s'", t)
+		}
+	}
+	if tokenFile := expandHome(param("token_file")); tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return fmt.Errorf("summarize step failed to read token file: %w", err)
+		}
+		s.token = strings.TrimSpace(string(data))
+	}
+
+	log.Printf("   🧠 Summarizing %s with %s", file, model)
+	summary, err := s.summarize(rs.context(), snapshotText(doc))
+	if err != nil {
+		return fmt.Errorf("summarize step failed: %w", err)
+	}
+	summarized, err := addSummary(doc, summary)
+	if err != nil {
+		return fmt.Errorf("summarize step: %w", err)
+	}
+	if err := os.WriteFile(file, summarized, 0644); err != nil {
+		return fmt.Errorf("summarize step failed to update %s: %w", file, err)
+	}
+	log.Printf("   📝 Added a summary to %s", file)
+	return nil
+}
+
+// latestMarkdown returns the newest markdown snapshot recorded for url in
+// the history, under its canonical URL or the one it was fetched from.
+func latestMarkdown(historyPath, url string) (string, error) {
+	if historyPath == "" {
+		return "", fmt.Errorf("no file given and settings.history is disabled")
+	}
+	entries, err := history.Query(historyPath, history.Filter{Kind: history.KindSnapshot, Status: history.StatusSuccess, URL: url})
+	if err != nil {
+		return "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		for _, f := range entries[i].Files {
+			if strings.HasSuffix(f, ".md") || strings.HasSuffix(f, ".md.age") {
+				return f, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no markdown snapshot of %s in %s", url, historyPath)
+}
+
+// splitFrontmatter splits a markdown document into its YAML frontmatter,
+// without the --- lines, and the body. fm is nil when there is none.
+func splitFrontmatter(doc []byte) (fm, body []byte) {
+	rest, ok := bytes.CutPrefix(doc, []byte("---\n"))
+	if !ok {
+		return nil, doc
+	}
+	fm, body, ok = bytes.Cut(rest, []byte("\n---\n"))
+	if !ok {
+		return nil, doc
+	}
+	return append(fm, '\n'), body
+}
+
+// snapshotText returns the body of a markdown snapshot, with its whitespace
+// collapsed and cut to summaryMaxChars.
+func snapshotText(doc []byte) string {
+	_, body := splitFrontmatter(doc)
+	text := strings.Join(strings.Fields(string(body)), " ")
+	if runes := []rune(text); len(runes) > summaryMaxChars {
+		text = string(runes[:summaryMaxChars])
+	}
+	return text
+}
+
+// addSummary sets the summary key of the frontmatter of doc, when it has
+// one, and puts a Summary section under its title (or on top when it has
+// no title).
+func addSummary(doc []byte, summary string) ([]byte, error) {
+	fm, body := splitFrontmatter(doc)
+	var out bytes.Buffer
+	if fm != nil {
+		// JSON is valid YAML, and quotes summaries with colons or quotes.
+		value, err := json.Marshal(summary)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString("---\n")
+		for _, line := range strings.SplitAfter(string(fm), "\n") {
+			if !strings.HasPrefix(line, "summary:") {
+				out.WriteString(line)
+			}
+		}
+		fmt.Fprintf(&out, "summary: %s\n---\n", value)
+	}
+
+	section := "## Summary\n\n" + summary + "\n\n---\n\n"
+	lines := strings.SplitAfter(string(body), "\n")
+	title := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "# ") {
+			title = i
+			break
+		}
+		if strings.TrimSpace(line) != "" {
+			break
+		}
+	}
+	if title < 0 {
+		out.WriteString(section)
+		out.WriteString(string(body))
+		return out.Bytes(), nil
+	}
+	for i, line := range lines {
+		out.WriteString(line)
+		if i == title {
+			out.WriteString("\n" + section)
+			// The blank line after the title is already in the section.
+			if i+1 < len(lines) && strings.TrimSpace(lines[i+1]) == "" {
+				lines[i+1] = ""
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// summarizer asks an OpenAI-compatible chat completions API for a summary.
+// It talks to the endpoint directly rather than through
+// settings.snapshot.proxy: the endpoint is usually a local Ollama.
+type summarizer struct {
+	endpoint string // base URL, e.g. https://api.openai.com/v1
+	model    string
+	token    string
+	prompt   string
+	timeout  time.Duration
+}
+
+// summarize returns a summary of text.
+func (s summarizer) summarize(ctx context.Context, text string) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"model": s.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": s.prompt},
+			{"role": "user", "content": text},
+		},
+		"stream": false,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	client := &http.Client{Timeout: s.timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("summary request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("summary request failed: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode summary response: %w", err)
+	}
+	if len(result.Choices) == 0 || strings.TrimSpace(result.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("summary response is empty")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
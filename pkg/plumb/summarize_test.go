@@ -0,0 +1,113 @@
+package plumb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"browser-pipes/internal/history"
+)
+
+func TestExecuteSummarize(t *testing.T) {
+	var request struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"choices":[{"message":{"content":" Short: a \"quoted\" summary. "}}]}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	os.WriteFile(tokenFile, []byte("secret\n"), 0600)
+	snapshot := filepath.Join(dir, "article.md")
+	os.WriteFile(snapshot, []byte("---\ntitle: Article\nsummary: old\n---\n# Article\n\nThe  body\nof the article.\n"), 0644)
+	historyPath := filepath.Join(dir, "history.db")
+	history.Append(historyPath, history.Entry{Kind: history.KindSnapshot, URL: "https://example.com/a", OriginalURL: "https://t.co/a", Status: history.StatusSuccess, Files: []string{snapshot, filepath.Join(dir, "article.html")}})
+
+	scope := map[string]string{"history_file": historyPath, "model": "llama3.2"}
+	step := Step{Name: "summarize", Params: map[string]string{
+		"model":      "<<parameters.model>>",
+		"endpoint":   server.URL + "/v1/",
+		"token_file": tokenFile,
+	}}
+	if err := executeSummarize(&Config{}, &routeState{}, step, scope, "https://t.co/a"); err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "llama3.2" || auth != "Bearer secret" {
+		t.Errorf("expected model llama3.2 with the token, got %q and %q", request.Model, auth)
+	}
+	if len(request.Messages) != 2 || request.Messages[0].Content != defaultSummaryPrompt || request.Messages[1].Content != "# Article The body of the article." {
+		t.Errorf("expected the default prompt and the snapshot body, got %+v", request.Messages)
+	}
+
+	data, _ := os.ReadFile(snapshot)
+	want := "---\ntitle: Article\nsummary: \"Short: a \\\"quoted\\\" summary.\"\n---\n# Article\n\n## Summary\n\nShort: a \"quoted\" summary.\n\n---\n\nThe  body\nof the article.\n"
+	if string(data) != want {
+		t.Errorf("expected the summary in the snapshot:\n%s\ngot:\n%s", want, data)
+	}
+}
+
+func TestExecuteSummarize_Errors(t *testing.T) {
+	dir := t.TempDir()
+	encrypted := filepath.Join(dir, "article.md.age")
+	os.WriteFile(encrypted, []byte("age"), 0600)
+	plain := filepath.Join(dir, "article.md")
+	os.WriteFile(plain, []byte("# Article\n"), 0644)
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		scope  map[string]string
+		want   string
+	}{
+		{"no model", map[string]string{"file": encrypted}, nil, "needs a model"},
+		{"encrypted", map[string]string{"model": "m", "file": encrypted}, nil, "encrypted snapshot"},
+		{"no history", map[string]string{"model": "m"}, nil, "settings.history is disabled"},
+		{"not in history", map[string]string{"model": "m"}, map[string]string{"history_file": filepath.Join(dir, "history.db")}, "no markdown snapshot"},
+		{"missing file", map[string]string{"model": "m", "file": filepath.Join(dir, "missing.md")}, nil, "no such file"},
+		{"bad timeout", map[string]string{"model": "m", "file": plain, "timeout": "soon"}, nil, "invalid timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := executeSummarize(&Config{}, &routeState{}, Step{Name: "summarize", Params: tt.params}, tt.scope, "https://example.com/a")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error with %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestAddSummary(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"no title", "Some text.\n", "## Summary\n\nS.\n\n---\n\nSome text.\n"},
+		{"title", "\n# T\nBody\n", "\n# T\n\n## Summary\n\nS.\n\n---\n\nBody\n"},
+		{"frontmatter", "---\na: b\n---\nBody\n", "---\na: b\nsummary: \"S.\"\n---\n## Summary\n\nS.\n\n---\n\nBody\n"},
+	}
+	for _, tt := range tests {
+		got, err := addSummary([]byte(tt.doc), "S.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
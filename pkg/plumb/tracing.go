@@ -0,0 +1,255 @@
+package plumb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tracingTimeout bounds sending the spans of a route, which the response to
+// the browser waits for.
+const tracingTimeout = 5 * time.Second
+
+// TracingSettings send the spans of every route (the workflows, their jobs
+// and their steps) to an OpenTelemetry collector over OTLP/HTTP, so routes
+// show up in Jaeger or Tempo next to everything else.
+type TracingSettings struct {
+	Endpoint    string            `yaml:"endpoint" json:"endpoint,omitempty" jsonschema:"description=OTLP/HTTP collector such as http://localhost:4318 (spans go to /v1/traces unless the URL has a path); tracing is off without it"`
+	ServiceName string            `yaml:"service_name" json:"service_name,omitempty" jsonschema:"description=service.name of the spans (default: plumber)"`
+	Headers     map[string]string `yaml:"headers" json:"headers,omitempty" jsonschema:"description=HTTP headers sent with the spans such as Authorization"`
+}
+
+func (t TracingSettings) validate() error {
+	if t.Endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(t.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("settings.tracing has invalid endpoint '%s' (use an http:// or https:// URL)", t.Endpoint)
+	}
+	return nil
+}
+
+// tracesURL returns the URL the spans are posted to.
+func (t TracingSettings) tracesURL() string {
+	if u, err := url.Parse(t.Endpoint); err == nil && strings.Trim(u.Path, "/") == "" {
+		u.Path = "/v1/traces"
+		return u.String()
+	}
+	return t.Endpoint
+}
+
+// span is one timed operation of a route. Spans are ended in the reverse
+// order they are started, as the workflow, job and step calls return.
+type span struct {
+	traceID [16]byte
+	id      [8]byte
+	parent  *span
+	name    string
+	start   time.Time
+	end     time.Time
+	attrs   map[string]string
+	err     error
+}
+
+// set adds an attribute to s, which may be nil when tracing is off.
+func (s *span) set(key, value string) {
+	if s != nil {
+		s.attrs[key] = value
+	}
+}
+
+// tracer collects the spans of the route in progress.
+type tracer struct {
+	traceID [16]byte
+	current *span
+	ended   []*span
+}
+
+// startTrace starts the root span of a route, or returns nil when tracing
+// is off.
+func (c *Config) startTrace(rs *routeState, env Envelope) *span {
+	if c.Settings.Tracing.Endpoint == "" {
+		return nil
+	}
+	rs.trace = &tracer{}
+	rand.Read(rs.trace.traceID[:])
+	return rs.startSpan("route", map[string]string{
+		"url.full":        env.URL,
+		"plumber.id":      env.ID,
+		"plumber.origin":  env.Origin,
+		"plumber.target":  env.Target,
+		"plumber.has_dom": strconv.FormatBool(env.HTML != ""),
+	})
+}
+
+// startSpan starts a child of the current span. It returns nil, which
+// endSpan and set accept, when no route is being traced.
+func (rs *routeState) startSpan(name string, attrs map[string]string) *span {
+	if rs.trace == nil {
+		return nil
+	}
+	s := &span{traceID: rs.trace.traceID, parent: rs.trace.current, name: name, start: time.Now(), attrs: map[string]string{}}
+	rand.Read(s.id[:])
+	for k, v := range attrs {
+		if v != "" {
+			s.attrs[k] = v
+		}
+	}
+	rs.trace.current = s
+	return s
+}
+
+// endSpan ends s, failed when err is not nil.
+func (rs *routeState) endSpan(s *span, err error) {
+	if s == nil || rs.trace == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	rs.trace.ended = append(rs.trace.ended, s)
+	rs.trace.current = s.parent
+}
+
+// finishTrace ends the root span and sends the spans of the route. A
+// collector that is down only costs a warning.
+func (c *Config) finishTrace(rs *routeState, root *span, err error) {
+	if root == nil || rs.trace == nil {
+		return
+	}
+	rs.endSpan(root, err)
+	spans := rs.trace.ended
+	rs.trace = nil
+	if err := exportSpans(c.Settings.Tracing, spans); err != nil {
+		log.Printf("   ⚠️ Failed to export trace: %v", err)
+	}
+}
+
+// exportSpans posts spans to the collector as an OTLP/HTTP JSON request.
+func exportSpans(t TracingSettings, spans []*span) error {
+	body, err := json.Marshal(otlpRequest(t, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.tracesURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: tracingTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s %s", t.tracesURL(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// The OTLP JSON encoding of an ExportTraceServiceRequest, as far as plumber
+// uses it. IDs are hex and times are nanoseconds in strings.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 1 is ok, 2 is error
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// otlpKindInternal is SPAN_KIND_INTERNAL: plumber's spans are its own work,
+// not requests to or from another service.
+const otlpKindInternal = 1
+
+func otlpRequest(t TracingSettings, spans []*span) otlpTraces {
+	service := t.ServiceName
+	if service == "" {
+		service = "plumber"
+	}
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "browser-pipes/plumber"
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.id[:]),
+			Name:              s.name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attrs),
+			Status:            otlpStatus{Code: 1},
+		}
+		if s.parent != nil {
+			o.ParentSpanID = hex.EncodeToString(s.parent.id[:])
+		}
+		if s.err != nil {
+			o.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+		}
+		scope.Spans = append(scope.Spans, o)
+	}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]string{"service.name": service})},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
+
+// otlpAttributes returns attrs sorted by key.
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	out := make([]otlpAttribute, len(keys))
+	for i, k := range keys {
+		out[i].Key = k
+		out[i].Value.StringValue = attrs[k]
+	}
+	return out
+}
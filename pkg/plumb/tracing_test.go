@@ -0,0 +1,156 @@
+package plumb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRouteTracing(t *testing.T) {
+	requests := make(chan otlpTraces, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("unexpected request %s %s %v", r.Method, r.URL, r.Header)
+		}
+		var req otlpTraces
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		requests <- req
+	}))
+	defer ts.Close()
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(`
+version: "2"
+settings:
+  tracing:
+    endpoint: "`+ts.URL+`"
+    service_name: homelab-plumber
+    headers:
+      Authorization: Bearer secret
+commands:
+  check:
+    steps:
+      - run: "test -n '<< parameters.url >>'"
+jobs:
+  save:
+    steps:
+      - check
+  fail:
+    steps:
+      - run: "false"
+workflows:
+  main:
+    jobs:
+      - save:
+          match: "example\\.com"
+      - fail:
+          match: "/fail"
+`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := func(t *testing.T, url string) map[string]otlpSpan {
+		t.Helper()
+		route(context.Background(), &cfg, Envelope{ID: "1", Origin: "test", URL: url})
+		req := <-requests
+		rs := req.ResourceSpans[0]
+		if got := rs.Resource.Attributes[0]; got.Key != "service.name" || got.Value.StringValue != "homelab-plumber" {
+			t.Errorf("expected service.name homelab-plumber, got %+v", got)
+		}
+		byName := map[string]otlpSpan{}
+		for _, s := range rs.ScopeSpans[0].Spans {
+			if s.TraceID != rs.ScopeSpans[0].Spans[0].TraceID {
+				t.Errorf("span %s is in another trace", s.Name)
+			}
+			byName[s.Name] = s
+		}
+		return byName
+	}
+
+	t.Run("success", func(t *testing.T) {
+		got := spans(t, "https://example.com/a")
+		// route > workflow > job > command step > run step
+		chain := []string{"route", "workflow main", "job save", "step check", "step run"}
+		if len(got) != len(chain) {
+			t.Fatalf("expected spans %v, got %v", chain, got)
+		}
+		for i, name := range chain {
+			s, ok := got[name]
+			if !ok {
+				t.Fatalf("missing span %s in %v", name, got)
+			}
+			parent := ""
+			if i > 0 {
+				parent = got[chain[i-1]].SpanID
+			}
+			if s.ParentSpanID != parent {
+				t.Errorf("expected %s to be a child of %q", name, parent)
+			}
+			if s.Status.Code != 1 {
+				t.Errorf("expected %s to be ok, got %+v", name, s.Status)
+			}
+		}
+		var cmd string
+		for _, a := range got["step run"].Attributes {
+			if a.Key == "process.command_line" {
+				cmd = a.Value.StringValue
+			}
+		}
+		if cmd != "test -n 'https://example.com/a'" {
+			t.Errorf("expected the command line on the run step, got %q", cmd)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		got := spans(t, "https://example.com/fail")
+		for _, name := range []string{"route", "workflow main", "job fail", "step run"} {
+			if got[name].Status.Code != 2 || got[name].Status.Message == "" {
+				t.Errorf("expected %s to have failed, got %+v", name, got[name].Status)
+			}
+		}
+		if got["job save"].Status.Code != 1 {
+			t.Errorf("expected job save to be ok, got %+v", got["job save"].Status)
+		}
+	})
+
+	t.Run("collector down", func(t *testing.T) {
+		cfg := cfg
+		cfg.Settings.Tracing.Endpoint = "http://127.0.0.1:1"
+		if _, err := route(context.Background(), &cfg, Envelope{URL: "https://example.com/a"}); err != nil {
+			t.Errorf("expected the route to succeed without a collector, got %v", err)
+		}
+	})
+}
+
+func TestTracingSettings(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		valid    bool
+	}{
+		{"", "", true},
+		{"http://localhost:4318", "http://localhost:4318/v1/traces", true},
+		{"http://localhost:4318/", "http://localhost:4318/v1/traces", true},
+		{"https://tempo.example/otlp/v1/traces", "https://tempo.example/otlp/v1/traces", true},
+		{"localhost:4318", "", false},
+		{"grpc://localhost:4317", "", false},
+	}
+	for _, tt := range tests {
+		s := TracingSettings{Endpoint: tt.endpoint}
+		if err := s.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate(%q) = %v, want valid %v", tt.endpoint, err, tt.valid)
+		}
+		if tt.valid && tt.endpoint != "" && s.tracesURL() != tt.want {
+			t.Errorf("tracesURL(%q) = %q, want %q", tt.endpoint, s.tracesURL(), tt.want)
+		}
+	}
+}
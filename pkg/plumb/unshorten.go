@@ -0,0 +1,122 @@
+package plumb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"browser-pipes/internal/urlclean"
+)
+
+// defaultShorteners are resolved unless settings.unshorten lists its own
+// domains.
+var defaultShorteners = []string{
+	"t.co", "bit.ly", "lnkd.in", "amzn.to", "amzn.eu", "a.co", "tinyurl.com",
+	"goo.gl", "ow.ly", "buff.ly", "dlvr.it", "trib.al", "is.gd", "t.ly",
+	"tiny.cc", "cutt.ly", "rebrand.ly", "shorturl.at", "fb.me", "redd.it",
+	"spoti.fi", "wp.me", "flip.it", "apple.co", "msft.it",
+}
+
+// unshortenURL follows the redirects of a known short link and returns
+// where they end, so workflow patterns written for the destination site
+// match. Other URLs, and short links that cannot be resolved, are returned
+// as they are.
+func (c *Config) unshortenURL(rawURL string) string {
+	s := c.Settings.Unshorten
+	u := parseURL(rawURL)
+	if !s.Enabled || u == nil {
+		return rawURL
+	}
+	domains := s.Domains
+	if domains == nil {
+		domains = defaultShorteners
+	}
+	if !urlclean.MatchesDomain(u, domains) {
+		return rawURL
+	}
+
+	timeout, maxHops := s.limits()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	client, err := c.httpClient(0)
+	if err != nil {
+		log.Printf("   ⚠️ Failed to resolve %s: %v", rawURL, err)
+		return rawURL
+	}
+	final, err := followRedirects(ctx, client, rawURL, maxHops, c.blocked)
+	if err != nil {
+		log.Printf("   ⚠️ Failed to resolve %s: %v", rawURL, err)
+	}
+	if final != rawURL {
+		log.Printf("   🔗 Unshortened %s -> %s", rawURL, final)
+	}
+	return final
+}
+
+// limits returns the time and hop limits, with their defaults.
+func (s UnshortenSettings) limits() (time.Duration, int) {
+	timeout := 5 * time.Second
+	if d, err := time.ParseDuration(s.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	maxHops := 5
+	if s.MaxHops > 0 {
+		maxHops = s.MaxHops
+	}
+	return timeout, maxHops
+}
+
+// followRedirects requests rawURL and its redirects with client one hop at a
+// time, up to maxHops, and returns the last URL reached. Only the response
+// headers are read, and a hop for which stop reports true (a blocklisted
+// site) is returned without being requested.
+func followRedirects(ctx context.Context, client *http.Client, rawURL string, maxHops int, stop func(string) bool) (string, error) {
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	current := rawURL
+	for range maxHops {
+		if stop(current) {
+			return current, nil
+		}
+		next, err := redirectTarget(ctx, client, current)
+		if err != nil || next == "" {
+			return current, err
+		}
+		current = next
+	}
+	return current, fmt.Errorf("more than %d redirects", maxHops)
+}
+
+// redirectTarget returns where rawURL redirects to, or "" when it does not.
+// Shorteners that reject HEAD are asked again with GET.
+func redirectTarget(ctx context.Context, client *http.Client, rawURL string) (string, error) {
+	var resp *http.Response
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("User-Agent", "browser-pipes")
+		resp, err = client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusForbidden {
+			break
+		}
+	}
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return "", nil
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return "", nil
+	}
+	if location.Scheme != "http" && location.Scheme != "https" {
+		return "", fmt.Errorf("redirect to %s", location)
+	}
+	return location.String(), nil
+}
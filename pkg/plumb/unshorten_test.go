@@ -0,0 +1,64 @@
+package plumb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnshortenURL(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/s":
+			http.Redirect(w, r, "/hop", http.StatusMovedPermanently)
+		case "/hop":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, srv.URL+"/article?utm_source=twitter&id=1", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &Config{Settings: Settings{Unshorten: UnshortenSettings{Enabled: true, Domains: []string{"127.0.0.1"}, MaxHops: 3}}}
+
+	if got := cfg.cleanURL(cfg.unshortenURL(srv.URL + "/s")); got != srv.URL+"/article?id=1" {
+		t.Errorf("expected the short link resolved and cleaned, got %q", got)
+	}
+	if got := cfg.unshortenURL(srv.URL + "/loop"); got != srv.URL+"/loop" {
+		t.Errorf("expected a redirect loop to stop at the hop limit, got %q", got)
+	}
+	if got := cfg.unshortenURL("https://example.com/s"); got != "https://example.com/s" {
+		t.Errorf("expected other domains left alone, got %q", got)
+	}
+
+	cfg.Settings.Unshorten.Enabled = false
+	if got := cfg.unshortenURL(srv.URL + "/s"); got != srv.URL+"/s" {
+		t.Errorf("expected no resolution when disabled, got %q", got)
+	}
+}
+
+func TestUnshortenURL_Proxy(t *testing.T) {
+	var requested []string
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.String())
+		http.Redirect(w, r, "https://example.com/article", http.StatusMovedPermanently)
+	}))
+	defer proxySrv.Close()
+
+	cfg := &Config{Settings: Settings{
+		Unshorten: UnshortenSettings{Enabled: true, MaxHops: 1},
+		Snapshot:  SnapshotSettings{Proxy: proxySrv.URL},
+		Blocklist: []BlockRule{{Domains: []string{"example.com"}}},
+	}}
+	if got := cfg.unshortenURL("http://t.co/abc"); got != "https://example.com/article" {
+		t.Errorf("expected the redirect the proxy answered, got %q", got)
+	}
+	if len(requested) != 1 || requested[0] != "http://t.co/abc" {
+		t.Errorf("expected the short link requested through the proxy, got %v", requested)
+	}
+}
@@ -0,0 +1,34 @@
+package plumb
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"browser-pipes/internal/urlhash"
+)
+
+func parseURL(uri string) *url.URL {
+	u, _ := url.Parse(uri)
+	return u
+}
+
+func hashURL(uri string) string {
+	return urlhash.Short(uri)
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// shellQuote quotes s as a single sh word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,440 @@
+package plumb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"browser-pipes/internal/history"
+	"browser-pipes/internal/proxy"
+	"browser-pipes/pkg/readmd"
+)
+
+const (
+	defaultWatchInterval = 24 * time.Hour
+	watchPollInterval    = time.Minute
+	maxWatchPageSize     = 10 * 1024 * 1024
+	// maxDiffCells bounds the line diff table; larger pages are diffed as
+	// a full replacement.
+	maxDiffCells = 4_000_000
+)
+
+// watchItem is a URL on the watchlist and the state of its last check.
+type watchItem struct {
+	URL      string    `json:"url"`
+	Interval string    `json:"interval,omitempty"` // overrides settings.watch.interval
+	Job      string    `json:"job,omitempty"`      // overrides settings.watch.job
+	Added    time.Time `json:"added"`
+	Checked  time.Time `json:"checked,omitzero"`
+	Changed  time.Time `json:"changed,omitzero"`
+	Hash     string    `json:"hash,omitempty"` // history.ContentHash of the page text
+}
+
+func (w watchItem) interval(cfg *Config) time.Duration {
+	for _, s := range []string{w.Interval, cfg.Settings.Watch.Interval} {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultWatchInterval
+}
+
+func (w watchItem) due(cfg *Config, now time.Time) bool {
+	return w.Checked.IsZero() || now.Sub(w.Checked) >= w.interval(cfg)
+}
+
+// watchlistPath resolves the watchlist file: settings.watch.path, else
+// watchlist.json next to the history file. The page texts and diffs of
+// the last checks are kept in a watch/ folder beside it.
+func watchlistPath(cfg *Config) (string, error) {
+	if cfg.Settings.Watch.Path != "" {
+		return expandHome(cfg.Settings.Watch.Path), nil
+	}
+	historyPath, err := historyFile(cfg, "")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(historyPath), "watchlist.json"), nil
+}
+
+func loadWatchlist(path string) ([]watchItem, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watchlist: %w", err)
+	}
+	var items []watchItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("failed to parse watchlist: %w", err)
+	}
+	return items, nil
+}
+
+func saveWatchlist(path string, items []watchItem) error {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create watchlist directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write watchlist: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// storeWatchItem writes the state of one item back to the watchlist. The
+// list is re-read first so URLs added during a check are kept; an item
+// removed meanwhile stays removed.
+func storeWatchItem(path string, item watchItem) error {
+	items, err := loadWatchlist(path)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(items, func(w watchItem) bool { return w.URL == item.URL })
+	if i < 0 {
+		return nil
+	}
+	items[i] = item
+	return saveWatchlist(path, items)
+}
+
+// runWatch implements "plumber watch": add, remove and list manage the
+// watchlist, run checks the URLs that are due.
+func runWatch(args []string, cfg *Config, stdout io.Writer, stderr io.Writer) error {
+	usage := fmt.Errorf("usage: plumber watch [add|remove|list|run]")
+	if len(args) == 0 {
+		return usage
+	}
+	path, err := watchlistPath(cfg)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("watch "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	switch args[0] {
+	case "add":
+		interval := fs.String("interval", "", "Check interval for this URL (Go duration; default: settings.watch.interval or 24h)")
+		job := fs.String("job", "", "Job run when this URL changed (default: settings.watch.job)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: plumber watch add [--interval 6h] [--job name] <url>")
+		}
+		if *interval != "" {
+			if d, err := time.ParseDuration(*interval); err != nil || d <= 0 {
+				return fmt.Errorf("invalid --interval %q", *interval)
+			}
+		}
+		if *job != "" {
+			if _, ok := cfg.Jobs[*job]; !ok {
+				return fmt.Errorf("undefined job '%s'", *job)
+			}
+		}
+		return addWatch(path, cfg.normalizeURL(cfg.cleanURL(fs.Arg(0))), *interval, *job)
+
+	case "remove":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: plumber watch remove <url>")
+		}
+		return removeWatch(path, cfg.normalizeURL(cfg.cleanURL(fs.Arg(0))))
+
+	case "list":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return listWatch(path, cfg, stdout)
+
+	case "run":
+		once := fs.Bool("once", false, "Check the URLs that are due once and exit, e.g. from cron")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration is invalid: %w", err)
+		}
+		client, err := cfg.httpClient(30 * time.Second)
+		if err != nil {
+			return err
+		}
+		log.Printf("👀 Watching the URLs in %s", path)
+		for {
+			if err := checkDue(cfg, path, client, time.Now()); err != nil {
+				return err
+			}
+			if *once {
+				return nil
+			}
+			time.Sleep(watchPollInterval)
+		}
+	}
+	return usage
+}
+
+func addWatch(path, url, interval, job string) error {
+	items, err := loadWatchlist(path)
+	if err != nil {
+		return err
+	}
+	if i := slices.IndexFunc(items, func(w watchItem) bool { return w.URL == url }); i >= 0 {
+		items[i].Interval, items[i].Job = interval, job
+		log.Printf("👀 Updated watch on %s", url)
+	} else {
+		items = append(items, watchItem{URL: url, Interval: interval, Job: job, Added: time.Now()})
+		log.Printf("👀 Watching %s", url)
+	}
+	return saveWatchlist(path, items)
+}
+
+func removeWatch(path, url string) error {
+	items, err := loadWatchlist(path)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(items, func(w watchItem) bool { return w.URL == url })
+	if i < 0 {
+		return fmt.Errorf("%s is not on the watchlist", url)
+	}
+	items = slices.Delete(items, i, i+1)
+	log.Printf("🗑️ Stopped watching %s", url)
+	return saveWatchlist(path, items)
+}
+
+func listWatch(path string, cfg *Config, stdout io.Writer) error {
+	items, err := loadWatchlist(path)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		log.Printf("📭 No watched URLs in %s", path)
+		return nil
+	}
+	when := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Local().Format("2006-01-02 15:04")
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INTERVAL\tCHECKED\tCHANGED\tJOB\tURL")
+	for _, w := range items {
+		job := w.Job
+		if job == "" {
+			job = cfg.Settings.Watch.Job
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", w.interval(cfg), when(w.Checked), when(w.Changed), dash(job), w.URL)
+	}
+	return tw.Flush()
+}
+
+// checkDue checks every watched URL whose interval has passed. A URL that
+// fails to load is retried at its next interval.
+func checkDue(cfg *Config, path string, client *http.Client, now time.Time) error {
+	items, err := loadWatchlist(path)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if !item.due(cfg, now) {
+			continue
+		}
+		if err := checkWatched(cfg, &item, filepath.Join(filepath.Dir(path), "watch"), client, now); err != nil {
+			log.Printf("   ❌ %s: %v", item.URL, err)
+		}
+		item.Checked = now
+		if err := storeWatchItem(path, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWatched fetches a watched URL and compares the hash of its article
+// text with the last check or, for a new item, the last snapshot in the
+// history. On a change it writes a line diff against the previous text and
+// runs the watch job with the fetched page, so the job can snapshot it and
+// send a notification.
+func checkWatched(cfg *Config, item *watchItem, dir string, client *http.Client, now time.Time) error {
+	body, err := fetchPage(client, item.URL)
+	if err != nil {
+		return err
+	}
+	article, err := readmd.Extract(body, parseURL(item.URL), cfg.Settings.Snapshot.Readability.options())
+	if err != nil {
+		return fmt.Errorf("failed to parse article: %w", err)
+	}
+	var text strings.Builder
+	if err := article.RenderText(&text); err != nil {
+		return fmt.Errorf("failed to render text: %w", err)
+	}
+	hash := history.ContentHash(text.String())
+
+	prev := item.Hash
+	if prev == "" {
+		prev = lastSnapshotHash(cfg, item.URL)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create watch directory: %w", err)
+	}
+	base := filepath.Join(dir, hashURL(item.URL))
+	switch prev {
+	case "":
+		log.Printf("   📌 Recorded the current version of %s", item.URL)
+		item.Hash = hash
+		return os.WriteFile(base+".txt", []byte(text.String()), 0600)
+	case hash:
+		log.Printf("   ✔️ Unchanged: %s", item.URL)
+		item.Hash = hash
+		return os.WriteFile(base+".txt", []byte(text.String()), 0600)
+	}
+
+	oldText, _ := os.ReadFile(base + ".txt")
+	diff, added, removed := lineDiff(string(oldText), text.String())
+	if err := os.WriteFile(base+".diff", []byte(diff), 0600); err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+	log.Printf("   🔔 Changed: %s (+%d -%d lines)", item.URL, added, removed)
+
+	jobName := item.Job
+	if jobName == "" {
+		jobName = cfg.Settings.Watch.Job
+	}
+	if job, ok := cfg.Jobs[jobName]; ok {
+		params := map[string]string{
+			"diff_file":     base + ".diff",
+			"previous_hash": prev,
+			"tags":          strings.Join(cfg.tagsFor(item.URL), ","),
+		}
+		start := time.Now()
+		err := runJob(cfg, newRouteState(context.Background(), "watch"), jobName, job, params, item.URL, string(body))
+		recordRoute(cfg, Envelope{URL: item.URL, Origin: "watch"}, item.URL, []string{jobName}, time.Since(start), err)
+		updateFeed(cfg)
+		if err != nil {
+			// Keep the old state so the change is reported again next time.
+			return fmt.Errorf("job %s failed: %w", jobName, err)
+		}
+	}
+
+	item.Hash = hash
+	item.Changed = now
+	return os.WriteFile(base+".txt", []byte(text.String()), 0600)
+}
+
+// httpClient returns the client for every fetch plumber makes itself, which
+// goes through settings.snapshot.proxy like the snapshots do, so a proxy
+// such as Tor sees all of plumber's traffic.
+func (c *Config) httpClient(timeout time.Duration) (*http.Client, error) {
+	transport, err := proxy.Transport(c.Settings.Snapshot.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// fetchPage returns the page at url as UTF-8, which is also how the job
+// gets it as html_file.
+func fetchPage(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWatchPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return readmd.DecodeHTML(body, resp.Header.Get("Content-Type")), nil
+}
+
+// lastSnapshotHash returns the content hash of the latest snapshot of url in
+// the history, or "".
+func lastSnapshotHash(cfg *Config, url string) string {
+	path, err := historyFile(cfg, "")
+	if err != nil {
+		return ""
+	}
+	entries, _ := history.Query(path, history.Filter{Kind: history.KindSnapshot, Status: history.StatusSuccess, URL: url})
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.URL == url && e.ContentHash != "" {
+			return e.ContentHash
+		}
+	}
+	return ""
+}
+
+// lineDiff compares the non-blank lines of two texts and returns the
+// removed ("- ") and added ("+ ") lines in order, with their counts.
+func lineDiff(oldText, newText string) (diff string, added, removed int) {
+	a, b := textLines(oldText), textLines(newText)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	var lcs [][]int
+	if (len(a)+1)*(len(b)+1) <= maxDiffCells {
+		lcs = make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case lcs != nil && i < len(a) && j < len(b) && a[i] == b[j]:
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs == nil || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&out, "- %s\n", a[i])
+			i, removed = i+1, removed+1
+		default:
+			fmt.Fprintf(&out, "+ %s\n", b[j])
+			j, added = j+1, added+1
+		}
+	}
+	return out.String(), added, removed
+}
+
+func textLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,139 @@
+package plumb
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-pipes/internal/history"
+)
+
+func TestLineDiff(t *testing.T) {
+	diff, added, removed := lineDiff("a\nb\n\nc\nd\n", "a\nc\n  d  \ne\n")
+	if diff != "- b\n+ e\n" || added != 1 || removed != 1 {
+		t.Errorf("unexpected diff (+%d -%d):\n%s", added, removed, diff)
+	}
+	if diff, _, _ := lineDiff("same", "same"); diff != "" {
+		t.Errorf("expected no diff, got %q", diff)
+	}
+	if diff, added, _ := lineDiff("", "new\nlines"); diff != "+ new\n+ lines\n" || added != 2 {
+		t.Errorf("expected all lines added, got %q", diff)
+	}
+}
+
+func TestWatchlist(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{
+		Settings: Settings{Watch: WatchSettings{Path: filepath.Join(dir, "watchlist.json"), Interval: "6h"}},
+		Jobs:     map[string]Job{"snap": {}},
+	}
+	var stdout, stderr bytes.Buffer
+
+	if err := runWatch([]string{"add", "https://example.com/pricing?utm_source=x"}, cfg, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if err := runWatch([]string{"add", "--interval", "1h", "--job", "snap", "https://example.com/docs"}, cfg, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if err := runWatch([]string{"add", "--job", "missing", "https://example.com/x"}, cfg, &stdout, &stderr); err == nil {
+		t.Error("expected an error for an undefined job")
+	}
+	if err := runWatch([]string{"list"}, cfg, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	out := stdout.String()
+	for _, want := range []string{"6h0m0s", "https://example.com/pricing\n", "1h0m0s", "snap"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in list output:\n%s", want, out)
+		}
+	}
+
+	if err := runWatch([]string{"remove", "https://example.com/pricing"}, cfg, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	items, _ := loadWatchlist(cfg.Settings.Watch.Path)
+	if len(items) != 1 || items[0].URL != "https://example.com/docs" {
+		t.Errorf("unexpected watchlist %+v", items)
+	}
+	if err := runWatch([]string{"remove", "https://example.com/pricing"}, cfg, &stdout, &stderr); err == nil {
+		t.Error("expected an error removing an unknown URL")
+	}
+}
+
+func TestCheckDue(t *testing.T) {
+	price := "10"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><head><title>Pricing</title></head><body><article><p>The plan costs %s dollars a month, billed yearly, with every feature included.</p><p>Support is included in every plan, by email and chat.</p></article></body></html>", price)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "changed")
+	cfg := &Config{
+		Settings: Settings{
+			History: HistorySettings{Enabled: true, Path: filepath.Join(dir, "history.db")},
+			Watch:   WatchSettings{Interval: "1h", Job: "notify"},
+		},
+		Jobs: map[string]Job{"notify": {Steps: []Step{
+			{Name: "run", Args: "cat '<<parameters.diff_file>>' > " + out + " && grep -q dollars '<<parameters.html_file>>'"},
+		}}},
+	}
+	path, _ := watchlistPath(cfg)
+	if path != filepath.Join(dir, "watchlist.json") {
+		t.Errorf("expected the watchlist next to the history, got %s", path)
+	}
+	if err := addWatch(path, ts.URL, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	check := func(at time.Time) {
+		t.Helper()
+		if err := checkDue(cfg, path, ts.Client(), at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first check only records the page.
+	check(now)
+	if _, err := os.Stat(out); err == nil {
+		t.Fatal("expected no job run on the first check")
+	}
+
+	// Not due yet, so a change goes unnoticed.
+	price = "12"
+	check(now.Add(30 * time.Minute))
+	if _, err := os.Stat(out); err == nil {
+		t.Fatal("expected no check before the interval")
+	}
+
+	check(now.Add(time.Hour))
+	diff, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("expected the job to run on a change: %v", err)
+	}
+	if !strings.Contains(string(diff), "- The plan costs 10 dollars") || !strings.Contains(string(diff), "+ The plan costs 12 dollars") {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+
+	items, _ := loadWatchlist(path)
+	if len(items) != 1 || items[0].Changed.IsZero() || items[0].Hash == "" {
+		t.Errorf("expected the change to be recorded, got %+v", items)
+	}
+	if entries, _ := history.Read(cfg.Settings.History.Path); len(entries) == 0 || entries[len(entries)-1].Origin != "watch" {
+		t.Errorf("expected a history entry for the watch run, got %+v", entries)
+	}
+
+	// Unchanged pages do not run the job again.
+	os.Remove(out)
+	check(now.Add(2 * time.Hour))
+	if _, err := os.Stat(out); err == nil {
+		t.Error("expected no job run for an unchanged page")
+	}
+}
@@ -0,0 +1,204 @@
+package plumb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ytdlpMarker prefixes the lines plumber asks yt-dlp to print, so they can
+// be told apart from its regular output.
+const ytdlpMarker = "[browser-pipes]"
+
+// ytdlpParams are the parameters of the built-in ytdlp step.
+var ytdlpParams = []string{"format", "output", "cookies", "args", "save_to"}
+
+// executeYtdlp runs the built-in ytdlp step:
+//
+//   - ytdlp:
+//     format: "bv*[height<=1080]+ba/b"
+//     output: "%(uploader)s/%(title)s.%(ext)s"
+//
+// Downloads go to snapshot_folder unless output is absolute, and use the
+// snapshot_cookies file unless cookies is set and the snapshot_proxy.
+// snapshot_on_conflict skip or overwrite maps to yt-dlp's overwrite flags;
+// version, which yt-dlp has no flag for, keeps its default of skipping
+// files it already downloaded.
+// Progress is logged in 10% steps instead of yt-dlp's progress bar, and
+// save_to captures the path of the downloaded file.
+func executeYtdlp(cfg *Config, rs *routeState, step Step, scopeParams map[string]string, url string, workspace string) error {
+	param := func(name string) string {
+		return resolveParams(step.Params[name], scopeParams)
+	}
+
+	folder := scopeParams["snapshot_folder"]
+	output := param("output")
+	if folder == "" && !strings.HasPrefix(expandHome(output), "/") {
+		return fmt.Errorf("ytdlp step needs an absolute output or settings.snapshot.folder")
+	}
+
+	args := []string{
+		"yt-dlp", "--newline", "--progress",
+		"--progress-template", shellQuote("download:" + ytdlpMarker + " progress %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s %(progress.speed)s %(progress.eta)s"),
+		"--print", shellQuote("after_move:" + ytdlpMarker + " file %(filepath)s"),
+	}
+	if folder != "" {
+		args = append(args, "--paths", shellQuote(folder))
+	}
+	if output != "" {
+		args = append(args, "--output", shellQuote(expandHome(output)))
+	}
+	if format := param("format"); format != "" {
+		args = append(args, "--format", shellQuote(format))
+	}
+	cookies := param("cookies")
+	if cookies == "" {
+		cookies = scopeParams["snapshot_cookies"]
+	}
+	if cookies != "" {
+		args = append(args, "--cookies", shellQuote(expandHome(cookies)))
+	}
+	if p := scopeParams["snapshot_proxy"]; p != "" {
+		args = append(args, "--proxy", shellQuote(p))
+	}
+	switch scopeParams["snapshot_on_conflict"] {
+	case "skip":
+		args = append(args, "--no-overwrites")
+	case "overwrite":
+		args = append(args, "--force-overwrites")
+	}
+	if extra := param("args"); extra != "" {
+		args = append(args, extra)
+	}
+	script := strings.Join(append(args, "--", shellQuote(url)), " ")
+
+	log.Printf("   📺 Running yt-dlp: %s", script)
+
+	// Both streams are read line by line: the progress template goes to
+	// stdout, warnings and errors to stderr.
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = os.Environ()
+	cmd.Dir = workspace
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	if err := cmd.Start(); err != nil {
+		cfg.logCommand(rs, cmd, url, err)
+		return fmt.Errorf("ytdlp step failed to start: %w", err)
+	}
+	done := make(chan []string)
+	go func() {
+		done <- followYtdlp(pr)
+	}()
+	err := cmd.Wait()
+	pw.Close()
+	files := <-done
+	cfg.logCommand(rs, cmd, url, err)
+	if err != nil {
+		return fmt.Errorf("ytdlp step failed: %w", err)
+	}
+
+	for _, f := range files {
+		log.Printf("   📼 Downloaded: %s", f)
+	}
+	if saveTo := step.Params["save_to"]; saveTo != "" && len(files) > 0 {
+		scopeParams[saveTo] = files[len(files)-1]
+		log.Printf("   📝 Captured output to << parameters.%s >>: %s", saveTo, scopeParams[saveTo])
+	}
+	return nil
+}
+
+// followYtdlp logs yt-dlp's output as it comes, condensing progress lines,
+// and returns the paths of the downloaded files.
+func followYtdlp(r io.Reader) []string {
+	var files []string
+	var progress ytdlpProgress
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		rest, ok := strings.CutPrefix(line, ytdlpMarker+" ")
+		switch {
+		case line == "":
+		case !ok:
+			log.Printf("   %s", line)
+		case strings.HasPrefix(rest, "file "):
+			files = append(files, strings.TrimPrefix(rest, "file "))
+		case strings.HasPrefix(rest, "progress "):
+			if msg := progress.update(strings.Fields(strings.TrimPrefix(rest, "progress "))); msg != "" {
+				log.Printf("   ⬇️ %s", msg)
+			}
+		}
+	}
+	// Keep draining so yt-dlp never blocks on a full pipe.
+	io.Copy(io.Discard, r)
+	return files
+}
+
+// ytdlpProgress condenses yt-dlp's many progress lines per second into one
+// message per 10% downloaded. yt-dlp reports each file of a download (e.g.
+// video and audio before merging) separately.
+type ytdlpProgress struct {
+	downloaded float64
+	step       int
+}
+
+// update takes the fields of a progress line (downloaded, total, estimated
+// total, speed, ETA; "NA" when unknown) and returns a message when another
+// 10% step has been reached, or "" otherwise.
+func (p *ytdlpProgress) update(fields []string) string {
+	if len(fields) != 5 {
+		return ""
+	}
+	num := func(s string) float64 {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0
+		}
+		return v
+	}
+	downloaded, total, speed, eta := num(fields[0]), num(fields[1]), num(fields[3]), num(fields[4])
+	if total == 0 {
+		total = num(fields[2])
+	}
+	if total == 0 {
+		return ""
+	}
+
+	if downloaded < p.downloaded {
+		p.step = 0 // next file
+	}
+	p.downloaded = downloaded
+
+	step := min(int(downloaded/total*10), 10)
+	if step <= p.step {
+		return ""
+	}
+	p.step = step
+
+	msg := fmt.Sprintf("%d%% of %s", step*10, formatBytes(total))
+	if step < 10 && speed > 0 {
+		msg += fmt.Sprintf(" at %s/s, ETA %s", formatBytes(speed), time.Duration(eta)*time.Second)
+	}
+	return msg
+}
+
+// formatBytes renders n bytes with a binary unit, e.g. "12.3 MiB".
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
@@ -0,0 +1,88 @@
+package plumb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestYtdlpProgress(t *testing.T) {
+	var p ytdlpProgress
+	var msgs []string
+	for _, line := range []string{
+		"0 1048576 NA NA NA",
+		"52428 1048576 NA 1024 20",
+		"104858 1048576 NA 2048 10",
+		"524288 NA 1048576 2048 5",
+		"1048576 1048576 NA 2048 0",
+		"1024 2048 NA 512 1", // second file restarts the steps
+		"2048 2048 NA 512 0",
+		"garbage",
+	} {
+		if msg := p.update(strings.Fields(line)); msg != "" {
+			msgs = append(msgs, msg)
+		}
+	}
+	want := []string{
+		"10% of 1.0 MiB at 2.0 KiB/s, ETA 10s",
+		"50% of 1.0 MiB at 2.0 KiB/s, ETA 5s",
+		"100% of 1.0 MiB",
+		"50% of 2.0 KiB at 512 B/s, ETA 1s",
+		"100% of 2.0 KiB",
+	}
+	if strings.Join(msgs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected progress messages:\n%s", strings.Join(msgs, "\n"))
+	}
+}
+
+func TestExecuteYtdlp(t *testing.T) {
+	bin := t.TempDir()
+	argsFile := filepath.Join(bin, "args")
+	script := `#!/bin/sh
+printf '%s\n' "$@" > ` + argsFile + `
+echo "[youtube] abc: Downloading webpage"
+echo "[browser-pipes] progress 50 100 NA 10 5"
+echo "[browser-pipes] progress 100 100 NA 10 0"
+echo "[browser-pipes] file /videos/Clip [abc].mp4"
+`
+	if err := os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	scope := map[string]string{"snapshot_folder": "/videos", "snapshot_cookies": "/tmp/cookies.txt", "snapshot_proxy": "socks5h://127.0.0.1:9050", "snapshot_on_conflict": "overwrite", "quality": "720"}
+	step := Step{Name: "ytdlp", Params: map[string]string{
+		"format":  "bv*[height<=<<parameters.quality>>]+ba/b",
+		"output":  "%(title)s [%(id)s].%(ext)s",
+		"args":    "--embed-subs",
+		"save_to": "video",
+	}}
+	if err := executeYtdlp(&Config{}, &routeState{}, step, scope, "https://youtube.com/watch?v=abc", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if scope["video"] != "/videos/Clip [abc].mp4" {
+		t.Errorf("expected the downloaded file in save_to, got %q", scope["video"])
+	}
+
+	data, _ := os.ReadFile(argsFile)
+	args := string(data)
+	for _, want := range []string{
+		"--paths\n/videos\n",
+		"--output\n%(title)s [%(id)s].%(ext)s\n",
+		"--format\nbv*[height<=720]+ba/b\n",
+		"--cookies\n/tmp/cookies.txt\n",
+		"--proxy\nsocks5h://127.0.0.1:9050\n",
+		"--force-overwrites\n",
+		"--embed-subs\n--\nhttps://youtube.com/watch?v=abc\n",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected %q in yt-dlp arguments:\n%s", want, args)
+		}
+	}
+
+	delete(scope, "snapshot_folder")
+	if err := executeYtdlp(&Config{}, &routeState{}, Step{Name: "ytdlp"}, scope, "https://youtube.com/watch?v=abc", t.TempDir()); err == nil {
+		t.Error("expected an error without an output folder")
+	}
+}
@@ -0,0 +1,39 @@
+package readmd
+
+import (
+	"unicode/utf8"
+
+	"github.com/gogs/chardet"
+	"golang.org/x/net/html/charset"
+)
+
+// DecodeHTML returns body as UTF-8 for parsing. The charset comes from a
+// byte order mark or the Content-Type header; otherwise a page that is valid
+// UTF-8 is taken as is (the browser sends its DOM that way, whatever its
+// <meta> says), then the <meta> charset applies, then a guess from the bytes.
+// Undecodable pages are returned unchanged.
+func DecodeHTML(body []byte, contentType string) []byte {
+	enc, name, certain := charset.DetermineEncoding(body, contentType)
+	if !certain {
+		if utf8.Valid(body) {
+			return body
+		}
+		// DetermineEncoding falls back to windows-1252 when there is no
+		// <meta> charset to go by.
+		if name == "windows-1252" {
+			if guess, err := chardet.NewHtmlDetector().DetectBest(body); err == nil {
+				if e, n := charset.Lookup(guess.Charset); e != nil {
+					enc, name = e, n
+				}
+			}
+		}
+	}
+	if name == "utf-8" {
+		return body
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
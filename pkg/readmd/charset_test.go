@@ -0,0 +1,39 @@
+package readmd
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestDecodeHTML(t *testing.T) {
+	encode := func(e encoding.Encoding, s string) []byte {
+		b, err := e.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	japaneseText := "<p>日本語の記事です。文字化けしないこと。</p>"
+	russianText := "<p>" + strings.Repeat("Это статья на русском языке, и она должна читаться без искажений. ", 5) + "</p>"
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		want        string
+	}{
+		{"meta charset", encode(japanese.ShiftJIS, `<html><head><meta charset="shift_jis"></head><body>`+japaneseText), "", japaneseText},
+		{"content type", encode(japanese.ShiftJIS, "<html><body>"+japaneseText), "text/html; charset=Shift_JIS", japaneseText},
+		{"guessed", encode(charmap.Windows1251, "<html><body>"+russianText), "text/html", russianText},
+		{"utf-8 with a stale meta", []byte(`<html><head><meta charset="shift_jis"></head><body>` + japaneseText), "", japaneseText},
+	}
+	for _, tt := range tests {
+		if got := string(DecodeHTML(tt.body, tt.contentType)); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: expected %q in %q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package readmd
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// footnoteTag is the element a footnote reference is swapped for before
+// conversion; footnoteRule renders it as [^label].
+const footnoteTag = "browser-pipes-footnote"
+
+// footnote is a note pulled out of the article, as HTML.
+type footnote struct {
+	label string
+	html  string
+}
+
+// footnoteRule renders the references footnotes left in the article.
+var footnoteRule = md.Rule{
+	Filter: []string{footnoteTag},
+	Replacement: func(_ string, selec *goquery.Selection, _ *md.Options) *string {
+		return md.String("[^" + selec.AttrOr("data-label", "") + "]")
+	},
+}
+
+// footnotes finds the references in contentHTML that point at a footnote
+// or endnote of the same article, such as <sup><a href="#fn1">1</a></sup>
+// into a list of notes or Wikipedia's cite notes, and swaps each for a
+// footnoteTag. The notes are cut out of the article, without their
+// backlinks, and returned in order of first reference. Links to anything
+// else are left alone.
+func footnotes(contentHTML string) (string, []footnote, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(contentHTML), body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read footnotes: %w", err)
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+
+	ids := make(map[string]*html.Node)
+	var anchors []*html.Node
+	walk(body, func(n *html.Node) {
+		if id := attr(n, "id"); id != "" {
+			if _, ok := ids[id]; !ok {
+				ids[id] = n
+			}
+		}
+		if n.DataAtom == atom.A {
+			anchors = append(anchors, n)
+		}
+	})
+
+	type ref struct{ anchor, note *html.Node }
+	var refs []ref
+	var notes []*html.Node
+	for _, a := range anchors {
+		u, err := url.Parse(attr(a, "href"))
+		if err != nil || u.Fragment == "" || !isNoteRef(a) {
+			continue
+		}
+		if note := ids[u.Fragment]; note != nil && isNote(note) && !contains(note, a) {
+			refs = append(refs, ref{a, note})
+			if !slices.Contains(notes, note) {
+				notes = append(notes, note)
+			}
+		}
+	}
+	if len(refs) == 0 {
+		return contentHTML, nil, nil
+	}
+
+	labels := make(map[*html.Node]string)
+	backlinks := make(map[string]bool)
+	for _, r := range refs {
+		if slices.ContainsFunc(notes, func(note *html.Node) bool { return contains(note, r.anchor) }) {
+			continue // a note citing another note keeps its link
+		}
+		label, ok := labels[r.note]
+		if !ok {
+			label = strconv.Itoa(len(labels) + 1)
+			labels[r.note] = label
+		}
+		old := r.anchor
+		if p := old.Parent; p != nil && p.DataAtom == atom.Sup && strings.TrimSpace(textContent(p)) == strings.TrimSpace(textContent(old)) {
+			old = p
+		}
+		for _, n := range []*html.Node{r.anchor, old} {
+			if id := attr(n, "id"); id != "" {
+				backlinks[id] = true
+			}
+		}
+		old.Parent.InsertBefore(&html.Node{
+			Type: html.ElementNode,
+			Data: footnoteTag,
+			Attr: []html.Attribute{{Key: "data-label", Val: label}},
+		}, old)
+		old.Parent.RemoveChild(old)
+	}
+
+	var out []footnote
+	for _, note := range notes {
+		label, ok := labels[note]
+		if !ok {
+			continue
+		}
+		removeBacklinks(note, backlinks)
+		var b strings.Builder
+		for c := note.FirstChild; c != nil; c = c.NextSibling {
+			if err := html.Render(&b, c); err != nil {
+				return "", nil, fmt.Errorf("failed to read footnotes: %w", err)
+			}
+		}
+		out = append(out, footnote{label: label, html: b.String()})
+		// Drop the note, then the list and section it leaves empty.
+		for n := note; n != body && n.Parent != nil; {
+			parent := n.Parent
+			parent.RemoveChild(n)
+			if parent == body || !isEmpty(parent) {
+				break
+			}
+			n = parent
+		}
+	}
+	slices.SortFunc(out, func(a, b footnote) int {
+		x, _ := strconv.Atoi(a.label)
+		y, _ := strconv.Atoi(b.label)
+		return x - y
+	})
+
+	var b strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return "", nil, fmt.Errorf("failed to read footnotes: %w", err)
+		}
+	}
+	return b.String(), out, nil
+}
+
+// isNoteRef reports whether a looks like a footnote reference: a
+// superscript link or one marked as a note reference.
+func isNoteRef(a *html.Node) bool {
+	if attr(a, "role") == "doc-noteref" || (a.Parent != nil && a.Parent.DataAtom == atom.Sup) {
+		return true
+	}
+	for c := a.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Sup {
+			return true
+		}
+	}
+	return false
+}
+
+// isNote reports whether n looks like the note a reference points at: a
+// list item or an element marked as a footnote.
+func isNote(n *html.Node) bool {
+	if n.DataAtom == atom.Li {
+		return true
+	}
+	switch attr(n, "role") {
+	case "doc-footnote", "doc-endnote":
+		return true
+	}
+	return slices.ContainsFunc(strings.Fields(attr(n, "class")), func(class string) bool {
+		return strings.Contains(strings.ToLower(class), "footnote")
+	})
+}
+
+// removeBacklinks removes the links of note back to its references, and
+// the "^" or "↩" wrappers they leave empty.
+func removeBacklinks(note *html.Node, backlinks map[string]bool) {
+	var links []*html.Node
+	walk(note, func(n *html.Node) {
+		if n.DataAtom != atom.A {
+			return
+		}
+		href := attr(n, "href")
+		if attr(n, "role") == "doc-backlink" || (strings.HasPrefix(href, "#") && backlinks[href[1:]]) {
+			links = append(links, n)
+		}
+	})
+	for _, n := range links {
+		for n.Parent != nil && n.Parent != note {
+			parent := n.Parent
+			parent.RemoveChild(n)
+			if strings.Trim(textContent(parent), " \t\n^↩↑") != "" {
+				break
+			}
+			n = parent
+		}
+		if n.Parent == note {
+			note.RemoveChild(n)
+		}
+	}
+}
+
+// isEmpty reports whether n holds nothing but whitespace and rules.
+func isEmpty(n *html.Node) bool {
+	empty := true
+	walk(n, func(c *html.Node) {
+		if c == n {
+			return
+		}
+		switch {
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) != "":
+			empty = false
+		case c.Type == html.ElementNode && c.DataAtom != atom.Hr:
+			empty = false
+		}
+	})
+	return empty
+}
+
+// appendFootnotes adds the converted notes to the end of markdown, with
+// the lines after the first indented under their label so a note can hold
+// several paragraphs.
+func appendFootnotes(markdown string, converter *md.Converter, notes []footnote) (string, error) {
+	if len(notes) == 0 {
+		return markdown, nil
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(markdown, "\n") + "\n\n")
+	for _, note := range notes {
+		text, err := converter.ConvertString(note.html)
+		if err != nil {
+			return "", fmt.Errorf("failed to convert footnote %s: %w", note.label, err)
+		}
+		for i, line := range strings.Split(strings.TrimSpace(text), "\n") {
+			switch {
+			case i == 0:
+				b.WriteString("[^" + note.label + "]: " + line)
+			case line == "":
+			default:
+				b.WriteString("    " + line)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+func contains(n, descendant *html.Node) bool {
+	for p := descendant; p != nil; p = p.Parent {
+		if p == n {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,184 @@
+package readmd
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"unicode"
+
+	readability "codeberg.org/readeck/go-readability/v2"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// stopwords are frequent short words of the Latin-script languages Language
+// tells apart by their text.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "that", "with", "for", "was", "this", "are", "it", "you", "have", "not", "be", "on"},
+	"es": {"el", "los", "las", "del", "que", "y", "en", "una", "por", "con", "para", "es", "se", "no", "lo", "como", "más"},
+	"fr": {"le", "les", "des", "et", "est", "une", "du", "que", "dans", "pour", "pas", "sur", "qui", "au", "avec", "ce", "il"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "ein", "eine", "den", "zu", "von", "sich", "auch", "auf", "für", "dem"},
+	"it": {"il", "di", "che", "è", "la", "per", "non", "una", "sono", "del", "della", "con", "gli", "anche", "come", "più", "nel"},
+	"pt": {"o", "os", "da", "do", "que", "não", "uma", "em", "para", "com", "é", "dos", "das", "mais", "como", "ao", "seu"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "met", "zijn", "voor", "ook", "er", "maar", "aan"},
+}
+
+// Language returns the language of the article as a lowercase ISO 639
+// code such as "en", without region: the one its content element, the
+// page's <html lang> or its content-language metadata declare, else a
+// guess from the script and common words of its text. It is "" when
+// neither says.
+func Language(body []byte, article readability.Article) string {
+	if lang := primaryLanguage(contentLang(article.Node)); lang != "" {
+		return lang
+	}
+	if lang := primaryLanguage(article.Language()); lang != "" {
+		return lang
+	}
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+		for _, sel := range []string{`meta[http-equiv="content-language" i]`, `meta[name="language" i]`, `meta[property="og:locale"]`} {
+			if lang := primaryLanguage(doc.Find(sel).First().AttrOr("content", "")); lang != "" {
+				return lang
+			}
+		}
+	}
+
+	var text strings.Builder
+	if article.Node != nil {
+		if err := article.RenderText(&text); err != nil {
+			return ""
+		}
+	}
+	return GuessLanguage(text.String())
+}
+
+// contentLang returns the lang attribute of the content element, which
+// readability wraps in a <div> of its own, or "".
+func contentLang(n *html.Node) string {
+	for n != nil {
+		if lang := attr(n, "lang"); lang != "" {
+			return lang
+		}
+		var only *html.Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				if only != nil {
+					return ""
+				}
+				only = c
+			} else if c.Type == html.TextNode && strings.TrimSpace(c.Data) != "" {
+				return ""
+			}
+		}
+		n = only
+	}
+	return ""
+}
+
+// primaryLanguage returns the primary subtag of a BCP 47 tag ("en-US",
+// "pt_BR", "fr"), or "" for anything that is not one.
+func primaryLanguage(tag string) string {
+	tag, _, _ = strings.Cut(strings.TrimSpace(tag), ",") // content-language may list several
+	tag, _, _ = strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	tag = strings.ToLower(tag)
+	if len(tag) < 2 || len(tag) > 3 {
+		return ""
+	}
+	for _, r := range tag {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+	return tag
+}
+
+// GuessLanguage guesses the language of text: by its script when most of
+// its letters are not Latin, else by the common words of a handful of
+// European languages. It returns "" when text is too short or unclear.
+func GuessLanguage(text string) string {
+	scripts := make(map[string]int)
+	var letters int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			scripts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				scripts["uk"]++
+			}
+			scripts["ru"]++
+		case unicode.Is(unicode.Arabic, r):
+			if strings.ContainsRune("پچژگ", r) {
+				scripts["fa"]++
+			}
+			scripts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Thai, r):
+			scripts["th"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		}
+	}
+	if letters < 20 {
+		return ""
+	}
+
+	// Japanese mixes kana into Han; Ukrainian and Persian add letters to
+	// the Cyrillic and Arabic alphabets.
+	cjk := scripts["ja"] + scripts["ko"] + scripts["zh"]
+	switch {
+	case cjk*2 > letters && scripts["ja"]*20 > cjk:
+		return "ja"
+	case cjk*2 > letters && scripts["ko"] >= scripts["zh"]:
+		return "ko"
+	case cjk*2 > letters:
+		return "zh"
+	case scripts["ru"]*2 > letters && scripts["uk"] > 0:
+		return "uk"
+	case scripts["ar"]*2 > letters && scripts["fa"] > 0:
+		return "fa"
+	}
+	for _, lang := range []string{"ru", "ar", "he", "el", "th", "hi"} {
+		if scripts[lang]*2 > letters {
+			return lang
+		}
+	}
+
+	hits := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	for _, w := range words {
+		for lang, list := range stopwords {
+			if slices.Contains(list, w) {
+				hits[lang]++
+			}
+		}
+	}
+	best, second := "", 0
+	for lang, n := range hits {
+		if best == "" || n > hits[best] || (n == hits[best] && lang < best) {
+			if best != "" {
+				second = max(second, hits[best])
+			}
+			best = lang
+		} else {
+			second = max(second, n)
+		}
+	}
+	// A winner needs enough common words, and clearly more than the
+	// runner-up, since the lists share a few.
+	if best == "" || hits[best] < 3 || hits[best]*10 < len(words) || hits[best]*2 < second*3 {
+		return ""
+	}
+	return best
+}
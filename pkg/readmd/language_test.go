@@ -0,0 +1,57 @@
+package readmd
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestLanguage(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/post")
+	english := "<p>This is the story of the town and the people who have lived in it for a long time, and it is not over.</p>"
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{"HTML Lang", `<html lang="pt-BR"><body><article>` + english + `</article></body></html>`, "pt"},
+		{"Article Lang", `<html lang="en"><body><article lang="fr_CA">` + english + `</article></body></html>`, "fr"},
+		{"Content-Language", `<html><head><meta http-equiv="Content-Language" content="de, en"></head><body><article>` + english + `</article></body></html>`, "de"},
+		{"OG Locale", `<html><head><meta property="og:locale" content="es_ES"></head><body><article>` + english + `</article></body></html>`, "es"},
+		{"Guessed", `<html lang="x-klingon-long"><body><article>` + english + `</article></body></html>`, "en"},
+		{"Unknown", `<html><body><article><p>12345 67890</p></article></body></html>`, ""},
+	}
+	for _, tt := range tests {
+		article, err := Extract([]byte(tt.page), pageURL, Options{MinChars: 10})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := Language([]byte(tt.page), article); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGuessLanguage(t *testing.T) {
+	tests := map[string]string{
+		"The quick brown fox jumps over the lazy dog, and this is the end of it.":                         "en",
+		"El perro de los vecinos duerme en la casa y no quiere salir con nosotros para la fiesta.":        "es",
+		"Le chat de la voisine est dans le jardin et il ne veut pas rentrer avec les enfants.":            "fr",
+		"Der Hund ist nicht mit den Kindern auf der Straße, sondern sitzt auch heute in dem Haus.":        "de",
+		"Il cane della vicina non è in casa, e anche oggi gioca con gli amici nel giardino più grande.":   "it",
+		"O cão da vizinha não está em casa, e hoje brinca com os amigos no jardim mais bonito do bairro.": "pt",
+		"De hond van de buren is niet in het huis, maar speelt ook vandaag met de kinderen op straat.":    "nl",
+		"今日はとても良い天気ですね。私は公園へ散歩に行きました。":                                                                    "ja",
+		"今天天气很好，我们一起去公园散步吧，然后回家吃饭。":                                                                       "zh",
+		"오늘은 날씨가 정말 좋네요. 공원에 산책하러 갔어요.":                                                                   "ko",
+		"Сегодня очень хорошая погода, и мы пошли гулять в парк.":                                         "ru",
+		"Сьогодні дуже гарна погода, і ми пішли гуляти в парк.":                                           "uk",
+		"Σήμερα ο καιρός είναι πολύ καλός και πήγαμε βόλτα στο πάρκο.":                                    "el",
+		"short":                                  "",
+		"Lorem ipsum dolor sit amet consectetur": "",
+	}
+	for text, want := range tests {
+		if got := GuessLanguage(text); got != want {
+			t.Errorf("GuessLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
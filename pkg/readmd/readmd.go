@@ -0,0 +1,296 @@
+// Package readmd extracts the article of a web page with go-readability and
+// converts it to markdown. It is the extraction go-read-md snapshots with
+// and plumber watch compares, so both see the same article text for the
+// same settings. Other programs import it to extract articles the same way.
+package readmd
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	readability "codeberg.org/readeck/go-readability/v2"
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/plugin"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// PreserveKinds are the element kinds Options.Preserve can protect from
+// readability's cleanup.
+var PreserveKinds = []string{"tables", "figures", "images"}
+
+// placeholderPrefix starts the text that stands in for a preserved element
+// while readability runs.
+const placeholderPrefix = "browser-pipes-preserved-"
+
+// Options tune go-readability for pages its defaults mangle. The zero value
+// keeps the library defaults.
+type Options struct {
+	MinChars        int      // minimum article length before retrying with looser rules
+	TopCandidates   int      // number of top-scoring candidates compared
+	KeepClasses     bool     // keep class attributes in the article HTML
+	PreserveClasses []string // classes kept even without KeepClasses
+	Preserve        []string // element kinds protected from cleanup, see PreserveKinds
+	Debug           bool     // log candidate scoring and removals to stderr
+}
+
+// ParsePreserve parses a comma-separated list of PreserveKinds, such as the
+// --preserve value of go-read-md.
+func ParsePreserve(value string) ([]string, error) {
+	var kinds []string
+	for _, k := range strings.Split(value, ",") {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" {
+			continue
+		}
+		if !slices.Contains(PreserveKinds, k) {
+			return nil, fmt.Errorf("invalid --preserve value %q (use %s)", k, strings.Join(PreserveKinds, ", "))
+		}
+		if !slices.Contains(kinds, k) {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds, nil
+}
+
+// Extract runs go-readability over body with opts applied.
+func Extract(body []byte, pageURL *url.URL, opts Options) (readability.Article, error) {
+	parser := readability.NewParser()
+	if opts.MinChars > 0 {
+		parser.CharThresholds = opts.MinChars
+	}
+	if opts.TopCandidates > 0 {
+		parser.NTopCandidates = opts.TopCandidates
+	}
+	parser.KeepClasses = opts.KeepClasses
+	parser.ClassesToPreserve = append(parser.ClassesToPreserve, opts.PreserveClasses...)
+	if opts.Debug {
+		parser.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	if len(opts.Preserve) == 0 {
+		return parser.Parse(bytes.NewReader(body), pageURL)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return readability.Article{}, fmt.Errorf("failed to parse input: %w", err)
+	}
+	kept := stash(doc, opts.Preserve)
+	article, err := parser.ParseAndMutate(doc.Nodes[0], pageURL)
+	if err == nil && article.Node != nil {
+		restore(article.Node, kept, pageURL)
+	}
+	return article, err
+}
+
+// stash swaps the elements readability should not touch for short text
+// placeholders and returns the originals by placeholder. Readability judges
+// a container by its text and link density, so a figure or data table is
+// often dropped together with the div around it; a line of text survives
+// those checks and is swapped back by restore.
+func stash(doc *goquery.Document, kinds []string) map[string]*html.Node {
+	var targets []string
+	for _, kind := range kinds {
+		switch kind {
+		case "tables":
+			targets = append(targets, "table")
+		case "figures":
+			targets = append(targets, "figure")
+		case "images":
+			targets = append(targets, "picture", "img")
+		}
+	}
+	selector := strings.Join(targets, ", ")
+
+	kept := make(map[string]*html.Node)
+	doc.Find(selector).Each(func(_ int, s *goquery.Selection) {
+		// Only stash the outermost match: an image in a figure or picture
+		// is kept with it.
+		if s.ParentsFiltered(selector).Length() > 0 || isLayoutTable(s) {
+			return
+		}
+		node := s.Get(0)
+		tag := "p"
+		if node.Data == "img" || node.Data == "picture" {
+			if p := node.Parent; p != nil && (p.Data == "a" || p.Data == "p" || p.Data == "span") {
+				tag = "span" // inline image, keep the paragraph intact
+			}
+		}
+		token := fmt.Sprintf("%s%d", placeholderPrefix, len(kept))
+		placeholder := &html.Node{Type: html.ElementNode, Data: tag, DataAtom: atom.Lookup([]byte(tag))}
+		placeholder.AppendChild(&html.Node{Type: html.TextNode, Data: token})
+		node.Parent.InsertBefore(placeholder, node)
+		node.Parent.RemoveChild(node)
+		kept[token] = node
+	})
+	return kept
+}
+
+// isLayoutTable reports whether a table lays out the page rather than
+// holding data. Stashing one would hide the article itself.
+func isLayoutTable(s *goquery.Selection) bool {
+	if goquery.NodeName(s) != "table" {
+		return false
+	}
+	if role, _ := s.Attr("role"); role == "presentation" {
+		return true
+	}
+	return s.Find("table, p, article, main, h1, h2").Length() > 0
+}
+
+// restore puts the stashed elements back in place of the placeholders that
+// made it into the article, resolving their links against pageURL as
+// readability does for the rest of the content.
+func restore(root *html.Node, kept map[string]*html.Node, pageURL *url.URL) {
+	var placeholders []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode && strings.HasPrefix(strings.TrimSpace(n.Data), placeholderPrefix) {
+			placeholders = append(placeholders, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	for _, text := range placeholders {
+		original, ok := kept[strings.TrimSpace(text.Data)]
+		if !ok {
+			continue
+		}
+		ResolveLinks(original, pageURL)
+		// Replace the placeholder element when the token is all it holds.
+		target := text
+		if p := text.Parent; p != nil && p != root && p.FirstChild == text && p.LastChild == text {
+			target = p
+		}
+		target.Parent.InsertBefore(original, target)
+		target.Parent.RemoveChild(target)
+	}
+}
+
+// ResolveLinks makes the URLs in n and its descendants absolute.
+func ResolveLinks(n *html.Node, base *url.URL) {
+	if n.Type == html.ElementNode {
+		for i, a := range n.Attr {
+			switch a.Key {
+			case "src", "href", "poster":
+				n.Attr[i].Val = resolveURL(base, a.Val)
+			case "srcset":
+				candidates := strings.Split(a.Val, ",")
+				for j, c := range candidates {
+					fields := strings.Fields(c)
+					if len(fields) > 0 {
+						fields[0] = resolveURL(base, fields[0])
+						candidates[j] = strings.Join(fields, " ")
+					}
+				}
+				n.Attr[i].Val = strings.Join(candidates, ", ")
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		ResolveLinks(c, base)
+	}
+}
+
+// resolveURL resolves ref against base, leaving fragments, data: URLs and
+// unparsable values alone.
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "data:") {
+		return ref
+	}
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// MarkdownPlugins are the GitHub Flavored Markdown extensions
+// MarkdownOptions.Plugins can enable; "gfm" stands for all of them.
+// "footnotes" turns the article's footnote references and notes into
+// [^1] references and definitions instead of links to anchors the
+// snapshot no longer has.
+var MarkdownPlugins = []string{"tables", "strikethrough", "task-lists", "footnotes"}
+
+// CodeFences are the code block fences MarkdownOptions.CodeFence can pick:
+// ``` (the default) or ~~~.
+var CodeFences = []string{"backticks", "tildes"}
+
+// MarkdownOptions tune the html-to-markdown conversion.
+type MarkdownOptions struct {
+	Plugins   []string  // MarkdownPlugins to enable
+	CodeFence string    // one of CodeFences
+	Rules     []md.Rule // override the rules for their elements, such as a flavor's link syntax
+}
+
+// ParseMarkdownPlugins parses a comma-separated list of MarkdownPlugins,
+// such as the --markdown-plugins value of go-read-md.
+func ParseMarkdownPlugins(value string) ([]string, error) {
+	var plugins []string
+	for _, p := range strings.Split(value, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		var add []string
+		switch {
+		case p == "":
+		case p == "gfm":
+			add = MarkdownPlugins
+		case slices.Contains(MarkdownPlugins, p):
+			add = []string{p}
+		default:
+			return nil, fmt.Errorf("invalid --markdown-plugins value %q (use %s or gfm)", p, strings.Join(MarkdownPlugins, ", "))
+		}
+		for _, p := range add {
+			if !slices.Contains(plugins, p) {
+				plugins = append(plugins, p)
+			}
+		}
+	}
+	return plugins, nil
+}
+
+// Markdown converts extracted article HTML into markdown.
+func Markdown(contentHTML string, opts MarkdownOptions) (string, error) {
+	var options md.Options
+	switch opts.CodeFence {
+	case "", "backticks":
+	case "tildes":
+		options.Fence = "~~~"
+	default:
+		return "", fmt.Errorf("invalid code fence %q (use %s)", opts.CodeFence, strings.Join(CodeFences, ", "))
+	}
+	var notes []footnote
+	if slices.Contains(opts.Plugins, "footnotes") {
+		var err error
+		if contentHTML, notes, err = footnotes(contentHTML); err != nil {
+			return "", err
+		}
+	}
+	converter := md.NewConverter("", true, &options)
+	converter.AddRules(footnoteRule)
+	for _, p := range opts.Plugins {
+		switch p {
+		case "tables":
+			converter.Use(plugin.Table())
+		case "strikethrough":
+			converter.Use(plugin.Strikethrough(""))
+		case "task-lists":
+			converter.Use(plugin.TaskListItems())
+		}
+	}
+	converter.AddRules(opts.Rules...)
+	markdown, err := converter.ConvertString(contentHTML)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert to markdown: %w", err)
+	}
+	return appendFootnotes(markdown, converter, notes)
+}
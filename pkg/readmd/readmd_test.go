@@ -0,0 +1,192 @@
+package readmd
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExtractPreserve(t *testing.T) {
+	para := "<p>" + strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor. ", 8) + "</p>"
+	page := func(inner string) []byte {
+		return []byte("<html><head><title>T</title></head><body><article>" + para + inner + para + "</article></body></html>")
+	}
+	pageURL, _ := url.Parse("https://example.com/post/")
+
+	tests := []struct {
+		name     string
+		inner    string
+		preserve []string
+		want     string
+	}{
+		{
+			name:     "table",
+			inner:    `<div><table><tr><td>k</td><td>v</td></tr><tr><td><a href="1">l1</a></td><td><a href="2">l2</a></td></tr></table></div>`,
+			preserve: []string{"tables"},
+			want:     `<a href="https://example.com/post/1">l1</a>`,
+		},
+		{
+			name:     "images",
+			inner:    `<div><img src="b.png"><img srcset="c.png 1x, /d.png 2x"></div>`,
+			preserve: []string{"images"},
+			want:     `<img srcset="https://example.com/post/c.png 1x, https://example.com/d.png 2x"/>`,
+		},
+		{
+			name:     "figure",
+			inner:    `<div><figure><img src="a.png"><figcaption>One</figcaption></figure></div>`,
+			preserve: []string{"figures"},
+			want:     `<figure><img src="https://example.com/post/a.png"/><figcaption>One</figcaption></figure>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			render := func(opts Options) string {
+				article, err := Extract(page(tt.inner), pageURL, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var b strings.Builder
+				if err := article.RenderHTML(&b); err != nil {
+					t.Fatal(err)
+				}
+				return b.String()
+			}
+
+			if got := render(Options{Preserve: tt.preserve}); !strings.Contains(got, tt.want) || strings.Contains(got, placeholderPrefix) {
+				t.Errorf("expected %s in %s", tt.want, got)
+			}
+		})
+	}
+
+	// Without --preserve readability drops the linky table with its div.
+	article, err := Extract(page(tests[0].inner), pageURL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	article.RenderHTML(&b)
+	if strings.Contains(b.String(), "<table") {
+		t.Errorf("expected the default cleanup to drop the table, got %s", b.String())
+	}
+}
+
+func TestExtractLayoutTable(t *testing.T) {
+	body := "<html><body><table><tr><td><h1>Title</h1><p>" + strings.Repeat("Some article text, with commas, and more. ", 20) + "</p></td></tr></table></body></html>"
+	pageURL, _ := url.Parse("https://example.com/")
+	article, err := Extract([]byte(body), pageURL, Options{Preserve: []string{"tables"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	article.RenderText(&text)
+	if !strings.Contains(text.String(), "Some article text") {
+		t.Errorf("expected the layout table to be extracted normally, got %q", text.String())
+	}
+}
+
+func TestParsePreserve(t *testing.T) {
+	kinds, err := ParsePreserve(" Tables,images,,tables ")
+	if err != nil || strings.Join(kinds, ",") != "tables,images" {
+		t.Errorf("unexpected result %v (%v)", kinds, err)
+	}
+	if _, err := ParsePreserve("videos"); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
+
+func TestExtractOptions(t *testing.T) {
+	body := `<html><body><article class="post"><p class="lead keep">` + strings.Repeat("Short text, but enough. ", 10) + `</p></article></body></html>`
+	pageURL, _ := url.Parse("https://example.com/")
+
+	render := func(opts Options) string {
+		article, err := Extract([]byte(body), pageURL, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		article.RenderHTML(&b)
+		return b.String()
+	}
+	if got := render(Options{}); strings.Contains(got, "lead") {
+		t.Errorf("expected classes to be stripped by default, got %s", got)
+	}
+	if got := render(Options{PreserveClasses: []string{"keep"}}); !strings.Contains(got, `class="keep"`) {
+		t.Errorf("expected the preserved class, got %s", got)
+	}
+	if got := render(Options{KeepClasses: true}); !strings.Contains(got, `class="lead keep"`) {
+		t.Errorf("expected all classes, got %s", got)
+	}
+}
+
+func TestMarkdownOptions(t *testing.T) {
+	contentHTML := `<table><tr><th>Name</th><th>Age</th></tr><tr><td>Ann</td><td>32</td></tr></table>
+<p><del>old</del> new</p>
+<ul><li><input type="checkbox" checked> done</li></ul>
+<pre><code class="language-go">fmt.Println("hi")</code></pre>`
+
+	plain, err := Markdown(contentHTML, MarkdownOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain, "| Name | Age |") || strings.Contains(plain, "~~old~~") || !strings.Contains(plain, "```go\n") {
+		t.Errorf("expected plain CommonMark by default, got:\n%s", plain)
+	}
+
+	plugins, err := ParseMarkdownPlugins("gfm, tables")
+	if err != nil || strings.Join(plugins, ",") != "tables,strikethrough,task-lists,footnotes" {
+		t.Fatalf("unexpected plugins %v (%v)", plugins, err)
+	}
+	gfm, err := Markdown(contentHTML, MarkdownOptions{Plugins: plugins, CodeFence: "tildes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"| Name | Age |\n|", "| Ann | 32 |", "~~old~~ new", "- [x]  done", "~~~go\nfmt.Println(\"hi\")\n~~~"} {
+		if !strings.Contains(gfm, want) {
+			t.Errorf("expected %q in:\n%s", want, gfm)
+		}
+	}
+
+	if _, err := ParseMarkdownPlugins("tables,emoji"); err == nil {
+		t.Error("expected an error for an unknown plugin")
+	}
+	if _, err := Markdown(contentHTML, MarkdownOptions{CodeFence: "fancy"}); err == nil {
+		t.Error("expected an error for an unknown code fence")
+	}
+}
+
+func TestMarkdownFootnotes(t *testing.T) {
+	contentHTML := `<p>Cats sleep a lot.<sup id="fnref:1"><a href="#fn:1" class="footnote-ref" role="doc-noteref">1</a></sup> Dogs too.<sup class="reference" id="cite_ref-2"><a href="https://example.com/page#cite_note-2">[2]</a></sup> Again.<sup><a href="#fn:1">1</a></sup> See <a href="#history">History</a>.</p>
+<h2 id="history">History</h2>
+<p>Old.</p>
+<div class="footnotes" role="doc-endnotes"><hr><ol>
+<li id="fn:1"><p>Up to <em>16 hours</em> a day.</p><p>More on naps. <a href="#fnref:1" class="footnote-backref" role="doc-backlink">↩</a></p></li>
+</ol></div>
+<ol class="references"><li id="cite_note-2"><span class="mw-cite-backlink"><b><a href="#cite_ref-2">^</a></b></span> <span class="reference-text">A <a href="https://example.com/dogs">study</a>.</span></li></ol>`
+
+	plain, err := Markdown(contentHTML, MarkdownOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain, "[^1]") {
+		t.Errorf("expected no footnotes without the plugin, got:\n%s", plain)
+	}
+
+	got, err := Markdown(contentHTML, MarkdownOptions{Plugins: []string{"footnotes"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Cats sleep a lot.[^1] Dogs too.[^2] Again.[^1] See [History](#history).",
+		"[^1]: Up to _16 hours_ a day.\n\n    More on naps.\n[^2]",
+		"[^2]: A [study](https://example.com/dogs).",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"↩", "^ A", "fn:1", "* * *", "1. "} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("expected no %q in:\n%s", unwanted, got)
+		}
+	}
+}
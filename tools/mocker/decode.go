@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// decode reads native messaging frames, such as plumber's responses, from
+// r until EOF and prints each message as indented JSON, or as it is when it
+// is not JSON.
+func decode(r io.Reader, w io.Writer) error {
+	for n := 1; ; n++ {
+		var length uint32
+		err := binary.Read(r, binary.LittleEndian, &length)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("message %d: truncated header: %w", n, err)
+		}
+		if length > maxMessageSize {
+			return fmt.Errorf("message %d: length %d is over the %d byte limit", n, length, maxMessageSize)
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("message %d: truncated body: %w", n, err)
+		}
+
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, msg, "", "  "); err != nil {
+			fmt.Fprintf(w, "%s\n", msg)
+			continue
+		}
+		fmt.Fprintf(w, "%s\n", pretty.Bytes())
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"browser-pipes/pkg/plumb"
+)
+
+// recentURLs is how many earlier URLs interactive mode offers by number.
+const recentURLs = 5
+
+// interactive prompts on stderr for the URL, origin and target of one
+// envelope after another and frames each to w as soon as it is complete.
+// Enter keeps the value in brackets, the previous envelope's; a number
+// picks one of the recent URLs listed. With a history file the earlier
+// envelopes seed the defaults, and new ones are appended so the session
+// can be replayed. It ends at EOF.
+func interactive(stdin io.Reader, w, stderr io.Writer, historyFile string) error {
+	last := plumb.Envelope{Origin: "mocker"}
+	var urls []string
+	if historyFile != "" {
+		envs, err := readEnvelopes(historyFile)
+		if err != nil {
+			return err
+		}
+		for _, env := range envs {
+			urls = remember(urls, env.URL)
+			last = env
+		}
+	}
+
+	in := bufio.NewScanner(stdin)
+	ask := func(label, def string) (string, bool) {
+		if def != "" {
+			fmt.Fprintf(stderr, "%s [%s]: ", label, def)
+		} else {
+			fmt.Fprintf(stderr, "%s: ", label)
+		}
+		if !in.Scan() {
+			return "", false
+		}
+		if answer := strings.TrimSpace(in.Text()); answer != "" {
+			return answer, true
+		}
+		return def, true
+	}
+
+	sent := 0
+	for {
+		for i, u := range urls {
+			fmt.Fprintf(stderr, "  %d) %s\n", i+1, u)
+		}
+		url, ok := ask("URL", last.URL)
+		if !ok {
+			break
+		}
+		if n, err := strconv.Atoi(url); err == nil && n >= 1 && n <= len(urls) {
+			url = urls[n-1]
+		}
+		if url == "" {
+			fmt.Fprintln(stderr, "⚠️ A URL is required")
+			continue
+		}
+		origin, ok := ask("Origin", last.Origin)
+		if !ok {
+			break
+		}
+		// An empty target lets plumber's workflows route the URL, so "-"
+		// clears a remembered one.
+		target, ok := ask("Target (- for none)", last.Target)
+		if !ok {
+			break
+		}
+		if target == "-" {
+			target = ""
+		}
+
+		env := plumb.Envelope{ID: newID(), Origin: origin, URL: url, Target: target, Timestamp: time.Now().Unix()}
+		msg, err := json.Marshal(env)
+		if err != nil {
+			return err
+		}
+		if err := writeFrame(w, msg); err != nil {
+			return err
+		}
+		if historyFile != "" {
+			if err := appendLine(historyFile, msg); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(stderr, "📤 %s\n", msg)
+		last, urls = env, remember(urls, url)
+		sent++
+	}
+	fmt.Fprintf(stderr, "\n📨 Sent %d envelopes\n", sent)
+	return in.Err()
+}
+
+// remember puts url first in urls, without repeats, keeping recentURLs.
+func remember(urls []string, url string) []string {
+	urls = slices.DeleteFunc(urls, func(u string) bool { return u == url })
+	urls = append([]string{url}, urls...)
+	return urls[:min(len(urls), recentURLs)]
+}
+
+// readEnvelopes returns the envelopes of a JSONL file, oldest first. A
+// missing file has none; lines that are not envelopes are skipped.
+func readEnvelopes(path string) ([]plumb.Envelope, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var envs []plumb.Envelope
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxMessageSize)
+	for scanner.Scan() {
+		var env plumb.Envelope
+		if json.Unmarshal(envelopeOf(scanner.Bytes()), &env) == nil && env.URL != "" {
+			envs = append(envs, env)
+		}
+	}
+	return envs, scanner.Err()
+}
+
+func appendLine(path string, line []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newID returns a random UUID, as the extension gives its envelopes.
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -1,18 +1,138 @@
 package main
 
 import (
+	"bufio"
 	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
+	"strings"
+	"time"
 )
 
 func main() {
-	// Read all input (JSON) from stdin
-	input, _ := io.ReadAll(os.Stdin)
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// run frames stdin as a single native messaging message, or with a JSONL
+// file replays each of its envelopes as a message of its own.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("mocker", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	delay := fs.Duration("delay", 0, "Pause between replayed envelopes")
+	jitter := fs.Duration("jitter", 0, "Vary each pause by up to this much either way")
+	interact := fs.Bool("i", false, "Prompt for the URL, origin and target of each envelope")
+	historyFile := fs.String("history", "", "With -i, seed the defaults from this JSONL file and append the envelopes sent")
+	decodeFrames := fs.Bool("decode", false, "Print the framed messages on stdin, such as plumber's responses, as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: mocker < message.json\n")
+		fmt.Fprintf(stderr, "       mocker [flags] <envelopes.jsonl|->\n")
+		fmt.Fprintf(stderr, "       mocker -i [--history session.jsonl] | plumber run | mocker --decode\n")
+		fmt.Fprintf(stderr, "Frames a JSON message for plumber's native messaging stdin, replays a\n")
+		fmt.Fprintf(stderr, "session (one envelope per line, each framed in turn), builds envelopes\n")
+		fmt.Fprintf(stderr, "from prompts, or decodes the framed responses plumber writes.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *delay < 0 || *jitter < 0 {
+		return fmt.Errorf("--delay and --jitter cannot be negative")
+	}
+
+	if *decodeFrames {
+		return decode(stdin, stdout)
+	}
+	if *interact {
+		return interactive(stdin, stdout, stderr, *historyFile)
+	}
+	if fs.NArg() == 0 {
+		input, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		return writeFrame(stdout, input)
+	}
+
+	in := stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	return replay(in, stdout, stderr, *delay, *jitter)
+}
+
+// replay frames each envelope of the JSONL in r, skipping blank lines and
+// # comments, and pauses for delay, give or take jitter, between them. The
+// lines are envelopes, or the envelope and response pairs plumber --record
+// writes.
+func replay(r io.Reader, w, stderr io.Writer, delay, jitter time.Duration) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxMessageSize)
+	sent := 0
+	for line := 1; scanner.Scan(); line++ {
+		msg := strings.TrimSpace(scanner.Text())
+		if msg == "" || strings.HasPrefix(msg, "#") {
+			continue
+		}
+		if !json.Valid([]byte(msg)) {
+			return fmt.Errorf("line %d is not valid JSON", line)
+		}
+		if sent > 0 {
+			time.Sleep(pause(delay, jitter))
+		}
+		if err := writeFrame(w, envelopeOf([]byte(msg))); err != nil {
+			return err
+		}
+		sent++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read envelopes: %w", err)
+	}
+	fmt.Fprintf(stderr, "📨 Replayed %d envelopes\n", sent)
+	return nil
+}
+
+// envelopeOf returns the envelope of a plumber --record line, or line
+// itself when it is an envelope already.
+func envelopeOf(line []byte) []byte {
+	var recorded struct {
+		Envelope json.RawMessage `json:"envelope"`
+	}
+	if json.Unmarshal(line, &recorded) == nil && len(recorded.Envelope) > 0 {
+		return recorded.Envelope
+	}
+	return line
+}
+
+// pause returns delay shifted by a random amount within ±jitter, never
+// below zero.
+func pause(delay, jitter time.Duration) time.Duration {
+	if jitter > 0 {
+		delay += time.Duration(rand.Int64N(int64(2*jitter)+1)) - jitter
+	}
+	return max(delay, 0)
+}
 
-	// Write the length of the message (4 bytes, Little Endian)
-	binary.Write(os.Stdout, binary.LittleEndian, uint32(len(input)))
+// maxMessageSize is the largest message plumber accepts.
+const maxMessageSize = 10 * 1024 * 1024
 
-	// Write the message itself
-	os.Stdout.Write(input)
+// writeFrame writes msg with the 4-byte little-endian length header of the
+// native messaging protocol.
+func writeFrame(w io.Writer, msg []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(msg))); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
 }
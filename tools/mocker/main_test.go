@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-pipes/pkg/plumb"
+)
+
+// readFrames splits native messaging output into its messages.
+func readFrames(t *testing.T, r io.Reader) []string {
+	t.Helper()
+	var msgs []string
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err == io.EOF {
+			return msgs
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, string(msg))
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Single Message", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if err := run(nil, strings.NewReader(`{"url":"https://example.com"}`), &stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFrames(t, &stdout); len(got) != 1 || got[0] != `{"url":"https://example.com"}` {
+			t.Errorf("unexpected frames %q", got)
+		}
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		session := filepath.Join(t.TempDir(), "session.jsonl")
+		os.WriteFile(session, []byte("{\"url\":\"https://a.com\"}\n\n# second tab\n{\"url\":\"https://b.com\",\"target\":\"markdown\"}\n"), 0644)
+
+		var stdout bytes.Buffer
+		start := time.Now()
+		if err := run([]string{"--delay", "20ms", session}, nil, &stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(start) < 20*time.Millisecond {
+			t.Error("expected a pause between envelopes")
+		}
+		want := []string{`{"url":"https://a.com"}`, `{"url":"https://b.com","target":"markdown"}`}
+		if got := readFrames(t, &stdout); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+
+		stdout.Reset()
+		if err := run([]string{"-"}, strings.NewReader("{\"url\":\"https://a.com\"}\n"), &stdout, io.Discard); err != nil || len(readFrames(t, &stdout)) != 1 {
+			t.Errorf("expected one envelope from stdin, got %v", err)
+		}
+	})
+
+	t.Run("Replay Recording", func(t *testing.T) {
+		recording := `{"time":"2026-01-02T10:00:00Z","envelope":{"id":"1","url":"https://a.com"},"response":{"status":"success","message":"ok"}}` + "\n"
+		var stdout bytes.Buffer
+		if err := run([]string{"-"}, strings.NewReader(recording), &stdout, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFrames(t, &stdout); len(got) != 1 || got[0] != `{"id":"1","url":"https://a.com"}` {
+			t.Errorf("expected the recorded envelope, got %q", got)
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		err := run([]string{"-"}, strings.NewReader("{\"url\":\"https://a.com\"}\nnot json\n"), io.Discard, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("expected an error naming line 2, got %v", err)
+		}
+	})
+}
+
+func TestPause(t *testing.T) {
+	for range 100 {
+		if d := pause(100*time.Millisecond, 30*time.Millisecond); d < 70*time.Millisecond || d > 130*time.Millisecond {
+			t.Fatalf("pause %v outside 100ms ± 30ms", d)
+		}
+	}
+	if d := pause(10*time.Millisecond, time.Second); d < 0 {
+		t.Errorf("expected no negative pause, got %v", d)
+	}
+}
+
+func TestInteractive(t *testing.T) {
+	history := filepath.Join(t.TempDir(), "session.jsonl")
+	os.WriteFile(history, []byte(`{"url":"https://old.com","origin":"firefox","target":"markdown"}`+"\n"), 0644)
+
+	// Resend the last envelope of the history as it was, then a new URL
+	// from another browser without a target, and stop at EOF.
+	input := "\n\n\nhttps://new.com\nchrome\n-\n"
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-i", "--history", history}, strings.NewReader(input), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []plumb.Envelope
+	for _, msg := range readFrames(t, &stdout) {
+		var env plumb.Envelope
+		if err := json.Unmarshal([]byte(msg), &env); err != nil {
+			t.Fatal(err)
+		}
+		if env.ID == "" || env.Timestamp == 0 {
+			t.Errorf("expected an id and timestamp, got %s", msg)
+		}
+		got = append(got, env)
+	}
+	if len(got) != 2 ||
+		got[0].URL != "https://old.com" || got[0].Origin != "firefox" || got[0].Target != "markdown" ||
+		got[1].URL != "https://new.com" || got[1].Origin != "chrome" || got[1].Target != "" {
+		t.Errorf("unexpected envelopes %+v", got)
+	}
+	if !strings.Contains(stderr.String(), "URL [https://old.com]: ") || !strings.Contains(stderr.String(), "Sent 2 envelopes") {
+		t.Errorf("unexpected prompts %q", stderr.String())
+	}
+	if envs, _ := readEnvelopes(history); len(envs) != 3 {
+		t.Errorf("expected the envelopes appended to the history, got %d", len(envs))
+	}
+}
+
+func TestRemember(t *testing.T) {
+	var urls []string
+	for _, u := range []string{"a", "b", "c", "a", "d", "e", "f"} {
+		urls = remember(urls, u)
+	}
+	if want := []string{"f", "e", "d", "a", "c"}; !slices.Equal(urls, want) {
+		t.Errorf("expected %v, got %v", want, urls)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var frames bytes.Buffer
+	writeFrame(&frames, []byte(`{"status":"success","message":"ok"}`))
+	writeFrame(&frames, []byte(`not json`))
+	var stdout bytes.Buffer
+	if err := run([]string{"--decode"}, &frames, &stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"status\": \"success\",\n  \"message\": \"ok\"\n}\nnot json\n"; stdout.String() != want {
+		t.Errorf("expected %q, got %q", want, stdout.String())
+	}
+
+	for name, input := range map[string][]byte{
+		"header": {1, 0},
+		"body":   {5, 0, 0, 0, '{'},
+		"limit":  {0xff, 0xff, 0xff, 0xff},
+	} {
+		if err := decode(bytes.NewReader(input), io.Discard); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}